@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/raskovnik/rdbms/internal/api/routes"
 	"github.com/raskovnik/rdbms/internal/app"
@@ -16,19 +17,51 @@ import (
 func main() {
 	mode := flag.String("mode", "repl", "Mode: repl or webapp")
 	port := flag.String("port", "8080", "Port for webapp mode")
+	dataDir := flag.String("data", "", "Directory for the write-ahead log and snapshots, empty keeps data in memory only")
+	dbFile := flag.String("db", "", "Database file of fixed-size pages, with its log next to it, so tables may be larger than memory. Replaces -data")
+	checkpointInterval := flag.Duration("checkpoint-interval", 5*time.Minute, "How often to snapshot the database and truncate the log, 0 disables")
+	vacuumInterval := flag.Duration("vacuum-interval", time.Minute, "How often to reclaim row versions no transaction can see, 0 disables")
 	flag.Parse()
 
+	durable := *dataDir != "" || *dbFile != ""
 	db := engine.NewDB()
+	if durable {
+		var opened *engine.Database
+		var err error
+		if *dbFile != "" {
+			opened, err = engine.Open(*dbFile)
+		} else {
+			opened, err = engine.NewDurableDB(*dataDir)
+		}
+		if err != nil {
+			log.Fatalf("could not open database: %v", err)
+		}
+		db = opened
+	}
+	// deferred first so it runs last, after the timers below are stopped
+	defer db.Close()
+
+	if durable && *checkpointInterval > 0 {
+		stop := db.CheckpointEvery(*checkpointInterval, func(err error) {
+			log.Printf("Warning: checkpoint failed: %v", err)
+		})
+		defer stop()
+	}
+
+	if *vacuumInterval > 0 {
+		stop := db.VacuumEvery(*vacuumInterval)
+		defer stop()
+	}
 
 	switch *mode {
 	case "repl":
-		repl.Start(os.Stdin, os.Stdout)
+		repl.Start(os.Stdin, os.Stdout, db)
 	case "webapp":
 		app := app.NewWebApp(db)
 
 		// setup schema
 		if _, err := app.SetupSchema(); err != nil {
-			log.Printf("Warning: %v (table may already exist)", err)
+			log.Fatalf("could not set up schema: %v", err)
 		}
 
 		// routes
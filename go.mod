@@ -2,4 +2,4 @@ module github.com/raskovnik/rdbms
 
 go 1.25.5
 
-require github.com/go-chi/chi/v5 v5.2.3 // indirect
+require github.com/go-chi/chi/v5 v5.2.3
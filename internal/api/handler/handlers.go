@@ -4,19 +4,43 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/raskovnik/rdbms/internal/app"
 	"github.com/raskovnik/rdbms/internal/ast"
+	"github.com/raskovnik/rdbms/internal/datetime"
+	"github.com/raskovnik/rdbms/internal/engine"
 )
 
-// GET /todos -> list all todos
+// page size for GET /todos when ?limit= is not given, and the largest one allowed
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// GET /todos?limit=n&offset=m -> list a page of todos
 func GetTodos(app *app.WebApp) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		limit, err := queryInt(r, "limit", defaultPageSize)
+		if err != nil || limit < 0 || limit > maxPageSize {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+
+		offset, err := queryInt(r, "offset", 0)
+		if err != nil || offset < 0 {
+			http.Error(w, "invalid offset", http.StatusBadRequest)
+			return
+		}
+
 		stmt := &ast.SelectStatement{ // define our select statement
 			Table:   "todos",
 			Columns: []string{"*"},
+			OrderBy: []ast.OrderByItem{ // newest first, ids are assigned in creation order
+				{Column: "id", Descending: true},
+			},
+			Limit:  &limit,
+			Offset: offset,
 		}
 
 		rows, err := app.DB.Execute(stmt) // execute the statement
@@ -49,29 +73,28 @@ func CreateTodo(app *app.WebApp) http.HandlerFunc {
 			return
 		}
 
-		// generate id
-		id := app.GetNextID()
-
-		// create statememnt definition
+		// the id comes from the SERIAL column and is read back from the inserted row
 		stmt := &ast.InsertStatement{
-			Table: "todos",
-			Values: []interface{}{
-				id,
+			Table:   "todos",
+			Columns: []string{"task", "completed", "created_at"},
+			Values: [][]interface{}{{
 				req.Task,
-				0, // not complete
-				time.Now().Format(time.RFC3339),
-			},
+				false,          // not complete
+				datetime.Now(), // serialized as RFC 3339 in UTC
+			}},
+			Returning: []string{"id"},
 		}
 
-		_, err := app.DB.Execute(stmt)
+		res, err := app.DB.Execute(stmt)
 
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"id":   id,
+			"id":   res.([]engine.Row)[0]["id"],
 			"task": req.Task,
 		})
 	}
@@ -89,7 +112,7 @@ func UpdateTodo(app *app.WebApp) http.HandlerFunc {
 		}
 
 		var req struct {
-			Completed int `json:"completed"`
+			Completed bool `json:"completed"`
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -102,10 +125,10 @@ func UpdateTodo(app *app.WebApp) http.HandlerFunc {
 			Updates: []ast.ColumnUpdate{
 				{Column: "completed", Value: req.Completed},
 			},
-			Where: &ast.WhereClause{
-				Column:   "id",
+			Where: &ast.BinaryExpression{ // WHERE id = {id}
+				Left:     &ast.Identifier{Name: "id"},
 				Operator: "=",
-				Value:    id,
+				Right:    &ast.Literal{Value: id},
 			},
 		}
 
@@ -140,10 +163,10 @@ func DeleteTodo(app *app.WebApp) http.HandlerFunc {
 
 		stmt := &ast.DeleteStatement{ // define our delete statement
 			Table: "todos",
-			Where: &ast.WhereClause{
-				Column:   "id",
+			Where: &ast.BinaryExpression{ // WHERE id = {id}
+				Left:     &ast.Identifier{Name: "id"},
 				Operator: "=",
-				Value:    id,
+				Right:    &ast.Literal{Value: id},
 			},
 		}
 
@@ -163,3 +186,12 @@ func DeleteTodo(app *app.WebApp) http.HandlerFunc {
 		json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
 	}
 }
+
+// read an integer query parameter, def when it is absent
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	return strconv.Atoi(value)
+}
@@ -144,7 +144,7 @@ var indexHTML = `<!DOCTYPE html>
                 const response = await fetch(` + "`" + `/todos/${id}` + "`" + `, {
                     method: 'PUT',
                     headers: { 'Content-Type': 'application/json' },
-                    body: JSON.stringify({ completed: completed ? 1 : 0 })
+                    body: JSON.stringify({ completed: completed })
                 });
                 
                 if (!response.ok) throw new Error('Failed to update todo');
@@ -13,37 +13,21 @@ func NewWebApp(db *engine.Database) *WebApp {
 	return &WebApp{DB: db}
 }
 
+// create the todos table unless it is already there, safe to run on every start
 func (app *WebApp) SetupSchema() (interface{}, error) {
 	stmt := &ast.CreateStatement{
-		Table: "todos",
+		Table:       "todos",
+		IfNotExists: true,
 		Columns: []ast.ColumnDef{
-			{Name: "id", Type: "INT", PrimaryKey: true},
-			{Name: "task", Type: "TEXT"},
-			{Name: "completed", Type: "INT"},
-			{Name: "created_at", Type: "TEXT"},
+			{Name: "id", Type: "INT", PrimaryKey: true, Serial: true}, // ids come from todos_id_seq
+			{Name: "task", Type: "TEXT", NotNull: true, Check: &ast.CheckConstraint{
+				Name: "task_not_empty", // task != ''
+				Expr: &ast.BinaryExpression{Left: &ast.Identifier{Name: "task"}, Operator: "!=", Right: &ast.Literal{Value: ""}},
+			}},
+			{Name: "completed", Type: "BOOL"},
+			{Name: "created_at", Type: "TIMESTAMP"},
 		},
 	}
 
 	return app.DB.Execute(stmt)
 }
-
-// handler to get next available id
-func (app *WebApp) GetNextID() int {
-	stmt := &ast.SelectStatement{
-		Table:   "todos",
-		Columns: []string{"*"},
-	}
-
-	res, _ := app.DB.Execute(stmt)
-	maxID := 0
-
-	rows, _ := res.([]engine.Row)
-
-	for _, row := range rows {
-		if id, ok := row["id"].(int); ok && id > maxID {
-			maxID = id
-		}
-	}
-
-	return maxID + 1
-}
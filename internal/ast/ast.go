@@ -1,14 +1,29 @@
 package ast
 
+import (
+	"fmt"
+	"strings"
+
+	"github.com/raskovnik/rdbms/internal/datetime"
+)
+
 type Statement interface {
 	statementNode()
 	String() string
 }
 
-// INSERT INTO table VALUES (values)
+// expressions appear in WHERE clauses and evaluate against a single row
+type Expression interface {
+	expressionNode()
+	String() string
+}
+
+// INSERT INTO table [(col, col)] VALUES (values), (values) [RETURNING col, col]
 type InsertStatement struct {
-	Table  string
-	Values []interface{}
+	Table     string
+	Columns   []string        // columns the values are for, nil for every column in schema order
+	Values    [][]interface{} // one list per row, a value or an Expression computed per row
+	Returning []string        // columns of the inserted rows to return, * for all
 }
 
 func (is *InsertStatement) statementNode() {}
@@ -18,15 +33,47 @@ func (is *InsertStatement) String() string {
 
 type ColumnDef struct {
 	Name       string
-	Type       string // int, text, bool
+	Type       string // INT, TEXT, BOOL, FLOAT, DECIMAL, DATE, TIME, TIMESTAMP
+	Precision  int    // DECIMAL(p, s) total digits, 0 for any
+	Scale      int    // DECIMAL(p, s) digits after the decimal point
 	PrimaryKey bool
 	Unique     bool
+	NotNull    bool             // NOT NULL, implied by PRIMARY KEY
+	Default    Expression       // DEFAULT value, nil for none
+	Serial     bool             // SERIAL or AUTOINCREMENT, an INT filled from a sequence
+	References *ForeignKey      // REFERENCES table(col), nil for none
+	Check      *CheckConstraint // CHECK (expr), nil for none
+}
+
+// the parent row a column value must match -> REFERENCES users(id) ON DELETE CASCADE
+type ForeignKey struct {
+	Table    string
+	Column   string // "" for the primary key of Table
+	OnDelete string // RESTRICT, CASCADE or SET NULL
+}
+
+// [CONSTRAINT name] CHECK (expr) -> a row is rejected when expr is false, unknown (NULL)
+// lets it through
+type CheckConstraint struct {
+	Name string // table_col_check or table_check when none is given
+	Expr Expression
+}
+
+// PRIMARY KEY (a, b) or UNIQUE (a, b) over several columns of a table, a key on one
+// column is marked on its ColumnDef
+type KeyConstraint struct {
+	Name    string // name of the index enforcing it, given when the table is created
+	Columns []string
+	Primary bool
 }
 
-// CREATE TABLE table (col dt, col dt)
+// CREATE TABLE [IF NOT EXISTS] table (col dt, col dt)
 type CreateStatement struct {
-	Table   string
-	Columns []ColumnDef
+	Table       string
+	Columns     []ColumnDef
+	Keys        []KeyConstraint   // multi-column keys, one-column ones are in Columns
+	Checks      []CheckConstraint // table CHECK constraints, column ones are in Columns
+	IfNotExists bool
 }
 
 func (cs *CreateStatement) statementNode() {}
@@ -34,18 +81,142 @@ func (cs *CreateStatement) String() string {
 	return "CREATE TABLE " + cs.Table
 }
 
-// WHERE column = > < value
-type WhereClause struct {
-	Column   string
-	Operator string
-	Value    interface{}
+// column reference -> name
+type Identifier struct {
+	Name string
+}
+
+func (i *Identifier) expressionNode() {}
+func (i *Identifier) String() string {
+	return i.Name
+}
+
+// literal value -> 1, 'Alice', TRUE, NULL, DATE '2024-01-15'
+type Literal struct {
+	Value interface{} // nil for NULL
+}
+
+func (l *Literal) expressionNode() {}
+func (l *Literal) String() string {
+	switch v := l.Value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "'" + v + "'"
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case datetime.Date:
+		return "DATE '" + v.String() + "'"
+	case datetime.Time:
+		return "TIME '" + v.String() + "'"
+	case datetime.Timestamp:
+		return "TIMESTAMP '" + v.String() + "'"
+	case datetime.Interval:
+		return "INTERVAL '" + v.String() + "'"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// left op right -> id = 1, a > 1 AND b < 2, price * 2
+type BinaryExpression struct {
+	Left     Expression
+	Operator string // = != < <= > >= AND OR + - * /
+	Right    Expression
+}
+
+func (be *BinaryExpression) expressionNode() {}
+func (be *BinaryExpression) String() string {
+	return "(" + be.Left.String() + " " + be.Operator + " " + be.Right.String() + ")"
+}
+
+// aggregate function over the rows of a group -> COUNT(*), SUM(total)
+type AggregateExpression struct {
+	Function string // COUNT SUM AVG MIN MAX
+	Column   string // * for COUNT(*)
+}
+
+func (ae *AggregateExpression) expressionNode() {}
+func (ae *AggregateExpression) String() string {
+	return ae.Function + "(" + ae.Column + ")"
+}
+
+// op operand -> NOT active = 1, -price
+type UnaryExpression struct {
+	Operator string // NOT -
+	Operand  Expression
+}
+
+func (ue *UnaryExpression) expressionNode() {}
+func (ue *UnaryExpression) String() string {
+	return "(" + ue.Operator + " " + ue.Operand.String() + ")"
+}
+
+// operand IS [NOT] NULL -> email IS NULL
+type IsNullExpression struct {
+	Operand Expression
+	Not     bool // IS NOT NULL
+}
+
+func (ie *IsNullExpression) expressionNode() {}
+func (ie *IsNullExpression) String() string {
+	if ie.Not {
+		return "(" + ie.Operand.String() + " IS NOT NULL)"
+	}
+	return "(" + ie.Operand.String() + " IS NULL)"
+}
+
+// scalar function call -> NOW(), DATE_TRUNC('month', created_at), CURRENT_DATE
+type FunctionCall struct {
+	Name string // upper case
+	Args []Expression
+}
+
+func (fc *FunctionCall) expressionNode() {}
+func (fc *FunctionCall) String() string {
+	if fc.Name == "CURRENT_DATE" {
+		return fc.Name
+	}
+	args := make([]string, len(fc.Args))
+	for i, arg := range fc.Args {
+		args[i] = arg.String()
+	}
+	return fc.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// EXTRACT(field FROM source) -> EXTRACT(YEAR FROM created_at)
+type ExtractExpression struct {
+	Field  string // upper case -> YEAR, MONTH, DOW
+	Source Expression
+}
+
+func (ee *ExtractExpression) expressionNode() {}
+func (ee *ExtractExpression) String() string {
+	return "EXTRACT(" + ee.Field + " FROM " + ee.Source.String() + ")"
 }
 
-// SELECT * col, col FROM table WHERE condition
+// ORDER BY col [ASC|DESC]
+type OrderByItem struct {
+	Column     string
+	Descending bool
+	Aggregate  *AggregateExpression // ORDER BY COUNT(*), Column is then COUNT(*)
+}
+
+// SELECT * col, col, COUNT(*) FROM table WHERE condition GROUP BY col HAVING condition
+// ORDER BY col DESC, col LIMIT n OFFSET m
 type SelectStatement struct {
-	Columns []string // * col, col
-	Table   string
-	Where   *WhereClause // nil if no clause
+	Columns    []string               // * col, col
+	Aggregates []*AggregateExpression // COUNT(*), MAX(col) in the column list
+	Table      string
+	Where      Expression    // nil if no clause
+	GroupBy    []string      // nil if no clause
+	Having     Expression    // nil if no clause
+	OrderBy    []OrderByItem // nil if no clause
+	Limit      *int          // nil if no clause
+	Offset     int           // rows to skip, 0 if no clause
 }
 
 func (ss *SelectStatement) statementNode() {}
@@ -55,14 +226,14 @@ func (ss *SelectStatement) String() string {
 
 type ColumnUpdate struct {
 	Column string
-	Value  interface{}
+	Value  interface{} // a value or an Expression computed from each row
 }
 
 // UPDATE table SET col = val, col = val, WHERE condition
 type UpdateStatement struct {
 	Table   string
 	Updates []ColumnUpdate
-	Where   *WhereClause
+	Where   Expression
 }
 
 func (us *UpdateStatement) statementNode() {}
@@ -73,7 +244,7 @@ func (us *UpdateStatement) String() string {
 // DELETE FROM table WHERE condition
 type DeleteStatement struct {
 	Table string
-	Where *WhereClause
+	Where Expression
 }
 
 func (ds *DeleteStatement) statementNode() {}
@@ -95,3 +266,107 @@ func (js *JoinStatement) statementNode() {}
 func (js *JoinStatement) String() string {
 	return "JOIN " + js.LeftTable + " " + js.RightTable
 }
+
+// CREATE [UNIQUE] INDEX name ON table [USING BTREE|HASH] (col, col)
+type CreateIndexStatement struct {
+	Name    string
+	Table   string
+	Columns []string
+	Unique  bool
+	Using   string // BTREE or HASH, empty for the default
+}
+
+func (cis *CreateIndexStatement) statementNode() {}
+func (cis *CreateIndexStatement) String() string {
+	return "CREATE INDEX " + cis.Name + " ON " + cis.Table
+}
+
+// DROP INDEX name
+type DropIndexStatement struct {
+	Name string
+}
+
+func (dis *DropIndexStatement) statementNode() {}
+func (dis *DropIndexStatement) String() string {
+	return "DROP INDEX " + dis.Name
+}
+
+// CREATE SEQUENCE [IF NOT EXISTS] name [START [WITH] n] [INCREMENT [BY] n]
+type CreateSequenceStatement struct {
+	Name        string
+	Start       int
+	Increment   int
+	IfNotExists bool
+}
+
+func (css *CreateSequenceStatement) statementNode() {}
+func (css *CreateSequenceStatement) String() string {
+	return "CREATE SEQUENCE " + css.Name
+}
+
+// DROP TABLE [IF EXISTS] table
+type DropTableStatement struct {
+	Table    string
+	IfExists bool
+}
+
+func (dts *DropTableStatement) statementNode() {}
+func (dts *DropTableStatement) String() string {
+	return "DROP TABLE " + dts.Table
+}
+
+// TRUNCATE TABLE table -> remove every row
+type TruncateStatement struct {
+	Table string
+}
+
+func (ts *TruncateStatement) statementNode() {}
+func (ts *TruncateStatement) String() string {
+	return "TRUNCATE TABLE " + ts.Table
+}
+
+// ALTER TABLE table ADD COLUMN col dt | DROP COLUMN col | RENAME COLUMN col TO name | RENAME TO name
+type AlterTableStatement struct {
+	Table   string
+	Action  string    // ADD COLUMN, DROP COLUMN, RENAME COLUMN or RENAME TO
+	Column  ColumnDef // column to add
+	Name    string    // column to drop or rename
+	NewName string    // new name of the column or table
+}
+
+func (ats *AlterTableStatement) statementNode() {}
+func (ats *AlterTableStatement) String() string {
+	return "ALTER TABLE " + ats.Table + " " + ats.Action
+}
+
+// CHECKPOINT -> snapshot the database and truncate its log
+type CheckpointStatement struct{}
+
+func (cs *CheckpointStatement) statementNode() {}
+func (cs *CheckpointStatement) String() string {
+	return "CHECKPOINT"
+}
+
+// BEGIN -> start a transaction
+type BeginStatement struct{}
+
+func (bs *BeginStatement) statementNode() {}
+func (bs *BeginStatement) String() string {
+	return "BEGIN"
+}
+
+// COMMIT -> make the changes of a transaction permanent
+type CommitStatement struct{}
+
+func (cs *CommitStatement) statementNode() {}
+func (cs *CommitStatement) String() string {
+	return "COMMIT"
+}
+
+// ROLLBACK -> undo the changes of a transaction
+type RollbackStatement struct{}
+
+func (rs *RollbackStatement) statementNode() {}
+func (rs *RollbackStatement) String() string {
+	return "ROLLBACK"
+}
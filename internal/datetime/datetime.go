@@ -0,0 +1,495 @@
+// Package datetime implements the values of DATE, TIME and TIMESTAMP columns and the
+// INTERVAL values added to them. Everything is in UTC with microsecond precision.
+package datetime
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+const (
+	dateLayout      = "2006-01-02"
+	timeLayout      = "15:04:05.999999"
+	timestampLayout = "2006-01-02 15:04:05.999999"
+)
+
+// layouts accepted for timestamps, a fraction of a second is always allowed after
+// the seconds. a zone converts the time to UTC
+var timestampLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	time.RFC3339,
+	"2006-01-02 15:04",
+	dateLayout,
+}
+
+// a calendar day -> 2024-01-15
+type Date struct {
+	t time.Time // midnight UTC
+}
+
+// a time of day -> 14:30:00
+type Time struct {
+	d time.Duration // since midnight, less than a day
+}
+
+// a date and time of day -> 2024-01-15 14:30:00
+type Timestamp struct {
+	t time.Time // UTC
+}
+
+// a span of time. months and days are kept apart from the rest because their length
+// varies -> adding 1 month to Jan 31 gives Mar 2 or Mar 3
+type Interval struct {
+	months int
+	days   int
+	d      time.Duration
+}
+
+// the timestamp of t, in UTC and without the monotonic clock so equal timestamps are ==
+func NewTimestamp(t time.Time) Timestamp {
+	return Timestamp{t: t.UTC().Truncate(time.Microsecond)}
+}
+
+// the current time
+func Now() Timestamp {
+	return NewTimestamp(time.Now())
+}
+
+// the day t falls on in UTC
+func DateOf(t time.Time) Date {
+	t = t.UTC()
+	return Date{t: time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)}
+}
+
+func NewInterval(months, days int, d time.Duration) Interval {
+	return Interval{months: months, days: days, d: d.Truncate(time.Microsecond)}
+}
+
+// parse a date -> 2024-01-15
+func ParseDate(s string) (Date, error) {
+	t, err := time.Parse(dateLayout, strings.TrimSpace(s))
+	if err != nil {
+		return Date{}, fmt.Errorf("invalid date %q", s)
+	}
+	return Date{t: t}, nil
+}
+
+// parse a time of day -> 14:30, 14:30:00, 14:30:00.25
+func ParseTime(s string) (Time, error) {
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return Time{d: NewTimestamp(t).t.Sub(DateOf(t).t)}, nil
+		}
+	}
+	return Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+// parse a timestamp -> 2024-01-15 14:30:00, 2024-01-15T14:30:00+02:00, 2024-01-15
+func ParseTimestamp(s string) (Timestamp, error) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return NewTimestamp(t), nil
+		}
+	}
+	return Timestamp{}, fmt.Errorf("invalid timestamp %q", s)
+}
+
+// the date at midnight
+func (d Date) Timestamp() Timestamp {
+	return Timestamp{t: d.t}
+}
+
+func (d Date) Time() time.Time {
+	return d.t
+}
+
+// the date n days later
+func (d Date) AddDays(n int) Date {
+	return Date{t: d.t.AddDate(0, 0, n)}
+}
+
+// days from other to d
+func (d Date) Sub(other Date) int {
+	return int(d.t.Sub(other.t) / day)
+}
+
+func (d Date) Cmp(other Date) int {
+	return d.t.Compare(other.t)
+}
+
+func (d Date) String() string {
+	return d.t.Format(dateLayout)
+}
+
+func (t Time) Duration() time.Duration {
+	return t.d
+}
+
+// the time of day after adding the time part of an interval, wrapping around midnight
+func (t Time) Add(iv Interval) Time {
+	d := (t.d + iv.d) % day
+	if d < 0 {
+		d += day
+	}
+	return Time{d: d}
+}
+
+// the interval from other to t
+func (t Time) Sub(other Time) Interval {
+	return Interval{d: t.d - other.d}
+}
+
+func (t Time) Cmp(other Time) int {
+	switch {
+	case t.d < other.d:
+		return -1
+	case t.d > other.d:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// a field of the time -> HOUR, MINUTE, SECOND, EPOCH (seconds since midnight). ok is
+// false for an unknown field
+func (t Time) Extract(field string) (int, bool) {
+	switch strings.ToUpper(field) {
+	case "HOUR":
+		return int(t.d / time.Hour), true
+	case "MINUTE":
+		return int(t.d % time.Hour / time.Minute), true
+	case "SECOND":
+		return int(t.d % time.Minute / time.Second), true
+	case "EPOCH":
+		return int(t.d / time.Second), true
+	default:
+		return 0, false
+	}
+}
+
+func (t Time) String() string {
+	return time.Time{}.Add(t.d).Format(timeLayout)
+}
+
+func (ts Timestamp) Time() time.Time {
+	return ts.t
+}
+
+// the day of the timestamp
+func (ts Timestamp) Date() Date {
+	return DateOf(ts.t)
+}
+
+// the time of day of the timestamp
+func (ts Timestamp) TimeOfDay() Time {
+	return Time{d: ts.t.Sub(DateOf(ts.t).t)}
+}
+
+// add months and days by the calendar, then the rest of the interval
+func (ts Timestamp) Add(iv Interval) Timestamp {
+	return Timestamp{t: ts.t.AddDate(0, iv.months, iv.days).Add(iv.d)}
+}
+
+// the interval from other to ts in days and time -> 1 day 02:00:00
+func (ts Timestamp) Sub(other Timestamp) Interval {
+	d := ts.t.Sub(other.t)
+	return Interval{days: int(d / day), d: d % day}
+}
+
+func (ts Timestamp) Cmp(other Timestamp) int {
+	return ts.t.Compare(other.t)
+}
+
+// the timestamp truncated to the start of a unit -> second, minute, hour, day, week
+// (starting Monday), month, quarter, year. ok is false for an unknown unit
+func (ts Timestamp) Trunc(unit string) (Timestamp, bool) {
+	t := ts.t
+	year, month, dayOfMonth := t.Date()
+
+	switch strings.ToLower(unit) {
+	case "second":
+		t = t.Truncate(time.Second)
+	case "minute":
+		t = t.Truncate(time.Minute)
+	case "hour":
+		t = t.Truncate(time.Hour)
+	case "day":
+		t = time.Date(year, month, dayOfMonth, 0, 0, 0, 0, time.UTC)
+	case "week":
+		monday := (int(t.Weekday()) + 6) % 7
+		t = time.Date(year, month, dayOfMonth-monday, 0, 0, 0, 0, time.UTC)
+	case "month":
+		t = time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	case "quarter":
+		t = time.Date(year, month-(month-1)%3, 1, 0, 0, 0, 0, time.UTC)
+	case "year":
+		t = time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return Timestamp{}, false
+	}
+	return Timestamp{t: t}, true
+}
+
+// a field of the timestamp -> YEAR, QUARTER, MONTH, WEEK (ISO week number), DAY, DOW
+// (0 is Sunday), DOY, HOUR, MINUTE, SECOND, EPOCH (seconds since 1970). fractions of
+// a second are dropped. ok is false for an unknown field
+func (ts Timestamp) Extract(field string) (int, bool) {
+	t := ts.t
+	switch strings.ToUpper(field) {
+	case "YEAR":
+		return t.Year(), true
+	case "QUARTER":
+		return (int(t.Month())-1)/3 + 1, true
+	case "MONTH":
+		return int(t.Month()), true
+	case "WEEK":
+		_, week := t.ISOWeek()
+		return week, true
+	case "DAY":
+		return t.Day(), true
+	case "DOW":
+		return int(t.Weekday()), true
+	case "DOY":
+		return t.YearDay(), true
+	case "HOUR":
+		return t.Hour(), true
+	case "MINUTE":
+		return t.Minute(), true
+	case "SECOND":
+		return t.Second(), true
+	case "EPOCH":
+		return int(t.Unix()), true
+	default:
+		return 0, false
+	}
+}
+
+func (ts Timestamp) String() string {
+	return ts.t.Format(timestampLayout)
+}
+
+// the interval with every part negated
+func (iv Interval) Neg() Interval {
+	return Interval{months: -iv.months, days: -iv.days, d: -iv.d}
+}
+
+func (iv Interval) Add(other Interval) Interval {
+	return Interval{months: iv.months + other.months, days: iv.days + other.days, d: iv.d + other.d}
+}
+
+func (iv Interval) Mul(n int) Interval {
+	return Interval{months: iv.months * n, days: iv.days * n, d: iv.d * time.Duration(n)}
+}
+
+// the interval as a duration, counting a month as 30 days
+func (iv Interval) approx() time.Duration {
+	return time.Duration(iv.months*30+iv.days)*day + iv.d
+}
+
+// compare by length, a month counts as 30 days -> 1 month equals 30 days
+func (iv Interval) Cmp(other Interval) int {
+	a, b := iv.approx(), other.approx()
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// an equal interval made of a duration only, so intervals that compare equal hash
+// alike -> 1 month and 30 days are both 720:00:00
+func (iv Interval) Normalize() Interval {
+	return Interval{d: iv.approx()}
+}
+
+// a field of the interval -> YEAR, MONTH (0-11), DAY, HOUR, MINUTE, SECOND, EPOCH
+// (length in seconds). ok is false for an unknown field
+func (iv Interval) Extract(field string) (int, bool) {
+	switch strings.ToUpper(field) {
+	case "YEAR":
+		return iv.months / 12, true
+	case "MONTH":
+		return iv.months % 12, true
+	case "DAY":
+		return iv.days, true
+	case "HOUR":
+		return int(iv.d / time.Hour), true
+	case "MINUTE":
+		return int(iv.d % time.Hour / time.Minute), true
+	case "SECOND":
+		return int(iv.d % time.Minute / time.Second), true
+	case "EPOCH":
+		return int(iv.approx() / time.Second), true
+	default:
+		return 0, false
+	}
+}
+
+// the interval as years, months and days followed by the rest as a time
+// -> 1 year 2 months 3 days 04:05:06, 00:00:00 when empty
+func (iv Interval) String() string {
+	var parts []string
+	plural := func(n int, unit string) {
+		if n == 1 || n == -1 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, unit))
+		} else if n != 0 {
+			parts = append(parts, fmt.Sprintf("%d %ss", n, unit))
+		}
+	}
+	plural(iv.months/12, "year")
+	plural(iv.months%12, "month")
+	plural(iv.days, "day")
+
+	if iv.d != 0 || len(parts) == 0 {
+		d, sign := iv.d, ""
+		if d < 0 {
+			d, sign = -d, "-"
+		}
+		parts = append(parts, sign+fmt.Sprintf("%02d:", int(d/time.Hour))+time.Time{}.Add(d%time.Hour).Format("04:05.999999"))
+	}
+	return strings.Join(parts, " ")
+}
+
+// units of the amounts in an interval
+var intervalUnits = map[string]Interval{
+	"year":   {months: 12},
+	"month":  {months: 1},
+	"mon":    {months: 1},
+	"week":   {days: 7},
+	"day":    {days: 1},
+	"hour":   {d: time.Hour},
+	"minute": {d: time.Minute},
+	"min":    {d: time.Minute},
+	"second": {d: time.Second},
+	"sec":    {d: time.Second},
+}
+
+// parse an interval of amounts with units and an optional time -> 1 day, 2 hours 30
+// minutes, -1 month, 1 year 2 months 3 days 04:05:06
+func ParseInterval(s string) (Interval, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return Interval{}, fmt.Errorf("invalid interval %q", s)
+	}
+
+	var iv Interval
+	for i := 0; i < len(fields); i++ {
+		// a time part -> 04:05:06 or -04:05
+		if strings.Contains(fields[i], ":") {
+			d, err := parseClock(strings.TrimPrefix(fields[i], "-"))
+			if err != nil {
+				return Interval{}, fmt.Errorf("invalid interval %q", s)
+			}
+			if strings.HasPrefix(fields[i], "-") {
+				d = -d
+			}
+			iv.d += d
+			continue
+		}
+
+		n, err := strconv.Atoi(fields[i])
+		if err != nil || i+1 == len(fields) {
+			return Interval{}, fmt.Errorf("invalid interval %q", s)
+		}
+
+		i++
+		unit, ok := intervalUnits[strings.TrimSuffix(strings.ToLower(fields[i]), "s")]
+		if !ok {
+			return Interval{}, fmt.Errorf("invalid interval unit %q", fields[i])
+		}
+		iv = iv.Add(unit.Mul(n))
+	}
+	return iv, nil
+}
+
+// parse the time part of an interval, hours may go past 23 -> 30:00:00, 04:05,
+// 00:00:01.5
+func parseClock(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+
+	var hours, minutes int
+	if _, err := fmt.Sscanf(parts[0]+" "+parts[1], "%d %d", &hours, &minutes); err != nil || minutes > 59 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	d := time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute
+
+	if len(parts) == 3 {
+		seconds, err := time.ParseDuration(parts[2] + "s")
+		if err != nil || seconds < 0 || seconds >= time.Minute {
+			return 0, fmt.Errorf("invalid time %q", s)
+		}
+		d += seconds
+	}
+	return d.Truncate(time.Microsecond), nil
+}
+
+// dates and times are encoded as JSON strings -> "2024-01-15", "14:30:00",
+// "2024-01-15T14:30:00Z", "1 day"
+func (d Date) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + d.String() + `"`), nil
+}
+
+func (t Time) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + t.String() + `"`), nil
+}
+
+func (ts Timestamp) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + ts.t.Format(time.RFC3339Nano) + `"`), nil
+}
+
+func (iv Interval) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + iv.String() + `"`), nil
+}
+
+// values are logged and snapshotted as their text form
+func (d Date) GobEncode() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Date) GobDecode(data []byte) error {
+	parsed, err := ParseDate(string(data))
+	*d = parsed
+	return err
+}
+
+func (t Time) GobEncode() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *Time) GobDecode(data []byte) error {
+	parsed, err := ParseTime(string(data))
+	*t = parsed
+	return err
+}
+
+func (ts Timestamp) GobEncode() ([]byte, error) {
+	return []byte(ts.String()), nil
+}
+
+func (ts *Timestamp) GobDecode(data []byte) error {
+	parsed, err := ParseTimestamp(string(data))
+	*ts = parsed
+	return err
+}
+
+func (iv Interval) GobEncode() ([]byte, error) {
+	return []byte(iv.String()), nil
+}
+
+func (iv *Interval) GobDecode(data []byte) error {
+	parsed, err := ParseInterval(string(data))
+	*iv = parsed
+	return err
+}
@@ -0,0 +1,196 @@
+package datetime
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func mustTimestamp(t *testing.T, s string) Timestamp {
+	t.Helper()
+
+	ts, err := ParseTimestamp(s)
+	if err != nil {
+		t.Fatalf("ParseTimestamp(%q) failed: %v", s, err)
+	}
+	return ts
+}
+
+func TestParseAndString(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"2024-01-15 14:30:00", "2024-01-15 14:30:00"},
+		{"2024-01-15T14:30:00.25", "2024-01-15 14:30:00.25"},
+		{"2024-01-15T14:30:00+02:00", "2024-01-15 12:30:00"},
+		{"2024-01-15T14:30:00Z", "2024-01-15 14:30:00"},
+		{"2024-01-15 14:30", "2024-01-15 14:30:00"},
+		{"2024-01-15", "2024-01-15 00:00:00"},
+	}
+	for _, tt := range tests {
+		if got := mustTimestamp(t, tt.input).String(); got != tt.expected {
+			t.Errorf("ParseTimestamp(%q) wrong. expected=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+
+	if d, err := ParseDate("2024-02-29"); err != nil || d.String() != "2024-02-29" {
+		t.Errorf("ParseDate wrong. got=%s, err=%v", d, err)
+	}
+	if tm, err := ParseTime("09:05"); err != nil || tm.String() != "09:05:00" {
+		t.Errorf("ParseTime wrong. got=%s, err=%v", tm, err)
+	}
+
+	for _, input := range []string{"2023-02-29", "yesterday", "2024-13-01"} {
+		if _, err := ParseDate(input); err == nil {
+			t.Errorf("expected error parsing date %q, got nil", input)
+		}
+	}
+	for _, input := range []string{"25:00", "10:61", "noon"} {
+		if _, err := ParseTime(input); err == nil {
+			t.Errorf("expected error parsing time %q, got nil", input)
+		}
+	}
+	if _, err := ParseTimestamp("2024-01-15 14:30:00 tomorrow"); err == nil {
+		t.Error("expected error parsing a bad timestamp, got nil")
+	}
+}
+
+func TestIntervals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 day", "1 day"},
+		{"2 hours 30 minutes", "02:30:00"},
+		{"1 year 14 months", "2 years 2 months"},
+		{"-1 month", "-1 month"},
+		{"2 weeks 1 sec", "14 days 00:00:01"},
+		{"1 day 30:00:00.5", "1 day 30:00:00.5"},
+		{"-04:05", "-04:05:00"},
+		{"0 days", "00:00:00"},
+	}
+	for _, tt := range tests {
+		iv, err := ParseInterval(tt.input)
+		if err != nil {
+			t.Fatalf("ParseInterval(%q) failed: %v", tt.input, err)
+		}
+		if iv.String() != tt.expected {
+			t.Errorf("ParseInterval(%q) wrong. expected=%s, got=%s", tt.input, tt.expected, iv)
+		}
+
+		// the text form parses back to the same interval
+		if again, err := ParseInterval(iv.String()); err != nil || again != iv {
+			t.Errorf("interval %s did not round trip. got=%v, err=%v", iv, again, err)
+		}
+	}
+
+	for _, input := range []string{"", "day", "1", "1 fortnight", "1.5 days", "1:99"} {
+		if _, err := ParseInterval(input); err == nil {
+			t.Errorf("expected error parsing interval %q, got nil", input)
+		}
+	}
+
+	if NewInterval(1, 0, 0).Cmp(NewInterval(0, 30, 0)) != 0 || NewInterval(0, 1, 0).Cmp(NewInterval(0, 0, 25*time.Hour)) >= 0 {
+		t.Error("intervals compared wrong")
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	ts := mustTimestamp(t, "2024-01-31 10:00:00")
+
+	if got := ts.Add(NewInterval(1, 0, 0)).String(); got != "2024-03-02 10:00:00" {
+		t.Errorf("adding 1 month wrong. got=%s", got)
+	}
+	if got := ts.Add(NewInterval(0, -1, -time.Hour)).String(); got != "2024-01-30 09:00:00" {
+		t.Errorf("subtracting 1 day 1 hour wrong. got=%s", got)
+	}
+	if got := mustTimestamp(t, "2024-02-01 12:00:00").Sub(ts).String(); got != "1 day 02:00:00" {
+		t.Errorf("timestamp difference wrong. got=%s", got)
+	}
+
+	date := ts.Date()
+	if got := date.AddDays(1).String(); got != "2024-02-01" {
+		t.Errorf("adding a day wrong. got=%s", got)
+	}
+	if got := date.AddDays(30).Sub(date); got != 30 {
+		t.Errorf("date difference wrong. got=%d", got)
+	}
+
+	tm, _ := ParseTime("23:30")
+	if got := tm.Add(NewInterval(0, 0, time.Hour)).String(); got != "00:30:00" {
+		t.Errorf("time did not wrap around midnight. got=%s", got)
+	}
+}
+
+func TestTruncAndExtract(t *testing.T) {
+	ts := mustTimestamp(t, "2024-05-16 14:35:27.5") // a Thursday
+
+	tests := []struct {
+		unit     string
+		expected string
+	}{
+		{"second", "2024-05-16 14:35:27"},
+		{"minute", "2024-05-16 14:35:00"},
+		{"HOUR", "2024-05-16 14:00:00"},
+		{"day", "2024-05-16 00:00:00"},
+		{"week", "2024-05-13 00:00:00"},
+		{"month", "2024-05-01 00:00:00"},
+		{"quarter", "2024-04-01 00:00:00"},
+		{"year", "2024-01-01 00:00:00"},
+	}
+	for _, tt := range tests {
+		got, ok := ts.Trunc(tt.unit)
+		if !ok || got.String() != tt.expected {
+			t.Errorf("Trunc(%s) wrong. expected=%s, got=%s", tt.unit, tt.expected, got)
+		}
+	}
+	if _, ok := ts.Trunc("fortnight"); ok {
+		t.Error("expected unknown unit to fail")
+	}
+
+	fields := map[string]int{
+		"year": 2024, "quarter": 2, "month": 5, "week": 20, "day": 16, "dow": 4,
+		"doy": 137, "hour": 14, "minute": 35, "second": 27, "epoch": 1715870127,
+	}
+	for field, expected := range fields {
+		if got, ok := ts.Extract(field); !ok || got != expected {
+			t.Errorf("Extract(%s) wrong. expected=%d, got=%d", field, expected, got)
+		}
+	}
+	if _, ok := ts.Extract("century"); ok {
+		t.Error("expected unknown field to fail")
+	}
+
+	iv, _ := ParseInterval("1 year 3 months 2 days 04:05:06")
+	if months, _ := iv.Extract("MONTH"); months != 3 {
+		t.Errorf("interval month wrong. got=%d", months)
+	}
+	if minutes, _ := iv.Extract("minute"); minutes != 5 {
+		t.Errorf("interval minute wrong. got=%d", minutes)
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	ts := mustTimestamp(t, "2024-01-15 14:30:00")
+	date, _ := ParseDate("2024-01-15")
+	tm, _ := ParseTime("14:30")
+	iv, _ := ParseInterval("1 day")
+
+	data, err := json.Marshal(map[string]interface{}{"a": ts, "b": date, "c": tm, "d": iv})
+	expected := `{"a":"2024-01-15T14:30:00Z","b":"2024-01-15","c":"14:30:00","d":"1 day"}`
+	if err != nil || string(data) != expected {
+		t.Errorf("wrong JSON. got=%s, err=%v", data, err)
+	}
+
+	encoded, _ := ts.GobEncode()
+	var decoded Timestamp
+	if err := decoded.GobDecode(encoded); err != nil || decoded != ts {
+		t.Errorf("gob round trip failed. got=%s, err=%v", decoded, err)
+	}
+
+	// equal timestamps are equal as values, whatever time they came from
+	if NewTimestamp(time.Date(2024, 1, 15, 16, 30, 0, 0, time.FixedZone("EET", 7200))) != ts {
+		t.Error("expected timestamps of the same instant to be ==")
+	}
+}
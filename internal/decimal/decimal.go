@@ -0,0 +1,216 @@
+// Package decimal implements exact base-10 numbers for DECIMAL columns, so money
+// and other fixed point values never pick up binary floating point error.
+package decimal
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// a number coef * 10^-scale -> 12.50 is coef 1250, scale 2. the zero value is 0
+type Decimal struct {
+	coef  *big.Int
+	scale int
+}
+
+var ten = big.NewInt(10)
+
+// parse a decimal literal -> 12, -3.50, 0.125
+func Parse(s string) (Decimal, error) {
+	digits := strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+	intPart, fracPart, _ := strings.Cut(digits, ".")
+	if intPart == "" && fracPart == "" {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+
+	coef, ok := new(big.Int).SetString(intPart+fracPart, 10)
+	if !ok || strings.ContainsAny(intPart+fracPart, "+-") {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	if strings.HasPrefix(s, "-") {
+		coef.Neg(coef)
+	}
+
+	return Decimal{coef: coef, scale: len(fracPart)}, nil
+}
+
+// convert an integer exactly
+func FromInt(n int) Decimal {
+	return Decimal{coef: big.NewInt(int64(n))}
+}
+
+// convert a float through its shortest decimal form -> 0.1 is 0.1, not 0.1000000000000000055
+func FromFloat(f float64) (Decimal, error) {
+	return Parse(strconv.FormatFloat(f, 'f', -1, 64))
+}
+
+func (d Decimal) value() *big.Int {
+	if d.coef == nil {
+		return new(big.Int)
+	}
+	return d.coef
+}
+
+// digits after the decimal point
+func (d Decimal) Scale() int {
+	return d.scale
+}
+
+// digits before the decimal point -> 3 for 123.45, 0 for 0.5
+func (d Decimal) IntegerDigits() int {
+	if d.Sign() == 0 {
+		return 0
+	}
+	digits := len(new(big.Int).Abs(d.value()).String()) - d.scale
+	return max(digits, 0)
+}
+
+func (d Decimal) Sign() int {
+	return d.value().Sign()
+}
+
+// the same number with the given scale, rounding half away from zero when digits
+// are dropped -> 2.345 at scale 2 is 2.35
+func (d Decimal) Rescale(scale int) Decimal {
+	if scale >= d.scale {
+		factor := new(big.Int).Exp(ten, big.NewInt(int64(scale-d.scale)), nil)
+		return Decimal{coef: new(big.Int).Mul(d.value(), factor), scale: scale}
+	}
+
+	factor := new(big.Int).Exp(ten, big.NewInt(int64(d.scale-scale)), nil)
+	quo, rem := new(big.Int).QuoRem(d.value(), factor, new(big.Int))
+
+	// round away from zero when the dropped part is at least half
+	if new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2)).Cmp(factor) >= 0 {
+		if d.Sign() < 0 {
+			quo.Sub(quo, big.NewInt(1))
+		} else {
+			quo.Add(quo, big.NewInt(1))
+		}
+	}
+	return Decimal{coef: quo, scale: scale}
+}
+
+// the number without trailing zeros after the decimal point -> 1.50 is 1.5
+func (d Decimal) Normalize() Decimal {
+	coef := new(big.Int).Set(d.value())
+	scale := d.scale
+	rem := new(big.Int)
+	for scale > 0 {
+		quo, r := new(big.Int).QuoRem(coef, ten, rem)
+		if r.Sign() != 0 {
+			break
+		}
+		coef = quo
+		scale--
+	}
+	return Decimal{coef: coef, scale: scale}
+}
+
+// align two numbers to the larger scale
+func align(a, b Decimal) (*big.Int, *big.Int, int) {
+	scale := max(a.scale, b.scale)
+	return a.Rescale(scale).value(), b.Rescale(scale).value(), scale
+}
+
+func (d Decimal) Add(other Decimal) Decimal {
+	a, b, scale := align(d, other)
+	return Decimal{coef: new(big.Int).Add(a, b), scale: scale}
+}
+
+func (d Decimal) Sub(other Decimal) Decimal {
+	a, b, scale := align(d, other)
+	return Decimal{coef: new(big.Int).Sub(a, b), scale: scale}
+}
+
+func (d Decimal) Mul(other Decimal) Decimal {
+	return Decimal{coef: new(big.Int).Mul(d.value(), other.value()), scale: d.scale + other.scale}
+}
+
+// divide, rounding the quotient to the given scale. ok is false for division by zero
+func (d Decimal) Quo(other Decimal, scale int) (Decimal, bool) {
+	if other.Sign() == 0 {
+		return Decimal{}, false
+	}
+
+	// d / other = (d.coef * 10^(scale + other.scale - d.scale + 1)) / other.coef at
+	// scale + 1, the extra digit decides the rounding
+	shift := scale + other.scale - d.scale + 1
+	num := new(big.Int).Set(d.value())
+	den := new(big.Int).Set(other.value())
+	if shift >= 0 {
+		num.Mul(num, new(big.Int).Exp(ten, big.NewInt(int64(shift)), nil))
+	} else {
+		den.Mul(den, new(big.Int).Exp(ten, big.NewInt(int64(-shift)), nil))
+	}
+
+	return Decimal{coef: new(big.Int).Quo(num, den), scale: scale + 1}.Rescale(scale), true
+}
+
+// compare -> -1, 0, 1
+func (d Decimal) Cmp(other Decimal) int {
+	a, b, _ := align(d, other)
+	return a.Cmp(b)
+}
+
+// the number as an int, ok is false if it has a fractional part or does not fit
+func (d Decimal) Int() (int, bool) {
+	n := d.Normalize()
+	if n.scale > 0 || !n.value().IsInt64() {
+		return 0, false
+	}
+	return int(n.value().Int64()), true
+}
+
+// the nearest float
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// the number with all of its scale digits -> 12.50
+func (d Decimal) String() string {
+	digits := new(big.Int).Abs(d.value()).String()
+	if d.scale > 0 {
+		if len(digits) <= d.scale {
+			digits = strings.Repeat("0", d.scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-d.scale] + "." + digits[len(digits)-d.scale:]
+	}
+
+	if d.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// encode as a JSON number, keeping every digit
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	parsed, err := Parse(string(bytes.Trim(data, `"`)))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// decimals are logged and snapshotted as their text form
+func (d Decimal) GobEncode() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Decimal) GobDecode(data []byte) error {
+	parsed, err := Parse(string(data))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
@@ -0,0 +1,131 @@
+package decimal
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func mustParse(t *testing.T, s string) Decimal {
+	t.Helper()
+
+	d, err := Parse(s)
+	if err != nil {
+		t.Fatalf("Parse(%q) failed: %v", s, err)
+	}
+	return d
+}
+
+func TestParseAndString(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"12", "12"},
+		{"12.50", "12.50"},
+		{"-3.5", "-3.5"},
+		{"0.05", "0.05"},
+		{"-0.005", "-0.005"},
+		{".5", "0.5"},
+	}
+
+	for _, tt := range tests {
+		if got := mustParse(t, tt.input).String(); got != tt.expected {
+			t.Errorf("Parse(%q).String() wrong. expected=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+
+	for _, input := range []string{"", "-", "1.2.3", "abc", "1e5", "1.-5"} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("expected error parsing %q, got nil", input)
+		}
+	}
+}
+
+func TestArithmeticIsExact(t *testing.T) {
+	// 0.1 + 0.2 drifts in floating point
+	sum := mustParse(t, "0.1").Add(mustParse(t, "0.2"))
+	if sum.Cmp(mustParse(t, "0.3")) != 0 {
+		t.Errorf("0.1 + 0.2 = %s", sum)
+	}
+
+	tests := []struct {
+		got      Decimal
+		expected string
+	}{
+		{mustParse(t, "10.25").Sub(mustParse(t, "0.5")), "9.75"},
+		{mustParse(t, "1.5").Mul(mustParse(t, "-0.25")), "-0.375"},
+		{FromInt(7).Add(mustParse(t, "0.07")), "7.07"},
+	}
+	for _, tt := range tests {
+		if tt.got.String() != tt.expected {
+			t.Errorf("wrong result. expected=%s, got=%s", tt.expected, tt.got)
+		}
+	}
+
+	quo, ok := FromInt(10).Quo(FromInt(3), 4)
+	if !ok || quo.String() != "3.3333" {
+		t.Errorf("10 / 3 wrong. got=%s", quo)
+	}
+	quo, _ = FromInt(-2).Quo(FromInt(3), 2)
+	if quo.String() != "-0.67" {
+		t.Errorf("-2 / 3 wrong. got=%s", quo)
+	}
+	if _, ok := FromInt(1).Quo(Decimal{}, 2); ok {
+		t.Error("expected division by zero to fail")
+	}
+}
+
+func TestRescaleAndCompare(t *testing.T) {
+	tests := []struct {
+		input    string
+		scale    int
+		expected string
+	}{
+		{"2.345", 2, "2.35"},
+		{"2.344", 2, "2.34"},
+		{"-2.345", 2, "-2.35"},
+		{"2.5", 0, "3"},
+		{"2", 3, "2.000"},
+	}
+	for _, tt := range tests {
+		if got := mustParse(t, tt.input).Rescale(tt.scale).String(); got != tt.expected {
+			t.Errorf("Rescale(%s, %d) wrong. expected=%s, got=%s", tt.input, tt.scale, tt.expected, got)
+		}
+	}
+
+	if mustParse(t, "1.50").Cmp(mustParse(t, "1.5")) != 0 || mustParse(t, "1.50").Normalize().String() != "1.5" {
+		t.Error("1.50 and 1.5 should be equal")
+	}
+	if mustParse(t, "-1").Cmp(mustParse(t, "0.5")) >= 0 {
+		t.Error("-1 should be less than 0.5")
+	}
+
+	if n, ok := mustParse(t, "42.00").Int(); !ok || n != 42 {
+		t.Errorf("expected 42.00 as int, got %d %v", n, ok)
+	}
+	if _, ok := mustParse(t, "42.5").Int(); ok {
+		t.Error("expected 42.5 not to convert to an int")
+	}
+
+	if digits := mustParse(t, "123.45").IntegerDigits(); digits != 3 {
+		t.Errorf("wrong integer digits for 123.45, got %d", digits)
+	}
+	if digits := mustParse(t, "0.05").IntegerDigits(); digits != 0 {
+		t.Errorf("wrong integer digits for 0.05, got %d", digits)
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	d := mustParse(t, "19.90")
+
+	data, err := json.Marshal(map[string]interface{}{"price": d})
+	if err != nil || string(data) != `{"price":19.90}` {
+		t.Errorf("wrong JSON. got=%s, err=%v", data, err)
+	}
+
+	encoded, _ := d.GobEncode()
+	var decoded Decimal
+	if err := decoded.GobDecode(encoded); err != nil || decoded.String() != "19.90" {
+		t.Errorf("gob round trip failed. got=%s, err=%v", decoded, err)
+	}
+}
@@ -0,0 +1,354 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/raskovnik/rdbms/internal/ast"
+	"github.com/raskovnik/rdbms/internal/decimal"
+)
+
+// running state of one aggregate function within a group
+type accumulator struct {
+	agg   *ast.AggregateExpression
+	count int         // values seen, or rows for COUNT(*)
+	sum   interface{} // SUM and AVG, in the column's numeric type
+	value interface{} // MIN and MAX
+}
+
+func (acc *accumulator) add(row Row) {
+	if acc.agg.Column == "*" {
+		acc.count++
+		return
+	}
+
+	value := row[acc.agg.Column]
+	if value == nil {
+		return
+	}
+	acc.count++
+
+	switch acc.agg.Function {
+	case "SUM", "AVG":
+		if acc.count == 1 {
+			acc.sum = value
+		} else {
+			acc.sum = arithmetic(acc.sum, "+", value)
+		}
+	case "MIN":
+		if acc.count == 1 || compareKeys(value, acc.value) < 0 {
+			acc.value = value
+		}
+	case "MAX":
+		if acc.count == 1 || compareKeys(value, acc.value) > 0 {
+			acc.value = value
+		}
+	}
+}
+
+// final value of the aggregate, nil for SUM/AVG/MIN/MAX over no values
+func (acc *accumulator) result() interface{} {
+	if acc.agg.Function == "COUNT" {
+		return acc.count
+	}
+	if acc.count == 0 {
+		return nil
+	}
+
+	switch acc.agg.Function {
+	case "SUM":
+		return acc.sum
+	case "AVG":
+		// averages of exact DECIMAL values stay exact, anything else is a FLOAT
+		if _, exact := acc.sum.(decimal.Decimal); exact {
+			return arithmetic(acc.sum, "/", acc.count)
+		}
+		return toFloat(acc.sum) / float64(acc.count)
+	default:
+		return acc.value
+	}
+}
+
+// rows sharing the same GROUP BY values
+type group struct {
+	keys         Row // GROUP BY column values
+	accumulators []*accumulator
+}
+
+// execute a SELECT with aggregates or GROUP BY as a hash aggregation: matching rows are
+// hashed on their GROUP BY values into groups, each keeping one accumulator per
+// aggregate. HAVING, ORDER BY and LIMIT then apply to one output row per group
+func (tx *Tx) executeAggregate(table *Table, stmt *ast.SelectStatement) ([]Row, error) {
+	aggregates, err := checkAggregate(table, stmt)
+	if err != nil {
+		return nil, err
+	}
+
+	row, ok, err := tx.indexAggregate(table, stmt, aggregates)
+	if err != nil {
+		return nil, err
+	}
+	results := []Row{row}
+	if !ok {
+		if results, err = tx.hashAggregate(table, stmt, aggregates); err != nil {
+			return nil, err
+		}
+	}
+
+	if stmt.Having != nil {
+		having := tx.bind(stmt.Having)
+		kept := []Row{}
+		for _, row := range results {
+			if evaluateWhere(row, having) {
+				kept = append(kept, row)
+			}
+		}
+		results = kept
+	}
+
+	if len(stmt.OrderBy) > 0 {
+		sortRows(results, stmt.OrderBy)
+	}
+
+	// OFFSET and LIMIT, kept within the results like a scan does
+	results = results[min(max(stmt.Offset, 0), len(results)):]
+	if stmt.Limit != nil {
+		results = results[:min(max(*stmt.Limit, 0), len(results))]
+	}
+
+	// keep only the selected columns and aggregates
+	projected := make([]Row, len(results))
+	for i, row := range results {
+		projectedRow := make(Row)
+		for _, col := range stmt.Columns {
+			projectedRow[col] = row[col]
+		}
+		for _, agg := range stmt.Aggregates {
+			projectedRow[agg.String()] = row[agg.String()]
+		}
+		projected[i] = projectedRow
+	}
+
+	return projected, nil
+}
+
+// report whether ORDER BY sorts on an aggregate, which makes the query an aggregate query
+func hasAggregateOrder(orderBy []ast.OrderByItem) bool {
+	for _, item := range orderBy {
+		if item.Aggregate != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// validate an aggregate query and collect every aggregate it computes, including
+// those only used in HAVING or ORDER BY
+func checkAggregate(table *Table, stmt *ast.SelectStatement) ([]*ast.AggregateExpression, error) {
+	grouped := make(map[string]bool)
+	for _, col := range stmt.GroupBy {
+		if !table.hasColumn(col) {
+			return nil, fmt.Errorf("column %s does not exist", col)
+		}
+		grouped[col] = true
+	}
+
+	for _, col := range stmt.Columns {
+		if col == "*" {
+			return nil, fmt.Errorf("SELECT * cannot be used with aggregates or GROUP BY")
+		}
+		if !table.hasColumn(col) {
+			return nil, fmt.Errorf("column %s does not exist", col)
+		}
+		if !grouped[col] {
+			return nil, fmt.Errorf("column %s must appear in GROUP BY or be used in an aggregate", col)
+		}
+	}
+
+	var aggregates []*ast.AggregateExpression
+	seen := make(map[string]bool)
+	collect := func(agg *ast.AggregateExpression) {
+		if !seen[agg.String()] {
+			seen[agg.String()] = true
+			aggregates = append(aggregates, agg)
+		}
+	}
+
+	for _, agg := range stmt.Aggregates {
+		collect(agg)
+	}
+	if stmt.Having != nil {
+		if err := checkHaving(stmt.Having, grouped, collect); err != nil {
+			return nil, err
+		}
+	}
+	for _, item := range stmt.OrderBy {
+		if item.Aggregate != nil {
+			collect(item.Aggregate)
+		} else if !grouped[item.Column] {
+			return nil, fmt.Errorf("ORDER BY column %s must appear in GROUP BY", item.Column)
+		}
+	}
+
+	for _, agg := range aggregates {
+		if agg.Column == "*" {
+			continue
+		}
+
+		col, exists := table.column(agg.Column)
+		if !exists {
+			return nil, fmt.Errorf("column %s does not exist", agg.Column)
+		}
+		if (agg.Function == "SUM" || agg.Function == "AVG") && !isNumericType(col.Type) {
+			return nil, fmt.Errorf("%s requires a numeric column, %s is %s", agg.Function, col.Name, col.Type)
+		}
+	}
+
+	return aggregates, nil
+}
+
+// check that HAVING only references GROUP BY columns and aggregates
+func checkHaving(expr ast.Expression, grouped map[string]bool, collect func(*ast.AggregateExpression)) error {
+	switch e := expr.(type) {
+	case *ast.Identifier:
+		if !grouped[e.Name] {
+			return fmt.Errorf("HAVING column %s must appear in GROUP BY or be used in an aggregate", e.Name)
+		}
+	case *ast.AggregateExpression:
+		collect(e)
+	case *ast.UnaryExpression:
+		return checkHaving(e.Operand, grouped, collect)
+	case *ast.IsNullExpression:
+		return checkHaving(e.Operand, grouped, collect)
+	case *ast.FunctionCall:
+		if err := checkFunction(e); err != nil {
+			return err
+		}
+		for _, arg := range e.Args {
+			if err := checkHaving(arg, grouped, collect); err != nil {
+				return err
+			}
+		}
+	case *ast.ExtractExpression:
+		if err := checkExtract(e); err != nil {
+			return err
+		}
+		return checkHaving(e.Source, grouped, collect)
+	case *ast.BinaryExpression:
+		if err := checkHaving(e.Left, grouped, collect); err != nil {
+			return err
+		}
+		return checkHaving(e.Right, grouped, collect)
+	}
+	return nil
+}
+
+// group the matching rows in a hash table keyed on their GROUP BY values, groups are
+// returned in the order they are first seen
+func (tx *Tx) hashAggregate(table *Table, stmt *ast.SelectStatement, aggregates []*ast.AggregateExpression) ([]Row, error) {
+	groups := make(map[interface{}]*group)
+	var order []*group
+
+	newGroup := func(keys Row) *group {
+		g := &group{keys: keys}
+		for _, agg := range aggregates {
+			g.accumulators = append(g.accumulators, &accumulator{agg: agg})
+		}
+		order = append(order, g)
+		return g
+	}
+
+	err := tx.scanRows(table, stmt.Where, nil, func(_ int, row Row) bool {
+		key := make(Tuple, len(stmt.GroupBy))
+		for i, col := range stmt.GroupBy {
+			key[i] = row[col]
+		}
+
+		g, exists := groups[hashKey(key)]
+		if !exists {
+			keys := make(Row, len(stmt.GroupBy))
+			for _, col := range stmt.GroupBy {
+				keys[col] = row[col]
+			}
+			g = newGroup(keys)
+			groups[hashKey(key)] = g
+		}
+
+		for _, acc := range g.accumulators {
+			acc.add(row)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// without GROUP BY the whole table is one group, even when it is empty
+	if len(stmt.GroupBy) == 0 && len(order) == 0 {
+		newGroup(Row{})
+	}
+
+	results := make([]Row, len(order))
+	for i, g := range order {
+		row := make(Row, len(g.keys)+len(g.accumulators))
+		for col, value := range g.keys {
+			row[col] = value
+		}
+		for _, acc := range g.accumulators {
+			row[acc.agg.String()] = acc.result()
+		}
+		results[i] = row
+	}
+
+	return results, nil
+}
+
+// answer MIN and MAX over a whole table without scanning it -> they are the first
+// non-NULL key from either end of an ordered index that belongs to a row the
+// transaction sees
+func (tx *Tx) indexAggregate(table *Table, stmt *ast.SelectStatement, aggregates []*ast.AggregateExpression) (Row, bool, error) {
+	if stmt.Where != nil || len(stmt.GroupBy) > 0 {
+		return nil, false, nil
+	}
+
+	row := make(Row, len(aggregates))
+	for _, agg := range aggregates {
+		if agg.Function != "MIN" && agg.Function != "MAX" {
+			return nil, false, nil
+		}
+
+		index, exists := table.indexOn(agg.Column)
+		ordered, isOrdered := index.(OrderedIndex)
+		if !exists || !isOrdered {
+			return nil, false, nil
+		}
+
+		var value interface{}
+		var err error
+		scanErr := ordered.Scan(nil, nil, agg.Function == "MAX", func(key interface{}, rowIndices []int) bool {
+			if key == nil {
+				return true
+			}
+			for _, pos := range rowIndices {
+				var visibleRow Row
+				var ok bool
+				if visibleRow, ok, err = tx.visible(table, pos); err != nil {
+					return false
+				}
+				if ok && compareKeys(visibleRow[agg.Column], key) == 0 {
+					value = key
+					return false
+				}
+			}
+			return true
+		})
+		if err == nil {
+			err = scanErr
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		row[agg.String()] = value
+	}
+
+	return row, true, nil
+}
@@ -0,0 +1,182 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/raskovnik/rdbms/internal/ast"
+)
+
+func setupAggregateTestDB(t *testing.T) *Database {
+	db := NewDB()
+	execSQL(t, db, "CREATE TABLE orders (id INT PRIMARY KEY, user_id INT, item TEXT, total INT)")
+	for _, stmt := range []string{
+		"INSERT INTO orders VALUES (1, 1, 'pen', 5)",
+		"INSERT INTO orders VALUES (2, 2, 'book', 20)",
+		"INSERT INTO orders VALUES (3, 1, 'ink', 7)",
+		"INSERT INTO orders VALUES (4, 3, 'desk', 150)",
+		"INSERT INTO orders VALUES (5, 1, 'pad', 3)",
+		"INSERT INTO orders VALUES (6, 2, 'lamp', 40)",
+	} {
+		execSQL(t, db, stmt)
+	}
+	return db
+}
+
+func TestAggregateWithoutGroupBy(t *testing.T) {
+	db := setupAggregateTestDB(t)
+
+	results := execSQL(t, db, "SELECT COUNT(*), COUNT(item), SUM(total), AVG(total), MIN(item), MAX(id) FROM orders").([]Row)
+	if len(results) != 1 {
+		t.Fatalf("expected 1 row, got %d", len(results))
+	}
+
+	expected := Row{
+		"COUNT(*)":    6,
+		"COUNT(item)": 6,
+		"SUM(total)":  225,
+		"AVG(total)":  37.5,
+		"MIN(item)":   "book",
+		"MAX(id)":     6,
+	}
+	for col, value := range expected {
+		if results[0][col] != value {
+			t.Errorf("%s wrong. expected=%v, got=%v", col, value, results[0][col])
+		}
+	}
+
+	// an empty input still produces one row
+	results = execSQL(t, db, "SELECT COUNT(*), SUM(total), MAX(total) FROM orders WHERE total > 1000").([]Row)
+	if len(results) != 1 || results[0]["COUNT(*)"] != 0 || results[0]["SUM(total)"] != nil || results[0]["MAX(total)"] != nil {
+		t.Errorf("wrong aggregates over no rows: %v", results)
+	}
+}
+
+func TestAggregateGroupBy(t *testing.T) {
+	db := setupAggregateTestDB(t)
+
+	results := execSQL(t, db, "SELECT user_id, COUNT(*), SUM(total) FROM orders GROUP BY user_id ORDER BY user_id").([]Row)
+
+	expected := []Row{
+		{"user_id": 1, "COUNT(*)": 3, "SUM(total)": 15},
+		{"user_id": 2, "COUNT(*)": 2, "SUM(total)": 60},
+		{"user_id": 3, "COUNT(*)": 1, "SUM(total)": 150},
+	}
+
+	if len(results) != len(expected) {
+		t.Fatalf("wrong number of groups. expected=%d, got=%d", len(expected), len(results))
+	}
+	for i, row := range expected {
+		if len(results[i]) != len(row) {
+			t.Errorf("group %d has wrong columns: %v", i, results[i])
+		}
+		for col, value := range row {
+			if results[i][col] != value {
+				t.Errorf("group %d %s wrong. expected=%v, got=%v", i, col, value, results[i][col])
+			}
+		}
+	}
+}
+
+func TestAggregateHavingOrderLimit(t *testing.T) {
+	db := setupAggregateTestDB(t)
+
+	tests := []struct {
+		query    string
+		expected []int // user_id of each group
+	}{
+		{"SELECT user_id FROM orders GROUP BY user_id HAVING COUNT(*) > 1", []int{1, 2}},
+		{"SELECT user_id FROM orders GROUP BY user_id HAVING SUM(total) >= 60 AND user_id != 3", []int{2}},
+		{"SELECT user_id FROM orders GROUP BY user_id ORDER BY SUM(total) DESC", []int{3, 2, 1}},
+		{"SELECT user_id, MAX(total) FROM orders GROUP BY user_id ORDER BY MAX(total) LIMIT 2", []int{1, 2}},
+		{"SELECT user_id FROM orders WHERE total < 100 GROUP BY user_id ORDER BY user_id DESC LIMIT 1 OFFSET 1", []int{1}},
+	}
+
+	for _, tt := range tests {
+		results := execSQL(t, db, tt.query).([]Row)
+		if len(results) != len(tt.expected) {
+			t.Fatalf("wrong number of groups for %q. expected=%d, got=%d", tt.query, len(tt.expected), len(results))
+		}
+		for i, userID := range tt.expected {
+			if results[i]["user_id"] != userID {
+				t.Errorf("group %d wrong for %q. expected=%d, got=%v", i, tt.query, userID, results[i]["user_id"])
+			}
+		}
+	}
+}
+
+func TestAggregateLimitOffsetBounds(t *testing.T) {
+	db := setupAggregateTestDB(t)
+
+	tests := []struct {
+		query  string
+		limit  int
+		offset int
+		groups int
+	}{
+		{"SELECT COUNT(*) FROM orders", 5, 0, 1},
+		{"SELECT COUNT(*) FROM orders", 1, 1, 0},
+		{"SELECT user_id FROM orders GROUP BY user_id", 2, 2, 1},
+		{"SELECT user_id FROM orders GROUP BY user_id", 10, 10, 0},
+		// the parser refuses negative counts, a statement built without it gets no rows
+		{"SELECT COUNT(*) FROM orders", -1, 0, 0},
+		{"SELECT user_id FROM orders GROUP BY user_id", 2, -3, 2},
+	}
+
+	for _, tt := range tests {
+		stmt := parseSQL(t, tt.query).(*ast.SelectStatement)
+		stmt.Limit, stmt.Offset = &tt.limit, tt.offset
+		res, err := db.Execute(stmt)
+		if err != nil {
+			t.Fatalf("%q LIMIT %d OFFSET %d failed: %v", tt.query, tt.limit, tt.offset, err)
+		}
+		if rows := res.([]Row); len(rows) != tt.groups {
+			t.Errorf("wrong rows for %q LIMIT %d OFFSET %d. expected=%d, got=%v", tt.query, tt.limit, tt.offset, tt.groups, rows)
+		}
+	}
+}
+
+func TestAggregateUsesIndex(t *testing.T) {
+	db := setupAggregateTestDB(t)
+	table := db.tables["orders"]
+
+	tx := db.Begin()
+	tx.start(false)
+	defer tx.Rollback()
+
+	stmt := parseSQL(t, "SELECT MIN(id), MAX(id) FROM orders").(*ast.SelectStatement)
+	row, ok, err := tx.indexAggregate(table, stmt, stmt.Aggregates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("expected MIN/MAX on the primary key to be read from its index")
+	}
+	if row["MIN(id)"] != 1 || row["MAX(id)"] != 6 {
+		t.Errorf("wrong index aggregates: %v", row)
+	}
+
+	stmt = parseSQL(t, "SELECT MAX(total) FROM orders").(*ast.SelectStatement)
+	if _, ok, _ := tx.indexAggregate(table, stmt, stmt.Aggregates); ok {
+		t.Error("expected MAX on an unindexed column to scan")
+	}
+}
+
+func TestAggregateErrors(t *testing.T) {
+	db := setupAggregateTestDB(t)
+
+	tests := []string{
+		"SELECT item, COUNT(*) FROM orders GROUP BY user_id",
+		"SELECT SUM(item) FROM orders",
+		"SELECT COUNT(missing) FROM orders",
+		"SELECT user_id FROM orders GROUP BY missing",
+		"SELECT user_id FROM orders GROUP BY user_id HAVING total > 1",
+		"SELECT user_id FROM orders GROUP BY user_id ORDER BY total",
+		"SELECT * FROM orders WHERE COUNT(*) > 1",
+	}
+
+	for _, query := range tests {
+		if _, err := db.Execute(parseSQL(t, query)); err == nil {
+			t.Errorf("expected error for %q, got nil", query)
+		}
+	}
+}
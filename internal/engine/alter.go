@@ -0,0 +1,367 @@
+package engine
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/raskovnik/rdbms/internal/ast"
+)
+
+func (tx *Tx) executeAlter(stmt *ast.AlterTableStatement) error {
+	db := tx.db
+
+	table, exists := db.tables[stmt.Table]
+	if !exists {
+		return fmt.Errorf("table %s does not exist", stmt.Table)
+	}
+
+	op := walOp{Table: table.Name}
+
+	switch stmt.Action {
+	case "ADD COLUMN":
+		col := stmt.Column
+		if table.hasColumn(col.Name) {
+			return fmt.Errorf("column %s already exists in table %s", col.Name, table.Name)
+		}
+		if _, hasPK := table.primaryIndex(); col.PrimaryKey && hasPK {
+			return fmt.Errorf("table %s already has a primary key", table.Name)
+		}
+		if _, taken := table.Indexes[col.Name]; taken && (col.PrimaryKey || col.Unique) {
+			return fmt.Errorf("index %s already exists", col.Name)
+		}
+		if col.Serial {
+			return fmt.Errorf("cannot add SERIAL column %s to an existing table", col.Name)
+		}
+		if col.References != nil {
+			if err := db.checkForeignKey(table, &col); err != nil {
+				return err
+			}
+		}
+		if col.Check != nil {
+			// named and checked as part of the table it makes
+			defined := &Table{Name: table.Name, Schema: append(append([]ast.ColumnDef{}, table.Schema...), col), Checks: table.Checks}
+			if err := tx.prepareChecks(defined); err != nil {
+				return err
+			}
+			col = defined.Schema[len(defined.Schema)-1]
+		}
+
+		// existing rows get the default, computed once so every row and the log agree.
+		// a sequence would give them all the same value
+		calls := false
+		if col.Default != nil {
+			var err error
+			if calls, err = tx.checkDefault(col); err != nil {
+				return err
+			}
+			if calls && table.hasRows() {
+				return fmt.Errorf("DEFAULT of column %s takes a sequence value, it cannot fill existing rows", col.Name)
+			}
+		}
+		var value interface{}
+		if (col.Default != nil && !calls) || table.hasRows() {
+			var err error
+			if value, err = tx.defaultValue(col); err != nil {
+				return err
+			}
+		}
+
+		// the rows already there all take the default, which must name a parent row
+		if col.References != nil && table.hasRows() {
+			if err := tx.checkParent(table.Name, col, value); err != nil {
+				return err
+			}
+		}
+
+		op.Kind = walAddColumn
+		op.Schema = []ast.ColumnDef{col}
+		op.Value = value
+	case "DROP COLUMN":
+		if !table.hasColumn(stmt.Name) {
+			return fmt.Errorf("column %s does not exist", stmt.Name)
+		}
+		if len(table.Schema) == 1 {
+			return fmt.Errorf("cannot drop %s, the only column of table %s", stmt.Name, table.Name)
+		}
+		// the column's own CHECK goes with it
+		dropped, _ := table.column(stmt.Name)
+		for _, check := range table.checks() {
+			if dropped.Check != nil && dropped.Check.Name == check.Name {
+				continue
+			}
+			if usesColumn(check.Expr, stmt.Name) {
+				return fmt.Errorf("cannot drop column %s of table %s, CHECK constraint %s uses it", stmt.Name, table.Name, check.Name)
+			}
+		}
+		for _, key := range table.Keys {
+			if slices.Contains(key.Columns, stmt.Name) {
+				return fmt.Errorf("cannot drop column %s of table %s, key %s uses it", stmt.Name, table.Name, key.Name)
+			}
+		}
+		for _, ref := range db.referencing(table.Name) {
+			if ref.column.References.Column == stmt.Name && (ref.table != table || ref.column.Name != stmt.Name) {
+				return fmt.Errorf("cannot drop column %s of table %s, column %s.%s references it", stmt.Name, table.Name, ref.table.Name, ref.column.Name)
+			}
+		}
+
+		op.Kind = walDropColumn
+		op.Column = stmt.Name
+	case "RENAME COLUMN":
+		col, exists := table.column(stmt.Name)
+		if !exists {
+			return fmt.Errorf("column %s does not exist", stmt.Name)
+		}
+		if table.hasColumn(stmt.NewName) {
+			return fmt.Errorf("column %s already exists in table %s", stmt.NewName, table.Name)
+		}
+		if _, taken := table.Indexes[stmt.NewName]; taken && (col.PrimaryKey || col.Unique) {
+			return fmt.Errorf("index %s already exists", stmt.NewName)
+		}
+
+		op.Kind = walRenameColumn
+		op.Column = stmt.Name
+		op.NewName = stmt.NewName
+	case "RENAME TO":
+		if _, exists := db.tables[stmt.NewName]; exists {
+			return fmt.Errorf("table %s already exists", stmt.NewName)
+		}
+
+		op.Kind = walRenameTable
+		op.NewName = stmt.NewName
+	default:
+		return fmt.Errorf("unknown ALTER TABLE action %s", stmt.Action)
+	}
+
+	altered, err := alterTable(table, op)
+	if err != nil {
+		return err
+	}
+
+	// the rows already there must satisfy an added column's CHECK, and still fit in a
+	// page. they are read one at a time
+	if op.Kind == walAddColumn {
+		err := altered.eachLiveRow(func(row Row) error {
+			rows := []Row{row}
+			if op.Schema[0].Check != nil {
+				if err := tx.checkRows(altered, rows); err != nil {
+					return err
+				}
+			}
+			return tx.checkStorable(altered, rows)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// the original table is kept untouched, a rollback puts it back
+	tx.saveSchema(table.Name)
+	tx.saveSchema(altered.Name)
+	tx.logOps(op)
+
+	if altered.Name != table.Name {
+		for _, seq := range db.ownedSequences(table.Name) {
+			tx.saveSequence(seq.Name)
+			seq.Owner = altered.Name
+		}
+	}
+
+	delete(db.tables, table.Name)
+	db.tables[altered.Name] = altered
+	db.renameReferences(op, tx.saveSchema)
+	return nil
+}
+
+// the value a column takes when a row gives none, its DEFAULT or NULL
+func (tx *Tx) defaultValue(col ast.ColumnDef) (interface{}, error) {
+	if col.Default == nil {
+		return coerceValue(col, nil)
+	}
+
+	if _, err := tx.checkDefault(col); err != nil {
+		return nil, err
+	}
+
+	value, err := coerceValue(col, evalExpression(nil, tx.bind(col.Default)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DEFAULT for column %s: %w", col.Name, err)
+	}
+	return value, nil
+}
+
+// check a DEFAULT without computing it, calls is true if it takes a sequence value
+func (tx *Tx) checkDefault(col ast.ColumnDef) (calls bool, err error) {
+	// a default reads no column -> DEFAULT 0, DEFAULT NOW(), DEFAULT nextval('ids')
+	if err := checkExpression(&Table{}, col.Default); err != nil {
+		return false, fmt.Errorf("invalid DEFAULT for column %s: %w", col.Name, err)
+	}
+
+	calls, err = tx.checkSequences(col.Default)
+	if err != nil {
+		return calls, fmt.Errorf("invalid DEFAULT for column %s: %w", col.Name, err)
+	}
+	return calls, nil
+}
+
+// build the table left by an ALTER TABLE change as a copy of table, keeping every row
+// version with its visibility. rows on disk stay there and are not read. secondary
+// indexes follow their columns and are dropped with them
+func alterTable(table *Table, op walOp) (*Table, error) {
+	name := table.Name
+	schema := make([]ast.ColumnDef, 0, len(table.Schema)+1)
+	checks := table.Checks
+	convert := func(row Row) Row { return row }
+	renamed := func(column string) string { return column }
+
+	switch op.Kind {
+	case walAddColumn:
+		col := op.Schema[0]
+		schema = append(append(schema, table.Schema...), col)
+		convert = func(row Row) Row {
+			return withColumn(row, "", col.Name, op.Value)
+		}
+	case walDropColumn:
+		for _, col := range table.Schema {
+			if col.Name != op.Column {
+				schema = append(schema, col)
+			}
+		}
+		convert = func(row Row) Row {
+			return withColumn(row, op.Column, "", nil)
+		}
+	case walRenameColumn:
+		for _, col := range table.Schema {
+			if col.Name == op.Column {
+				col.Name = op.NewName
+			}
+			if col.Check != nil {
+				col.Check = &ast.CheckConstraint{Name: col.Check.Name, Expr: renameColumn(col.Check.Expr, op.Column, op.NewName)}
+			}
+			schema = append(schema, col)
+		}
+		checks = make([]ast.CheckConstraint, 0, len(table.Checks))
+		for _, check := range table.Checks {
+			checks = append(checks, ast.CheckConstraint{Name: check.Name, Expr: renameColumn(check.Expr, op.Column, op.NewName)})
+		}
+		convert = func(row Row) Row {
+			return withColumn(row, op.Column, op.NewName, row[op.Column])
+		}
+		renamed = func(column string) string {
+			if column == op.Column {
+				return op.NewName
+			}
+			return column
+		}
+	case walRenameTable:
+		name = op.NewName
+		schema = append(schema, table.Schema...)
+	default:
+		return nil, fmt.Errorf("unknown ALTER TABLE operation %d", op.Kind)
+	}
+
+	// keys follow renamed columns, a column in a key cannot be dropped
+	keys := make([]ast.KeyConstraint, len(table.Keys))
+	for i, key := range table.Keys {
+		key.Columns = make([]string, len(key.Columns))
+		for j, col := range table.Keys[i].Columns {
+			key.Columns[j] = renamed(col)
+		}
+		keys[i] = key
+	}
+
+	// key and unique columns get their indexes from the new schema and keys
+	altered := newTable(name, schema, table.pool)
+	altered.addKeys(keys)
+	altered.Checks = checks
+	altered.ids = table.ids
+	altered.free = append([]int(nil), table.free...)
+
+	// rows on disk are read through the store, which converts them as they are read,
+	// and the next checkpoint writes them in the new schema. rows in memory are
+	// converted here
+	if table.store != nil {
+		sameValues := op.Kind == walRenameTable || op.Kind == walRenameColumn
+		altered.store = table.store.reshaped(schema, convert, sameValues)
+	}
+	for pos, head := range table.versions {
+		var newest, last *rowVersion
+		for v := head; v != nil; v = v.prev {
+			version := &rowVersion{row: convert(v.row), xmin: v.xmin, xmax: v.xmax}
+			if last == nil {
+				newest = version
+			} else {
+				last.prev = version
+			}
+			last = version
+		}
+		altered.versions[pos] = newest
+	}
+
+	for _, index := range sortedIndexes(table) {
+		info := *index.Info()
+		if table.isConstraintIndex(info.Name) {
+			continue
+		}
+
+		columns := make([]string, 0, len(info.Columns))
+		for _, col := range info.Columns {
+			if op.Kind == walDropColumn && col == op.Column {
+				columns = nil
+				break
+			}
+			columns = append(columns, renamed(col))
+		}
+		if columns == nil {
+			continue
+		}
+
+		info.Columns = columns
+		altered.Indexes[info.Name] = altered.newIndex(info)
+	}
+
+	// rows keep their ids and their keys, an index in pages is copied with its entries.
+	// the others are built again, and the index of an added unique column
+	for name, index := range altered.Indexes {
+		from := name
+		if op.Kind == walRenameColumn && name == op.NewName && altered.isConstraintIndex(name) {
+			from = op.Column
+		}
+		if paged, ok := pagedOf(table.Indexes[from]); ok {
+			altered.Indexes[name] = paged.clone(*index.Info())
+			continue
+		}
+		if err := addVersions(index, altered); err != nil {
+			return nil, err
+		}
+	}
+
+	// an added key or unique column must not repeat its default
+	if op.Kind == walAddColumn {
+		if index, exists := altered.Indexes[op.Schema[0].Name]; exists {
+			row, err := duplicateRow(altered, index)
+			if err != nil {
+				return nil, err
+			}
+			if row != nil {
+				return nil, fmt.Errorf("could not add unique column %s: duplicate value %v", op.Schema[0].Name, op.Value)
+			}
+		}
+	}
+
+	return altered, nil
+}
+
+// a copy of row without the column from and with the column to set to value, either
+// name may be empty
+func withColumn(row Row, from, to string, value interface{}) Row {
+	copied := make(Row, len(row)+1)
+	for col, v := range row {
+		if col != from {
+			copied[col] = v
+		}
+	}
+	if to != "" {
+		copied[to] = value
+	}
+	return copied
+}
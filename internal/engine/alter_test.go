@@ -0,0 +1,231 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAlterAddColumn(t *testing.T) {
+	db := setupTestDB(t)
+
+	execSQL(t, db, "ALTER TABLE users ADD COLUMN age INT NOT NULL DEFAULT 20 + 10")
+	execSQL(t, db, "ALTER TABLE users ADD email TEXT")
+	execSQL(t, db, "ALTER TABLE users ADD COLUMN joined TIMESTAMP DEFAULT NOW()")
+	execSQL(t, db, "INSERT INTO users VALUES (3, 'Carol', 41, 'carol@example.com', NULL)")
+
+	rows := execSQL(t, db, "SELECT * FROM users ORDER BY id").([]Row)
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %v", rows)
+	}
+	if rows[0]["age"] != 30 || rows[1]["age"] != 30 || rows[2]["age"] != 41 {
+		t.Errorf("existing rows were not given the default: %v", rows)
+	}
+	if rows[0]["email"] != nil || rows[0]["joined"] == nil || rows[0]["joined"] != rows[1]["joined"] {
+		t.Errorf("wrong added columns: %v", rows)
+	}
+
+	for _, input := range []string{
+		"ALTER TABLE users ADD COLUMN name TEXT",
+		"ALTER TABLE users ADD COLUMN nickname TEXT NOT NULL",
+		"ALTER TABLE users ADD COLUMN code INT UNIQUE DEFAULT 7",
+		"ALTER TABLE users ADD COLUMN user_id INT PRIMARY KEY",
+		"ALTER TABLE users ADD COLUMN score INT DEFAULT 'high'",
+		"ALTER TABLE users ADD COLUMN next_id INT DEFAULT id + 1",
+		"ALTER TABLE missing ADD COLUMN age INT",
+		"CREATE TABLE items (id INT, done BOOL DEFAULT 0)",
+	} {
+		if _, err := db.Execute(parseSQL(t, input)); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+
+	// unique and NOT NULL columns can still be added where no row breaks them
+	execSQL(t, db, "ALTER TABLE users ADD COLUMN code INT UNIQUE")
+	if _, err := db.Execute(parseSQL(t, "UPDATE users SET code = 1")); err == nil {
+		t.Error("expected the added unique column to reject duplicates")
+	}
+	execSQL(t, db, "CREATE TABLE items (id INT)")
+	execSQL(t, db, "ALTER TABLE items ADD COLUMN name TEXT NOT NULL")
+}
+
+func TestAlterDropColumn(t *testing.T) {
+	db := setupTestDB(t)
+	execSQL(t, db, "ALTER TABLE users ADD COLUMN age INT DEFAULT 30")
+	execSQL(t, db, "CREATE INDEX users_name ON users (name)")
+	execSQL(t, db, "CREATE INDEX users_age ON users (age)")
+
+	execSQL(t, db, "ALTER TABLE users DROP COLUMN name")
+
+	table := db.tables["users"]
+	if len(table.Schema) != 2 || table.hasColumn("name") {
+		t.Errorf("wrong schema after DROP COLUMN: %v", table.Schema)
+	}
+	if _, _, exists := db.findIndex("users_name"); exists {
+		t.Error("index on the dropped column still exists")
+	}
+	if _, exists := table.Indexes["users_age"]; !exists {
+		t.Error("index on another column was dropped")
+	}
+	rows := execSQL(t, db, "SELECT * FROM users WHERE age = 30 ORDER BY id").([]Row)
+	if len(rows) != 2 || fmt.Sprint(rows[0]) != "map[age:30 id:1]" {
+		t.Errorf("wrong rows after DROP COLUMN: %v", rows)
+	}
+	if _, err := db.Execute(parseSQL(t, "SELECT * FROM users WHERE name = 'Alice'")); err == nil {
+		t.Error("expected the dropped column to be gone")
+	}
+
+	// dropping the key column drops the key
+	execSQL(t, db, "ALTER TABLE users DROP id")
+	table = db.tables["users"]
+	if table.pkColumn != "" || len(table.Indexes) != 1 {
+		t.Errorf("primary key left after dropping its column: %q, %v", table.pkColumn, table.Indexes)
+	}
+	execSQL(t, db, "INSERT INTO users VALUES (30)")
+
+	for _, input := range []string{
+		"ALTER TABLE users DROP COLUMN name",
+		"ALTER TABLE users DROP COLUMN age",
+	} {
+		if _, err := db.Execute(parseSQL(t, input)); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+}
+
+func TestAlterRenameColumn(t *testing.T) {
+	db := setupTestDB(t)
+	execSQL(t, db, "CREATE INDEX users_name ON users (name, id)")
+
+	execSQL(t, db, "ALTER TABLE users RENAME COLUMN id TO user_id")
+	execSQL(t, db, "ALTER TABLE users RENAME name TO full_name")
+
+	table := db.tables["users"]
+	if table.pkColumn != "user_id" {
+		t.Errorf("primary key not renamed. got=%q", table.pkColumn)
+	}
+	if _, exists := table.Indexes["user_id"]; !exists {
+		t.Errorf("key index not renamed: %v", table.Indexes)
+	}
+	if cols := table.Indexes["users_name"].Info().Columns; fmt.Sprint(cols) != "[full_name user_id]" {
+		t.Errorf("index columns not renamed. got=%v", cols)
+	}
+
+	rows := execSQL(t, db, "SELECT * FROM users WHERE user_id = 2").([]Row)
+	if len(rows) != 1 || rows[0]["full_name"] != "Bob" {
+		t.Errorf("wrong rows after RENAME COLUMN: %v", rows)
+	}
+	if _, err := db.Execute(parseSQL(t, "INSERT INTO users VALUES (2, 'Bobby')")); err == nil {
+		t.Error("expected the renamed key to reject duplicates")
+	}
+
+	for _, input := range []string{
+		"ALTER TABLE users RENAME COLUMN id TO ident",
+		"ALTER TABLE users RENAME COLUMN full_name TO user_id",
+	} {
+		if _, err := db.Execute(parseSQL(t, input)); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+}
+
+func TestAlterRenameTable(t *testing.T) {
+	db := setupTestDB(t)
+	execSQL(t, db, "CREATE TABLE orders (id INT)")
+
+	execSQL(t, db, "ALTER TABLE users RENAME TO people")
+
+	if _, exists := db.tables["users"]; exists {
+		t.Error("table still exists under its old name")
+	}
+	rows := execSQL(t, db, "SELECT * FROM people WHERE id = 1").([]Row)
+	if len(rows) != 1 || rows[0]["name"] != "Alice" {
+		t.Errorf("wrong rows after RENAME TO: %v", rows)
+	}
+
+	if _, err := db.Execute(parseSQL(t, "ALTER TABLE people RENAME TO orders")); err == nil {
+		t.Error("expected error renaming onto an existing table")
+	}
+}
+
+func TestAlterRollback(t *testing.T) {
+	db := setupTestDB(t)
+	original := db.tables["users"]
+
+	tx := db.Begin()
+	execTx(t, tx, "INSERT INTO users VALUES (3, 'Carol')")
+	execTx(t, tx, "ALTER TABLE users ADD COLUMN age INT DEFAULT 1")
+	execTx(t, tx, "UPDATE users SET age = 2 WHERE id = 3")
+	execTx(t, tx, "ALTER TABLE users RENAME COLUMN name TO full_name")
+	execTx(t, tx, "ALTER TABLE users RENAME TO people")
+
+	// a failed statement leaves the altered table in place
+	if _, err := tx.Execute(parseSQL(t, "ALTER TABLE people DROP COLUMN missing")); err == nil {
+		t.Fatal("expected error dropping a missing column")
+	}
+	rows := execTx(t, tx, "SELECT * FROM people ORDER BY id").([]Row)
+	if len(rows) != 3 || rows[2]["age"] != 2 || rows[2]["full_name"] != "Carol" {
+		t.Errorf("wrong rows in the transaction: %v", rows)
+	}
+	tx.Rollback()
+
+	if _, exists := db.tables["people"]; exists {
+		t.Error("renamed table left after rollback")
+	}
+	if db.tables["users"] != original || len(original.Schema) != 2 {
+		t.Errorf("original table not restored: %v", original.Schema)
+	}
+	rows = execSQL(t, db, "SELECT * FROM users WHERE name = 'Bob'").([]Row)
+	if len(rows) != 1 || fmt.Sprint(rows[0]) != "map[id:2 name:Bob]" {
+		t.Errorf("wrong rows after rollback: %v", rows)
+	}
+	if rows := execSQL(t, db, "SELECT * FROM users").([]Row); len(rows) != 2 {
+		t.Errorf("expected 2 rows after rollback, got %v", rows)
+	}
+}
+
+func TestAlterSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	db := openDurable(t, dir)
+	execSQL(t, db, "CREATE TABLE users (id INT PRIMARY KEY, name TEXT, age INT)")
+	execSQL(t, db, "INSERT INTO users VALUES (1, 'Alice', 30)")
+	execSQL(t, db, "ALTER TABLE users ADD COLUMN joined TIMESTAMP DEFAULT NOW()")
+	execSQL(t, db, "CHECKPOINT")
+	execSQL(t, db, "ALTER TABLE users ADD COLUMN score DECIMAL(4, 1) DEFAULT 2.5 * 2")
+	execSQL(t, db, "CREATE INDEX users_age ON users (age)")
+	execSQL(t, db, "ALTER TABLE users DROP COLUMN age")
+	execSQL(t, db, "ALTER TABLE users RENAME COLUMN name TO full_name")
+	execSQL(t, db, "ALTER TABLE users RENAME TO people")
+	execSQL(t, db, "INSERT INTO people VALUES (2, 'Bob', NULL, 1)")
+	joined := execSQL(t, db, "SELECT * FROM people WHERE id = 1").([]Row)[0]["joined"]
+	db.Close()
+
+	db = openDurable(t, dir)
+
+	rows := execSQL(t, db, "SELECT * FROM people ORDER BY id").([]Row)
+	if len(rows) != 2 {
+		db.Close()
+		t.Fatalf("expected 2 rows after restart, got %v", rows)
+	}
+	if rows[0]["full_name"] != "Alice" || fmt.Sprint(rows[0]["score"]) != "5.0" || rows[0]["joined"] != joined {
+		t.Errorf("wrong row 1 after restart: %v", rows[0])
+	}
+	if _, exists := rows[0]["age"]; exists {
+		t.Errorf("dropped column back after restart: %v", rows[0])
+	}
+	if _, _, exists := db.findIndex("users_age"); exists {
+		t.Error("index on the dropped column back after restart")
+	}
+	if _, err := db.Execute(parseSQL(t, "INSERT INTO people VALUES (2, 'Bobby', NULL, 1)")); err == nil {
+		t.Error("expected the primary key to survive restart")
+	}
+
+	// a default is part of the schema written by a checkpoint
+	execSQL(t, db, "CHECKPOINT")
+	db.Close()
+	db = openDurable(t, dir)
+	defer db.Close()
+	if col, _ := db.tables["people"].column("score"); col.Default == nil || col.Default.String() != "(2.5 * 2)" {
+		t.Errorf("default lost in the snapshot. got=%v", col.Default)
+	}
+}
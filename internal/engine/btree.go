@@ -0,0 +1,380 @@
+package engine
+
+import "sort"
+
+// max keys per node, nodes other than the root keep at least half of that
+const btreeOrder = 64
+
+const btreeMinKeys = btreeOrder / 2
+
+// B+tree index, values are kept sorted in the leaves so ranges can be scanned in order
+type BTreeIndex struct {
+	IndexInfo
+	root *btreeNode
+}
+
+// internal nodes hold separator keys, keys in children[i] are >= keys[i-1] and < keys[i].
+// leaves hold the values and the row indices for each
+type btreeNode struct {
+	keys     []interface{}
+	rows     [][]int      // leaves only
+	children []*btreeNode // internal nodes only
+}
+
+func (n *btreeNode) isLeaf() bool {
+	return n.children == nil
+}
+
+func NewBTreeIndex(info IndexInfo) *BTreeIndex {
+	info.Using = IndexBTree
+	return &BTreeIndex{
+		IndexInfo: info,
+		root:      &btreeNode{},
+	}
+}
+
+// position of the first key >= value
+func (n *btreeNode) lowerBound(value interface{}) int {
+	return sort.Search(len(n.keys), func(i int) bool {
+		return compareKeys(n.keys[i], value) >= 0
+	})
+}
+
+// child that may contain value
+func (n *btreeNode) childFor(value interface{}) int {
+	return sort.Search(len(n.keys), func(i int) bool {
+		return compareKeys(n.keys[i], value) > 0
+	})
+}
+
+// add a value to the index for a given row index
+func (idx *BTreeIndex) Add(value interface{}, rowIndex int) {
+	sepKey, right := idx.root.insert(value, rowIndex)
+	if right != nil {
+		// root split -> tree grows by one level
+		idx.root = &btreeNode{
+			keys:     []interface{}{sepKey},
+			children: []*btreeNode{idx.root, right},
+		}
+	}
+}
+
+// insert into the subtree, returns the new right sibling and its separator if n split
+func (n *btreeNode) insert(value interface{}, rowIndex int) (interface{}, *btreeNode) {
+	if n.isLeaf() {
+		i := n.lowerBound(value)
+		if i < len(n.keys) && compareKeys(n.keys[i], value) == 0 {
+			n.rows[i] = append(n.rows[i], rowIndex)
+			return nil, nil
+		}
+
+		n.keys = insertAt(n.keys, i, value)
+		n.rows = insertAt(n.rows, i, []int{rowIndex})
+	} else {
+		i := n.childFor(value)
+		sepKey, right := n.children[i].insert(value, rowIndex)
+		if right == nil {
+			return nil, nil
+		}
+
+		n.keys = insertAt(n.keys, i, sepKey)
+		n.children = insertAt(n.children, i+1, right)
+	}
+
+	if len(n.keys) <= btreeOrder {
+		return nil, nil
+	}
+
+	return n.split()
+}
+
+// move the upper half of an overfull node into a new right sibling
+func (n *btreeNode) split() (interface{}, *btreeNode) {
+	mid := len(n.keys) / 2
+	right := &btreeNode{}
+
+	if n.isLeaf() {
+		right.keys = append([]interface{}{}, n.keys[mid:]...)
+		right.rows = append([][]int{}, n.rows[mid:]...)
+		n.keys = n.keys[:mid]
+		n.rows = n.rows[:mid]
+		return right.keys[0], right
+	}
+
+	// the middle separator moves up instead of being copied
+	sepKey := n.keys[mid]
+	right.keys = append([]interface{}{}, n.keys[mid+1:]...)
+	right.children = append([]*btreeNode{}, n.children[mid+1:]...)
+	n.keys = n.keys[:mid]
+	n.children = n.children[:mid+1]
+	return sepKey, right
+}
+
+// remove a value from the index
+func (idx *BTreeIndex) Remove(value interface{}, rowIndex int) {
+	idx.root.remove(value, rowIndex)
+
+	// root with a single child -> tree shrinks by one level
+	if !idx.root.isLeaf() && len(idx.root.keys) == 0 {
+		idx.root = idx.root.children[0]
+	}
+}
+
+func (n *btreeNode) remove(value interface{}, rowIndex int) {
+	if n.isLeaf() {
+		i := n.lowerBound(value)
+		if i == len(n.keys) || compareKeys(n.keys[i], value) != 0 {
+			return
+		}
+
+		for j, ind := range n.rows[i] {
+			if ind == rowIndex {
+				n.rows[i] = append(n.rows[i][:j], n.rows[i][j+1:]...)
+				break
+			}
+		}
+
+		if len(n.rows[i]) == 0 {
+			n.keys = removeAt(n.keys, i)
+			n.rows = removeAt(n.rows, i)
+		}
+		return
+	}
+
+	i := n.childFor(value)
+	n.children[i].remove(value, rowIndex)
+
+	if len(n.children[i].keys) < btreeMinKeys {
+		n.rebalance(i)
+	}
+}
+
+// refill an underfull child from a sibling, or merge it with one
+func (n *btreeNode) rebalance(i int) {
+	child := n.children[i]
+
+	if i > 0 && len(n.children[i-1].keys) > btreeMinKeys {
+		left := n.children[i-1]
+		last := len(left.keys) - 1
+
+		if child.isLeaf() {
+			child.keys = insertAt(child.keys, 0, left.keys[last])
+			child.rows = insertAt(child.rows, 0, left.rows[last])
+			left.rows = left.rows[:last]
+			n.keys[i-1] = child.keys[0]
+		} else {
+			child.keys = insertAt(child.keys, 0, n.keys[i-1])
+			child.children = insertAt(child.children, 0, left.children[last+1])
+			n.keys[i-1] = left.keys[last]
+			left.children = left.children[:last+1]
+		}
+		left.keys = left.keys[:last]
+		return
+	}
+
+	if i < len(n.children)-1 && len(n.children[i+1].keys) > btreeMinKeys {
+		right := n.children[i+1]
+
+		if child.isLeaf() {
+			child.keys = append(child.keys, right.keys[0])
+			child.rows = append(child.rows, right.rows[0])
+			right.rows = removeAt(right.rows, 0)
+			right.keys = removeAt(right.keys, 0)
+			n.keys[i] = right.keys[0]
+		} else {
+			child.keys = append(child.keys, n.keys[i])
+			child.children = append(child.children, right.children[0])
+			n.keys[i] = right.keys[0]
+			right.keys = removeAt(right.keys, 0)
+			right.children = removeAt(right.children, 0)
+		}
+		return
+	}
+
+	// neither sibling can spare a key -> merge with one of them
+	if i == len(n.children)-1 {
+		i--
+	}
+	left, right := n.children[i], n.children[i+1]
+
+	if left.isLeaf() {
+		left.keys = append(left.keys, right.keys...)
+		left.rows = append(left.rows, right.rows...)
+	} else {
+		left.keys = append(append(left.keys, n.keys[i]), right.keys...)
+		left.children = append(left.children, right.children...)
+	}
+
+	n.keys = removeAt(n.keys, i)
+	n.children = removeAt(n.children, i+1)
+}
+
+// return row indices for a given value
+func (idx *BTreeIndex) Lookup(value interface{}) ([]int, error) {
+	return idx.lookup(value), nil
+}
+
+func (idx *BTreeIndex) lookup(value interface{}) []int {
+	n := idx.root
+	for !n.isLeaf() {
+		n = n.children[n.childFor(value)]
+	}
+
+	i := n.lowerBound(value)
+	if i < len(n.keys) && compareKeys(n.keys[i], value) == 0 {
+		return n.rows[i]
+	}
+	return nil
+}
+
+// check if a value exists in the index
+func (idx *BTreeIndex) Exists(value interface{}) (bool, error) {
+	return len(idx.lookup(value)) > 0, nil
+}
+
+// remove every value from the index
+func (idx *BTreeIndex) Clear() {
+	idx.root = &btreeNode{}
+}
+
+// smallest value in the index
+func (idx *BTreeIndex) Min() (interface{}, bool, error) {
+	n := idx.root
+	for !n.isLeaf() {
+		n = n.children[0]
+	}
+
+	if len(n.keys) == 0 {
+		return nil, false, nil
+	}
+	return n.keys[0], true, nil
+}
+
+// largest value in the index
+func (idx *BTreeIndex) Max() (interface{}, bool, error) {
+	n := idx.root
+	for !n.isLeaf() {
+		n = n.children[len(n.children)-1]
+	}
+
+	if len(n.keys) == 0 {
+		return nil, false, nil
+	}
+	return n.keys[len(n.keys)-1], true, nil
+}
+
+func (idx *BTreeIndex) Scan(lo, hi *Bound, descending bool, fn func(value interface{}, rowIndices []int) bool) error {
+	if descending {
+		idx.root.descend(lo, hi, fn)
+	} else {
+		idx.root.ascend(lo, hi, fn)
+	}
+	return nil
+}
+
+// report whether a value is past the upper bound
+func aboveBound(value interface{}, hi *Bound) bool {
+	if hi == nil {
+		return false
+	}
+	cmp := compareKeys(value, hi.Value)
+	return cmp > 0 || cmp == 0 && !hi.Inclusive
+}
+
+// report whether a value is before the lower bound
+func belowBound(value interface{}, lo *Bound) bool {
+	if lo == nil {
+		return false
+	}
+	cmp := compareKeys(value, lo.Value)
+	return cmp < 0 || cmp == 0 && !lo.Inclusive
+}
+
+// visit keys in ascending order, returns false once iteration should stop
+func (n *btreeNode) ascend(lo, hi *Bound, fn func(interface{}, []int) bool) bool {
+	if n.isLeaf() {
+		start := 0
+		if lo != nil {
+			start = n.lowerBound(lo.Value)
+		}
+
+		for i := start; i < len(n.keys); i++ {
+			if belowBound(n.keys[i], lo) {
+				continue // the bound itself when it is exclusive
+			}
+			if aboveBound(n.keys[i], hi) {
+				return false
+			}
+			if !fn(n.keys[i], n.rows[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	start := 0
+	if lo != nil {
+		start = n.childFor(lo.Value)
+	}
+
+	for i := start; i < len(n.children); i++ {
+		// everything in children[i] is >= keys[i-1]
+		if i > 0 && aboveBound(n.keys[i-1], hi) {
+			return false
+		}
+		if !n.children[i].ascend(lo, hi, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// visit keys in descending order, returns false once iteration should stop
+func (n *btreeNode) descend(lo, hi *Bound, fn func(interface{}, []int) bool) bool {
+	if n.isLeaf() {
+		start := len(n.keys) - 1
+		if hi != nil {
+			start = n.childFor(hi.Value) - 1 // last key <= hi
+		}
+
+		for i := start; i >= 0; i-- {
+			if aboveBound(n.keys[i], hi) {
+				continue // the bound itself when it is exclusive
+			}
+			if belowBound(n.keys[i], lo) {
+				return false
+			}
+			if !fn(n.keys[i], n.rows[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	start := len(n.children) - 1
+	if hi != nil {
+		start = n.childFor(hi.Value)
+	}
+
+	for i := start; i >= 0; i-- {
+		// everything in children[i] is < keys[i]
+		if i < len(n.keys) && lo != nil && compareKeys(n.keys[i], lo.Value) <= 0 {
+			return false
+		}
+		if !n.children[i].descend(lo, hi, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+func insertAt[T any](s []T, i int, v T) []T {
+	s = append(s, v)
+	copy(s[i+1:], s[i:])
+	s[i] = v
+	return s
+}
+
+func removeAt[T any](s []T, i int) []T {
+	return append(s[:i], s[i+1:]...)
+}
@@ -0,0 +1,164 @@
+package engine
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// Helper function
+func scanKeys(idx *BTreeIndex, lo, hi *Bound, descending bool) []int {
+	var keys []int
+	idx.Scan(lo, hi, descending, func(value interface{}, _ []int) bool {
+		keys = append(keys, value.(int))
+		return true
+	})
+	return keys
+}
+
+func TestBTreeIndexMatchesReference(t *testing.T) {
+	idx := NewBTreeIndex(IndexInfo{Name: "n", Columns: []string{"n"}})
+	reference := make(map[int][]int)
+	rng := rand.New(rand.NewSource(1))
+
+	// enough operations to split and merge nodes at several levels
+	for i := 0; i < 20000; i++ {
+		key := rng.Intn(3000)
+		if rng.Intn(3) == 0 && len(reference[key]) > 0 {
+			row := reference[key][0]
+			idx.Remove(key, row)
+			reference[key] = reference[key][1:]
+			if len(reference[key]) == 0 {
+				delete(reference, key)
+			}
+		} else {
+			idx.Add(key, i)
+			reference[key] = append(reference[key], i)
+		}
+	}
+
+	var expected []int
+	for key, rows := range reference {
+		expected = append(expected, key)
+		if got := idx.lookup(key); len(got) != len(rows) {
+			t.Fatalf("Lookup(%d) wrong. expected=%v, got=%v", key, rows, got)
+		}
+	}
+	sort.Ints(expected)
+
+	got := scanKeys(idx, nil, nil, false)
+	if len(got) != len(expected) {
+		t.Fatalf("wrong number of keys. expected=%d, got=%d", len(expected), len(got))
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("keys out of order at %d. expected=%d, got=%d", i, expected[i], got[i])
+		}
+	}
+
+	if min, _, _ := idx.Min(); min != expected[0] {
+		t.Errorf("Min wrong. expected=%d, got=%v", expected[0], min)
+	}
+	if max, _, _ := idx.Max(); max != expected[len(expected)-1] {
+		t.Errorf("Max wrong. expected=%d, got=%v", expected[len(expected)-1], max)
+	}
+
+	// remove everything -> empty tree
+	for key, rows := range reference {
+		for _, row := range rows {
+			idx.Remove(key, row)
+		}
+	}
+	if _, ok, _ := idx.Min(); ok {
+		t.Error("expected empty index after removing every key")
+	}
+	if !idx.root.isLeaf() {
+		t.Error("expected tree to shrink back to a single leaf")
+	}
+}
+
+func TestBTreeIndexScanBounds(t *testing.T) {
+	idx := NewBTreeIndex(IndexInfo{Name: "n", Columns: []string{"n"}})
+	for i := 0; i < 500; i += 5 {
+		idx.Add(i, i)
+	}
+
+	tests := []struct {
+		name       string
+		lo, hi     *Bound
+		descending bool
+		first      int
+		last       int
+		count      int
+	}{
+		{"inclusive", &Bound{Value: 100, Inclusive: true}, &Bound{Value: 200, Inclusive: true}, false, 100, 200, 21},
+		{"exclusive", &Bound{Value: 100}, &Bound{Value: 200}, false, 105, 195, 19},
+		{"between keys", &Bound{Value: 101, Inclusive: true}, &Bound{Value: 199, Inclusive: true}, false, 105, 195, 19},
+		{"open low", nil, &Bound{Value: 20}, false, 0, 15, 4},
+		{"open high", &Bound{Value: 480}, nil, false, 485, 495, 3},
+		{"descending", &Bound{Value: 100, Inclusive: true}, &Bound{Value: 200}, true, 195, 100, 20},
+		{"descending open", nil, nil, true, 495, 0, 100},
+		{"empty", &Bound{Value: 201}, &Bound{Value: 204}, false, 0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		keys := scanKeys(idx, tt.lo, tt.hi, tt.descending)
+		if len(keys) != tt.count {
+			t.Errorf("%s: wrong number of keys. expected=%d, got=%d", tt.name, tt.count, len(keys))
+			continue
+		}
+		if tt.count > 0 && (keys[0] != tt.first || keys[len(keys)-1] != tt.last) {
+			t.Errorf("%s: wrong range. expected=%d..%d, got=%d..%d", tt.name, tt.first, tt.last, keys[0], keys[len(keys)-1])
+		}
+	}
+
+	// iteration stops when fn returns false
+	var visited int
+	idx.Scan(nil, nil, false, func(interface{}, []int) bool {
+		visited++
+		return visited < 3
+	})
+	if visited != 3 {
+		t.Errorf("scan did not stop early. visited=%d", visited)
+	}
+}
+
+func TestExecuteSelectRangeUsesOrderedIndex(t *testing.T) {
+	db := NewDB()
+	execSQL(t, db, "CREATE TABLE events (id INT PRIMARY KEY, name TEXT)")
+	for _, stmt := range []string{
+		"INSERT INTO events VALUES (5, 'e')",
+		"INSERT INTO events VALUES (1, 'a')",
+		"INSERT INTO events VALUES (3, 'c')",
+		"INSERT INTO events VALUES (4, 'd')",
+		"INSERT INTO events VALUES (2, 'b')",
+	} {
+		execSQL(t, db, stmt)
+	}
+
+	table := db.tables["events"]
+	candidates, indexed, err := indexCandidates(table, parseWhere(t, "id > 1 AND 4 >= id AND name != 'x'"))
+	if err != nil || !indexed {
+		t.Fatal("expected range condition to use the primary key index")
+	}
+	if len(candidates) != 3 {
+		t.Errorf("wrong number of candidates. expected=3, got=%d", len(candidates))
+	}
+
+	if _, indexed, _ := indexCandidates(table, parseWhere(t, "id > 1 OR name = 'a'")); indexed {
+		t.Error("OR condition must not use an index")
+	}
+
+	results := execSQL(t, db, "SELECT name FROM events WHERE id >= 2 AND id < 5").([]Row)
+	if len(results) != 3 {
+		t.Fatalf("wrong number of results. expected=3, got=%d", len(results))
+	}
+
+	// candidates keep table order
+	expected := []string{"c", "d", "b"}
+	for i, name := range expected {
+		if results[i]["name"] != name {
+			t.Errorf("result %d wrong. expected=%s, got=%v", i, name, results[i]["name"])
+		}
+	}
+}
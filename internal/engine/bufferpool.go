@@ -0,0 +1,195 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// pages kept in memory when Open is not told otherwise, 32 MiB
+const defaultPoolPages = 4096
+
+// fewer frames than this cannot hold the pages one operation pins at a time
+const minPoolPages = 4
+
+// returned by evict when every frame is pinned
+var errPoolFull = errors.New("every page of the buffer pool is in use")
+
+// a page held in memory. pinned pages are in use and stay, the others can be evicted
+type frame struct {
+	id         pageID
+	data       []byte
+	pins       int
+	dirty      bool // changed since it was read, written back before eviction
+	referenced bool // used since the clock hand last passed
+	loaded     bool // holds a page, false for a frame never used
+}
+
+// a bounded cache of the pages of a database file. when every frame is taken, the clock
+// hand sweeps them, clearing the referenced bit of each, and evicts the first unpinned
+// page not used since its last pass, an approximation of least recently used. pages are
+// pinned only while they are read or written, so when every frame is pinned a fetch waits
+// for one to be unpinned
+type bufferPool struct {
+	mu       sync.Mutex // held while a page is looked up or read, statements share the pool
+	unpinned *sync.Cond // signalled when a frame's last pin is released
+	pager    *pager
+	frames   []*frame
+	pages    map[pageID]*frame
+	hand     int
+
+	// counters, for tests
+	reads     int
+	evictions int
+}
+
+func newBufferPool(p *pager, size int) *bufferPool {
+	size = max(size, minPoolPages)
+	pool := &bufferPool{
+		pager:  p,
+		frames: make([]*frame, size),
+		pages:  make(map[pageID]*frame, size),
+	}
+	pool.unpinned = sync.NewCond(&pool.mu)
+	for i := range pool.frames {
+		pool.frames[i] = &frame{data: make([]byte, pageSize)}
+	}
+	return pool
+}
+
+// the page with the given id, pinned until unpin is called. its data must not be kept
+// past that
+func (bp *bufferPool) fetch(id pageID) (*frame, error) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	if f, exists := bp.pages[id]; exists {
+		f.pins++
+		f.referenced = true
+		return f, nil
+	}
+
+	f, err := bp.evict()
+	if err != nil {
+		return nil, err
+	}
+	// another fetch may have read the page while this one waited
+	if loaded, exists := bp.pages[id]; exists {
+		loaded.pins++
+		loaded.referenced = true
+		return loaded, nil
+	}
+	if err := bp.pager.read(id, f.data); err != nil {
+		return nil, err
+	}
+	bp.reads++
+
+	bp.load(f, id)
+	f.pins++
+	return f, nil
+}
+
+func (bp *bufferPool) unpin(f *frame) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	f.pins--
+	if f.pins == 0 {
+		bp.unpinned.Broadcast()
+	}
+}
+
+// replace the contents of a page, it is written to the file when evicted or flushed
+func (bp *bufferPool) write(id pageID, data []byte) error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	f, exists := bp.pages[id]
+	if !exists {
+		var err error
+		if f, err = bp.evict(); err != nil {
+			return err
+		}
+		if loaded, exists := bp.pages[id]; exists {
+			f = loaded
+		} else {
+			bp.load(f, id)
+		}
+	}
+	if f.pins > 0 {
+		return fmt.Errorf("page %d is in use", id)
+	}
+
+	copy(f.data, data)
+	f.dirty = true
+	f.referenced = true
+	return nil
+}
+
+// write every changed page to the file and sync it
+func (bp *bufferPool) flush() error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	for _, f := range bp.frames {
+		if f.loaded && f.dirty {
+			if err := bp.pager.write(f.id, f.data); err != nil {
+				return err
+			}
+			f.dirty = false
+		}
+	}
+	return bp.pager.sync()
+}
+
+// a frame to load a page into, writing back the page it held when needed. waits while
+// every frame is pinned
+func (bp *bufferPool) evict() (*frame, error) {
+	for {
+		f, err := bp.sweep()
+		if err != errPoolFull {
+			return f, err
+		}
+		bp.unpinned.Wait()
+	}
+}
+
+// the next frame the clock hand finds free or not used since its last pass
+func (bp *bufferPool) sweep() (*frame, error) {
+	// two full sweeps clear every referenced bit, a frame still taken after that is pinned
+	for range 2 * len(bp.frames) {
+		f := bp.frames[bp.hand]
+		bp.hand = (bp.hand + 1) % len(bp.frames)
+
+		if !f.loaded {
+			return f, nil
+		}
+		if f.pins > 0 {
+			continue
+		}
+		if f.referenced {
+			f.referenced = false
+			continue
+		}
+
+		if f.dirty {
+			if err := bp.pager.write(f.id, f.data); err != nil {
+				return nil, err
+			}
+			f.dirty = false
+		}
+		delete(bp.pages, f.id)
+		f.loaded = false
+		bp.evictions++
+		return f, nil
+	}
+	return nil, errPoolFull
+}
+
+func (bp *bufferPool) load(f *frame, id pageID) {
+	f.id = id
+	f.loaded = true
+	f.referenced = true
+	f.dirty = false
+	bp.pages[id] = f
+}
@@ -0,0 +1,177 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/raskovnik/rdbms/internal/ast"
+)
+
+// every CHECK constraint of a table, those of its columns first in schema order
+func (t *Table) checks() []ast.CheckConstraint {
+	var checks []ast.CheckConstraint
+	for _, col := range t.Schema {
+		if col.Check != nil {
+			checks = append(checks, *col.Check)
+		}
+	}
+	return append(checks, t.Checks...)
+}
+
+// name the unnamed CHECK constraints of a table being defined and check that each
+// one is a condition on its columns. names are unique in the table -> orders_qty_check,
+// orders_check, orders_check1
+func (tx *Tx) prepareChecks(table *Table) error {
+	names := make(map[string]bool)
+	for _, check := range table.checks() {
+		if check.Name == "" {
+			continue
+		}
+		if names[check.Name] {
+			return fmt.Errorf("constraint %s already exists in table %s", check.Name, table.Name)
+		}
+		names[check.Name] = true
+	}
+
+	unique := func(base string) string {
+		name := base
+		for n := 1; names[name]; n++ {
+			name = base + strconv.Itoa(n)
+		}
+		names[name] = true
+		return name
+	}
+
+	schema := make([]ast.ColumnDef, len(table.Schema))
+	for i, col := range table.Schema {
+		if col.Check != nil && col.Check.Name == "" {
+			check := *col.Check
+			check.Name = unique(table.Name + "_" + col.Name + "_check")
+			col.Check = &check
+		}
+		schema[i] = col
+	}
+	table.Schema = schema
+
+	checks := make([]ast.CheckConstraint, len(table.Checks))
+	for i, check := range table.Checks {
+		if check.Name == "" {
+			check.Name = unique(table.Name + "_check")
+		}
+		checks[i] = check
+	}
+	table.Checks = checks
+
+	for _, check := range table.checks() {
+		if err := tx.checkCondition(table, check); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check that a CHECK constraint reads columns of the table and gives true or false
+func (tx *Tx) checkCondition(table *Table, check ast.CheckConstraint) error {
+	if err := checkExpression(table, check.Expr); err != nil {
+		return fmt.Errorf("invalid CHECK constraint %s: %w", check.Name, err)
+	}
+
+	calls, err := tx.checkSequences(check.Expr)
+	if err == nil && calls {
+		err = fmt.Errorf("NEXTVAL is not allowed")
+	}
+	if err != nil {
+		return fmt.Errorf("invalid CHECK constraint %s: %w", check.Name, err)
+	}
+
+	if !isCondition(table, check.Expr) {
+		return fmt.Errorf("invalid CHECK constraint %s: %s is not a condition", check.Name, check.Expr)
+	}
+	return nil
+}
+
+// report whether an expression gives a boolean -> a comparison, AND, OR, NOT, IS NULL,
+// a BOOL column or TRUE
+func isCondition(table *Table, expr ast.Expression) bool {
+	switch e := expr.(type) {
+	case *ast.BinaryExpression:
+		switch e.Operator {
+		case "+", "-", "*", "/":
+			return false
+		}
+		return true
+	case *ast.UnaryExpression:
+		return e.Operator == "NOT"
+	case *ast.IsNullExpression:
+		return true
+	case *ast.Identifier:
+		col, _ := table.column(e.Name)
+		return col.Type == "BOOL"
+	case *ast.Literal:
+		_, ok := e.Value.(bool)
+		return ok || e.Value == nil
+	}
+	return false
+}
+
+// check rows about to be written to table against its CHECK constraints, a row fails
+// one only when the condition is false
+func (tx *Tx) checkRows(table *Table, rows []Row) error {
+	for _, check := range table.checks() {
+		expr := tx.bind(check.Expr)
+		for _, row := range rows {
+			if passed, known := evalCondition(row, expr); known && !passed {
+				return fmt.Errorf("new row for table %s violates CHECK constraint %s", table.Name, check.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// report whether an expression reads a column
+func usesColumn(expr ast.Expression, column string) bool {
+	switch e := expr.(type) {
+	case *ast.Identifier:
+		return e.Name == column
+	case *ast.UnaryExpression:
+		return usesColumn(e.Operand, column)
+	case *ast.IsNullExpression:
+		return usesColumn(e.Operand, column)
+	case *ast.ExtractExpression:
+		return usesColumn(e.Source, column)
+	case *ast.BinaryExpression:
+		return usesColumn(e.Left, column) || usesColumn(e.Right, column)
+	case *ast.FunctionCall:
+		for _, arg := range e.Args {
+			if usesColumn(arg, column) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// a copy of an expression that reads column to wherever it read column from
+func renameColumn(expr ast.Expression, from, to string) ast.Expression {
+	switch e := expr.(type) {
+	case *ast.Identifier:
+		if e.Name == from {
+			return &ast.Identifier{Name: to}
+		}
+	case *ast.UnaryExpression:
+		return &ast.UnaryExpression{Operator: e.Operator, Operand: renameColumn(e.Operand, from, to)}
+	case *ast.IsNullExpression:
+		return &ast.IsNullExpression{Operand: renameColumn(e.Operand, from, to), Not: e.Not}
+	case *ast.ExtractExpression:
+		return &ast.ExtractExpression{Field: e.Field, Source: renameColumn(e.Source, from, to)}
+	case *ast.BinaryExpression:
+		return &ast.BinaryExpression{Left: renameColumn(e.Left, from, to), Operator: e.Operator, Right: renameColumn(e.Right, from, to)}
+	case *ast.FunctionCall:
+		call := &ast.FunctionCall{Name: e.Name, Args: make([]ast.Expression, len(e.Args))}
+		for i, arg := range e.Args {
+			call.Args[i] = renameColumn(arg, from, to)
+		}
+		return call
+	}
+	return expr
+}
@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckConstraints(t *testing.T) {
+	db := NewDB()
+	execSQL(t, db, "CREATE TABLE items (id INT PRIMARY KEY, qty INT CHECK (qty > 0), price DECIMAL(6,2) CONSTRAINT positive_price CHECK (price >= 0), "+
+		"discount DECIMAL(6,2), CHECK (discount <= price), CHECK (qty < 1000 OR discount IS NULL))")
+
+	table := db.tables["items"]
+	var names []string
+	for _, check := range table.checks() {
+		names = append(names, check.Name)
+	}
+	if strings.Join(names, " ") != "items_qty_check positive_price items_check items_check1" {
+		t.Errorf("wrong constraint names: %v", names)
+	}
+
+	execSQL(t, db, "INSERT INTO items VALUES (1, 5, 10.00, 2.50)")
+	// unknown is not a violation
+	execSQL(t, db, "INSERT INTO items (id, qty) VALUES (2, NULL)")
+
+	tests := []struct {
+		input      string
+		constraint string
+	}{
+		{"INSERT INTO items VALUES (3, 0, 1, NULL)", "items_qty_check"},
+		{"INSERT INTO items VALUES (3, 1, -1, NULL)", "positive_price"},
+		{"INSERT INTO items VALUES (3, 1, 1, 2)", "items_check"},
+		{"INSERT INTO items VALUES (3, 1000, 5, 1)", "items_check1"},
+		{"INSERT INTO items VALUES (3, 1, 1, NULL), (4, -1, 1, NULL)", "items_qty_check"},
+		{"UPDATE items SET qty = -5 WHERE id = 1", "items_qty_check"},
+		{"UPDATE items SET discount = 20 WHERE id = 1", "items_check"},
+	}
+	for _, tt := range tests {
+		_, err := db.Execute(parseSQL(t, tt.input))
+		if err == nil || err.Error() != "new row for table items violates CHECK constraint "+tt.constraint {
+			t.Errorf("wrong error for %q. expected violation of %s, got %v", tt.input, tt.constraint, err)
+		}
+	}
+
+	rows := execSQL(t, db, "SELECT * FROM items ORDER BY id").([]Row)
+	if len(rows) != 2 || rows[0]["qty"] != 5 {
+		t.Errorf("failed statements changed rows: %v", rows)
+	}
+	execSQL(t, db, "UPDATE items SET discount = 5 WHERE id = 1")
+
+	execSQL(t, db, "CREATE SEQUENCE ids")
+	for _, input := range []string{
+		"CREATE TABLE bad (a INT CHECK (b > 0))",
+		"CREATE TABLE bad (a INT CHECK (a + 1))",
+		"CREATE TABLE bad (a INT CHECK (COUNT(*) > 0))",
+		"CREATE TABLE bad (a INT CONSTRAINT c CHECK (a > 0), CONSTRAINT c CHECK (a < 9))",
+		"CREATE TABLE bad (a INT CHECK (a < nextval('ids')))",
+	} {
+		if _, err := db.Execute(parseSQL(t, input)); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+	if _, exists := db.tables["bad"]; exists {
+		t.Error("table created with an invalid CHECK")
+	}
+}
+
+func TestCheckConstraintsFollowAlterTable(t *testing.T) {
+	db := NewDB()
+	execSQL(t, db, "CREATE TABLE todos (id INT PRIMARY KEY, task TEXT CHECK (task != ''), done INT CHECK (done = 0 OR done = 1), CHECK (id > 0 AND done IS NOT NULL))")
+	execSQL(t, db, "INSERT INTO todos VALUES (1, 'write', 0)")
+
+	execSQL(t, db, "ALTER TABLE todos RENAME COLUMN done TO completed")
+	if _, err := db.Execute(parseSQL(t, "UPDATE todos SET completed = 2")); err == nil || !strings.Contains(err.Error(), "todos_done_check") {
+		t.Errorf("CHECK not kept on a renamed column, got %v", err)
+	}
+	if _, err := db.Execute(parseSQL(t, "INSERT INTO todos VALUES (2, 'x', NULL)")); err == nil || !strings.Contains(err.Error(), "todos_check") {
+		t.Errorf("table CHECK does not read the renamed column, got %v", err)
+	}
+
+	// a column used by another constraint stays, one with only its own goes
+	if _, err := db.Execute(parseSQL(t, "ALTER TABLE todos DROP COLUMN completed")); err == nil {
+		t.Error("expected error dropping a column a table CHECK uses, got nil")
+	}
+	execSQL(t, db, "ALTER TABLE todos DROP COLUMN task")
+	execSQL(t, db, "INSERT INTO todos VALUES (2, 1)")
+
+	// the rows already there must pass the CHECK of an added column
+	if _, err := db.Execute(parseSQL(t, "ALTER TABLE todos ADD COLUMN priority INT DEFAULT 0 CHECK (priority > 0)")); err == nil {
+		t.Error("expected error adding a column whose default fails its CHECK, got nil")
+	}
+	execSQL(t, db, "ALTER TABLE todos ADD COLUMN priority INT DEFAULT 1 CHECK (priority > 0)")
+	if _, err := db.Execute(parseSQL(t, "UPDATE todos SET priority = 0")); err == nil || !strings.Contains(err.Error(), "todos_priority_check") {
+		t.Errorf("CHECK of an added column not enforced, got %v", err)
+	}
+
+	execSQL(t, db, "TRUNCATE todos")
+	if _, err := db.Execute(parseSQL(t, "INSERT INTO todos VALUES (3, 5, 1)")); err == nil {
+		t.Error("CHECK lost by TRUNCATE")
+	}
+}
+
+func TestCheckConstraintsSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	db := openDurable(t, dir)
+	execSQL(t, db, "CREATE TABLE a (n INT CHECK (n > 0), m INT, CONSTRAINT m_small CHECK (m < 10))")
+	execSQL(t, db, "CHECKPOINT")
+	execSQL(t, db, "CREATE TABLE b (n INT CHECK (n > 0), m INT, CONSTRAINT m_small CHECK (m < 10))")
+	db.Close()
+
+	db = openDurable(t, dir)
+	defer db.Close()
+	for _, table := range []string{"a", "b"} {
+		if _, err := db.Execute(parseSQL(t, "INSERT INTO "+table+" VALUES (1, 10)")); err == nil || !strings.Contains(err.Error(), "m_small") {
+			t.Errorf("table CHECK of %s lost after restart, got %v", table, err)
+		}
+		if _, err := db.Execute(parseSQL(t, "INSERT INTO "+table+" VALUES (0, 1)")); err == nil || !strings.Contains(err.Error(), table+"_n_check") {
+			t.Errorf("column CHECK of %s lost after restart, got %v", table, err)
+		}
+	}
+}
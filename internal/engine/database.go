@@ -2,67 +2,254 @@ package engine
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"sync"
 
 	"github.com/raskovnik/rdbms/internal/ast"
 )
 
 type Database struct {
-	tables map[string]*Table
-	mu     sync.RWMutex
+	tables    map[string]*Table
+	sequences map[string]*Sequence
+	mu        sync.RWMutex // held by each statement while it runs, shared by reads
+	writeMu   sync.Mutex   // held by the one transaction allowed to write
+
+	// running transactions, the oldest snapshot decides which row versions are dead
+	txMu    sync.Mutex
+	nextXID uint64
+	active  map[uint64]*Tx
+
+	// durable databases only
+	dir          string
+	wal          *wal        // nil for in-memory databases
+	pool         *bufferPool // pages of the database file, nil unless opened with Open
+	stored       *catalog    // what the header of the database file points at
+	lsn          uint64      // last log record applied
+	checkpointMu sync.Mutex
 }
 
 func NewDB() *Database {
 	return &Database{
-		tables: make(map[string]*Table),
+		tables:    make(map[string]*Table),
+		sequences: make(map[string]*Sequence),
+		nextXID:   frozenXID + 1,
+		active:    make(map[uint64]*Tx),
 	}
 }
 
+// open a database that survives restarts, every change is written to a log in dir
+// before it is applied. on startup the last snapshot is loaded and the log replayed
+func NewDurableDB(dir string) (*Database, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	log, err := openWAL(filepath.Join(dir, walFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	db := NewDB()
+	db.dir = dir
+
+	snap, ok, err := readSnapshot(dir)
+	if err != nil {
+		log.close()
+		return nil, err
+	}
+	if ok {
+		db.loadSnapshot(snap)
+	}
+
+	if err := db.replayLog(log); err != nil {
+		log.close()
+		return nil, err
+	}
+
+	db.wal = log
+	return db, nil
+}
+
+// release the files of a durable database
+func (db *Database) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.wal == nil {
+		return nil
+	}
+
+	err := db.wal.close()
+	db.wal = nil
+	if db.pool != nil {
+		if closeErr := db.pool.pager.close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
 type Table struct {
 	Name     string
 	Schema   []ast.ColumnDef
-	Rows     []Row
-	Indexes  map[string]*Index
+	Indexes  map[string]Index      // by index name, key and unique columns use the column name
+	Keys     []ast.KeyConstraint   // keys on several columns, one-column ones are in Schema
+	Checks   []ast.CheckConstraint // table CHECK constraints, column ones are in Schema
 	pkColumn string
+	versions map[int]*rowVersion // version chain of the rows held in memory, by row id
+	ids      int                 // row ids handed out, each below it is a row or free
+	free     []int               // ids of removed rows, reused by later rows
+	store    *heapStore          // rows as of the last checkpoint, nil when every row is in memory
+	pool     *bufferPool         // pages of the database file holding the table, nil in memory
 }
 
 type Row map[string]interface{}
 
 func NewTable(name string, schema []ast.ColumnDef) *Table {
+	return newTable(name, schema, nil)
+}
+
+// a table whose rows and indexes go in the pages of a database file, in memory when
+// pool is nil
+func newTable(name string, schema []ast.ColumnDef, pool *bufferPool) *Table {
 	table := &Table{
-		Name:    name,
-		Schema:  schema,
-		Rows:    []Row{},
-		Indexes: make(map[string]*Index),
+		Name:     name,
+		Schema:   schema,
+		Indexes:  make(map[string]Index),
+		versions: make(map[int]*rowVersion),
+		pool:     pool,
 	}
 
-	// identify the primary key column
+	// identify the primary key column, key and unique columns get an ordered index
 	for _, col := range schema {
 		if col.PrimaryKey {
 			table.pkColumn = col.Name
-			table.Indexes[col.Name] = NewIndex(col.Name)
 		}
-		if col.Unique {
-			table.Indexes[col.Name] = NewIndex(col.Name)
+		if col.PrimaryKey || col.Unique {
+			table.Indexes[col.Name] = table.newIndex(IndexInfo{
+				Name:    col.Name,
+				Columns: []string{col.Name},
+				Unique:  true,
+			})
 		}
 	}
 
 	return table
 }
 
+// set the keys on several columns of a table, each gets an ordered unique index named
+// after the key
+func (t *Table) addKeys(keys []ast.KeyConstraint) {
+	t.Keys = keys
+	for _, key := range keys {
+		t.Indexes[key.Name] = t.newIndex(IndexInfo{
+			Name:    key.Name,
+			Columns: key.Columns,
+			Unique:  true,
+		})
+	}
+}
+
+// create an empty index of the kind the definition asks for, in pages of the database
+// file for a table stored there
+func (t *Table) newIndex(info IndexInfo) Index {
+	if t.pool != nil {
+		return newPagedIndex(info, t.pool, 0)
+	}
+	return newIndex(info)
+}
+
+// the index enforcing the primary key, on one column or several
+func (t *Table) primaryIndex() (Index, bool) {
+	name := t.pkColumn
+	for _, key := range t.Keys {
+		if key.Primary {
+			name = key.Name
+		}
+	}
+	index, exists := t.Indexes[name]
+	return index, name != "" && exists
+}
+
+// a table with the same schema and indexes but no rows
+func (t *Table) emptyCopy() *Table {
+	empty := newTable(t.Name, t.Schema, t.pool)
+	empty.addKeys(t.Keys)
+	empty.Checks = t.Checks
+	for name, index := range t.Indexes {
+		if _, exists := empty.Indexes[name]; !exists {
+			empty.Indexes[name] = empty.newIndex(*index.Info())
+		}
+	}
+	return empty
+}
+
+// find an index on exactly the given column, preferring an ordered one
+func (t *Table) indexOn(column string) (Index, bool) {
+	var found Index
+	for _, index := range t.Indexes {
+		cols := index.Info().Columns
+		if len(cols) != 1 || cols[0] != column {
+			continue
+		}
+		if _, ordered := index.(OrderedIndex); ordered {
+			return index, true
+		}
+		found = index
+	}
+	return found, found != nil
+}
+
+// check if an index was created for a PRIMARY KEY or UNIQUE column or key
+func (t *Table) isConstraintIndex(name string) bool {
+	for _, col := range t.Schema {
+		if col.Name == name && (col.PrimaryKey || col.Unique) {
+			return true
+		}
+	}
+	for _, key := range t.Keys {
+		if key.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// check if the table schema defines a column
+func (t *Table) hasColumn(name string) bool {
+	_, exists := t.column(name)
+	return exists
+}
+
+// look up a column definition by name
+func (t *Table) column(name string) (ast.ColumnDef, bool) {
+	for _, col := range t.Schema {
+		if col.Name == name {
+			return col, true
+		}
+	}
+	return ast.ColumnDef{}, false
+}
+
 func (db *Database) Execute(stmt ast.Statement) (interface{}, error) {
-	switch s := stmt.(type) {
-	case *ast.CreateStatement:
-		return nil, db.executeCreate(s)
-	case *ast.InsertStatement:
-		return nil, db.executeInsert(s)
-	case *ast.SelectStatement:
-		return db.executeSelect(s)
-	case *ast.DeleteStatement:
-		return db.executeDelete(s)
-	case *ast.UpdateStatement:
-		return db.executeUpdate(s)
-	default:
-		return nil, fmt.Errorf("unknown statement type: %T", stmt)
+	switch stmt.(type) {
+	case *ast.CheckpointStatement:
+		return nil, db.Checkpoint()
+	case *ast.BeginStatement, *ast.CommitStatement, *ast.RollbackStatement:
+		return nil, fmt.Errorf("%s is only supported in a session", stmt)
+	}
+
+	// every other statement runs in a transaction of its own
+	tx := db.Begin()
+	res, err := tx.Execute(stmt)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
 	}
+	return res, nil
 }
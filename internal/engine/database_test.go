@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/raskovnik/rdbms/internal/ast"
+	"github.com/raskovnik/rdbms/internal/lexer"
+	"github.com/raskovnik/rdbms/internal/parser"
 )
 
 func TestExecuteCreateTable(t *testing.T) {
@@ -18,7 +20,7 @@ func TestExecuteCreateTable(t *testing.T) {
 		},
 	}
 
-	err := db.executeCreate(stmt)
+	_, err := db.Execute(stmt)
 	if err != nil {
 		t.Fatalf("executeCreate failed: %v", err)
 	}
@@ -58,18 +60,82 @@ func TestExecuteCreateTableDuplicate(t *testing.T) {
 	}
 
 	// First creation should succeed
-	err := db.executeCreate(stmt)
+	_, err := db.Execute(stmt)
 	if err != nil {
 		t.Fatalf("first create failed: %v", err)
 	}
 
 	// Second creation should fail
-	err = db.executeCreate(stmt)
+	_, err = db.Execute(stmt)
 	if err == nil {
 		t.Fatal("expected error for duplicate table, got nil")
 	}
 }
 
+func TestExecuteCreateTableIfNotExists(t *testing.T) {
+	db := setupTestDB(t)
+
+	execSQL(t, db, "CREATE TABLE IF NOT EXISTS users (id INT PRIMARY KEY)")
+	if table := db.tables["users"]; len(table.Schema) != 2 || table.ids != 2 {
+		t.Errorf("existing table was replaced: %v", table.Schema)
+	}
+
+	execSQL(t, db, "CREATE TABLE IF NOT EXISTS orders (id INT PRIMARY KEY)")
+	if _, exists := db.tables["orders"]; !exists {
+		t.Error("missing table was not created")
+	}
+}
+
+func TestExecuteDropTable(t *testing.T) {
+	db := setupTestDB(t)
+
+	execSQL(t, db, "DROP TABLE users")
+	if _, exists := db.tables["users"]; exists {
+		t.Fatal("table still exists after DROP TABLE")
+	}
+	if _, err := db.Execute(parseSQL(t, "SELECT * FROM users")); err == nil {
+		t.Error("expected error selecting from a dropped table")
+	}
+	if _, err := db.Execute(parseSQL(t, "DROP TABLE users")); err == nil {
+		t.Error("expected error dropping a missing table")
+	}
+	execSQL(t, db, "DROP TABLE IF EXISTS users")
+
+	// the name can be used again
+	execSQL(t, db, "CREATE TABLE users (id INT)")
+	if rows := execSQL(t, db, "SELECT * FROM users").([]Row); len(rows) != 0 {
+		t.Errorf("recreated table has rows: %v", rows)
+	}
+}
+
+func TestExecuteTruncate(t *testing.T) {
+	db := setupTestDB(t)
+	execSQL(t, db, "CREATE INDEX users_name ON users (name) USING HASH")
+
+	execSQL(t, db, "TRUNCATE TABLE users")
+
+	table := db.tables["users"]
+	if table.ids != 0 || table.hasRows() {
+		t.Errorf("rows left after TRUNCATE: %v", liveRows(t, table))
+	}
+	if len(table.Indexes) != 2 || indexHas(t, table.Indexes["users_name"], "Alice") || indexHas(t, table.Indexes["id"], 1) {
+		t.Errorf("indexes not reset by TRUNCATE: %v", table.Indexes)
+	}
+
+	// constraints still hold on the emptied table
+	execSQL(t, db, "INSERT INTO users VALUES (1, 'Alice')")
+	if _, err := db.Execute(parseSQL(t, "INSERT INTO users VALUES (1, 'Bob')")); err == nil {
+		t.Error("expected the primary key to survive TRUNCATE")
+	}
+	if rows := execSQL(t, db, "SELECT * FROM users WHERE name = 'Alice'").([]Row); len(rows) != 1 {
+		t.Errorf("wrong rows after TRUNCATE and insert: %v", rows)
+	}
+
+	if _, err := db.Execute(parseSQL(t, "TRUNCATE missing")); err == nil {
+		t.Error("expected error truncating a missing table")
+	}
+}
+
 func TestExecuteInsert(t *testing.T) {
 	db := NewDB()
 
@@ -81,31 +147,31 @@ func TestExecuteInsert(t *testing.T) {
 			{Name: "name", Type: "TEXT"},
 		},
 	}
-	db.executeCreate(createStmt)
+	db.Execute(createStmt)
 
 	// Insert row
 	insertStmt := &ast.InsertStatement{
 		Table:  "users",
-		Values: []interface{}{1, "Alice"},
+		Values: [][]interface{}{{1, "Alice"}},
 	}
 
-	err := db.executeInsert(insertStmt)
+	_, err := db.Execute(insertStmt)
 	if err != nil {
 		t.Fatalf("executeInsert failed: %v", err)
 	}
 
 	// Verify row was added
 	table := db.tables["users"]
-	if len(table.Rows) != 1 {
-		t.Fatalf("wrong number of rows. expected=1, got=%d", len(table.Rows))
+	if table.ids != 1 {
+		t.Fatalf("wrong number of rows. expected=1, got=%d", table.ids)
 	}
 
-	if table.Rows[0]["id"] != 1 {
-		t.Errorf("wrong id. expected=1, got=%v", table.Rows[0]["id"])
+	if tableRow(t, table, 0)["id"] != 1 {
+		t.Errorf("wrong id. expected=1, got=%v", tableRow(t, table, 0)["id"])
 	}
 
-	if table.Rows[0]["name"] != "Alice" {
-		t.Errorf("wrong name. expected=Alice, got=%v", table.Rows[0]["name"])
+	if tableRow(t, table, 0)["name"] != "Alice" {
+		t.Errorf("wrong name. expected=Alice, got=%v", tableRow(t, table, 0)["name"])
 	}
 }
 
@@ -119,27 +185,84 @@ func TestExecuteInsertDuplicatePrimaryKey(t *testing.T) {
 			{Name: "name", Type: "TEXT"},
 		},
 	}
-	db.executeCreate(createStmt)
+	db.Execute(createStmt)
 
 	// Insert first row
 	insertStmt := &ast.InsertStatement{
 		Table:  "users",
-		Values: []interface{}{1, "Alice"},
+		Values: [][]interface{}{{1, "Alice"}},
 	}
-	db.executeInsert(insertStmt)
+	db.Execute(insertStmt)
 
 	// Try to insert duplicate PK
 	insertStmt2 := &ast.InsertStatement{
 		Table:  "users",
-		Values: []interface{}{1, "Bob"},
+		Values: [][]interface{}{{1, "Bob"}},
 	}
 
-	err := db.executeInsert(insertStmt2)
+	_, err := db.Execute(insertStmt2)
 	if err == nil {
 		t.Fatal("expected error for duplicate primary key, got nil")
 	}
 }
 
+func TestExecuteInsertColumnList(t *testing.T) {
+	db := NewDB()
+	execSQL(t, db, "CREATE TABLE todos (id INT PRIMARY KEY, task TEXT NOT NULL, done BOOL NOT NULL DEFAULT FALSE, note TEXT, created_at TIMESTAMP DEFAULT NOW())")
+
+	execSQL(t, db, "INSERT INTO todos (task, id) VALUES ('write tests', 1)")
+	execSQL(t, db, "INSERT INTO todos (id, task, done, note) VALUES (2, 'ship', TRUE, 'soon')")
+
+	rows := execSQL(t, db, "SELECT * FROM todos ORDER BY id").([]Row)
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %v", rows)
+	}
+	if rows[0]["task"] != "write tests" || rows[0]["done"] != false || rows[0]["note"] != nil || rows[0]["created_at"] == nil {
+		t.Errorf("omitted columns not filled from their defaults: %v", rows[0])
+	}
+	if rows[1]["done"] != true || rows[1]["note"] != "soon" {
+		t.Errorf("given values replaced by defaults: %v", rows[1])
+	}
+
+	for _, input := range []string{
+		"INSERT INTO todos (id) VALUES (3)",                        // task is NOT NULL without a default
+		"INSERT INTO todos (id, task) VALUES (3)",                  // too few values
+		"INSERT INTO todos (id, task) VALUES (3, 'a', TRUE)",       // too many values
+		"INSERT INTO todos (id, missing) VALUES (3, 'a')",          // unknown column
+		"INSERT INTO todos (id, task, id) VALUES (3, 'a', 4)",      // column twice
+		"INSERT INTO todos (id, task, done) VALUES (3, 'a', NULL)", // an explicit NULL is not the default
+	} {
+		if _, err := db.Execute(parseSQL(t, input)); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+}
+
+func TestExecuteInsertManyRowsIsAtomic(t *testing.T) {
+	db := setupTestDB(t)
+
+	execSQL(t, db, "INSERT INTO users VALUES (3, 'Carol'), (4, 'Dave'), (5, NULL)")
+	if rows := execSQL(t, db, "SELECT * FROM users").([]Row); len(rows) != 5 {
+		t.Fatalf("expected 5 rows, got %v", rows)
+	}
+
+	// a bad row anywhere in the batch leaves no row behind
+	for _, input := range []string{
+		"INSERT INTO users VALUES (6, 'Eve'), (1, 'Again')",         // duplicate of an existing row
+		"INSERT INTO users VALUES (6, 'Eve'), (7, 'Fay'), (6, 'X')", // duplicate within the batch
+		"INSERT INTO users VALUES (6, 'Eve'), ('seven', 'Fay')",     // wrong type
+		"INSERT INTO users VALUES (6, 'Eve'), (7)",                  // wrong count
+	} {
+		if _, err := db.Execute(parseSQL(t, input)); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+	if rows := execSQL(t, db, "SELECT * FROM users WHERE id > 5").([]Row); len(rows) != 0 {
+		t.Errorf("failed batch left rows behind: %v", rows)
+	}
+	execSQL(t, db, "INSERT INTO users VALUES (6, 'Eve')")
+}
+
 func TestExecuteSelectAll(t *testing.T) {
 	db := setupTestDB(t)
 
@@ -148,7 +271,7 @@ func TestExecuteSelectAll(t *testing.T) {
 		Columns: []string{"*"},
 	}
 
-	results, err := db.executeSelect(stmt)
+	results, err := execSelect(db, stmt)
 	if err != nil {
 		t.Fatalf("executeSelect failed: %v", err)
 	}
@@ -164,14 +287,14 @@ func TestExecuteSelectWithWhere(t *testing.T) {
 	stmt := &ast.SelectStatement{
 		Table:   "users",
 		Columns: []string{"*"},
-		Where: &ast.WhereClause{
-			Column:   "id",
+		Where: &ast.BinaryExpression{
+			Left:     &ast.Identifier{Name: "id"},
 			Operator: "=",
-			Value:    1,
+			Right:    &ast.Literal{Value: 1},
 		},
 	}
 
-	results, err := db.executeSelect(stmt)
+	results, err := execSelect(db, stmt)
 	if err != nil {
 		t.Fatalf("executeSelect failed: %v", err)
 	}
@@ -185,6 +308,24 @@ func TestExecuteSelectWithWhere(t *testing.T) {
 	}
 }
 
+// run a SELECT in its own transaction
+func execSelect(db *Database, stmt *ast.SelectStatement) ([]Row, error) {
+	result, err := db.Execute(stmt)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]Row), nil
+}
+
+// run an UPDATE or DELETE in its own transaction, returning the rows affected
+func execCount(db *Database, stmt ast.Statement) (int, error) {
+	result, err := db.Execute(stmt)
+	if err != nil {
+		return 0, err
+	}
+	return result.(int), nil
+}
+
 // Helper function
 func setupTestDB(t *testing.T) *Database {
 	db := NewDB()
@@ -196,16 +337,16 @@ func setupTestDB(t *testing.T) *Database {
 			{Name: "name", Type: "TEXT"},
 		},
 	}
-	db.executeCreate(createStmt)
+	db.Execute(createStmt)
 
-	db.executeInsert(&ast.InsertStatement{
+	db.Execute(&ast.InsertStatement{
 		Table:  "users",
-		Values: []interface{}{1, "Alice"},
+		Values: [][]interface{}{{1, "Alice"}},
 	})
 
-	db.executeInsert(&ast.InsertStatement{
+	db.Execute(&ast.InsertStatement{
 		Table:  "users",
-		Values: []interface{}{2, "Bob"},
+		Values: [][]interface{}{{2, "Bob"}},
 	})
 
 	return db
@@ -219,14 +360,14 @@ func TestExecuteUpdate(t *testing.T) {
 		Updates: []ast.ColumnUpdate{
 			{Column: "name", Value: "Alice Updated"},
 		},
-		Where: &ast.WhereClause{
-			Column:   "id",
+		Where: &ast.BinaryExpression{
+			Left:     &ast.Identifier{Name: "id"},
 			Operator: "=",
-			Value:    1,
+			Right:    &ast.Literal{Value: 1},
 		},
 	}
 
-	count, err := db.executeUpdate(stmt)
+	count, err := execCount(db, stmt)
 	if err != nil {
 		t.Fatalf("failed: %v", err)
 	}
@@ -236,8 +377,514 @@ func TestExecuteUpdate(t *testing.T) {
 	}
 
 	// Verify
-	row := db.tables["users"].Rows[0]
+	row := tableRow(t, db.tables["users"], 0)
 	if row["name"] != "Alice Updated" {
 		t.Errorf("name not updated")
 	}
 }
+
+func TestExecuteUpdateIsAtomic(t *testing.T) {
+	db := setupTestDB(t)
+	execSQL(t, db, "CREATE UNIQUE INDEX users_name ON users (name)")
+	table := db.tables["users"]
+	rowsBefore := liveRows(t, table)
+
+	tests := []struct {
+		update string
+		reason string
+	}{
+		{"UPDATE users SET id = 2 WHERE id = 1", "duplicate primary key"},
+		{"UPDATE users SET id = 7", "same primary key for several rows"},
+		{"UPDATE users SET name = 'Bob' WHERE id = 1", "duplicate unique index value"},
+		{"UPDATE users SET id = 'x' WHERE id = 1", "wrong type"},
+		{"UPDATE users SET missing = 1", "unknown column"},
+		{"UPDATE users SET name = 'A', name = 'B' WHERE id = 1", "column assigned twice"},
+	}
+
+	for _, tt := range tests {
+		if _, err := db.Execute(parseSQL(t, tt.update)); err == nil {
+			t.Errorf("expected error for %s (%q), got nil", tt.reason, tt.update)
+		}
+	}
+
+	if table.ids != len(rowsBefore) {
+		t.Fatalf("wrong number of rows after failed updates. expected=%d, got=%d", len(rowsBefore), table.ids)
+	}
+	for i, row := range rowsBefore {
+		if !rowsEqual(tableRow(t, table, i), row) {
+			t.Errorf("row %d changed by a failed update. expected=%v, got=%v", i, row, tableRow(t, table, i))
+		}
+		if positions := indexLookup(t, table.Indexes["id"], row["id"]); len(positions) != 1 || positions[0] != i {
+			t.Errorf("primary key index changed by a failed update for id %v: %v", row["id"], positions)
+		}
+	}
+
+	// valid updates still go through afterwards
+	execSQL(t, db, "UPDATE users SET id = 3 WHERE id = 2")
+	execSQL(t, db, "UPDATE users SET name = 'Carol' WHERE id = 3")
+	if rows := execSQL(t, db, "SELECT * FROM users WHERE name = 'Carol'").([]Row); len(rows) != 1 || rows[0]["id"] != 3 {
+		t.Errorf("expected updated row, got %v", rows)
+	}
+}
+
+func TestExecuteBoolColumns(t *testing.T) {
+	db := NewDB()
+	execSQL(t, db, "CREATE TABLE todos (id INT PRIMARY KEY, task TEXT, done BOOL)")
+	execSQL(t, db, "INSERT INTO todos VALUES (1, 'write', TRUE)")
+	execSQL(t, db, "INSERT INTO todos VALUES (2, 'test', FALSE)")
+	execSQL(t, db, "INSERT INTO todos VALUES (3, 'ship', false)")
+
+	tests := []struct {
+		where    string
+		expected int
+	}{
+		{"done = TRUE", 1},
+		{"done = FALSE", 2},
+		{"done != TRUE", 2},
+		{"done", 1},
+		{"NOT done", 2},
+		{"done > FALSE", 1},
+	}
+
+	for _, tt := range tests {
+		rows := execSQL(t, db, "SELECT * FROM todos WHERE "+tt.where).([]Row)
+		if len(rows) != tt.expected {
+			t.Errorf("wrong number of results for %q. expected=%d, got=%d", tt.where, tt.expected, len(rows))
+		}
+	}
+
+	if count := execSQL(t, db, "UPDATE todos SET done = TRUE WHERE done = FALSE").(int); count != 2 {
+		t.Errorf("expected 2 updates, got %d", count)
+	}
+
+	if _, err := db.Execute(parseSQL(t, "INSERT INTO todos VALUES (4, 'x', 1)")); err == nil {
+		t.Error("expected type error for INT in a BOOL column, got nil")
+	}
+	if _, err := db.Execute(parseSQL(t, "INSERT INTO todos VALUES (TRUE, 'x', TRUE)")); err == nil {
+		t.Error("expected type error for BOOL in an INT column, got nil")
+	}
+}
+
+func setupJoinTestDB(t *testing.T) *Database {
+	db := setupTestDB(t)
+
+	createStmt := &ast.CreateStatement{
+		Table: "orders",
+		Columns: []ast.ColumnDef{
+			{Name: "id", Type: "INT", PrimaryKey: true},
+			{Name: "user_id", Type: "INT"},
+			{Name: "total", Type: "INT"},
+		},
+	}
+	if _, err := db.Execute(createStmt); err != nil {
+		t.Fatalf("executeCreate failed: %v", err)
+	}
+
+	orders := [][]interface{}{{10, 1, 100}, {11, 2, 250}, {12, 1, 75}}
+	for _, values := range orders {
+		if _, err := db.Execute(&ast.InsertStatement{Table: "orders", Values: [][]interface{}{values}}); err != nil {
+			t.Fatalf("executeInsert failed: %v", err)
+		}
+	}
+
+	return db
+}
+
+func TestExecuteJoin(t *testing.T) {
+	db := setupJoinTestDB(t)
+
+	stmt := &ast.JoinStatement{
+		LeftTable:  "users",
+		RightTable: "orders",
+		LeftCols:   []string{"name"},
+		RightCols:  []string{"total"},
+		OnLeft:     "id",
+		OnRight:    "user_id",
+	}
+
+	results, err := db.Execute(stmt)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	rows := results.([]Row)
+	if len(rows) != 3 {
+		t.Fatalf("wrong number of results. expected=3, got=%d", len(rows))
+	}
+
+	expected := []Row{
+		{"users.name": "Alice", "orders.total": 100},
+		{"users.name": "Alice", "orders.total": 75},
+		{"users.name": "Bob", "orders.total": 250},
+	}
+	for i, want := range expected {
+		for key, val := range want {
+			if rows[i][key] != val {
+				t.Errorf("row %d %s wrong. expected=%v, got=%v", i, key, val, rows[i][key])
+			}
+		}
+	}
+}
+
+func TestExecuteJoinUsesRightIndex(t *testing.T) {
+	db := setupJoinTestDB(t)
+
+	// join on the right table's primary key -> index lookup instead of hash build
+	stmt := &ast.JoinStatement{
+		LeftTable:  "orders",
+		RightTable: "users",
+		LeftCols:   []string{"id"},
+		RightCols:  []string{"name"},
+		OnLeft:     "user_id",
+		OnRight:    "id",
+	}
+
+	results, err := db.Execute(stmt)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	rows := results.([]Row)
+	if len(rows) != 3 {
+		t.Fatalf("wrong number of results. expected=3, got=%d", len(rows))
+	}
+
+	if rows[1]["orders.id"] != 11 || rows[1]["users.name"] != "Bob" {
+		t.Errorf("wrong joined row. got=%v", rows[1])
+	}
+}
+
+func TestExecuteJoinUnknownColumn(t *testing.T) {
+	db := setupJoinTestDB(t)
+
+	stmt := &ast.JoinStatement{
+		LeftTable:  "users",
+		RightTable: "orders",
+		LeftCols:   []string{"name"},
+		RightCols:  []string{"missing"},
+		OnLeft:     "id",
+		OnRight:    "user_id",
+	}
+
+	if _, err := db.Execute(stmt); err == nil {
+		t.Fatal("expected error for unknown column, got nil")
+	}
+}
+
+// Helper function
+func parseSQL(t *testing.T, input string) ast.Statement {
+	t.Helper()
+
+	stmt, err := parser.New(lexer.New(input)).ParseStatement()
+	if err != nil {
+		t.Fatalf("could not parse %q: %v", input, err)
+	}
+
+	return stmt
+}
+
+// Helper function
+func execSQL(t *testing.T, db *Database, input string) interface{} {
+	t.Helper()
+
+	stmt := parseSQL(t, input)
+	res, err := db.Execute(stmt)
+	if err != nil {
+		t.Fatalf("Execute %q failed: %v", input, err)
+	}
+
+	return res
+}
+
+// the current rows of a table, failing the test when they cannot be read
+func liveRows(t *testing.T, table *Table) []Row {
+	t.Helper()
+
+	rows, err := table.liveRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+// the newest version of a row, failing the test when it cannot be read
+func tableRow(t *testing.T, table *Table, id int) Row {
+	t.Helper()
+
+	row, err := table.row(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return row
+}
+
+// the rows an index holds under key, failing the test when it cannot be read
+func indexLookup(t *testing.T, index Index, key interface{}) []int {
+	t.Helper()
+
+	positions, err := index.Lookup(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return positions
+}
+
+// report whether an index holds key, failing the test when it cannot be read
+func indexHas(t *testing.T, index Index, key interface{}) bool {
+	t.Helper()
+
+	exists, err := index.Exists(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return exists
+}
+
+// Helper function
+func parseWhere(t *testing.T, input string) ast.Expression {
+	t.Helper()
+
+	stmt, err := parser.New(lexer.New("SELECT * FROM t WHERE " + input)).ParseStatement()
+	if err != nil {
+		t.Fatalf("could not parse %q: %v", input, err)
+	}
+
+	return stmt.(*ast.SelectStatement).Where
+}
+
+func TestExecuteSelectWithExpressions(t *testing.T) {
+	db := setupTestDB(t)
+	db.Execute(&ast.InsertStatement{Table: "users", Values: [][]interface{}{{3, "Carol"}}})
+
+	tests := []struct {
+		where    string
+		expected int
+	}{
+		{"id = 1 OR id = 3", 2},
+		{"id > 1 AND name = 'Bob'", 1},
+		{"id = 1 AND name = 'Bob'", 0},
+		{"NOT id = 2", 2},
+		{"(id = 1 OR id = 2) AND NOT name = 'Alice'", 1},
+		{"id >= 2 AND id <= 3", 2},
+		{"name != 'Bob'", 2},
+		{"name < 'Bob'", 1},
+	}
+
+	for _, tt := range tests {
+		results, err := execSelect(db, &ast.SelectStatement{
+			Table:   "users",
+			Columns: []string{"*"},
+			Where:   parseWhere(t, tt.where),
+		})
+		if err != nil {
+			t.Fatalf("executeSelect for %q failed: %v", tt.where, err)
+		}
+
+		if len(results) != tt.expected {
+			t.Errorf("wrong number of results for %q. expected=%d, got=%d", tt.where, tt.expected, len(results))
+		}
+	}
+}
+
+func TestExecuteSelectUnknownWhereColumn(t *testing.T) {
+	db := setupTestDB(t)
+
+	_, err := execSelect(db, &ast.SelectStatement{
+		Table:   "users",
+		Columns: []string{"*"},
+		Where:   parseWhere(t, "id = 1 AND missing = 2"),
+	})
+	if err == nil {
+		t.Fatal("expected error for unknown column, got nil")
+	}
+}
+
+func TestExecuteUpdateAndDeleteWithExpressions(t *testing.T) {
+	db := setupTestDB(t)
+	db.Execute(&ast.InsertStatement{Table: "users", Values: [][]interface{}{{3, "Carol"}}})
+
+	count, err := execCount(db, &ast.UpdateStatement{
+		Table:   "users",
+		Updates: []ast.ColumnUpdate{{Column: "name", Value: "Updated"}},
+		Where:   parseWhere(t, "id = 1 OR id = 3"),
+	})
+	if err != nil {
+		t.Fatalf("executeUpdate failed: %v", err)
+	}
+
+	if count != 2 {
+		t.Errorf("expected 2 updates, got %d", count)
+	}
+
+	count, err = execCount(db, &ast.DeleteStatement{
+		Table: "users",
+		Where: parseWhere(t, "name = 'Updated' AND NOT id = 3"),
+	})
+	if err != nil {
+		t.Fatalf("executeDelete failed: %v", err)
+	}
+
+	if count != 1 {
+		t.Errorf("expected 1 delete, got %d", count)
+	}
+
+	table := db.tables["users"]
+	if rows := liveRows(t, table); len(rows) != 2 {
+		t.Fatalf("wrong number of rows. expected=2, got=%d", len(rows))
+	}
+
+	// the rows left keep their ids, indexes still point at them
+	rows := indexLookup(t, table.Indexes["id"], 3)
+	if len(rows) != 1 || rows[0] != 2 || tableRow(t, table, rows[0])["name"] != "Updated" {
+		t.Errorf("index not updated after delete. got=%v", rows)
+	}
+}
+
+func setupOrderTestDB(t *testing.T) *Database {
+	db := NewDB()
+	execSQL(t, db, "CREATE TABLE todos (id INT PRIMARY KEY, task TEXT, priority INT)")
+	for _, stmt := range []string{
+		"INSERT INTO todos VALUES (3, 'c', 1)",
+		"INSERT INTO todos VALUES (1, 'a', 2)",
+		"INSERT INTO todos VALUES (5, 'e', 1)",
+		"INSERT INTO todos VALUES (2, 'b', 2)",
+		"INSERT INTO todos VALUES (4, 'd', 1)",
+	} {
+		execSQL(t, db, stmt)
+	}
+	return db
+}
+
+func TestExecuteSelectOrderBy(t *testing.T) {
+	db := setupOrderTestDB(t)
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"SELECT task FROM todos ORDER BY id", []string{"a", "b", "c", "d", "e"}},
+		{"SELECT task FROM todos ORDER BY id DESC", []string{"e", "d", "c", "b", "a"}},
+		{"SELECT task FROM todos ORDER BY task DESC", []string{"e", "d", "c", "b", "a"}},
+		{"SELECT task FROM todos ORDER BY priority", []string{"c", "e", "d", "a", "b"}}, // stable
+		{"SELECT task FROM todos ORDER BY priority DESC, id ASC", []string{"a", "b", "c", "d", "e"}},
+		{"SELECT task FROM todos ORDER BY priority, id DESC", []string{"e", "d", "c", "b", "a"}},
+		{"SELECT task FROM todos WHERE id > 1 AND id < 5 ORDER BY id DESC", []string{"d", "c", "b"}},
+		{"SELECT task FROM todos WHERE priority = 1 ORDER BY id DESC", []string{"e", "d", "c"}},
+		{"SELECT task FROM todos WHERE id = 2 ORDER BY task", []string{"b"}},
+	}
+
+	for _, tt := range tests {
+		results := execSQL(t, db, tt.query).([]Row)
+		if len(results) != len(tt.expected) {
+			t.Fatalf("wrong number of results for %q. expected=%d, got=%d", tt.query, len(tt.expected), len(results))
+		}
+		for i, task := range tt.expected {
+			if results[i]["task"] != task {
+				t.Errorf("result %d wrong for %q. expected=%s, got=%v", i, tt.query, task, results[i]["task"])
+			}
+		}
+	}
+
+	// sorting a copy leaves the table in insertion order
+	if tableRow(t, db.tables["todos"], 0)["id"] != 3 {
+		t.Error("ORDER BY reordered the table rows")
+	}
+}
+
+func TestExecuteSelectOrderByUsesIndex(t *testing.T) {
+	db := setupOrderTestDB(t)
+	table := db.tables["todos"]
+
+	orderBy := parseSQL(t, "SELECT * FROM todos ORDER BY id DESC").(*ast.SelectStatement).OrderBy
+	if _, descending, ok := orderIndex(table, orderBy); !ok || !descending {
+		t.Error("expected ORDER BY id DESC to read the primary key index backwards")
+	}
+
+	orderBy = parseSQL(t, "SELECT * FROM todos ORDER BY priority").(*ast.SelectStatement).OrderBy
+	if _, _, ok := orderIndex(table, orderBy); ok {
+		t.Error("expected ORDER BY on an unindexed column to sort")
+	}
+
+	execSQL(t, db, "CREATE INDEX todos_priority_id ON todos (priority, id)")
+	orderBy = parseSQL(t, "SELECT * FROM todos ORDER BY priority DESC, id DESC").(*ast.SelectStatement).OrderBy
+	if _, _, ok := orderIndex(table, orderBy); !ok {
+		t.Error("expected ORDER BY priority, id to use the multi-column index")
+	}
+
+	results := execSQL(t, db, "SELECT task FROM todos ORDER BY priority DESC, id DESC").([]Row)
+	expected := []string{"b", "a", "e", "d", "c"}
+	for i, task := range expected {
+		if results[i]["task"] != task {
+			t.Errorf("result %d wrong. expected=%s, got=%v", i, task, results[i]["task"])
+		}
+	}
+}
+
+func TestExecuteSelectOrderByUnknownColumn(t *testing.T) {
+	db := setupOrderTestDB(t)
+
+	if _, err := db.Execute(parseSQL(t, "SELECT * FROM todos ORDER BY missing")); err == nil {
+		t.Fatal("expected error for unknown ORDER BY column, got nil")
+	}
+}
+
+func TestExecuteSelectLimitOffset(t *testing.T) {
+	db := setupOrderTestDB(t)
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"SELECT task FROM todos ORDER BY id DESC LIMIT 2", []string{"e", "d"}},
+		{"SELECT task FROM todos ORDER BY id DESC LIMIT 2 OFFSET 2", []string{"c", "b"}},
+		{"SELECT task FROM todos ORDER BY id LIMIT 10 OFFSET 3", []string{"d", "e"}},
+		{"SELECT task FROM todos ORDER BY id LIMIT 2 OFFSET 10", []string{}},
+		{"SELECT task FROM todos ORDER BY id LIMIT 0", []string{}},
+		{"SELECT task FROM todos ORDER BY priority, id DESC LIMIT 2", []string{"e", "d"}},
+		{"SELECT task FROM todos LIMIT 2", []string{"c", "a"}},
+		{"SELECT task FROM todos WHERE priority = 2 LIMIT 1 OFFSET 1", []string{"b"}},
+		{"SELECT task FROM todos WHERE id >= 2 ORDER BY id LIMIT 2", []string{"b", "c"}},
+	}
+
+	for _, tt := range tests {
+		results := execSQL(t, db, tt.query).([]Row)
+		if len(results) != len(tt.expected) {
+			t.Fatalf("wrong number of results for %q. expected=%d, got=%d", tt.query, len(tt.expected), len(results))
+		}
+		for i, task := range tt.expected {
+			if results[i]["task"] != task {
+				t.Errorf("result %d wrong for %q. expected=%s, got=%v", i, tt.query, task, results[i]["task"])
+			}
+		}
+	}
+}
+
+func TestScanRowsStopsEarly(t *testing.T) {
+	db := setupOrderTestDB(t)
+	table := db.tables["todos"]
+
+	tx := db.Begin()
+	tx.start(false)
+	defer tx.Rollback()
+
+	// both the ordered index and the plain table scan stop when asked to
+	for _, query := range []string{
+		"SELECT * FROM todos ORDER BY id DESC",
+		"SELECT * FROM todos",
+	} {
+		stmt := parseSQL(t, query).(*ast.SelectStatement)
+
+		visited := 0
+		err := tx.scanRows(table, stmt.Where, stmt.OrderBy, func(int, Row) bool {
+			visited++
+			return visited < 2
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if visited != 2 {
+			t.Errorf("scan for %q visited %d rows after being stopped at 2", query, visited)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/raskovnik/rdbms/internal/datetime"
+)
+
+// report whether a column type holds dates or times
+func isDatetimeType(columnType string) bool {
+	return columnType == "DATE" || columnType == "TIME" || columnType == "TIMESTAMP"
+}
+
+// order two dates, times, timestamps or intervals, a date compares as midnight of
+// that day. ok is false if they are not comparable
+func compareDatetimes(a, b interface{}) (int, bool) {
+	switch av := a.(type) {
+	case datetime.Date:
+		if bv, ok := b.(datetime.Date); ok {
+			return av.Cmp(bv), true
+		}
+		if bv, ok := b.(datetime.Timestamp); ok {
+			return av.Timestamp().Cmp(bv), true
+		}
+	case datetime.Timestamp:
+		if bv, ok := b.(datetime.Timestamp); ok {
+			return av.Cmp(bv), true
+		}
+		if bv, ok := b.(datetime.Date); ok {
+			return av.Cmp(bv.Timestamp()), true
+		}
+	case datetime.Time:
+		if bv, ok := b.(datetime.Time); ok {
+			return av.Cmp(bv), true
+		}
+	case datetime.Interval:
+		if bv, ok := b.(datetime.Interval); ok {
+			return av.Cmp(bv), true
+		}
+	}
+	return 0, false
+}
+
+// apply + - * to dates, times and intervals, nil if the operator does not apply:
+//
+//	TIMESTAMP ± INTERVAL -> TIMESTAMP    TIMESTAMP - TIMESTAMP -> INTERVAL
+//	DATE ± INT (days)    -> DATE         DATE - DATE           -> INT (days)
+//	DATE ± INTERVAL      -> TIMESTAMP    DATE + TIME           -> TIMESTAMP
+//	TIME ± INTERVAL      -> TIME         TIME - TIME           -> INTERVAL
+//	INTERVAL ± INTERVAL  -> INTERVAL     INTERVAL * INT        -> INTERVAL
+func datetimeArithmetic(left interface{}, operator string, right interface{}) interface{} {
+	// put the date or time first -> 1 + DATE '2024-01-15', 2 * INTERVAL '1 day'
+	if operator == "+" || operator == "*" {
+		switch left.(type) {
+		case int, datetime.Interval:
+			switch right.(type) {
+			case datetime.Date, datetime.Timestamp, datetime.Time:
+				left, right = right, left
+			case datetime.Interval:
+				if _, isInt := left.(int); isInt {
+					left, right = right, left
+				}
+			}
+		}
+	}
+
+	switch l := left.(type) {
+	case datetime.Timestamp:
+		switch r := right.(type) {
+		case datetime.Interval:
+			return addInterval(operator, r, l.Add)
+		case datetime.Timestamp:
+			if operator == "-" {
+				return l.Sub(r)
+			}
+		case datetime.Date:
+			if operator == "-" {
+				return l.Sub(r.Timestamp())
+			}
+		}
+	case datetime.Date:
+		switch r := right.(type) {
+		case int:
+			switch operator {
+			case "+":
+				return l.AddDays(r)
+			case "-":
+				return l.AddDays(-r)
+			}
+		case datetime.Interval:
+			return addInterval(operator, r, l.Timestamp().Add)
+		case datetime.Date:
+			if operator == "-" {
+				return l.Sub(r)
+			}
+		case datetime.Timestamp:
+			if operator == "-" {
+				return l.Timestamp().Sub(r)
+			}
+		case datetime.Time:
+			if operator == "+" {
+				return l.Timestamp().Add(datetime.NewInterval(0, 0, r.Duration()))
+			}
+		}
+	case datetime.Time:
+		switch r := right.(type) {
+		case datetime.Interval:
+			return addInterval(operator, r, l.Add)
+		case datetime.Time:
+			if operator == "-" {
+				return l.Sub(r)
+			}
+		case datetime.Date:
+			if operator == "+" {
+				return r.Timestamp().Add(datetime.NewInterval(0, 0, l.Duration()))
+			}
+		}
+	case datetime.Interval:
+		switch r := right.(type) {
+		case datetime.Interval:
+			return addInterval(operator, r, l.Add)
+		case int:
+			if operator == "*" {
+				return l.Mul(r)
+			}
+		}
+	}
+	return nil
+}
+
+// add or subtract an interval with add, nil for any other operator
+func addInterval[T any](operator string, iv datetime.Interval, add func(datetime.Interval) T) interface{} {
+	switch operator {
+	case "+":
+		return add(iv)
+	case "-":
+		return add(iv.Neg())
+	default:
+		return nil
+	}
+}
+
+// convert a value for a DATE, TIME or TIMESTAMP column. strings are parsed, a
+// timestamp stored as a DATE keeps its day and a date stored as a TIMESTAMP is midnight
+func coerceDatetime(columnType string, value interface{}) (interface{}, error) {
+	if s, ok := value.(string); ok {
+		var (
+			parsed interface{}
+			err    error
+		)
+		switch columnType {
+		case "DATE":
+			parsed, err = datetime.ParseDate(s)
+		case "TIME":
+			parsed, err = datetime.ParseTime(s)
+		default:
+			parsed, err = datetime.ParseTimestamp(s)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("value %v is not valid type for %s: %w", value, columnType, err)
+		}
+		return parsed, nil
+	}
+
+	switch v := value.(type) {
+	case datetime.Timestamp:
+		if columnType == "DATE" {
+			return v.Date(), nil
+		}
+	case datetime.Date:
+		if columnType == "TIMESTAMP" {
+			return v.Timestamp(), nil
+		}
+	}
+	return value, nil
+}
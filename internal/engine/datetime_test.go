@@ -0,0 +1,229 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/raskovnik/rdbms/internal/ast"
+)
+
+func setupEventsTestDB(t *testing.T) *Database {
+	db := NewDB()
+	execSQL(t, db, "CREATE TABLE events (id INT PRIMARY KEY, day DATE, starts TIME, created_at TIMESTAMP)")
+	execSQL(t, db, "INSERT INTO events VALUES (1, DATE '2024-01-15', TIME '09:00', TIMESTAMP '2024-01-15 09:30:00')")
+	execSQL(t, db, "INSERT INTO events VALUES (2, '2024-02-29', '18:45:30', '2024-02-29T23:59:59Z')")
+	execSQL(t, db, "INSERT INTO events VALUES (3, TIMESTAMP '2024-03-01 12:00:00', NULL, DATE '2024-03-01')")
+	return db
+}
+
+func TestDatetimeColumns(t *testing.T) {
+	db := setupEventsTestDB(t)
+
+	rows := execSQL(t, db, "SELECT * FROM events ORDER BY id").([]Row)
+	expected := [][]string{
+		{"2024-01-15", "09:00:00", "2024-01-15 09:30:00"},
+		{"2024-02-29", "18:45:30", "2024-02-29 23:59:59"},
+		// a timestamp stored as a DATE keeps its day, a date as a TIMESTAMP is midnight
+		{"2024-03-01", "<nil>", "2024-03-01 00:00:00"},
+	}
+	for i, values := range expected {
+		got := []string{fmt.Sprint(rows[i]["day"]), fmt.Sprint(rows[i]["starts"]), fmt.Sprint(rows[i]["created_at"])}
+		if fmt.Sprint(got) != fmt.Sprint(values) {
+			t.Errorf("row %d wrong. expected=%v, got=%v", i, values, got)
+		}
+	}
+
+	for _, input := range []string{
+		"INSERT INTO events VALUES (4, '2023-02-29', NULL, NULL)",
+		"INSERT INTO events VALUES (4, NULL, '25:00', NULL)",
+		"INSERT INTO events VALUES (4, NULL, NULL, 'yesterday')",
+		"INSERT INTO events VALUES (4, 20240115, NULL, NULL)",
+		"INSERT INTO events VALUES (4, NULL, DATE '2024-01-15', NULL)",
+		"INSERT INTO events VALUES (4, NULL, NULL, INTERVAL '1 day')",
+		"UPDATE events SET day = TRUE WHERE id = 1",
+	} {
+		if _, err := db.Execute(parseSQL(t, input)); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+
+	// the REST layer encodes rows as JSON
+	data, err := json.Marshal(rows[0])
+	if err != nil {
+		t.Fatalf("could not encode row: %v", err)
+	}
+	if want := `{"created_at":"2024-01-15T09:30:00Z","day":"2024-01-15","id":1,"starts":"09:00:00"}`; string(data) != want {
+		t.Errorf("wrong JSON. expected=%s, got=%s", want, data)
+	}
+}
+
+func TestDatetimeExpressions(t *testing.T) {
+	db := setupEventsTestDB(t)
+
+	tests := []struct {
+		where    string
+		expected []int
+	}{
+		{"day = DATE '2024-02-29'", []int{2}},
+		{"created_at >= TIMESTAMP '2024-02-01 00:00:00'", []int{2, 3}},
+		{"created_at < DATE '2024-02-29'", []int{1}},
+		{"day = created_at", []int{3}},
+		{"starts > TIME '12:00'", []int{2}},
+		{"created_at + INTERVAL '1 day' > TIMESTAMP '2024-03-01 00:00:00'", []int{2, 3}},
+		{"created_at - INTERVAL '1 month' < DATE '2024-01-01'", []int{1}},
+		{"day + 1 = DATE '2024-03-01'", []int{2}},
+		{"day - DATE '2024-01-01' = 14", []int{1}},
+		{"created_at - day = INTERVAL '23:59:59'", []int{2}},
+		{"starts + INTERVAL '6 hours' = TIME '03:00'", nil},
+		{"starts + INTERVAL '6 hours' = TIME '00:45:30'", []int{2}},
+		{"day + starts = created_at - INTERVAL '30 minutes'", []int{1}},
+		{"INTERVAL '1 month' = INTERVAL '30 days' AND id = 1", []int{1}},
+		{"DATE_TRUNC('month', created_at) = DATE '2024-02-01'", []int{2}},
+		{"DATE_TRUNC('year', day) = TIMESTAMP '2024-01-01 00:00:00'", []int{1, 2, 3}},
+		{"EXTRACT(YEAR FROM created_at) = 2024 AND EXTRACT(MONTH FROM day) > 1", []int{2, 3}},
+		{"EXTRACT(DOW FROM day) = 1", []int{1}},
+		{"EXTRACT(HOUR FROM starts) < 12", []int{1}},
+		{"EXTRACT(DAY FROM created_at - day) = 0", []int{1, 2, 3}},
+		{"created_at < NOW() AND NOW() - INTERVAL '100 years' < day", []int{1, 2, 3}},
+		{"created_at > NOW()", nil},
+		{"day < CURRENT_DATE AND CURRENT_DATE <= NOW()", []int{1, 2, 3}},
+	}
+
+	for _, tt := range tests {
+		rows := execSQL(t, db, "SELECT * FROM events WHERE "+tt.where+" ORDER BY id").([]Row)
+		if len(rows) != len(tt.expected) {
+			t.Errorf("wrong rows for %q. expected=%v, got=%v", tt.where, tt.expected, rows)
+			continue
+		}
+		for i, id := range tt.expected {
+			if rows[i]["id"] != id {
+				t.Errorf("row %d for %q wrong. expected id=%d, got=%v", i, tt.where, id, rows[i]["id"])
+			}
+		}
+	}
+
+	for _, where := range []string{
+		"TODAY() = day",
+		"NOW(1) > created_at",
+		"DATE_TRUNC('fortnight', created_at) = day",
+		"DATE_TRUNC(created_at) = day",
+		"EXTRACT(CENTURY FROM day) = 21",
+		"DATE_TRUNC('day', missing) = day",
+	} {
+		if _, err := db.Execute(parseSQL(t, "SELECT * FROM events WHERE "+where)); err == nil {
+			t.Errorf("expected error for %q, got nil", where)
+		}
+	}
+}
+
+func TestDatetimeInValuesAndSet(t *testing.T) {
+	db := setupEventsTestDB(t)
+
+	tx := db.Begin()
+	defer tx.Rollback()
+	execTx(t, tx, "INSERT INTO events VALUES (4, CURRENT_DATE, NULL, NOW()), (5, CURRENT_DATE - 1, TIME '09:00' + INTERVAL '90 minutes', TIMESTAMP '2024-01-15 09:30:00' + INTERVAL '1 day')")
+
+	rows := execTx(t, tx, "SELECT * FROM events WHERE id > 3 ORDER BY id").([]Row)
+	if rows[0]["day"] != tx.now.Date() || rows[0]["created_at"] != tx.now {
+		t.Errorf("wrong row from CURRENT_DATE and NOW(): %v", rows[0])
+	}
+	expected := []string{tx.now.Date().AddDays(-1).String(), "10:30:00", "2024-01-16 09:30:00"}
+	if got := []string{fmt.Sprint(rows[1]["day"]), fmt.Sprint(rows[1]["starts"]), fmt.Sprint(rows[1]["created_at"])}; fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("wrong row from interval arithmetic. expected=%v, got=%v", expected, got)
+	}
+
+	// assignments are computed from the row as it was
+	execTx(t, tx, "UPDATE events SET day = created_at + INTERVAL '1 month', created_at = NOW() WHERE id <= 2")
+	rows = execTx(t, tx, "SELECT * FROM events WHERE id <= 2 ORDER BY id").([]Row)
+	for i, day := range []string{"2024-02-15", "2024-03-29"} {
+		if fmt.Sprint(rows[i]["day"]) != day || rows[i]["created_at"] != tx.now {
+			t.Errorf("row %d wrong after UPDATE. expected day=%s, got=%v", i, day, rows[i])
+		}
+	}
+
+	for _, input := range []string{
+		"INSERT INTO events VALUES (6, NULL, NULL, INTERVAL '1 day' + INTERVAL '1 hour')",
+		"INSERT INTO events VALUES (6, NULL, CURRENT_DATE, NULL)",
+		"UPDATE events SET starts = NOW() WHERE id = 1",
+		"UPDATE events SET day = DATE_TRUNC('fortnight', created_at)",
+	} {
+		if _, err := tx.Execute(parseSQL(t, input)); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+}
+
+func TestDatetimeIndexes(t *testing.T) {
+	db := setupEventsTestDB(t)
+	execSQL(t, db, "CREATE INDEX events_created ON events (created_at)")
+	execSQL(t, db, "CREATE INDEX events_day ON events (day) USING HASH")
+
+	// a date finds the timestamp at midnight of that day and the other way around
+	if rows := execSQL(t, db, "SELECT * FROM events WHERE created_at = DATE '2024-03-01'").([]Row); len(rows) != 1 || rows[0]["id"] != 3 {
+		t.Errorf("wrong rows for a date lookup: %v", rows)
+	}
+	if rows := execSQL(t, db, "SELECT * FROM events WHERE day = TIMESTAMP '2024-02-29 00:00:00'").([]Row); len(rows) != 1 || rows[0]["id"] != 2 {
+		t.Errorf("wrong rows for a timestamp lookup: %v", rows)
+	}
+
+	rows := execSQL(t, db, "SELECT * FROM events WHERE created_at > TIMESTAMP '2024-02-01 00:00:00' - INTERVAL '1 month' ORDER BY created_at DESC").([]Row)
+	if len(rows) != 3 || rows[0]["id"] != 3 || rows[2]["id"] != 1 {
+		t.Errorf("wrong rows in created_at order: %v", rows)
+	}
+}
+
+func TestNowIsFixedPerTransaction(t *testing.T) {
+	db := setupEventsTestDB(t)
+
+	tx := db.Begin()
+	defer tx.Rollback()
+	execTx(t, tx, "SELECT * FROM events")
+	started := tx.now
+
+	time.Sleep(2 * time.Millisecond)
+	execTx(t, tx, "SELECT * FROM events WHERE created_at < NOW()")
+	if tx.now != started {
+		t.Errorf("NOW() changed within a transaction: %v then %v", started, tx.now)
+	}
+
+	// NOW() and every part that reads no column is computed once, leaving a comparison
+	// with a literal the planner can use
+	bound := tx.bind(parseWhere(t, "created_at > NOW() - INTERVAL '1 day' AND id = 1 + 1"))
+	and := bound.(*ast.BinaryExpression)
+	for _, cond := range []ast.Expression{and.Left, and.Right} {
+		if _, ok := cond.(*ast.BinaryExpression).Right.(*ast.Literal); !ok {
+			t.Errorf("expected %s to compare with a literal", cond)
+		}
+	}
+	if got := and.Right.String(); got != "(id = 2)" {
+		t.Errorf("wrong folded condition. got=%s", got)
+	}
+}
+
+func TestDatetimeValuesSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	db := openDurable(t, dir)
+	execSQL(t, db, "CREATE TABLE events (id INT PRIMARY KEY, day DATE, starts TIME, created_at TIMESTAMP)")
+	execSQL(t, db, "INSERT INTO events VALUES (1, '2024-01-15', '09:00', '2024-01-15 09:30:00.125')")
+	execSQL(t, db, "CHECKPOINT")
+	execSQL(t, db, "INSERT INTO events VALUES (2, '2024-02-29', '18:45', '2024-02-29 23:59:59')")
+	execSQL(t, db, "UPDATE events SET starts = '10:15' WHERE id = 1")
+	db.Close()
+
+	db = openDurable(t, dir)
+	defer db.Close()
+
+	rows := execSQL(t, db, "SELECT * FROM events ORDER BY id").([]Row)
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows after restart, got %v", rows)
+	}
+	if fmt.Sprint(rows[0]["starts"]) != "10:15:00" || fmt.Sprint(rows[0]["created_at"]) != "2024-01-15 09:30:00.125" {
+		t.Errorf("wrong row 1 after restart: %v", rows[0])
+	}
+	if fmt.Sprint(rows[1]["day"]) != "2024-02-29" {
+		t.Errorf("wrong row 2 after restart: %v", rows[1])
+	}
+}
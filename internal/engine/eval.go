@@ -0,0 +1,241 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/raskovnik/rdbms/internal/ast"
+	"github.com/raskovnik/rdbms/internal/datetime"
+	"github.com/raskovnik/rdbms/internal/decimal"
+)
+
+// check that every column referenced by an expression exists in the table
+func checkExpression(table *Table, expr ast.Expression) error {
+	switch e := expr.(type) {
+	case *ast.Identifier:
+		if !table.hasColumn(e.Name) {
+			return fmt.Errorf("column %s does not exist", e.Name)
+		}
+	case *ast.AggregateExpression:
+		return fmt.Errorf("aggregate function %s is not allowed in WHERE, use HAVING", e)
+	case *ast.UnaryExpression:
+		return checkExpression(table, e.Operand)
+	case *ast.IsNullExpression:
+		return checkExpression(table, e.Operand)
+	case *ast.FunctionCall:
+		if err := checkFunction(e); err != nil {
+			return err
+		}
+		for _, arg := range e.Args {
+			if err := checkExpression(table, arg); err != nil {
+				return err
+			}
+		}
+	case *ast.ExtractExpression:
+		if err := checkExtract(e); err != nil {
+			return err
+		}
+		return checkExpression(table, e.Source)
+	case *ast.BinaryExpression:
+		if err := checkExpression(table, e.Left); err != nil {
+			return err
+		}
+		return checkExpression(table, e.Right)
+	}
+	return nil
+}
+
+// report whether a row satisfies a WHERE condition, a condition that is unknown
+// (NULL) does not
+func evaluateWhere(row Row, where ast.Expression) bool {
+	matched, _ := evalExpression(row, where).(bool)
+	return matched
+}
+
+// evaluate an expression against a row. conditions evaluate to true, false or nil
+// for unknown, which is what comparing with NULL gives (three-valued logic)
+func evalExpression(row Row, expr ast.Expression) interface{} {
+	switch e := expr.(type) {
+	case *ast.Identifier:
+		return row[e.Name]
+	case *ast.Literal:
+		return e.Value
+	case *ast.AggregateExpression:
+		// HAVING is evaluated against a group's output row, which holds the aggregates
+		return row[e.String()]
+	case *ast.UnaryExpression:
+		if e.Operator == "-" {
+			return negate(evalExpression(row, e.Operand))
+		}
+		if e.Operator == "NOT" {
+			// NOT unknown is unknown
+			if value, known := evalCondition(row, e.Operand); known {
+				return !value
+			}
+		}
+		return nil
+	case *ast.IsNullExpression:
+		return (evalExpression(row, e.Operand) == nil) != e.Not
+	case *ast.FunctionCall:
+		args := make([]interface{}, len(e.Args))
+		for i, arg := range e.Args {
+			args[i] = evalExpression(row, arg)
+		}
+		return callFunction(e.Name, args)
+	case *ast.ExtractExpression:
+		return extract(e.Field, evalExpression(row, e.Source))
+	case *ast.BinaryExpression:
+		switch e.Operator {
+		case "AND":
+			// false wins over unknown -> NULL AND false is false
+			left, leftKnown := evalCondition(row, e.Left)
+			right, rightKnown := evalCondition(row, e.Right)
+			if (leftKnown && !left) || (rightKnown && !right) {
+				return false
+			}
+			if !leftKnown || !rightKnown {
+				return nil
+			}
+			return true
+		case "OR":
+			// true wins over unknown -> NULL OR true is true
+			left, leftKnown := evalCondition(row, e.Left)
+			right, rightKnown := evalCondition(row, e.Right)
+			if (leftKnown && left) || (rightKnown && right) {
+				return true
+			}
+			if !leftKnown || !rightKnown {
+				return nil
+			}
+			return false
+		case "+", "-", "*", "/":
+			return arithmetic(evalExpression(row, e.Left), e.Operator, evalExpression(row, e.Right))
+		default:
+			return compare(evalExpression(row, e.Left), e.Operator, evalExpression(row, e.Right))
+		}
+	default:
+		return nil
+	}
+}
+
+// evaluate a condition, known is false when it is unknown
+func evalCondition(row Row, expr ast.Expression) (value bool, known bool) {
+	value, known = evalExpression(row, expr).(bool)
+	return value, known
+}
+
+// apply a comparison operator, values of different types never match but numbers of
+// any type compare by value. comparing with NULL is unknown and gives nil
+func compare(left interface{}, operator string, right interface{}) interface{} {
+	if left == nil || right == nil {
+		return nil
+	}
+
+	cmp, ok := compareValues(left, right)
+	if !ok {
+		return operator == "!="
+	}
+
+	switch operator {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	default:
+		return false
+	}
+}
+
+// order two values of the same type, two numbers or a date and a timestamp -> -1, 0, 1,
+// ok is false if they are not comparable
+func compareValues(a, b interface{}) (int, bool) {
+	if isNumeric(a) && isNumeric(b) {
+		return compareNumbers(a, b), true
+	}
+	if cmp, ok := compareDatetimes(a, b); ok {
+		return cmp, true
+	}
+
+	switch av := a.(type) {
+	case string:
+		if bv, ok := b.(string); ok {
+			return compareOrdered(av, bv), true
+		}
+	case bool:
+		if bv, ok := b.(bool); ok {
+			// false sorts before true
+			switch {
+			case av == bv:
+				return 0, true
+			case !av:
+				return -1, true
+			default:
+				return 1, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// total order over values of any type for index keys, values of different types
+// are ordered by type -> nil, bool, numbers, string, dates and timestamps, times, intervals
+func compareKeys(a, b interface{}) int {
+	if cmp, ok := compareValues(a, b); ok {
+		return cmp
+	}
+
+	// multi-column keys compare column by column
+	if at, ok := a.(Tuple); ok {
+		if bt, ok := b.(Tuple); ok {
+			for i := 0; i < len(at) && i < len(bt); i++ {
+				if cmp := compareKeys(at[i], bt[i]); cmp != 0 {
+					return cmp
+				}
+			}
+			return compareOrdered(len(at), len(bt))
+		}
+	}
+
+	return compareOrdered(typeRank(a), typeRank(b))
+}
+
+func typeRank(value interface{}) int {
+	switch value.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case int, float64, decimal.Decimal:
+		return 2
+	case string:
+		return 3
+	case datetime.Date, datetime.Timestamp:
+		return 4
+	case datetime.Time:
+		return 5
+	case datetime.Interval:
+		return 6
+	case Tuple:
+		return 7
+	default:
+		return 8
+	}
+}
+
+func compareOrdered[T int | float64 | string](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -2,16 +2,22 @@ package engine
 
 import (
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/raskovnik/rdbms/internal/ast"
+	"github.com/raskovnik/rdbms/internal/datetime"
 )
 
-func (db *Database) executeCreate(stmt *ast.CreateStatement) error {
-	db.mu.Lock()
-	defer db.mu.Unlock()
+func (tx *Tx) executeCreate(stmt *ast.CreateStatement) error {
+	db := tx.db
 
 	// check if table already exists
 	if _, exists := db.tables[stmt.Table]; exists {
+		if stmt.IfNotExists {
+			return nil
+		}
 		return fmt.Errorf("table %s already exists", stmt.Table)
 	}
 
@@ -27,70 +33,430 @@ func (db *Database) executeCreate(stmt *ast.CreateStatement) error {
 			pkCount++
 		}
 	}
+	for _, key := range stmt.Keys {
+		if key.Primary {
+			pkCount++
+		}
+	}
 
 	if pkCount > 1 {
 		return fmt.Errorf("table can only have one primary key")
 	}
 
+	// a default must suit its column, one taking a sequence value is only checked
+	// so no value is used up
+	columns := make([]ast.ColumnDef, len(stmt.Columns))
+	for i, col := range stmt.Columns {
+		if col.Serial && col.Default != nil {
+			return fmt.Errorf("SERIAL column %s cannot have a DEFAULT", col.Name)
+		}
+		if col.Default != nil {
+			calls, err := tx.checkDefault(col)
+			if err != nil {
+				return err
+			}
+			if !calls {
+				if _, err := tx.defaultValue(col); err != nil {
+					return err
+				}
+			}
+		}
+		columns[i] = col
+	}
+
+	// the columns of a primary key cannot be NULL, whether it has one column or several
+	for _, key := range stmt.Keys {
+		if !key.Primary {
+			continue
+		}
+		for i := range columns {
+			if slices.Contains(key.Columns, columns[i].Name) {
+				columns[i].NotNull = true
+			}
+		}
+	}
+	keys, err := tx.nameKeys(stmt.Table, columns, stmt.Keys)
+	if err != nil {
+		return err
+	}
+
+	// constraints may name columns of the table being created
+	self := NewTable(stmt.Table, columns)
+	self.Checks = stmt.Checks
+	if err := tx.prepareChecks(self); err != nil {
+		return err
+	}
+	columns = self.Schema
+
+	for i := range columns {
+		if columns[i].References != nil {
+			if err := db.checkForeignKey(self, &columns[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	// SERIAL columns get a sequence, logged before the table that uses it
+	for i := range columns {
+		if columns[i].Serial {
+			if err := tx.createSerial(stmt.Table, &columns[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	tx.saveSchema(stmt.Table)
+	tx.logOps(walOp{Kind: walCreate, Table: stmt.Table, Schema: columns, Keys: keys, Checks: self.Checks})
+
 	// create the table
-	db.tables[stmt.Table] = NewTable(stmt.Table, stmt.Columns)
+	table := newTable(stmt.Table, columns, db.pool)
+	table.addKeys(keys)
+	table.Checks = self.Checks
+	db.tables[stmt.Table] = table
+
+	return nil
+}
+
+// name the indexes of the keys on several columns of a table being created ->
+// orders_pkey, orders_user_id_sku_key. index names are unique across the database
+func (tx *Tx) nameKeys(table string, columns []ast.ColumnDef, keys []ast.KeyConstraint) ([]ast.KeyConstraint, error) {
+	taken := make(map[string]bool)
+	for _, col := range columns {
+		if col.PrimaryKey || col.Unique {
+			taken[col.Name] = true
+		}
+	}
+
+	named := make([]ast.KeyConstraint, len(keys))
+	for i, key := range keys {
+		base := table + "_pkey"
+		if !key.Primary {
+			base = table + "_" + strings.Join(key.Columns, "_") + "_key"
+		}
+		key.Name = base
+		for n := 1; taken[key.Name]; n++ {
+			key.Name = base + strconv.Itoa(n)
+		}
+		if _, _, exists := tx.db.findIndex(key.Name); exists {
+			return nil, fmt.Errorf("index %s already exists", key.Name)
+		}
+		taken[key.Name] = true
+		named[i] = key
+	}
+	return named, nil
+}
 
+func (tx *Tx) executeDropTable(stmt *ast.DropTableStatement) error {
+	if _, exists := tx.db.tables[stmt.Table]; !exists {
+		if stmt.IfExists {
+			return nil
+		}
+		return fmt.Errorf("table %s does not exist", stmt.Table)
+	}
+	if ref, exists := tx.db.referencedBy(stmt.Table); exists {
+		return fmt.Errorf("cannot drop table %s, column %s.%s references it", stmt.Table, ref.table.Name, ref.column.Name)
+	}
+
+	// the table object is kept for a rollback to put back
+	tx.saveSchema(stmt.Table)
+	tx.logOps(walOp{Kind: walDropTable, Table: stmt.Table})
+
+	for _, seq := range tx.db.ownedSequences(stmt.Table) {
+		tx.saveSequence(seq.Name)
+		delete(tx.db.sequences, seq.Name)
+	}
+	delete(tx.db.tables, stmt.Table)
 	return nil
 }
 
-func (db *Database) executeInsert(stmt *ast.InsertStatement) error {
-	db.mu.Lock()
-	defer db.mu.Unlock()
+// remove every row at once by swapping in an empty copy of the table with empty
+// indexes. unlike DELETE, older snapshots no longer see the rows
+func (tx *Tx) executeTruncate(stmt *ast.TruncateStatement) error {
+	table, exists := tx.db.tables[stmt.Table]
+	if !exists {
+		return fmt.Errorf("table %s does not exist", stmt.Table)
+	}
+	if ref, exists := tx.db.referencedBy(table.Name); exists {
+		return fmt.Errorf("cannot truncate table %s, column %s.%s references it", table.Name, ref.table.Name, ref.column.Name)
+	}
+
+	tx.saveSchema(table.Name)
+	tx.logOps(walOp{Kind: walClear, Table: table.Name})
 
-	// insert into users values(a, b, c)
+	tx.db.tables[table.Name] = table.emptyCopy()
+	return nil
+}
+
+func (tx *Tx) executeCreateIndex(stmt *ast.CreateIndexStatement) error {
+	db := tx.db
 
-	// get table
 	table, exists := db.tables[stmt.Table]
 	if !exists {
 		return fmt.Errorf("table %s does not exist", stmt.Table)
 	}
 
-	// validate value count matches schema
-	if len(stmt.Values) != len(table.Schema) {
-		return fmt.Errorf("value count %d does not match column count %d", len(stmt.Values), len(table.Schema))
+	// index names are unique across the database
+	if _, _, exists := db.findIndex(stmt.Name); exists {
+		return fmt.Errorf("index %s already exists", stmt.Name)
 	}
 
-	// create row
-	row := make(Row)
-	for i, col := range table.Schema {
-		value := stmt.Values[i]
+	if len(stmt.Columns) == 0 {
+		return fmt.Errorf("index must have at least one column")
+	}
 
-		// basic type validation
-		if !isValidType(value, col.Type) {
-			return fmt.Errorf("value %v is not valid type for %s", value, col.Type)
+	seen := make(map[string]bool)
+	for _, col := range stmt.Columns {
+		if !table.hasColumn(col) {
+			return fmt.Errorf("column %s does not exist", col)
+		}
+		if seen[col] {
+			return fmt.Errorf("column %s appears more than once in index", col)
 		}
+		seen[col] = true
+	}
+
+	info := IndexInfo{
+		Name:    stmt.Name,
+		Columns: stmt.Columns,
+		Unique:  stmt.Unique,
+		Using:   stmt.Using,
+	}
+
+	// fill the index from existing rows before anything is logged
+	index, err := buildIndex(table, info)
+	if err != nil {
+		return err
+	}
+
+	tx.saveSchema(table.Name)
+	tx.logOps(walOp{Kind: walCreateIndex, Table: table.Name, Index: &info})
+
+	table.Indexes[info.Name] = index
+	return nil
+}
+
+// create an index over the rows already in a table, including versions older
+// snapshots still see. uniqueness is checked between current rows
+func buildIndex(table *Table, info IndexInfo) (Index, error) {
+	index := table.newIndex(info)
+	if err := addVersions(index, table); err != nil {
+		return nil, err
+	}
 
-		row[col.Name] = value
+	if info.Unique {
+		row, err := duplicateRow(table, index)
+		if err != nil {
+			return nil, err
+		}
+		if row != nil {
+			return nil, fmt.Errorf("could not create unique index %s: duplicate value %v", info.Name, info.key(row))
+		}
 	}
 
-	// check constraints before adding row
-	rowIndex := len(table.Rows) // -> index after appending
+	return index, nil
+}
 
-	for colName, index := range table.Indexes {
-		value := row[colName]
+// the first current row whose key in a unique index another current row has too, nil
+// when there is none
+func duplicateRow(table *Table, index Index) (Row, error) {
+	for pos := range table.ids {
+		version, err := table.head(pos)
+		if err != nil {
+			return nil, err
+		}
+		if !version.live() {
+			continue
+		}
 
-		// cehck if value already exists (violates pk or unique)
-		if index.Exists(value) {
-			return fmt.Errorf("duplicate value %v for column %s", value, colName)
+		n, err := table.conflicts(index, version.row)
+		if err != nil {
+			return nil, err
+		}
+		if n > 1 {
+			return version.row, nil
 		}
 	}
+	return nil, nil
+}
 
-	// add row to table
-	table.Rows = append(table.Rows, row)
+func (tx *Tx) executeDropIndex(stmt *ast.DropIndexStatement) error {
+	table, _, exists := tx.db.findIndex(stmt.Name)
+	if !exists {
+		return fmt.Errorf("index %s does not exist", stmt.Name)
+	}
 
-	// update indexes
-	for colName, index := range table.Indexes {
-		value := row[colName]
-		index.Add(value, rowIndex)
+	if table.isConstraintIndex(stmt.Name) {
+		return fmt.Errorf("cannot drop index %s, it enforces the PRIMARY KEY or UNIQUE constraint of %s", stmt.Name, table.Name)
 	}
+
+	tx.saveSchema(table.Name)
+	tx.logOps(walOp{Kind: walDropIndex, Table: table.Name, Index: &IndexInfo{Name: stmt.Name}})
+
+	delete(table.Indexes, stmt.Name)
 	return nil
 }
 
+// find an index by name in any table
+func (db *Database) findIndex(name string) (*Table, Index, bool) {
+	for _, table := range db.tables {
+		if index, exists := table.Indexes[name]; exists {
+			return table, index, true
+		}
+	}
+	return nil, nil, false
+}
+
+func (tx *Tx) executeInsert(stmt *ast.InsertStatement) (interface{}, error) {
+	// insert into users (a, b) values (1, 2), (3, 4)
+
+	// get table
+	table, exists := tx.db.tables[stmt.Table]
+	if !exists {
+		return nil, fmt.Errorf("table %s does not exist", stmt.Table)
+	}
+
+	// without a column list the values cover every column in schema order
+	columns := stmt.Columns
+	if columns == nil {
+		for _, col := range table.Schema {
+			columns = append(columns, col.Name)
+		}
+	}
+
+	given := make(map[string]int, len(columns))
+	for i, name := range columns {
+		if !table.hasColumn(name) {
+			return nil, fmt.Errorf("column %s does not exist", name)
+		}
+		if _, seen := given[name]; seen {
+			return nil, fmt.Errorf("column %s appears more than once in INSERT", name)
+		}
+		given[name] = i
+	}
+
+	for _, col := range stmt.Returning {
+		if col != "*" && !table.hasColumn(col) {
+			return nil, fmt.Errorf("column %s does not exist", col)
+		}
+	}
+
+	for _, values := range stmt.Values {
+		// validate value count matches columns
+		if len(values) != len(columns) {
+			return nil, fmt.Errorf("value count %d does not match column count %d", len(values), len(columns))
+		}
+
+		// an expression reads no column of the row it builds -> nextval('ids'), NOW()
+		for _, value := range values {
+			if err := tx.checkValue(&Table{}, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// build and validate every row before any is added
+	rows := make([]Row, 0, len(stmt.Values))
+	for _, values := range stmt.Values {
+		row := make(Row, len(table.Schema))
+		for _, col := range table.Schema {
+			i, ok := given[col.Name]
+			if !ok {
+				// omitted columns take their default, a sequence gives each row its own
+				value, err := tx.defaultValue(col)
+				if err != nil {
+					return nil, err
+				}
+				row[col.Name] = value
+				continue
+			}
+
+			// basic type validation, numbers are converted to the column's type
+			value, err := tx.columnValue(col, values[i], nil)
+			if err != nil {
+				return nil, err
+			}
+
+			row[col.Name] = value
+		}
+		rows = append(rows, row)
+	}
+
+	if err := tx.checkRows(table, rows); err != nil {
+		return nil, err
+	}
+	if err := tx.checkStorable(table, rows); err != nil {
+		return nil, err
+	}
+
+	// check constraints against the table and the rows before it in the batch, a
+	// failure undoes the rows already added. by name, a row breaking several keys
+	// reports the same one each time
+	indexes := sortedIndexes(table)
+	for _, row := range rows {
+		for _, index := range indexes {
+			info := index.Info()
+
+			// cehck if value already exists (violates pk or unique)
+			if !info.Unique {
+				continue
+			}
+			n, err := table.conflicts(index, row)
+			if err != nil {
+				return nil, err
+			}
+			if n > 0 {
+				return nil, fmt.Errorf("duplicate value %v for %s", info.key(row), describeIndex(info))
+			}
+		}
+
+		// add row to table and indexes
+		tx.insertRow(table, row)
+	}
+
+	// keys are checked once every row is in, a row may reference one added with it
+	if err := tx.checkParents(table, rows); err != nil {
+		return nil, err
+	}
+
+	tx.logOps(walOp{Kind: walInsert, Table: table.Name, Rows: rows})
+
+	if stmt.Returning == nil {
+		return nil, nil
+	}
+	return project(rows, stmt.Returning)
+}
+
+// check a VALUES or SET value against the columns it may read, a literal needs no
+// check
+func (tx *Tx) checkValue(table *Table, value interface{}) error {
+	expr, ok := value.(ast.Expression)
+	if !ok {
+		return nil
+	}
+	if err := checkExpression(table, expr); err != nil {
+		return err
+	}
+	_, err := tx.checkSequences(expr)
+	return err
+}
+
+// the value of col from a VALUES or SET value, an expression is computed against row
+// (nil for an insert) and bound anew each time, like a DEFAULT
+func (tx *Tx) columnValue(col ast.ColumnDef, value interface{}, row Row) (interface{}, error) {
+	if expr, ok := value.(ast.Expression); ok {
+		value = evalExpression(row, tx.bind(expr))
+	}
+	return coerceValue(col, value)
+}
+
+// name a unique index in constraint errors -> column email, index users_by_name
+func describeIndex(info *IndexInfo) string {
+	if len(info.Columns) == 1 && info.Name == info.Columns[0] {
+		return "column " + info.Name
+	}
+	return "index " + info.Name
+}
+
 func isValidType(value interface{}, expectedType string) bool {
 	switch expectedType {
 	case "INT":
@@ -102,60 +468,78 @@ func isValidType(value interface{}, expectedType string) bool {
 	case "BOOL":
 		_, ok := value.(bool)
 		return ok
+	case "DATE":
+		_, ok := value.(datetime.Date)
+		return ok
+	case "TIME":
+		_, ok := value.(datetime.Time)
+		return ok
+	case "TIMESTAMP":
+		_, ok := value.(datetime.Timestamp)
+		return ok
 	default:
 		return false
 	}
 }
 
-func (db *Database) executeSelect(stmt *ast.SelectStatement) ([]Row, error) {
+func (tx *Tx) executeSelect(stmt *ast.SelectStatement) ([]Row, error) {
 	// select */[]columns(string) from tablename() where (optional) condition
 
-	db.mu.Lock()
-	defer db.mu.Unlock()
-
 	// get table
-	table, exists := db.tables[stmt.Table]
+	table, exists := tx.db.tables[stmt.Table]
 	if !exists {
 		return nil, fmt.Errorf("table %s does not exist", stmt.Table)
 	}
 
-	var results []Row
-
-	// if WHERE clause exists and targets an indexed column, use index for better performance
 	if stmt.Where != nil {
-		if index, indexed := table.Indexes[stmt.Where.Column]; indexed {
-			// use index lookup
-			rowIndices := index.Lookup(stmt.Where.Value)
-
-			for _, idx := range rowIndices {
-				row := table.Rows[idx]
-				if evaluateWhere(row, stmt.Where) {
-					results = append(results, row)
-				}
-			}
-		} else {
-			// full table scan
-			for _, row := range table.Rows {
-				if evaluateWhere(row, stmt.Where) {
-					results = append(results, row)
-				}
+		if err := checkExpression(table, stmt.Where); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(stmt.Aggregates) > 0 || len(stmt.GroupBy) > 0 || stmt.Having != nil || hasAggregateOrder(stmt.OrderBy) {
+		return tx.executeAggregate(table, stmt)
+	}
+
+	for _, item := range stmt.OrderBy {
+		if !table.hasColumn(item.Column) {
+			return nil, fmt.Errorf("column %s does not exist", item.Column)
+		}
+	}
+
+	// matching rows in order, through an index when the WHERE or ORDER BY clause allows.
+	// the scan stops as soon as OFFSET + LIMIT rows are produced
+	results := []Row{}
+	skip := stmt.Offset
+	if stmt.Limit == nil || *stmt.Limit > 0 {
+		err := tx.scanRows(table, stmt.Where, stmt.OrderBy, func(_ int, row Row) bool {
+			if skip > 0 {
+				skip--
+				return true
 			}
+			results = append(results, row)
+			return stmt.Limit == nil || len(results) < *stmt.Limit
+		})
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		// no where clause -> return all rows
-		results = table.Rows
 	}
 
+	return project(results, stmt.Columns)
+}
+
+// keep the given columns of each row, all of them for *
+func project(rows []Row, columns []string) ([]Row, error) {
 	// filter columns if not SELECT *
-	if len(stmt.Columns) == 1 && stmt.Columns[0] == "*" {
-		return results, nil
+	if len(columns) == 1 && columns[0] == "*" {
+		return rows, nil
 	}
 
 	// project specific columns
-	projected := make([]Row, len(results))
-	for i, row := range results {
+	projected := make([]Row, len(rows))
+	for i, row := range rows {
 		projectedRow := make(Row)
-		for _, col := range stmt.Columns {
+		for _, col := range columns {
 			if val, exists := row[col]; exists {
 				projectedRow[col] = val
 			} else {
@@ -168,146 +552,321 @@ func (db *Database) executeSelect(stmt *ast.SelectStatement) ([]Row, error) {
 	return projected, nil
 }
 
-func evaluateWhere(row Row, where *ast.WhereClause) bool {
-	value, exists := row[where.Column]
+func (tx *Tx) executeDelete(stmt *ast.DeleteStatement) (int, error) {
+	table, exists := tx.db.tables[stmt.Table]
 	if !exists {
-		return false
+		return 0, fmt.Errorf("table %s does not exist", stmt.Table)
 	}
 
-	switch where.Operator {
-	case "=":
-		return value == where.Value
-	case ">":
-		if intVal, ok := value.(int); ok {
-			if intWhere, ok := where.Value.(int); ok {
-				return intVal > intWhere
-			}
+	if stmt.Where != nil {
+		if err := checkExpression(table, stmt.Where); err != nil {
+			return 0, err
 		}
-		return false
-	case "<":
-		if intVal, ok := value.(int); ok {
-			if intWhere, ok := where.Value.(int); ok {
-				return intVal < intWhere
-			}
+	}
+
+	// find the rows to delete (all rows without WHERE), through an index when possible
+	var positions []int
+	var deletedRows []Row
+	err := tx.scanRows(table, stmt.Where, nil, func(pos int, row Row) bool {
+		positions = append(positions, pos)
+		deletedRows = append(deletedRows, row)
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if len(positions) == 0 {
+		return 0, nil
+	}
+
+	for _, pos := range positions {
+		if err := tx.checkCurrent(table, pos); err != nil {
+			return 0, err
 		}
-		return false
-	default:
-		return false
 	}
+
+	// logged with the rows even without WHERE, rows committed after the snapshot stay
+	tx.logOps(walOp{Kind: walDelete, Table: table.Name, Rows: deletedRows})
+
+	// rows stay in place for older snapshots until they are cleaned up
+	for _, pos := range positions {
+		if err := tx.deleteRow(table, pos); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.applyReferences(table, deletedRows, true); err != nil {
+		return 0, err
+	}
+
+	return len(positions), nil
 }
-func (db *Database) executeDelete(stmt *ast.DeleteStatement) (int, error) {
-	db.mu.Lock()
-	defer db.mu.Unlock()
 
-	table, exists := db.tables[stmt.Table]
+func (tx *Tx) executeUpdate(stmt *ast.UpdateStatement) (int, error) {
+	table, exists := tx.db.tables[stmt.Table]
 	if !exists {
 		return 0, fmt.Errorf("table %s does not exist", stmt.Table)
 	}
 
-	// DELETE FROM table (no WHERE clause) - delete all
-	if stmt.Where == nil {
-		deletedCount := len(table.Rows)
-		table.Rows = []Row{}
-		// Clear all indexes
-		for _, index := range table.Indexes {
-			index.Data = make(map[interface{}][]int)
+	if stmt.Where != nil {
+		if err := checkExpression(table, stmt.Where); err != nil {
+			return 0, err
 		}
-		return deletedCount, nil
 	}
 
-	// Filter out rows that match WHERE condition
-	var newRows []Row
-	deletedCount := 0
+	// validate the new values against the schema before touching any row
+	assigned := make(map[string]bool, len(stmt.Updates))
+	values := make(map[string]interface{}, len(stmt.Updates))
+	for _, update := range stmt.Updates {
+		col, exists := table.column(update.Column)
+		if !exists {
+			return 0, fmt.Errorf("column %s does not exist", update.Column)
+		}
+		if assigned[col.Name] {
+			return 0, fmt.Errorf("column %s is assigned more than once", col.Name)
+		}
+		assigned[col.Name] = true
 
-	// Use index if available for optimization
-	if index, indexed := table.Indexes[stmt.Where.Column]; indexed {
-		// Build set of row indices to delete
-		toDelete := make(map[int]bool)
-		candidates := index.Lookup(stmt.Where.Value)
-		for _, idx := range candidates {
-			if evaluateWhere(table.Rows[idx], stmt.Where) {
-				toDelete[idx] = true
+		// an expression is computed for each row below, from the row as it was
+		if _, computed := update.Value.(ast.Expression); computed {
+			if err := tx.checkValue(table, update.Value); err != nil {
+				return 0, err
 			}
+			values[col.Name] = update.Value
+			continue
 		}
 
-		// Keep rows that aren't in toDelete set
-		for i, row := range table.Rows {
-			if toDelete[i] {
-				deletedCount++
-			} else {
-				newRows = append(newRows, row)
-			}
+		value, err := coerceValue(col, update.Value)
+		if err != nil {
+			return 0, err
 		}
-	} else {
-		// Full table scan - keep rows that don't match
-		for _, row := range table.Rows {
-			if evaluateWhere(row, stmt.Where) {
-				deletedCount++
-			} else {
-				newRows = append(newRows, row)
+		values[col.Name] = value
+	}
+
+	// Find matching rows (all rows without WHERE)
+	var positions []int
+	var oldRows, newRows []Row
+
+	err := tx.scanRows(table, stmt.Where, nil, func(pos int, row Row) bool {
+		positions = append(positions, pos)
+		oldRows = append(oldRows, row)
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if len(positions) == 0 {
+		return 0, nil
+	}
+
+	// build their updated copies, nextval() gives each row its own value
+	for _, row := range oldRows {
+		updated := make(Row, len(row))
+		for col, val := range row {
+			updated[col] = val
+		}
+		for _, update := range stmt.Updates {
+			col, _ := table.column(update.Column)
+			value := values[col.Name]
+			if _, computed := value.(ast.Expression); computed {
+				if value, err = tx.columnValue(col, value, row); err != nil {
+					return 0, err
+				}
 			}
+			updated[col.Name] = value
+		}
+		newRows = append(newRows, updated)
+	}
+
+	for _, pos := range positions {
+		if err := tx.checkCurrent(table, pos); err != nil {
+			return 0, err
 		}
 	}
 
-	// Replace old rows with filtered rows
-	table.Rows = newRows
+	if err := tx.checkRows(table, newRows); err != nil {
+		return 0, err
+	}
+	if err := tx.checkStorable(table, newRows); err != nil {
+		return 0, err
+	}
+	if err := checkUniqueUpdate(table, positions, newRows); err != nil {
+		return 0, err
+	}
+
+	tx.logOps(walOp{Kind: walUpdate, Table: table.Name, Rows: oldRows, New: newRows})
 
-	// Rebuild indexes to reflect new row positions
-	db.rebuildIndexes(table)
+	// the old versions stay for older snapshots until they are cleaned up
+	for i, pos := range positions {
+		if err := tx.updateRow(table, pos, newRows[i]); err != nil {
+			return 0, err
+		}
+	}
+
+	// foreign keys are checked against the table as the statement left it
+	if err := tx.checkParents(table, newRows); err != nil {
+		return 0, err
+	}
+	if err := tx.applyReferences(table, oldRows, false); err != nil {
+		return 0, err
+	}
 
-	return deletedCount, nil
+	return len(positions), nil
 }
 
-func (db *Database) rebuildIndexes(table *Table) {
-	// Clear existing index data
-	for _, index := range table.Indexes {
-		index.Data = make(map[interface{}][]int)
+// check that updating the rows at positions to newRows keeps every unique index
+// unique, both among the updated rows and against the rows left as they are
+func checkUniqueUpdate(table *Table, positions []int, newRows []Row) error {
+	updated := make(map[int]bool, len(positions))
+	for _, pos := range positions {
+		updated[pos] = true
 	}
 
-	// Rebuild indexes from current rows
-	for rowIndex, row := range table.Rows {
-		for colName, index := range table.Indexes {
-			if value, exists := row[colName]; exists {
-				index.Add(value, rowIndex)
+	for _, index := range sortedIndexes(table) {
+		info := index.Info()
+		if !info.Unique {
+			continue
+		}
+
+		seen := make(map[interface{}]bool, len(newRows))
+		for _, row := range newRows {
+			key := info.key(row)
+			if hasNull(key) {
+				continue
+			}
+			if seen[hashKey(key)] {
+				return fmt.Errorf("duplicate value %v for %s", key, describeIndex(info))
+			}
+			seen[hashKey(key)] = true
+
+			positions, err := index.Lookup(key)
+			if err != nil {
+				return err
+			}
+			for _, pos := range positions {
+				head, err := table.head(pos)
+				if err != nil {
+					return err
+				}
+				if !updated[pos] && head.live() && compareKeys(info.key(head.row), key) == 0 {
+					return fmt.Errorf("duplicate value %v for %s", key, describeIndex(info))
+				}
 			}
 		}
 	}
+
+	return nil
 }
 
-func (db *Database) executeUpdate(stmt *ast.UpdateStatement) (int, error) {
-	db.mu.Lock()
-	defer db.mu.Unlock()
+func (tx *Tx) executeJoin(stmt *ast.JoinStatement) ([]Row, error) {
+	// select left.col, right.col from left join right on left.a = right.b
+	db := tx.db
 
-	table, exists := db.tables[stmt.Table]
+	left, exists := db.tables[stmt.LeftTable]
 	if !exists {
-		return 0, fmt.Errorf("table %s does not exist", stmt.Table)
+		return nil, fmt.Errorf("table %s does not exist", stmt.LeftTable)
+	}
+
+	right, exists := db.tables[stmt.RightTable]
+	if !exists {
+		return nil, fmt.Errorf("table %s does not exist", stmt.RightTable)
 	}
 
-	updatedCount := 0
+	// validate the selected and joined columns against each schema
+	if err := checkColumns(left, stmt.LeftCols, stmt.OnLeft); err != nil {
+		return nil, err
+	}
+	if err := checkColumns(right, stmt.RightCols, stmt.OnRight); err != nil {
+		return nil, err
+	}
 
-	// Find and update matching rows
-	if stmt.Where == nil {
-		// Update ALL rows
-		for i := range table.Rows {
-			for _, update := range stmt.Updates {
-				table.Rows[i][update.Column] = update.Value
+	// find matching right rows for a join key, using the right table's index when one
+	// exists, otherwise build a hash table over the right table once (hash join)
+	var matches func(key interface{}) ([]Row, error)
+	if index, indexed := right.indexOn(stmt.OnRight); indexed {
+		matches = func(key interface{}) ([]Row, error) {
+			positions, err := index.Lookup(key)
+			if err != nil {
+				return nil, err
+			}
+			var rows []Row
+			for _, pos := range positions {
+				// the index also holds keys of versions this transaction does not see
+				row, ok, err := tx.visible(right, pos)
+				if err != nil {
+					return nil, err
+				}
+				if ok && compareKeys(row[stmt.OnRight], key) == 0 {
+					rows = append(rows, row)
+				}
 			}
-			updatedCount++
+			return rows, nil
 		}
 	} else {
-		// Update matching rows
-		for i, row := range table.Rows {
-			if evaluateWhere(row, stmt.Where) {
-				for _, update := range stmt.Updates {
-					table.Rows[i][update.Column] = update.Value
-				}
-				updatedCount++
+		buckets := make(map[interface{}][]Row)
+		for pos := range right.ids {
+			row, ok, err := tx.visible(right, pos)
+			if err != nil {
+				return nil, err
 			}
+			if ok {
+				key := hashKey(row[stmt.OnRight])
+				buckets[key] = append(buckets[key], row)
+			}
+		}
+		matches = func(key interface{}) ([]Row, error) {
+			return buckets[hashKey(key)], nil
 		}
 	}
 
-	// Rebuild indexes (values may have changed)
-	db.rebuildIndexes(table)
+	// probe with every left row, preserving left table order
+	var results []Row
+	for pos := range left.ids {
+		leftRow, ok, err := tx.visible(left, pos)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
 
-	return updatedCount, nil
+		// NULL never equals anything, so it joins no rows
+		key := leftRow[stmt.OnLeft]
+		if key == nil {
+			continue
+		}
+
+		rightRows, err := matches(key)
+		if err != nil {
+			return nil, err
+		}
+		for _, rightRow := range rightRows {
+			joined := make(Row, len(stmt.LeftCols)+len(stmt.RightCols))
+			for _, col := range stmt.LeftCols {
+				joined[left.Name+"."+col] = leftRow[col]
+			}
+			for _, col := range stmt.RightCols {
+				joined[right.Name+"."+col] = rightRow[col]
+			}
+			results = append(results, joined)
+		}
+	}
+
+	return results, nil
+}
+
+func checkColumns(table *Table, cols []string, onCol string) error {
+	for _, col := range cols {
+		if !table.hasColumn(col) {
+			return fmt.Errorf("column %s.%s does not exist", table.Name, col)
+		}
+	}
+
+	if !table.hasColumn(onCol) {
+		return fmt.Errorf("column %s.%s does not exist", table.Name, onCol)
+	}
+
+	return nil
 }
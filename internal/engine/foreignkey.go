@@ -0,0 +1,297 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/raskovnik/rdbms/internal/ast"
+)
+
+// a column holding keys of another table's rows, its ColumnDef has References set
+type reference struct {
+	table  *Table
+	column ast.ColumnDef
+}
+
+// check the REFERENCES of a column being defined in table self and name the parent's
+// primary key when it names no column. a table may reference itself
+func (db *Database) checkForeignKey(self *Table, col *ast.ColumnDef) error {
+	fk := *col.References
+
+	parent, exists := db.tables[fk.Table]
+	if fk.Table == self.Name {
+		parent, exists = self, true
+	}
+	if !exists {
+		return fmt.Errorf("table %s referenced by column %s does not exist", fk.Table, col.Name)
+	}
+
+	if fk.Column == "" {
+		if _, hasPK := parent.primaryIndex(); hasPK && parent.pkColumn == "" {
+			return fmt.Errorf("primary key of table %s referenced by column %s has several columns", fk.Table, col.Name)
+		}
+		if parent.pkColumn == "" {
+			return fmt.Errorf("table %s referenced by column %s has no primary key", fk.Table, col.Name)
+		}
+		fk.Column = parent.pkColumn
+	}
+
+	// the parent key must be unique, so a value names one row, and found through its index
+	key, exists := parent.column(fk.Column)
+	if !exists {
+		return fmt.Errorf("column %s referenced by column %s does not exist in table %s", fk.Column, col.Name, fk.Table)
+	}
+	if !key.PrimaryKey && !key.Unique {
+		return fmt.Errorf("column %s.%s referenced by column %s must be a PRIMARY KEY or UNIQUE", fk.Table, fk.Column, col.Name)
+	}
+	if key.Type != col.Type {
+		return fmt.Errorf("column %s of type %s cannot reference %s.%s of type %s", col.Name, col.Type, fk.Table, fk.Column, key.Type)
+	}
+
+	if fk.OnDelete == "SET NULL" && (col.NotNull || col.PrimaryKey) {
+		return fmt.Errorf("column %s cannot be NULL, it cannot use ON DELETE SET NULL", col.Name)
+	}
+
+	col.References = &fk
+	return nil
+}
+
+// the columns referencing a table, its own included, in table and column order so
+// referential actions run and are logged in the same order every time
+func (db *Database) referencing(parent string) []reference {
+	names := make([]string, 0, len(db.tables))
+	for name := range db.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var refs []reference
+	for _, name := range names {
+		table := db.tables[name]
+		for _, col := range table.Schema {
+			if col.References != nil && col.References.Table == parent {
+				refs = append(refs, reference{table: table, column: col})
+			}
+		}
+	}
+	return refs
+}
+
+// report the first table other than parent itself with a column referencing it, a
+// table that others depend on cannot be dropped or emptied at once
+func (db *Database) referencedBy(parent string) (reference, bool) {
+	for _, ref := range db.referencing(parent) {
+		if ref.table.Name != parent {
+			return ref, true
+		}
+	}
+	return reference{}, false
+}
+
+// point the foreign keys naming a renamed table or column at its new name, save is
+// called with each table before its schema changes
+func (db *Database) renameReferences(op walOp, save func(name string)) {
+	for _, ref := range db.referencing(op.Table) {
+		fk := *ref.column.References
+		switch op.Kind {
+		case walRenameTable:
+			fk.Table = op.NewName
+		case walRenameColumn:
+			if fk.Column != op.Column {
+				continue
+			}
+			fk.Column = op.NewName
+		default:
+			return
+		}
+
+		// a rollback puts the saved schema back, so it is copied and not changed
+		table := ref.table
+		save(table.Name)
+
+		schema := make([]ast.ColumnDef, len(table.Schema))
+		copy(schema, table.Schema)
+		for i := range schema {
+			if schema[i].Name == ref.column.Name {
+				schema[i].References = &fk
+			}
+		}
+		table.Schema = schema
+	}
+}
+
+// positions of the current rows whose column holds value, through an index on the
+// column when there is one
+func (t *Table) liveRowsWith(column string, value interface{}) ([]int, error) {
+	var positions []int
+	match := func(pos int) error {
+		head, err := t.head(pos)
+		if err != nil {
+			return err
+		}
+		if head.live() && compareKeys(head.row[column], value) == 0 {
+			positions = append(positions, pos)
+		}
+		return nil
+	}
+
+	if index, exists := t.indexOn(column); exists {
+		candidates, err := index.Lookup(value)
+		if err != nil {
+			return nil, err
+		}
+		for _, pos := range candidates {
+			if err := match(pos); err != nil {
+				return nil, err
+			}
+		}
+		return positions, nil
+	}
+	for pos := range t.ids {
+		if err := match(pos); err != nil {
+			return nil, err
+		}
+	}
+	return positions, nil
+}
+
+// check that every key rows of table hold names a parent row
+func (tx *Tx) checkParents(table *Table, rows []Row) error {
+	for _, col := range table.Schema {
+		if col.References == nil {
+			continue
+		}
+		for _, row := range rows {
+			if err := tx.checkParent(table.Name, col, row[col.Name]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// check that a value of a referencing column names a parent row, NULL names none and
+// is always allowed
+func (tx *Tx) checkParent(table string, col ast.ColumnDef, value interface{}) error {
+	if value == nil {
+		return nil
+	}
+
+	fk := col.References
+	parent, exists := tx.db.tables[fk.Table]
+	var positions []int
+	if exists {
+		var err error
+		if positions, err = parent.liveRowsWith(fk.Column, value); err != nil {
+			return err
+		}
+	}
+	if len(positions) == 0 {
+		return fmt.Errorf("value %v of column %s.%s has no matching row in %s(%s)", value, table, col.Name, fk.Table, fk.Column)
+	}
+	return nil
+}
+
+// run the referential actions for rows that were deleted from table or updated away
+// from their keys, once the statement changed them. a key the table no longer holds
+// must not be left in any referencing row: ON DELETE CASCADE deletes those rows, SET
+// NULL clears their column and RESTRICT fails the statement. updates always restrict
+func (tx *Tx) applyReferences(table *Table, removed []Row, deleted bool) error {
+	for _, ref := range tx.db.referencing(table.Name) {
+		fk := ref.column.References
+		child := ref.table
+
+		// the rows holding a key that is gone, each one once
+		var positions []int
+		seen := make(map[int]bool)
+		for _, row := range removed {
+			key := row[fk.Column]
+			if key == nil {
+				continue
+			}
+			kept, err := table.liveRowsWith(fk.Column, key)
+			if err != nil {
+				return err
+			}
+			if len(kept) > 0 {
+				continue
+			}
+			referencing, err := child.liveRowsWith(ref.column.Name, key)
+			if err != nil {
+				return err
+			}
+			for _, pos := range referencing {
+				if !seen[pos] {
+					seen[pos] = true
+					positions = append(positions, pos)
+				}
+			}
+		}
+		if len(positions) == 0 {
+			continue
+		}
+		sort.Ints(positions)
+
+		action := fk.OnDelete
+		if !deleted {
+			action = "RESTRICT"
+		}
+		rows := make([]Row, len(positions))
+		for i, pos := range positions {
+			row, err := child.row(pos)
+			if err != nil {
+				return err
+			}
+			rows[i] = row
+		}
+
+		if action == "RESTRICT" {
+			key := rows[0][ref.column.Name]
+			verb := "update"
+			if deleted {
+				verb = "delete"
+			}
+			return fmt.Errorf("%s on table %s violates foreign key %s.%s: key %v is still referenced", verb, table.Name, child.Name, ref.column.Name, key)
+		}
+
+		for _, pos := range positions {
+			if err := tx.checkCurrent(child, pos); err != nil {
+				return err
+			}
+		}
+
+		switch action {
+		case "CASCADE":
+			tx.logOps(walOp{Kind: walDelete, Table: child.Name, Rows: rows})
+			for _, pos := range positions {
+				if err := tx.deleteRow(child, pos); err != nil {
+					return err
+				}
+			}
+			if err := tx.applyReferences(child, rows, true); err != nil {
+				return err
+			}
+		case "SET NULL":
+			cleared := make([]Row, len(rows))
+			for i, row := range rows {
+				cleared[i] = withColumn(row, "", ref.column.Name, nil)
+			}
+			if err := tx.checkRows(child, cleared); err != nil {
+				return err
+			}
+
+			tx.logOps(walOp{Kind: walUpdate, Table: child.Name, Rows: rows, New: cleared})
+			for i, pos := range positions {
+				if err := tx.updateRow(child, pos, cleared[i]); err != nil {
+					return err
+				}
+			}
+			if err := tx.applyReferences(child, rows, false); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown ON DELETE action %s", action)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func setupShop(t *testing.T, db *Database) {
+	t.Helper()
+
+	execSQL(t, db, "CREATE TABLE users (id INT PRIMARY KEY, email TEXT UNIQUE)")
+	execSQL(t, db, "CREATE TABLE orders (id INT PRIMARY KEY, user_id INT REFERENCES users ON DELETE CASCADE)")
+	execSQL(t, db, "CREATE TABLE items (id INT PRIMARY KEY, order_id INT, FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE)")
+	execSQL(t, db, "CREATE TABLE reviews (id INT PRIMARY KEY, author TEXT REFERENCES users(email) ON DELETE SET NULL)")
+	execSQL(t, db, "CREATE TABLE invoices (id INT PRIMARY KEY, order_id INT REFERENCES orders(id))")
+
+	execSQL(t, db, "INSERT INTO users VALUES (1, 'ann@example.com'), (2, 'bob@example.com')")
+	execSQL(t, db, "INSERT INTO orders VALUES (10, 1), (11, 1), (12, 2)")
+	execSQL(t, db, "INSERT INTO items VALUES (100, 10), (101, 10), (102, 12)")
+	execSQL(t, db, "INSERT INTO reviews VALUES (1, 'ann@example.com'), (2, 'bob@example.com')")
+}
+
+func countRows(t *testing.T, db *Database, table string) int {
+	t.Helper()
+	return execSQL(t, db, "SELECT COUNT(*) FROM "+table).([]Row)[0]["COUNT(*)"].(int)
+}
+
+func TestForeignKeyChecksParentRows(t *testing.T) {
+	db := NewDB()
+	setupShop(t, db)
+
+	if col, _ := db.tables["orders"].column("user_id"); col.References.Column != "id" {
+		t.Errorf("REFERENCES without a column should name the primary key. got=%+v", col.References)
+	}
+
+	execSQL(t, db, "INSERT INTO orders VALUES (13, NULL)")
+	execSQL(t, db, "UPDATE orders SET user_id = 2 WHERE id = 13")
+
+	for _, input := range []string{
+		"INSERT INTO orders VALUES (14, 3)",
+		"INSERT INTO orders VALUES (14, 1), (15, 3)",
+		"UPDATE orders SET user_id = 3 WHERE id = 13",
+		"INSERT INTO reviews VALUES (3, 'eve@example.com')",
+	} {
+		_, err := db.Execute(parseSQL(t, input))
+		if err == nil || !strings.Contains(err.Error(), "has no matching row") {
+			t.Errorf("expected missing parent error for %q, got %v", input, err)
+		}
+	}
+	if n := countRows(t, db, "orders"); n != 4 {
+		t.Errorf("failed inserts left rows behind, got %d orders", n)
+	}
+
+	// a parent key that rows still hold cannot change, one nobody holds can
+	if _, err := db.Execute(parseSQL(t, "UPDATE users SET id = 5 WHERE id = 1")); err == nil || !strings.Contains(err.Error(), "is still referenced") {
+		t.Errorf("expected referenced key error, got %v", err)
+	}
+	execSQL(t, db, "INSERT INTO users VALUES (3, 'cat@example.com')")
+	execSQL(t, db, "UPDATE users SET id = 4 WHERE id = 3")
+}
+
+func TestForeignKeyOnDelete(t *testing.T) {
+	db := NewDB()
+	setupShop(t, db)
+
+	// orders and their items go with the user, reviews keep their rows without an author
+	execSQL(t, db, "DELETE FROM users WHERE id = 1")
+	if n := countRows(t, db, "orders"); n != 1 {
+		t.Errorf("orders not deleted by cascade, %d left", n)
+	}
+	rows := execSQL(t, db, "SELECT * FROM items").([]Row)
+	if len(rows) != 1 || rows[0]["id"] != 102 {
+		t.Errorf("items not deleted by a cascade two levels deep: %v", rows)
+	}
+	rows = execSQL(t, db, "SELECT * FROM reviews ORDER BY id").([]Row)
+	if len(rows) != 2 || rows[0]["author"] != nil || rows[1]["author"] != "bob@example.com" {
+		t.Errorf("review author not set to NULL: %v", rows)
+	}
+
+	// an invoice restricts deleting its order, and with it the whole cascade
+	execSQL(t, db, "INSERT INTO invoices VALUES (1, 12)")
+	_, err := db.Execute(parseSQL(t, "DELETE FROM users"))
+	if err == nil || !strings.Contains(err.Error(), "delete on table orders violates foreign key invoices.order_id") {
+		t.Errorf("expected RESTRICT error, got %v", err)
+	}
+	if countRows(t, db, "users") != 1 || countRows(t, db, "orders") != 1 || countRows(t, db, "items") != 1 {
+		t.Error("a failed cascade left rows deleted")
+	}
+
+	execSQL(t, db, "DELETE FROM invoices")
+	execSQL(t, db, "DELETE FROM users")
+	for _, table := range []string{"users", "orders", "items"} {
+		if n := countRows(t, db, table); n != 0 {
+			t.Errorf("%d rows left in %s", n, table)
+		}
+	}
+}
+
+func TestForeignKeySelfReference(t *testing.T) {
+	db := NewDB()
+	execSQL(t, db, "CREATE TABLE staff (id INT PRIMARY KEY, manager INT REFERENCES staff(id) ON DELETE CASCADE)")
+
+	// a row may reference one added in the same statement, or itself
+	execSQL(t, db, "INSERT INTO staff VALUES (2, 1), (1, 1), (3, 2), (4, NULL)")
+
+	execSQL(t, db, "DELETE FROM staff WHERE id = 2")
+	rows := execSQL(t, db, "SELECT * FROM staff ORDER BY id").([]Row)
+	if len(rows) != 2 || rows[0]["id"] != 1 || rows[1]["id"] != 4 {
+		t.Errorf("wrong rows after a cascade within the table: %v", rows)
+	}
+
+	execSQL(t, db, "DELETE FROM staff WHERE id = 1")
+	if n := countRows(t, db, "staff"); n != 1 {
+		t.Errorf("row referencing itself not deleted, %d rows left", n)
+	}
+}
+
+func TestForeignKeySchemaChanges(t *testing.T) {
+	db := NewDB()
+	setupShop(t, db)
+	execSQL(t, db, "INSERT INTO invoices VALUES (1, 12)")
+
+	for _, input := range []string{
+		"CREATE TABLE bad (id INT REFERENCES missing(id))",
+		"CREATE TABLE bad (id INT REFERENCES orders(user_id))",
+		"CREATE TABLE bad (id TEXT REFERENCES users(id))",
+		"CREATE TABLE bad (id INT NOT NULL REFERENCES users ON DELETE SET NULL)",
+		"CREATE TABLE bad (id INT REFERENCES bad)",
+		"DROP TABLE users",
+		"TRUNCATE TABLE orders",
+		"ALTER TABLE users DROP COLUMN email",
+		"ALTER TABLE invoices ADD COLUMN user_id INT DEFAULT 9 REFERENCES users",
+	} {
+		if _, err := db.Execute(parseSQL(t, input)); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+
+	// foreign keys follow a renamed parent
+	execSQL(t, db, "ALTER TABLE users RENAME TO customers")
+	execSQL(t, db, "ALTER TABLE customers RENAME COLUMN id TO customer_id")
+	col, _ := db.tables["orders"].column("user_id")
+	if col.References.Table != "customers" || col.References.Column != "customer_id" {
+		t.Errorf("reference not renamed: %+v", col.References)
+	}
+	if _, err := db.Execute(parseSQL(t, "INSERT INTO orders VALUES (20, 7)")); err == nil {
+		t.Error("expected missing parent error after rename, got nil")
+	}
+
+	// a rollback puts the old names back
+	tx := db.Begin()
+	execTx(t, tx, "ALTER TABLE customers RENAME TO clients")
+	tx.Rollback()
+	if col, _ := db.tables["orders"].column("user_id"); col.References.Table != "customers" {
+		t.Errorf("rollback did not restore the reference: %+v", col.References)
+	}
+
+	execSQL(t, db, "ALTER TABLE invoices ADD COLUMN customer INT DEFAULT 2 REFERENCES customers")
+	execSQL(t, db, "DROP TABLE invoices")
+	execSQL(t, db, "DROP TABLE items")
+	execSQL(t, db, "TRUNCATE TABLE orders")
+}
+
+func TestForeignKeysSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	db := openDurable(t, dir)
+	setupShop(t, db)
+	execSQL(t, db, "CHECKPOINT")
+	execSQL(t, db, "ALTER TABLE users RENAME TO customers")
+	execSQL(t, db, "DELETE FROM customers WHERE id = 1")
+	db.Close()
+
+	db = openDurable(t, dir)
+	defer db.Close()
+
+	if countRows(t, db, "orders") != 1 || countRows(t, db, "items") != 1 {
+		t.Error("cascaded deletes not replayed")
+	}
+	if rows := execSQL(t, db, "SELECT * FROM reviews WHERE id = 1").([]Row); rows[0]["author"] != nil {
+		t.Errorf("SET NULL not replayed: %v", rows)
+	}
+
+	execSQL(t, db, "DELETE FROM customers WHERE id = 2")
+	if n := countRows(t, db, "orders"); n != 0 {
+		t.Errorf("foreign key lost after restart, %d orders left", n)
+	}
+}
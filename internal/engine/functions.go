@@ -0,0 +1,168 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/raskovnik/rdbms/internal/ast"
+	"github.com/raskovnik/rdbms/internal/datetime"
+)
+
+// scalar functions and the number of arguments they take
+var functionArity = map[string]int{
+	"NOW":          0, // NOW() -> the time the transaction started
+	"CURRENT_DATE": 0, // CURRENT_DATE -> the day the transaction started
+	"DATE_TRUNC":   2, // DATE_TRUNC('month', created_at) -> start of the month
+	"NEXTVAL":      1, // NEXTVAL('todos_id_seq') -> the next value of a sequence
+}
+
+// check a function call's name and arguments, and a literal DATE_TRUNC unit
+func checkFunction(call *ast.FunctionCall) error {
+	arity, exists := functionArity[call.Name]
+	if !exists {
+		return fmt.Errorf("function %s does not exist", call.Name)
+	}
+	if len(call.Args) != arity {
+		return fmt.Errorf("%s takes %d arguments, got %d", call.Name, arity, len(call.Args))
+	}
+
+	if call.Name == "DATE_TRUNC" {
+		if lit, ok := call.Args[0].(*ast.Literal); ok {
+			unit, _ := lit.Value.(string)
+			if _, valid := (datetime.Timestamp{}).Trunc(unit); !valid {
+				return fmt.Errorf("unknown DATE_TRUNC unit %s", lit)
+			}
+		}
+	}
+	return nil
+}
+
+// check that EXTRACT names a field of some date, time or interval
+func checkExtract(expr *ast.ExtractExpression) error {
+	_, timestampField := (datetime.Timestamp{}).Extract(expr.Field)
+	_, intervalField := (datetime.Interval{}).Extract(expr.Field)
+	if !timestampField && !intervalField {
+		return fmt.Errorf("unknown EXTRACT field %s", expr.Field)
+	}
+	return nil
+}
+
+// call a scalar function on evaluated arguments, nil when an argument is NULL or of
+// the wrong type
+func callFunction(name string, args []interface{}) interface{} {
+	switch name {
+	case "NOW":
+		// statements bind NOW() to the transaction's start, this is only reached
+		// for expressions evaluated outside one
+		return datetime.Now()
+	case "CURRENT_DATE":
+		return datetime.Now().Date()
+	case "DATE_TRUNC":
+		unit, ok := args[0].(string)
+		if !ok {
+			return nil
+		}
+		var ts datetime.Timestamp
+		switch v := args[1].(type) {
+		case datetime.Timestamp:
+			ts = v
+		case datetime.Date:
+			ts = v.Timestamp()
+		default:
+			return nil
+		}
+		if truncated, ok := ts.Trunc(unit); ok {
+			return truncated
+		}
+	case "NEXTVAL":
+		// sequences belong to a database, statements bind NEXTVAL() through their
+		// transaction
+		return nil
+	}
+	return nil
+}
+
+// a field of a date, time, timestamp or interval as an INT, nil if it has no such field
+func extract(field string, value interface{}) interface{} {
+	var (
+		n  int
+		ok bool
+	)
+	switch v := value.(type) {
+	case datetime.Date:
+		n, ok = v.Timestamp().Extract(field)
+	case datetime.Timestamp:
+		n, ok = v.Extract(field)
+	case datetime.Time:
+		n, ok = v.Extract(field)
+	case datetime.Interval:
+		n, ok = v.Extract(field)
+	}
+	if !ok {
+		return nil
+	}
+	return n
+}
+
+// prepare an expression for one statement: NOW() and CURRENT_DATE become the
+// transaction's start time and parts that read no column are computed once. a
+// comparison with a constant is what the planner can answer from an index ->
+// created_at > NOW() - INTERVAL '1 day'
+func (tx *Tx) bind(expr ast.Expression) ast.Expression {
+	bound, _ := tx.fold(expr)
+	return bound
+}
+
+// the expression with its constant parts evaluated, constant is true when it reads
+// no column at all
+func (tx *Tx) fold(expr ast.Expression) (folded ast.Expression, constant bool) {
+	switch e := expr.(type) {
+	case *ast.Literal:
+		return e, true
+	case *ast.FunctionCall:
+		switch e.Name {
+		case "NOW":
+			return &ast.Literal{Value: tx.now}, true
+		case "CURRENT_DATE":
+			return &ast.Literal{Value: tx.now.Date()}, true
+		case "NEXTVAL":
+			// a new value every time the expression is bound, NULL for a missing sequence
+			if name, ok := sequenceName(e); ok {
+				if value, exists := tx.nextval(name); exists {
+					return &ast.Literal{Value: value}, true
+				}
+			}
+			return &ast.Literal{Value: nil}, true
+		}
+		call := &ast.FunctionCall{Name: e.Name, Args: make([]ast.Expression, len(e.Args))}
+		constant = true
+		for i, arg := range e.Args {
+			var argConstant bool
+			call.Args[i], argConstant = tx.fold(arg)
+			constant = constant && argConstant
+		}
+		return evalIfConstant(call, constant)
+	case *ast.ExtractExpression:
+		source, constant := tx.fold(e.Source)
+		return evalIfConstant(&ast.ExtractExpression{Field: e.Field, Source: source}, constant)
+	case *ast.UnaryExpression:
+		operand, constant := tx.fold(e.Operand)
+		return evalIfConstant(&ast.UnaryExpression{Operator: e.Operator, Operand: operand}, constant)
+	case *ast.IsNullExpression:
+		operand, constant := tx.fold(e.Operand)
+		return evalIfConstant(&ast.IsNullExpression{Operand: operand, Not: e.Not}, constant)
+	case *ast.BinaryExpression:
+		left, leftConstant := tx.fold(e.Left)
+		right, rightConstant := tx.fold(e.Right)
+		return evalIfConstant(&ast.BinaryExpression{Left: left, Operator: e.Operator, Right: right}, leftConstant && rightConstant)
+	default:
+		// columns and aggregates
+		return expr, false
+	}
+}
+
+func evalIfConstant(expr ast.Expression, constant bool) (ast.Expression, bool) {
+	if constant {
+		return &ast.Literal{Value: evalExpression(nil, expr)}, true
+	}
+	return expr, false
+}
@@ -0,0 +1,406 @@
+package engine
+
+import (
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+
+	"github.com/raskovnik/rdbms/internal/ast"
+	"github.com/raskovnik/rdbms/internal/datetime"
+	"github.com/raskovnik/rdbms/internal/decimal"
+)
+
+// a heap page holds records, each one row:
+//
+//	[0:2]  number of slots
+//	[2:4]  start of the record area, records fill the page from the end down
+//	[4:]   slot directory, the offset and length of each record
+const (
+	heapHeaderSize = 4
+	heapSlotSize   = 4
+)
+
+// the largest record a heap page has room for, and the largest row whatever its id.
+// rows do not span pages
+const (
+	maxRecordSize = pageSize - heapHeaderSize - heapSlotSize
+	maxRowSize    = maxRecordSize - binary.MaxVarintLen64
+)
+
+type heapPage []byte
+
+func (p heapPage) init() {
+	clear(p)
+	binary.LittleEndian.PutUint16(p[2:4], pageSize)
+}
+
+func (p heapPage) slots() int {
+	return int(binary.LittleEndian.Uint16(p[0:2]))
+}
+
+func (p heapPage) recordStart() int {
+	return int(binary.LittleEndian.Uint16(p[2:4]))
+}
+
+func (p heapPage) record(slot int) ([]byte, error) {
+	if slot >= p.slots() {
+		return nil, fmt.Errorf("slot %d past the end of a page with %d", slot, p.slots())
+	}
+	dir := heapHeaderSize + slot*heapSlotSize
+	offset := int(binary.LittleEndian.Uint16(p[dir : dir+2]))
+	length := int(binary.LittleEndian.Uint16(p[dir+2 : dir+4]))
+	if offset+length > pageSize {
+		return nil, fmt.Errorf("record in slot %d runs past the end of the page", slot)
+	}
+	return p[offset : offset+length], nil
+}
+
+// add a record, returns its slot and false when the page has no room left
+func (p heapPage) insert(rec []byte) (int, bool) {
+	slot := p.slots()
+	dirEnd := heapHeaderSize + (slot+1)*heapSlotSize
+	start := p.recordStart() - len(rec)
+	if start < dirEnd {
+		return 0, false
+	}
+
+	copy(p[start:], rec)
+	dir := dirEnd - heapSlotSize
+	binary.LittleEndian.PutUint16(p[dir:dir+2], uint16(start))
+	binary.LittleEndian.PutUint16(p[dir+2:dir+4], uint16(len(rec)))
+	binary.LittleEndian.PutUint16(p[0:2], uint16(slot+1))
+	binary.LittleEndian.PutUint16(p[2:4], uint16(start))
+	return slot, true
+}
+
+// where a row is stored. page 0 holds the file header, so the zero loc is no row
+type rowLoc struct {
+	page pageID
+	slot uint16
+}
+
+// a loc as the row id of an entry of a row map, the page above the slot
+func (l rowLoc) packed() int {
+	return int(l.page)<<16 | int(l.slot)
+}
+
+func unpackLoc(packed int) rowLoc {
+	return rowLoc{page: pageID(packed >> 16), slot: uint16(packed)}
+}
+
+// the row map of a table is a B+tree of index pages keyed by row id, the entry of each
+// row on disk holds where its record is
+var rowMapInfo = IndexInfo{Name: "row map", Using: IndexBTree}
+
+// the rows of a table as of the last checkpoint, kept in heap pages of the database
+// file and read through the buffer pool, and found through the row map. rows changed
+// since then are held in memory by the table, the next checkpoint writes them
+type heapStore struct {
+	pool    *bufferPool
+	rowMap  pageID          // root of the row map, 0 for no rows
+	removed map[int]bool    // rows removed since the last checkpoint, by id
+	schema  []ast.ColumnDef // the columns of the records, in order
+	convert func(Row) Row   // makes a row of the table from a record, nil when it is one
+}
+
+func newHeapStore(pool *bufferPool, rowMap pageID, schema []ast.ColumnDef) *heapStore {
+	return &heapStore{pool: pool, rowMap: rowMap, removed: make(map[int]bool), schema: schema}
+}
+
+// where the record of a row is, the zero loc for rows not on disk
+func (s *heapStore) loc(id int) (rowLoc, error) {
+	if s.removed[id] {
+		return rowLoc{}, nil
+	}
+	return s.stored(id)
+}
+
+// where the last checkpoint wrote the record of a row, whether it was removed since or
+// not
+func (s *heapStore) stored(id int) (rowLoc, error) {
+	var loc rowLoc
+	if s.rowMap == 0 {
+		return loc, nil
+	}
+	bound := &Bound{Value: id, Inclusive: true}
+	_, err := walkIndex(s.pool, s.rowMap, bound, bound, false, func(entry indexEntry) bool {
+		loc = unpackLoc(entry.id)
+		return false
+	})
+	if err != nil {
+		return rowLoc{}, fmt.Errorf("row map: %w", err)
+	}
+	return loc, nil
+}
+
+// the stored version of a row, nil when the row is not on disk
+func (s *heapStore) load(id int) (*rowVersion, error) {
+	loc, err := s.loc(id)
+	if err != nil || loc == (rowLoc{}) {
+		return nil, err
+	}
+
+	f, err := s.pool.fetch(loc.page)
+	if err != nil {
+		return nil, err
+	}
+	defer s.pool.unpin(f)
+
+	rec, err := heapPage(f.data).record(int(loc.slot))
+	if err != nil {
+		return nil, fmt.Errorf("page %d: %w", loc.page, err)
+	}
+	stored, row, err := decodeRecord(rec, s.schema)
+	if err != nil {
+		return nil, fmt.Errorf("page %d slot %d: %w", loc.page, loc.slot, err)
+	}
+	if stored != id {
+		return nil, fmt.Errorf("page %d slot %d holds row %d, expected %d", loc.page, loc.slot, stored, id)
+	}
+	if s.convert != nil {
+		row = s.convert(row)
+	}
+	return &rowVersion{row: row, xmin: frozenXID}, nil
+}
+
+// remove a row from the store. its record and its entry in the row map stay until the
+// next checkpoint, which finds out whether it had any
+func (s *heapStore) remove(id int) {
+	s.removed[id] = true
+}
+
+// a copy that can change without affecting s, the pages stay shared
+func (s *heapStore) clone() *heapStore {
+	copied := *s
+	copied.removed = maps.Clone(s.removed)
+	return &copied
+}
+
+// a copy of the store that reads its records as rows of schema after an ALTER TABLE
+// change. when the records hold the same values in the same order, only the column
+// names change. otherwise each row read is passed through convert, and the next
+// checkpoint writes every row again
+func (s *heapStore) reshaped(schema []ast.ColumnDef, convert func(Row) Row, sameValues bool) *heapStore {
+	store := s.clone()
+	switch {
+	case sameValues && s.convert == nil:
+		store.schema = schema
+	case s.convert == nil:
+		store.convert = convert
+	default:
+		store.convert = func(row Row) Row {
+			return convert(s.convert(row))
+		}
+	}
+	return store
+}
+
+// the heap pages holding the records of the row map at root, in order
+func heapPages(pool *bufferPool, root pageID) ([]pageID, error) {
+	pages := make(map[pageID]bool)
+	_, err := walkIndex(pool, root, nil, nil, false, func(entry indexEntry) bool {
+		pages[unpackLoc(entry.id).page] = true
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("row map: %w", err)
+	}
+	return slices.Sorted(maps.Keys(pages)), nil
+}
+
+// check that rows fit in a heap page of the database file, they do not span pages, and
+// that their keys fit in index pages
+func (tx *Tx) checkStorable(table *Table, rows []Row) error {
+	if tx.db.pool == nil {
+		return nil
+	}
+	indexes := sortedIndexes(table)
+	for _, row := range rows {
+		rec, err := encodeRecord(0, row, table.Schema)
+		if err != nil {
+			return err
+		}
+		// the record of row id 0 has a one byte id
+		if size := len(rec) - 1; size > maxRowSize {
+			return fmt.Errorf("row of %d bytes is too large for table %s, a row takes at most %d", size, table.Name, maxRowSize)
+		}
+		for _, index := range indexes {
+			if err := checkIndexKey(index, index.Info().key(row)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// value tags of the record format
+const (
+	tagNull byte = iota
+	tagFalse
+	tagTrue
+	tagInt
+	tagFloat
+	tagText
+	tagDecimal
+	tagDate
+	tagTime
+	tagTimestamp
+	tagInterval
+	tagTuple // index keys only, a key on several columns
+)
+
+// a type that encodes itself, decimals and dates store their gob encoding
+type selfEncoder interface {
+	GobEncode() ([]byte, error)
+}
+
+// a record is the row id followed by the values in schema order, each a tag and the
+// value's bytes
+func encodeRecord(id int, row Row, schema []ast.ColumnDef) ([]byte, error) {
+	buf := binary.AppendUvarint(nil, uint64(id))
+	for _, col := range schema {
+		var err error
+		if buf, err = appendValue(buf, row[col.Name]); err != nil {
+			return nil, fmt.Errorf("column %s: %w", col.Name, err)
+		}
+	}
+	return buf, nil
+}
+
+func appendValue(buf []byte, value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return append(buf, tagNull), nil
+	case bool:
+		if v {
+			return append(buf, tagTrue), nil
+		}
+		return append(buf, tagFalse), nil
+	case int:
+		return binary.AppendVarint(append(buf, tagInt), int64(v)), nil
+	case float64:
+		return binary.LittleEndian.AppendUint64(append(buf, tagFloat), math.Float64bits(v)), nil
+	case string:
+		buf = binary.AppendUvarint(append(buf, tagText), uint64(len(v)))
+		return append(buf, v...), nil
+	}
+
+	var tag byte
+	switch value.(type) {
+	case decimal.Decimal:
+		tag = tagDecimal
+	case datetime.Date:
+		tag = tagDate
+	case datetime.Time:
+		tag = tagTime
+	case datetime.Timestamp:
+		tag = tagTimestamp
+	case datetime.Interval:
+		tag = tagInterval
+	default:
+		return nil, fmt.Errorf("cannot store a value of type %T", value)
+	}
+
+	data, err := value.(selfEncoder).GobEncode()
+	if err != nil {
+		return nil, err
+	}
+	buf = binary.AppendUvarint(append(buf, tag), uint64(len(data)))
+	return append(buf, data...), nil
+}
+
+// the row id and row of a record
+func decodeRecord(rec []byte, schema []ast.ColumnDef) (int, Row, error) {
+	id, n := binary.Uvarint(rec)
+	if n <= 0 {
+		return 0, nil, fmt.Errorf("bad row id")
+	}
+	rec = rec[n:]
+
+	row := make(Row, len(schema))
+	for _, col := range schema {
+		value, n, err := decodeValue(rec)
+		if err != nil {
+			return 0, nil, fmt.Errorf("column %s: %w", col.Name, err)
+		}
+		row[col.Name] = value
+		rec = rec[n:]
+	}
+	if len(rec) != 0 {
+		return 0, nil, fmt.Errorf("%d bytes left after the last column", len(rec))
+	}
+	return int(id), row, nil
+}
+
+// the row id of a record, without decoding its values
+func recordID(rec []byte) (int, error) {
+	id, n := binary.Uvarint(rec)
+	if n <= 0 {
+		return 0, fmt.Errorf("bad row id")
+	}
+	return int(id), nil
+}
+
+// decode one value, returns the bytes it took
+func decodeValue(buf []byte) (interface{}, int, error) {
+	if len(buf) == 0 {
+		return nil, 0, fmt.Errorf("record too short")
+	}
+
+	tag, rest := buf[0], buf[1:]
+	switch tag {
+	case tagNull:
+		return nil, 1, nil
+	case tagFalse:
+		return false, 1, nil
+	case tagTrue:
+		return true, 1, nil
+	case tagInt:
+		v, n := binary.Varint(rest)
+		if n <= 0 {
+			return nil, 0, fmt.Errorf("bad integer")
+		}
+		return int(v), 1 + n, nil
+	case tagFloat:
+		if len(rest) < 8 {
+			return nil, 0, fmt.Errorf("record too short")
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(rest)), 9, nil
+	}
+
+	length, n := binary.Uvarint(rest)
+	if n <= 0 || uint64(len(rest)-n) < length {
+		return nil, 0, fmt.Errorf("bad length")
+	}
+	data := rest[n : n+int(length)]
+	size := 1 + n + int(length)
+
+	var err error
+	switch tag {
+	case tagText:
+		return string(data), size, nil
+	case tagDecimal:
+		var v decimal.Decimal
+		err = v.GobDecode(data)
+		return v, size, err
+	case tagDate:
+		var v datetime.Date
+		err = v.GobDecode(data)
+		return v, size, err
+	case tagTime:
+		var v datetime.Time
+		err = v.GobDecode(data)
+		return v, size, err
+	case tagTimestamp:
+		var v datetime.Timestamp
+		err = v.GobDecode(data)
+		return v, size, err
+	case tagInterval:
+		var v datetime.Interval
+		err = v.GobDecode(data)
+		return v, size, err
+	}
+	return nil, 0, fmt.Errorf("unknown value tag %d", tag)
+}
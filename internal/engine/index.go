@@ -1,24 +1,146 @@
 package engine
 
-type Index struct {
-	ColumnName string
-	Data       map[interface{}][]int
+import (
+	"fmt"
+	"strings"
+
+	"github.com/raskovnik/rdbms/internal/datetime"
+)
+
+// an index maps column values to the ids of the rows holding them. indexes on
+// several columns are keyed by a Tuple of the column values. an index kept in pages
+// of a database file fails a lookup when it cannot read a page
+type Index interface {
+	Info() *IndexInfo
+	Add(value interface{}, rowIndex int)
+	Remove(value interface{}, rowIndex int)
+	Lookup(value interface{}) ([]int, error)
+	Exists(value interface{}) (bool, error)
+	Clear()
+}
+
+// an ordered index also keeps its values sorted, for range scans, ordering and min/max
+type OrderedIndex interface {
+	Index
+
+	// call fn with each value between lo and hi (nil means unbounded) and its row
+	// indices, in ascending or descending order, until fn returns false
+	Scan(lo, hi *Bound, descending bool, fn func(value interface{}, rowIndices []int) bool) error
+	Min() (interface{}, bool, error)
+	Max() (interface{}, bool, error)
+}
+
+// one end of a range scan
+type Bound struct {
+	Value     interface{}
+	Inclusive bool
+}
+
+const (
+	IndexBTree = "BTREE"
+	IndexHash  = "HASH"
+)
+
+// definition shared by every index implementation
+type IndexInfo struct {
+	Name    string
+	Columns []string
+	Unique  bool
+	Using   string // IndexBTree or IndexHash
 }
 
-func NewIndex(columnName string) *Index {
-	return &Index{
-		ColumnName: columnName,
-		Data:       make(map[interface{}][]int),
+func (info *IndexInfo) Info() *IndexInfo {
+	return info
+}
+
+// the value a row is indexed under
+func (info *IndexInfo) key(row Row) interface{} {
+	if len(info.Columns) == 1 {
+		return row[info.Columns[0]]
+	}
+
+	key := make(Tuple, len(info.Columns))
+	for i, col := range info.Columns {
+		key[i] = row[col]
+	}
+	return key
+}
+
+// create an empty index of the kind the definition asks for
+func newIndex(info IndexInfo) Index {
+	if info.Using == IndexHash {
+		return NewHashIndex(info)
+	}
+	return NewBTreeIndex(info)
+}
+
+// values of a multi-column index key, compared column by column
+type Tuple []interface{}
+
+// hash index, O(1) equality lookups but no ordering
+type HashIndex struct {
+	IndexInfo
+	Data map[interface{}][]int
+}
+
+func NewHashIndex(info IndexInfo) *HashIndex {
+	info.Using = IndexHash
+	return &HashIndex{
+		IndexInfo: info,
+		Data:      make(map[interface{}][]int),
+	}
+}
+
+// report whether an index key is or contains NULL
+func hasNull(key interface{}) bool {
+	if tuple, ok := key.(Tuple); ok {
+		for _, value := range tuple {
+			if value == nil {
+				return true
+			}
+		}
+		return false
+	}
+	return key == nil
+}
+
+// tuples are slices and cannot be map keys, so they are hashed by their text form
+func hashKey(value interface{}) interface{} {
+	tuple, ok := value.(Tuple)
+	if !ok {
+		return hashValue(value)
+	}
+
+	parts := make([]string, len(tuple))
+	for i, v := range tuple {
+		v = hashValue(v)
+		parts[i] = fmt.Sprintf("%T:%#v", v, v)
+	}
+	return strings.Join(parts, ",")
+}
+
+// a single value as it is hashed, values that compare equal get the same key whatever
+// their type -> 2 and 2.00, a date and midnight of that day
+func hashValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case datetime.Date:
+		return v.Timestamp()
+	case datetime.Interval:
+		return v.Normalize()
+	default:
+		return numberKey(value)
 	}
 }
 
 // add a value to the index for a given row index
-func (idx *Index) Add(value interface{}, rowIndex int) {
+func (idx *HashIndex) Add(value interface{}, rowIndex int) {
+	value = hashKey(value)
 	idx.Data[value] = append(idx.Data[value], rowIndex)
 }
 
 // remove a value from the index
-func (idx *Index) Remove(value interface{}, rowIndex int) {
+func (idx *HashIndex) Remove(value interface{}, rowIndex int) {
+	value = hashKey(value)
 	indices := idx.Data[value]
 
 	for i, ind := range indices {
@@ -34,12 +156,17 @@ func (idx *Index) Remove(value interface{}, rowIndex int) {
 }
 
 // return row indices for a given value
-func (idx *Index) Lookup(value interface{}) []int {
-	return idx.Data[value]
+func (idx *HashIndex) Lookup(value interface{}) ([]int, error) {
+	return idx.Data[hashKey(value)], nil
 }
 
 // check if a value exists in the index
-func (idx *Index) Exists(value interface{}) bool {
-	_, exists := idx.Data[value]
-	return exists
+func (idx *HashIndex) Exists(value interface{}) (bool, error) {
+	_, exists := idx.Data[hashKey(value)]
+	return exists, nil
+}
+
+// remove every value from the index
+func (idx *HashIndex) Clear() {
+	idx.Data = make(map[interface{}][]int)
 }
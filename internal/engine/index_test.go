@@ -0,0 +1,148 @@
+package engine
+
+import "testing"
+
+func TestCreateIndexBackfillsExistingRows(t *testing.T) {
+	db := NewDB()
+	execSQL(t, db, "CREATE TABLE orders (id INT PRIMARY KEY, user_id INT, total INT)")
+	execSQL(t, db, "INSERT INTO orders VALUES (1, 7, 100)")
+	execSQL(t, db, "INSERT INTO orders VALUES (2, 8, 250)")
+	execSQL(t, db, "INSERT INTO orders VALUES (3, 7, 75)")
+
+	execSQL(t, db, "CREATE INDEX orders_by_user ON orders (user_id)")
+
+	table := db.tables["orders"]
+	index, exists := table.Indexes["orders_by_user"]
+	if !exists {
+		t.Fatal("index was not created")
+	}
+
+	if rows := indexLookup(t, index, 7); len(rows) != 2 {
+		t.Errorf("wrong rows for user 7. expected=2, got=%v", rows)
+	}
+
+	// non-unique index accepts duplicates and is kept up to date
+	execSQL(t, db, "INSERT INTO orders VALUES (4, 7, 10)")
+	if rows := indexLookup(t, index, 7); len(rows) != 3 {
+		t.Errorf("index not updated on insert. got=%v", rows)
+	}
+
+	execSQL(t, db, "DELETE FROM orders WHERE total < 80")
+	if rows := indexLookup(t, index, 7); len(rows) != 1 {
+		t.Errorf("index not updated on delete. got=%v", rows)
+	}
+
+	// the planner picks the new index for equality conditions
+	if _, indexed, err := indexCandidates(table, parseWhere(t, "user_id = 7")); err != nil || !indexed {
+		t.Error("expected equality on user_id to use the new index")
+	}
+}
+
+func TestCreateUniqueIndexValidatesExistingRows(t *testing.T) {
+	db := NewDB()
+	execSQL(t, db, "CREATE TABLE users (id INT PRIMARY KEY, email TEXT)")
+	execSQL(t, db, "INSERT INTO users VALUES (1, 'a@example.com')")
+	execSQL(t, db, "INSERT INTO users VALUES (2, 'a@example.com')")
+
+	stmt := parseSQL(t, "CREATE UNIQUE INDEX users_email ON users (email)")
+	if _, err := db.Execute(stmt); err == nil {
+		t.Fatal("expected error for duplicate values, got nil")
+	}
+
+	if _, exists := db.tables["users"].Indexes["users_email"]; exists {
+		t.Error("failed index must not be added")
+	}
+
+	execSQL(t, db, "UPDATE users SET email = 'b@example.com' WHERE id = 2")
+	execSQL(t, db, "CREATE UNIQUE INDEX users_email ON users (email)")
+
+	if _, err := db.Execute(parseSQL(t, "INSERT INTO users VALUES (3, 'b@example.com')")); err == nil {
+		t.Error("expected error for duplicate value in unique index, got nil")
+	}
+}
+
+func TestCreateMultiColumnIndex(t *testing.T) {
+	db := NewDB()
+	execSQL(t, db, "CREATE TABLE members (group_id INT, user_id INT, role TEXT)")
+	execSQL(t, db, "INSERT INTO members VALUES (1, 1, 'owner')")
+	execSQL(t, db, "INSERT INTO members VALUES (1, 2, 'member')")
+	execSQL(t, db, "INSERT INTO members VALUES (2, 1, 'member')")
+
+	for _, using := range []string{"BTREE", "HASH"} {
+		name := "members_" + using
+		execSQL(t, db, "CREATE UNIQUE INDEX "+name+" ON members USING "+using+" (group_id, user_id)")
+
+		if _, err := db.Execute(parseSQL(t, "INSERT INTO members VALUES (1, 2, 'dup')")); err == nil {
+			t.Errorf("%s: expected error for duplicate composite key, got nil", using)
+		}
+
+		if rows := indexLookup(t, db.tables["members"].Indexes[name], Tuple{2, 1}); len(rows) != 1 {
+			t.Errorf("%s: wrong rows for (2, 1). got=%v", using, rows)
+		}
+
+		execSQL(t, db, "DROP INDEX "+name)
+	}
+
+	results := execSQL(t, db, "SELECT role FROM members WHERE user_id = 1 AND group_id = 2").([]Row)
+	if len(results) != 1 || results[0]["role"] != "member" {
+		t.Errorf("wrong results. got=%v", results)
+	}
+}
+
+func TestCreateIndexErrors(t *testing.T) {
+	db := NewDB()
+	execSQL(t, db, "CREATE TABLE users (id INT PRIMARY KEY, name TEXT)")
+	execSQL(t, db, "CREATE INDEX users_name ON users (name)")
+
+	inputs := []string{
+		"CREATE INDEX users_name ON users (id)",    // name taken
+		"CREATE INDEX other ON missing (id)",       // no table
+		"CREATE INDEX other ON users (missing)",    // no column
+		"CREATE INDEX other ON users (name, name)", // repeated column
+		"DROP INDEX missing",
+		"DROP INDEX id", // primary key
+	}
+
+	for _, input := range inputs {
+		if _, err := db.Execute(parseSQL(t, input)); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+
+	execSQL(t, db, "DROP INDEX users_name")
+	if _, exists := db.tables["users"].Indexes["users_name"]; exists {
+		t.Error("index not dropped")
+	}
+}
+
+func TestIndexesSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	db := openDurable(t, dir)
+	execSQL(t, db, "CREATE TABLE users (id INT PRIMARY KEY, name TEXT)")
+	execSQL(t, db, "INSERT INTO users VALUES (1, 'Alice')")
+	execSQL(t, db, "CREATE UNIQUE INDEX users_name ON users USING HASH (name)")
+	execSQL(t, db, "CREATE INDEX users_id_name ON users (id, name)")
+	execSQL(t, db, "CHECKPOINT")
+	execSQL(t, db, "DROP INDEX users_id_name")
+	execSQL(t, db, "CREATE INDEX users_name_id ON users (name, id)")
+	db.Close()
+
+	db = openDurable(t, dir)
+	defer db.Close()
+
+	indexes := db.tables["users"].Indexes
+	if _, ok := indexes["users_name"].(*HashIndex); !ok {
+		t.Errorf("hash index not restored. got=%T", indexes["users_name"])
+	}
+	if _, exists := indexes["users_id_name"]; exists {
+		t.Error("dropped index restored")
+	}
+	if rows := indexLookup(t, indexes["users_name_id"], Tuple{"Alice", 1}); len(rows) != 1 {
+		t.Errorf("index created after checkpoint not restored. got=%v", rows)
+	}
+
+	if _, err := db.Execute(parseSQL(t, "INSERT INTO users VALUES (2, 'Alice')")); err == nil {
+		t.Error("expected restored unique index to reject duplicates")
+	}
+}
@@ -0,0 +1,191 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCompositePrimaryKey(t *testing.T) {
+	db := NewDB()
+	execSQL(t, db, "CREATE TABLE memberships (team_id INT, user_id INT, role TEXT, PRIMARY KEY (team_id, user_id))")
+	execSQL(t, db, "INSERT INTO memberships VALUES (1, 1, 'owner'), (1, 2, 'member'), (2, 1, 'member')")
+
+	table := db.tables["memberships"]
+	if _, exists := table.Indexes["memberships_pkey"]; !exists {
+		t.Fatalf("no index for the primary key: %v", table.Indexes)
+	}
+	if col, _ := table.column("user_id"); !col.NotNull {
+		t.Error("primary key column not NOT NULL")
+	}
+
+	for _, input := range []string{
+		"INSERT INTO memberships VALUES (1, 2, 'owner')",
+		"INSERT INTO memberships VALUES (3, 1, 'a'), (3, 1, 'b')",
+		"INSERT INTO memberships VALUES (3, NULL, 'a')",
+		"UPDATE memberships SET user_id = 1 WHERE team_id = 1 AND user_id = 2",
+		"DROP INDEX memberships_pkey",
+		"ALTER TABLE memberships ADD COLUMN id INT PRIMARY KEY",
+		"ALTER TABLE memberships DROP COLUMN user_id",
+	} {
+		if _, err := db.Execute(parseSQL(t, input)); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+	if n := countRows(t, db, "memberships"); n != 3 {
+		t.Errorf("failed statements changed rows, %d left", n)
+	}
+
+	_, err := db.Execute(parseSQL(t, "INSERT INTO memberships VALUES (2, 1, 'owner')"))
+	if err == nil || !strings.Contains(err.Error(), "duplicate value [2 1] for index memberships_pkey") {
+		t.Errorf("wrong duplicate key error, got %v", err)
+	}
+
+	execSQL(t, db, "UPDATE memberships SET user_id = 3 WHERE team_id = 1 AND user_id = 2")
+	execSQL(t, db, "DELETE FROM memberships WHERE team_id = 1 AND user_id = 1")
+	execSQL(t, db, "INSERT INTO memberships VALUES (1, 1, 'owner'), (1, 2, 'member')")
+
+	// the name of the key's index is taken
+	execSQL(t, db, "CREATE INDEX other_pkey ON memberships (role)")
+	for _, input := range []string{
+		"CREATE TABLE bad (a INT PRIMARY KEY, b INT, PRIMARY KEY (a, b))",
+		"CREATE TABLE bad (a INT, b INT, PRIMARY KEY (a, b), PRIMARY KEY (b, a))",
+		"CREATE TABLE bad (id INT REFERENCES memberships)",
+		"CREATE TABLE other (a INT, b INT, PRIMARY KEY (a, b))",
+	} {
+		if _, err := db.Execute(parseSQL(t, input)); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+}
+
+func TestCompositeUniqueKey(t *testing.T) {
+	db := NewDB()
+	execSQL(t, db, "CREATE TABLE seats (id INT PRIMARY KEY, hall TEXT, seat INT, UNIQUE (hall, seat), UNIQUE (seat, hall))")
+
+	// a key holding NULL conflicts with no other
+	execSQL(t, db, "INSERT INTO seats VALUES (1, 'a', 1), (2, 'a', 2), (3, 'b', 1), (4, NULL, 1), (5, NULL, 1)")
+	if _, err := db.Execute(parseSQL(t, "INSERT INTO seats VALUES (6, 'b', 1)")); err == nil || !strings.Contains(err.Error(), "seats_hall_seat_key") {
+		t.Errorf("expected duplicate key error, got %v", err)
+	}
+
+	names := make([]string, 0, len(db.tables["seats"].Keys))
+	for _, key := range db.tables["seats"].Keys {
+		names = append(names, key.Name)
+	}
+	if fmt.Sprint(names) != "[seats_hall_seat_key seats_seat_hall_key]" {
+		t.Errorf("wrong key names: %v", names)
+	}
+
+	// a unique key on columns that already hold duplicates cannot be built
+	execSQL(t, db, "CREATE TABLE pairs (a INT, b INT)")
+	execSQL(t, db, "INSERT INTO pairs VALUES (1, 1), (1, 1)")
+	if _, err := db.Execute(parseSQL(t, "CREATE UNIQUE INDEX pairs_ab ON pairs (a, b)")); err == nil {
+		t.Error("expected duplicate error building a unique index, got nil")
+	}
+
+	// TRUNCATE keeps the keys
+	execSQL(t, db, "TRUNCATE seats")
+	execSQL(t, db, "INSERT INTO seats VALUES (1, 'a', 1)")
+	if _, err := db.Execute(parseSQL(t, "INSERT INTO seats VALUES (2, 'a', 1)")); err == nil {
+		t.Error("unique key lost by TRUNCATE")
+	}
+}
+
+func TestCompositeKeyPrefixLookup(t *testing.T) {
+	db := NewDB()
+	execSQL(t, db, "CREATE TABLE memberships (team_id INT, user_id INT, role TEXT, PRIMARY KEY (team_id, user_id))")
+	execSQL(t, db, "INSERT INTO memberships VALUES (2, 1, 'a'), (1, 2, 'b'), (3, 1, 'c'), (1, 1, 'd'), (2, 2, 'e')")
+	table := db.tables["memberships"]
+
+	tests := []struct {
+		where     string
+		positions string
+	}{
+		{"team_id = 1 AND user_id = 2", "[1]"},
+		{"team_id = 1", "[1 3]"},
+		{"2 = team_id AND role != 'x'", "[0 4]"},
+		{"team_id = 9", "[]"},
+	}
+	for _, tt := range tests {
+		positions, indexed, err := indexCandidates(table, parseWhere(t, tt.where))
+		if err != nil || !indexed || fmt.Sprint(positions) != tt.positions {
+			t.Errorf("wrong candidates for %q. expected=%s, got=%v (indexed=%v)", tt.where, tt.positions, positions, indexed)
+		}
+	}
+
+	// the second column alone is not a prefix of the key
+	if _, indexed, _ := indexCandidates(table, parseWhere(t, "user_id = 1")); indexed {
+		t.Error("index used without its leading column")
+	}
+
+	rows := execSQL(t, db, "SELECT role FROM memberships WHERE team_id = 2 ORDER BY user_id DESC").([]Row)
+	if fmt.Sprint(rows) != "[map[role:e] map[role:a]]" {
+		t.Errorf("wrong rows for a prefix lookup: %v", rows)
+	}
+	rows = execSQL(t, db, "SELECT role FROM memberships WHERE team_id = 1 AND role = 'd'").([]Row)
+	if fmt.Sprint(rows) != "[map[role:d]]" {
+		t.Errorf("wrong rows for a prefix lookup with a filter: %v", rows)
+	}
+}
+
+func TestCompositeKeysFollowAlterTable(t *testing.T) {
+	db := NewDB()
+	execSQL(t, db, "CREATE TABLE memberships (team_id INT, user_id INT, role TEXT, PRIMARY KEY (team_id, user_id))")
+	execSQL(t, db, "INSERT INTO memberships VALUES (1, 1, 'owner')")
+
+	execSQL(t, db, "ALTER TABLE memberships RENAME COLUMN user_id TO member_id")
+	execSQL(t, db, "ALTER TABLE memberships RENAME TO members")
+	execSQL(t, db, "ALTER TABLE members ADD COLUMN joined INT")
+
+	table := db.tables["members"]
+	if key := table.Keys[0]; key.Name != "memberships_pkey" || fmt.Sprint(key.Columns) != "[team_id member_id]" {
+		t.Errorf("key not renamed with its column: %+v", key)
+	}
+	if _, err := db.Execute(parseSQL(t, "INSERT INTO members VALUES (1, 1, 'x', NULL)")); err == nil {
+		t.Error("primary key lost by ALTER TABLE")
+	}
+	if positions, indexed, err := indexCandidates(table, parseWhere(t, "team_id = 1")); err != nil || !indexed || len(positions) != 1 {
+		t.Errorf("renamed key not used for lookups: %v", positions)
+	}
+
+	// a rollback puts the old key back
+	tx := db.Begin()
+	execTx(t, tx, "ALTER TABLE members RENAME COLUMN team_id TO group_id")
+	tx.Rollback()
+	if key := db.tables["members"].Keys[0]; fmt.Sprint(key.Columns) != "[team_id member_id]" {
+		t.Errorf("rollback did not restore the key: %+v", key)
+	}
+}
+
+func TestCompositeKeysSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	db := openDurable(t, dir)
+	execSQL(t, db, "CREATE TABLE a (x INT, y INT, z TEXT, PRIMARY KEY (x, y), UNIQUE (y, z))")
+	execSQL(t, db, "INSERT INTO a VALUES (1, 1, 'p'), (1, 2, 'q')")
+	execSQL(t, db, "CHECKPOINT")
+	execSQL(t, db, "CREATE TABLE b (x INT, y INT, z TEXT, PRIMARY KEY (x, y), UNIQUE (y, z))")
+	execSQL(t, db, "INSERT INTO b VALUES (1, 1, 'p'), (1, 2, 'q')")
+	// replayed updates and deletes find their rows through the key
+	execSQL(t, db, "UPDATE a SET z = 'r' WHERE x = 1 AND y = 2")
+	execSQL(t, db, "DELETE FROM b WHERE x = 1 AND y = 1")
+	db.Close()
+
+	db = openDurable(t, dir)
+	defer db.Close()
+	for table, z := range map[string]string{"a": "r", "b": "q"} {
+		if _, err := db.Execute(parseSQL(t, "INSERT INTO "+table+" VALUES (1, 2, 's')")); err == nil || !strings.Contains(err.Error(), table+"_pkey") {
+			t.Errorf("primary key of %s lost after restart, got %v", table, err)
+		}
+		if _, err := db.Execute(parseSQL(t, "INSERT INTO "+table+" VALUES (2, 2, '"+z+"')")); err == nil || !strings.Contains(err.Error(), table+"_y_z_key") {
+			t.Errorf("unique key of %s lost after restart, got %v", table, err)
+		}
+	}
+	if rows := execSQL(t, db, "SELECT z FROM a WHERE x = 1 ORDER BY y").([]Row); fmt.Sprint(rows) != "[map[z:p] map[z:r]]" {
+		t.Errorf("update not replayed: %v", rows)
+	}
+	if n := countRows(t, db, "b"); n != 1 {
+		t.Errorf("delete not replayed, %d rows in b", n)
+	}
+}
@@ -0,0 +1,404 @@
+package engine
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// transaction ids. 0 marks a version whose insert was rolled back, versions loaded
+// from disk belong to a transaction that committed before any other
+const (
+	invalidXID uint64 = 0
+	frozenXID  uint64 = 1
+)
+
+// one version of a row. an UPDATE creates a new version under the same row id and
+// keeps the old one in its chain for transactions that started earlier
+type rowVersion struct {
+	row  Row
+	xmin uint64      // transaction that created the version
+	xmax uint64      // transaction that deleted or replaced it, 0 while current
+	prev *rowVersion // older version, nil once cleaned up
+}
+
+// what a transaction sees: everything committed before it took its snapshot
+type txSnapshot struct {
+	xmin   uint64          // oldest transaction running when the snapshot was taken, itself included
+	xmax   uint64          // first transaction id not yet handed out
+	active map[uint64]bool // transactions running when the snapshot was taken
+}
+
+// report whether the changes of transaction xid are visible in the snapshot
+func (s *txSnapshot) committed(xid uint64) bool {
+	return xid != invalidXID && xid < s.xmax && !s.active[xid]
+}
+
+// the newest version of a row, read from the table's pages when it is not in memory.
+// nil for a free row id
+func (t *Table) head(id int) (*rowVersion, error) {
+	if v := t.versions[id]; v != nil || t.store == nil || id >= t.ids {
+		return v, nil
+	}
+
+	v, err := t.store.load(id)
+	if err != nil {
+		return nil, fmt.Errorf("table %s: %w", t.Name, err)
+	}
+	return v, nil
+}
+
+// the newest version of a row, kept in memory so it can be changed
+func (t *Table) hold(id int) (*rowVersion, error) {
+	v, err := t.head(id)
+	if v == nil {
+		return nil, err
+	}
+	t.versions[id] = v
+	return v, nil
+}
+
+// the newest version of a row, nil for a free row id
+func (t *Table) row(id int) (Row, error) {
+	v, err := t.head(id)
+	if v == nil {
+		return nil, err
+	}
+	return v.row, nil
+}
+
+// add a row created by transaction xid under a free row id, or a new one when there is
+// none. returns its row id
+func (t *Table) addRow(row Row, xid uint64) int {
+	version := &rowVersion{row: row, xmin: xid}
+
+	id := t.ids
+	if n := len(t.free); n > 0 {
+		id = t.free[n-1]
+		t.free = t.free[:n-1]
+	} else {
+		t.ids++
+	}
+	t.versions[id] = version
+
+	for _, index := range t.Indexes {
+		index.Add(index.Info().key(row), id)
+	}
+	return id
+}
+
+// remove a row and every version of it from head, its newest, with its index entries
+// and its record on disk. a later row reuses its id, rows around it keep theirs
+func (t *Table) removeRow(id int, head *rowVersion) {
+	for v := head; v != nil; v = v.prev {
+		for _, index := range t.Indexes {
+			info := index.Info()
+			if key := info.key(v.row); !chainHasKeyBefore(head, v, info, key) {
+				index.Remove(key, id)
+			}
+		}
+	}
+
+	delete(t.versions, id)
+	t.free = append(t.free, id)
+	if t.store != nil {
+		t.store.remove(id)
+	}
+}
+
+// overwrite a row with a committed version, only the index entries of keys that
+// changed are touched. used when replaying the log
+func (t *Table) replaceRow(id int, row Row) error {
+	old, err := t.row(id)
+	if err != nil {
+		return err
+	}
+	for _, index := range t.Indexes {
+		info := index.Info()
+		if oldKey, key := info.key(old), info.key(row); compareKeys(oldKey, key) != 0 {
+			index.Remove(oldKey, id)
+			index.Add(key, id)
+		}
+	}
+
+	t.versions[id] = &rowVersion{row: row, xmin: frozenXID}
+	return nil
+}
+
+// the current rows of the table in row id order
+func (t *Table) liveRows() ([]Row, error) {
+	var rows []Row
+	err := t.eachLiveRow(func(row Row) error {
+		rows = append(rows, row)
+		return nil
+	})
+	return rows, err
+}
+
+// call fn with each current row of the table in row id order, rows on disk are read as
+// they are reached and not kept in memory
+func (t *Table) eachLiveRow(fn func(Row) error) error {
+	for id := range t.ids {
+		version, err := t.head(id)
+		if err != nil {
+			return err
+		}
+		if !version.live() {
+			continue
+		}
+		if err := fn(version.row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// report whether any row id is in use, deleted rows count until they are cleaned up
+func (t *Table) hasRows() bool {
+	return t.ids > len(t.free)
+}
+
+// make row the newest version at pos, replacing the current one in transaction xid
+func (t *Table) pushVersion(pos int, row Row, xid uint64) error {
+	head, err := t.hold(pos)
+	if err != nil {
+		return err
+	}
+	head.xmax = xid
+
+	version := &rowVersion{row: row, xmin: xid, prev: head}
+	t.versions[pos] = version
+
+	// older versions keep their entries, so earlier snapshots still find them
+	for _, index := range t.Indexes {
+		info := index.Info()
+		if key := info.key(row); !chainHasKey(head, info, key) {
+			index.Add(key, pos)
+		}
+	}
+	return nil
+}
+
+// undo pushVersion, dropping index entries only the removed version had
+func (t *Table) popVersion(pos int) {
+	head := t.versions[pos]
+	prev := head.prev
+	prev.xmax = invalidXID
+
+	t.versions[pos] = prev
+
+	for _, index := range t.Indexes {
+		info := index.Info()
+		if key := info.key(head.row); !chainHasKey(prev, info, key) {
+			index.Remove(key, pos)
+		}
+	}
+}
+
+// replace every row with committed versions of rows, used when loading from disk. the
+// table's pages are left to the next checkpoint to free
+func (t *Table) loadRows(rows []Row) {
+	t.versions = make(map[int]*rowVersion, len(rows))
+	t.ids = len(rows)
+	t.free = nil
+	t.store = nil
+	for i, row := range rows {
+		t.versions[i] = &rowVersion{row: row, xmin: frozenXID}
+	}
+
+	for _, index := range t.Indexes {
+		index.Clear()
+		info := index.Info()
+		for i, row := range rows {
+			index.Add(info.key(row), i)
+		}
+	}
+}
+
+// report whether a version is the current state of a row, neither deleted nor rolled
+// back. a free row id has no version and is never live
+func (v *rowVersion) live() bool {
+	return v != nil && v.xmin != invalidXID && v.xmax == invalidXID
+}
+
+// count the current rows with the same key as row in a unique index. the index also
+// has keys of old versions, so each position is checked against its newest version.
+// a key with a NULL in it conflicts with nothing, NULL is not equal to NULL
+func (t *Table) conflicts(index Index, row Row) (int, error) {
+	info := index.Info()
+	key := info.key(row)
+	if hasNull(key) {
+		return 0, nil
+	}
+
+	positions, err := index.Lookup(key)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, pos := range positions {
+		head, err := t.head(pos)
+		if err != nil {
+			return 0, err
+		}
+		if head.live() && compareKeys(info.key(head.row), key) == 0 {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// add the distinct keys of each row's versions to an index
+func addVersions(index Index, t *Table) error {
+	info := index.Info()
+	for pos := range t.ids {
+		// free row ids have no versions
+		head, err := t.head(pos)
+		if err != nil {
+			return err
+		}
+		for v := head; v != nil; v = v.prev {
+			// an older version with the key of a newer one is already indexed
+			key := info.key(v.row)
+			if chainHasKeyBefore(head, v, info, key) {
+				continue
+			}
+			if err := checkIndexKey(index, key); err != nil {
+				return err
+			}
+			index.Add(key, pos)
+		}
+	}
+	return nil
+}
+
+// report whether a version newer than stop has the given index key
+func chainHasKeyBefore(v, stop *rowVersion, info *IndexInfo, key interface{}) bool {
+	for ; v != stop; v = v.prev {
+		if compareKeys(info.key(v.row), key) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// report whether any version from v back has the given index key
+func chainHasKey(v *rowVersion, info *IndexInfo, key interface{}) bool {
+	for ; v != nil; v = v.prev {
+		if compareKeys(info.key(v.row), key) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// report whether a version can no longer be seen by any transaction, given the
+// oldest snapshot still in use
+func deadVersion(v *rowVersion, horizon uint64) bool {
+	return v.xmin == invalidXID || (v.xmax != invalidXID && v.xmax < horizon)
+}
+
+// reclaim versions of the rows with the given ids (every row held in memory when nil)
+// that no snapshot can see. rows whose newest version is dead are removed in place,
+// dropping only their own index entries. returns the versions reclaimed
+func (t *Table) prune(horizon uint64, positions []int) int {
+	if positions == nil {
+		positions = slices.Sorted(maps.Keys(t.versions))
+	}
+
+	reclaimed := 0
+	for _, pos := range positions {
+		// an id can be listed twice, or be free already. rows only on disk have one
+		// version
+		head := t.versions[pos]
+		if head == nil {
+			continue
+		}
+
+		if deadVersion(head, horizon) {
+			for v := head; v != nil; v = v.prev {
+				reclaimed++
+			}
+			t.removeRow(pos, head)
+			continue
+		}
+
+		// cut the chain at the first dead version, every older one is dead too
+		for v := head; v.prev != nil; v = v.prev {
+			if !deadVersion(v.prev, horizon) {
+				continue
+			}
+
+			cut := v.prev
+			v.prev = nil
+			for old := cut; old != nil; old = old.prev {
+				reclaimed++
+				for _, index := range t.Indexes {
+					info := index.Info()
+					if key := info.key(old.row); !chainHasKey(head, info, key) {
+						index.Remove(key, pos)
+					}
+				}
+			}
+			break
+		}
+	}
+
+	return reclaimed
+}
+
+// oldest snapshot still in use, versions replaced or deleted before it are dead
+func (db *Database) horizon() uint64 {
+	db.txMu.Lock()
+	defer db.txMu.Unlock()
+
+	horizon := db.nextXID
+	for _, tx := range db.active {
+		horizon = min(horizon, tx.snap.xmin)
+	}
+	return horizon
+}
+
+// reclaim dead row versions in every table, returns how many were reclaimed. it waits
+// for a running write transaction and holds off other statements while it runs
+func (db *Database) Vacuum() int {
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	horizon := db.horizon()
+
+	reclaimed := 0
+	for _, table := range db.tables {
+		reclaimed += table.prune(horizon, nil)
+	}
+	return reclaimed
+}
+
+// run Vacuum on a timer until stop is called, stop waits for a running vacuum
+func (db *Database) VacuumEvery(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-ticker.C:
+				db.Vacuum()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+		<-stopped
+	}
+}
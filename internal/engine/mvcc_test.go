@@ -0,0 +1,205 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSnapshotIsolation(t *testing.T) {
+	db := setupTestDB(t)
+
+	reader := db.Begin()
+	defer reader.Rollback()
+	if rows := execTx(t, reader, "SELECT * FROM users").([]Row); len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %v", rows)
+	}
+
+	// changes committed after the reader's first statement
+	execSQL(t, db, "UPDATE users SET name = 'Changed' WHERE id = 1")
+	execSQL(t, db, "DELETE FROM users WHERE id = 2")
+	execSQL(t, db, "INSERT INTO users VALUES (3, 'Carol')")
+
+	tests := []struct {
+		query    string
+		expected []interface{}
+	}{
+		{"SELECT * FROM users", []interface{}{"Alice", "Bob"}},
+		{"SELECT * FROM users WHERE id = 1", []interface{}{"Alice"}},
+		{"SELECT * FROM users WHERE id >= 2", []interface{}{"Bob"}},
+		{"SELECT * FROM users ORDER BY id DESC", []interface{}{"Bob", "Alice"}},
+	}
+
+	for _, tt := range tests {
+		rows := execTx(t, reader, tt.query).([]Row)
+		if len(rows) != len(tt.expected) {
+			t.Fatalf("wrong rows for %q in the old snapshot: %v", tt.query, rows)
+		}
+		for i, name := range tt.expected {
+			if rows[i]["name"] != name {
+				t.Errorf("row %d for %q wrong. expected=%v, got=%v", i, tt.query, name, rows[i]["name"])
+			}
+		}
+	}
+
+	if row := execTx(t, reader, "SELECT MAX(id), COUNT(*) FROM users").([]Row)[0]; row["MAX(id)"] != 2 || row["COUNT(*)"] != 2 {
+		t.Errorf("aggregates ignored the snapshot: %v", row)
+	}
+
+	// a new transaction sees the committed changes
+	rows := execSQL(t, db, "SELECT * FROM users ORDER BY id").([]Row)
+	if len(rows) != 2 || rows[0]["name"] != "Changed" || rows[1]["id"] != 3 {
+		t.Errorf("expected committed changes in a new snapshot, got %v", rows)
+	}
+}
+
+func TestIndexFindsOldVersions(t *testing.T) {
+	db := setupTestDB(t)
+
+	reader := db.Begin()
+	defer reader.Rollback()
+	execTx(t, reader, "SELECT * FROM users")
+
+	// the key itself changes, the old snapshot still finds the row under its old key
+	execSQL(t, db, "UPDATE users SET id = 5 WHERE id = 1")
+
+	if rows := execTx(t, reader, "SELECT * FROM users WHERE id = 1").([]Row); len(rows) != 1 {
+		t.Errorf("old snapshot lost the row under its old key: %v", rows)
+	}
+	if rows := execTx(t, reader, "SELECT * FROM users WHERE id = 5").([]Row); len(rows) != 0 {
+		t.Errorf("old snapshot found the row under its new key: %v", rows)
+	}
+	if rows := execSQL(t, db, "SELECT * FROM users WHERE id = 1").([]Row); len(rows) != 0 {
+		t.Errorf("new snapshot found the row under its old key: %v", rows)
+	}
+
+	// each row appears once in index order, under the key it has in the snapshot
+	rows := execSQL(t, db, "SELECT * FROM users ORDER BY id").([]Row)
+	if len(rows) != 2 || rows[0]["id"] != 2 || rows[1]["id"] != 5 {
+		t.Errorf("wrong rows in index order: %v", rows)
+	}
+}
+
+func TestWriteConflict(t *testing.T) {
+	db := setupTestDB(t)
+
+	tx := db.Begin()
+	defer tx.Rollback()
+	execTx(t, tx, "SELECT * FROM users")
+
+	execSQL(t, db, "UPDATE users SET name = 'Changed' WHERE id = 1")
+
+	// the row changed after the snapshot, updating it again would lose that change
+	if _, err := tx.Execute(parseSQL(t, "UPDATE users SET name = 'Lost' WHERE id = 1")); err == nil {
+		t.Fatal("expected serialization error, got nil")
+	}
+
+	// rows nobody else changed can still be written
+	execTx(t, tx, "UPDATE users SET name = 'Bobby' WHERE id = 2")
+}
+
+func TestVacuum(t *testing.T) {
+	db := setupTestDB(t)
+	table := db.tables["users"]
+
+	reader := db.Begin()
+	execTx(t, reader, "SELECT * FROM users")
+
+	execSQL(t, db, "UPDATE users SET name = 'Changed' WHERE id = 1")
+	execSQL(t, db, "DELETE FROM users WHERE id = 2")
+
+	// the reader still needs the old versions
+	if reclaimed := db.Vacuum(); reclaimed != 0 {
+		t.Errorf("vacuum reclaimed %d versions an open snapshot needs", reclaimed)
+	}
+	if tableRow(t, table, 1) == nil {
+		t.Errorf("deleted row removed while visible to a snapshot")
+	}
+
+	reader.Commit()
+
+	if reclaimed := db.Vacuum(); reclaimed != 2 {
+		t.Errorf("expected 2 versions reclaimed, got %d", reclaimed)
+	}
+	if tableRow(t, table, 1) != nil || fmt.Sprint(table.free) != "[1]" || table.versions[0].prev != nil {
+		t.Errorf("dead versions left after vacuum: %v", liveRows(t, table))
+	}
+
+	// the free row id is reused, the other rows keep theirs
+	execSQL(t, db, "INSERT INTO users VALUES (3, 'Carol')")
+	if positions := indexLookup(t, table.Indexes["id"], 3); len(positions) != 1 || positions[0] != 1 || len(table.free) != 0 {
+		t.Errorf("free row id not reused: %v", positions)
+	}
+	execSQL(t, db, "DELETE FROM users WHERE id = 3")
+	if positions := indexLookup(t, table.Indexes["id"], 1); len(positions) != 1 || positions[0] != 0 {
+		t.Errorf("index not updated after vacuum: %v", positions)
+	}
+	if indexHas(t, table.Indexes["id"], 2) {
+		t.Error("index still holds the deleted row")
+	}
+}
+
+func TestVacuumEvery(t *testing.T) {
+	db := setupTestDB(t)
+	table := db.tables["users"]
+
+	reader := db.Begin()
+	execTx(t, reader, "SELECT * FROM users")
+	execSQL(t, db, "DELETE FROM users WHERE id = 2")
+	reader.Commit()
+
+	stop := db.VacuumEvery(time.Millisecond)
+	defer stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		db.mu.RLock()
+		n := len(table.free)
+		db.mu.RUnlock()
+
+		if n == 1 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("background vacuum did not remove the deleted row")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDeleteKeepsRowIds(t *testing.T) {
+	db := NewDB()
+	execSQL(t, db, "CREATE TABLE todos (id INT PRIMARY KEY, task TEXT, owner TEXT)")
+	execSQL(t, db, "CREATE INDEX todos_by_owner ON todos USING HASH (owner)")
+	execSQL(t, db, "INSERT INTO todos VALUES (1, 'a', 'ann'), (2, 'b', 'bob'), (3, 'c', 'ann'), (4, 'd', 'bob'), (5, 'e', 'cat')")
+	table := db.tables["todos"]
+
+	execSQL(t, db, "DELETE FROM todos WHERE owner = 'bob'")
+	for id, key := range map[int]int{0: 1, 2: 3, 4: 5} {
+		if positions := indexLookup(t, table.Indexes["id"], key); len(positions) != 1 || positions[0] != id {
+			t.Errorf("row %d moved after a delete. got=%v", key, positions)
+		}
+	}
+	if indexHas(t, table.Indexes["todos_by_owner"], "bob") || indexHas(t, table.Indexes["id"], 2) {
+		t.Error("index entries of deleted rows left behind")
+	}
+
+	// new rows fill the free ids, their index entries point at them
+	execSQL(t, db, "INSERT INTO todos VALUES (6, 'f', 'dan'), (7, 'g', 'dan'), (8, 'h', 'dan')")
+	if positions := indexLookup(t, table.Indexes["todos_by_owner"], "dan"); fmt.Sprint(positions) != "[3 1 5]" {
+		t.Errorf("free ids not reused. got=%v", positions)
+	}
+	rows := execSQL(t, db, "SELECT id FROM todos WHERE owner = 'dan' ORDER BY id").([]Row)
+	if fmt.Sprint(rows) != "[map[id:6] map[id:7] map[id:8]]" {
+		t.Errorf("wrong rows in reused ids: %v", rows)
+	}
+
+	// an update changes only the entries of the keys it changed
+	execSQL(t, db, "UPDATE todos SET owner = 'eve' WHERE id = 6")
+	if positions := indexLookup(t, table.Indexes["todos_by_owner"], "eve"); fmt.Sprint(positions) != "[3]" {
+		t.Errorf("wrong index entries after an update. got=%v", positions)
+	}
+	if positions := indexLookup(t, table.Indexes["todos_by_owner"], "dan"); fmt.Sprint(positions) != "[1 5]" {
+		t.Errorf("old key left after an update. got=%v", positions)
+	}
+}
@@ -0,0 +1,132 @@
+package engine
+
+import "testing"
+
+func setupNullTestDB(t *testing.T) *Database {
+	db := NewDB()
+	execSQL(t, db, "CREATE TABLE users (id INT PRIMARY KEY, name TEXT NOT NULL, email TEXT UNIQUE, age INT)")
+	execSQL(t, db, "INSERT INTO users VALUES (1, 'Alice', 'alice@example.com', 30)")
+	execSQL(t, db, "INSERT INTO users VALUES (2, 'Bob', NULL, NULL)")
+	execSQL(t, db, "INSERT INTO users VALUES (3, 'Carol', NULL, 25)")
+	return db
+}
+
+func TestNullConstraints(t *testing.T) {
+	db := setupNullTestDB(t)
+
+	for _, input := range []string{
+		"INSERT INTO users VALUES (4, NULL, NULL, NULL)",
+		"INSERT INTO users VALUES (NULL, 'Dan', NULL, NULL)",
+		"UPDATE users SET name = NULL WHERE id = 1",
+		"UPDATE users SET id = NULL WHERE id = 1",
+	} {
+		if _, err := db.Execute(parseSQL(t, input)); err == nil {
+			t.Errorf("expected NOT NULL error for %q, got nil", input)
+		}
+	}
+
+	// NULL is not equal to NULL, so UNIQUE allows any number of them
+	execSQL(t, db, "INSERT INTO users VALUES (4, 'Dan', NULL, NULL)")
+	execSQL(t, db, "UPDATE users SET email = NULL WHERE id = 1")
+	execSQL(t, db, "CREATE UNIQUE INDEX users_email_age ON users (email, age)")
+
+	if _, err := db.Execute(parseSQL(t, "INSERT INTO users VALUES (5, 'Eve', 'alice@example.com', NULL)")); err != nil {
+		t.Errorf("expected insert after the unique value was cleared, got %v", err)
+	}
+}
+
+func TestNullThreeValuedLogic(t *testing.T) {
+	db := setupNullTestDB(t)
+
+	tests := []struct {
+		where    string
+		expected []int
+	}{
+		{"age IS NULL", []int{2}},
+		{"age IS NOT NULL", []int{1, 3}},
+		{"email IS NULL", []int{2, 3}},
+		{"age = NULL", nil},
+		{"age != NULL", nil},
+		{"age > 20", []int{1, 3}},
+		{"NOT age > 26", []int{3}},
+		{"age > 26 OR id = 2", []int{1, 2}},
+		{"age > 26 OR NOT id = 2", []int{1, 3}},
+		{"NOT (age > 26 AND id = 2)", []int{1, 3}},
+		{"NOT (age > 26 AND id = 1)", []int{2, 3}},
+		{"NOT (age > 26 OR id = 1)", []int{3}},
+		{"email = 'alice@example.com' OR email IS NULL", []int{1, 2, 3}},
+	}
+
+	for _, tt := range tests {
+		rows := execSQL(t, db, "SELECT * FROM users WHERE "+tt.where+" ORDER BY id").([]Row)
+		if len(rows) != len(tt.expected) {
+			t.Errorf("wrong rows for %q. expected ids %v, got %v", tt.where, tt.expected, rows)
+			continue
+		}
+		for i, id := range tt.expected {
+			if rows[i]["id"] != id {
+				t.Errorf("wrong rows for %q. expected ids %v, got %v", tt.where, tt.expected, rows)
+				break
+			}
+		}
+	}
+}
+
+func TestNullAggregatesAndOrder(t *testing.T) {
+	db := setupNullTestDB(t)
+	execSQL(t, db, "CREATE INDEX users_age ON users (age)")
+
+	row := execSQL(t, db, "SELECT COUNT(*), COUNT(age), SUM(age), MIN(age), MAX(age) FROM users").([]Row)[0]
+	if row["COUNT(*)"] != 3 || row["COUNT(age)"] != 2 || row["SUM(age)"] != 55 || row["MIN(age)"] != 25 || row["MAX(age)"] != 30 {
+		t.Errorf("wrong aggregates over NULLs: %v", row)
+	}
+
+	// NULLs sort first, before every value
+	rows := execSQL(t, db, "SELECT * FROM users ORDER BY age").([]Row)
+	if rows[0]["id"] != 2 || rows[1]["id"] != 3 || rows[2]["id"] != 1 {
+		t.Errorf("wrong order with NULLs: %v", rows)
+	}
+
+	// an index finds NULLs for IS NULL, ranges skip them
+	if rows := execSQL(t, db, "SELECT * FROM users WHERE age IS NULL").([]Row); len(rows) != 1 || rows[0]["id"] != 2 {
+		t.Errorf("wrong rows for IS NULL through an index: %v", rows)
+	}
+	if rows := execSQL(t, db, "SELECT * FROM users WHERE age < 28").([]Row); len(rows) != 1 || rows[0]["id"] != 3 {
+		t.Errorf("range included a NULL: %v", rows)
+	}
+}
+
+func TestNullJoin(t *testing.T) {
+	db := setupNullTestDB(t)
+	execSQL(t, db, "CREATE TABLE logins (id INT PRIMARY KEY, email TEXT)")
+	execSQL(t, db, "INSERT INTO logins VALUES (1, NULL)")
+	execSQL(t, db, "INSERT INTO logins VALUES (2, 'alice@example.com')")
+
+	// NULL keys never match, with or without an index on the right side
+	for _, query := range []string{
+		"SELECT logins.id, users.id FROM logins JOIN users ON logins.email = users.email",
+		"SELECT users.id, logins.id FROM users JOIN logins ON users.email = logins.email",
+	} {
+		rows := execSQL(t, db, query).([]Row)
+		if len(rows) != 1 {
+			t.Errorf("expected one joined row for %q, got %v", query, rows)
+		}
+	}
+}
+
+func TestNullSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	db := openDurable(t, dir)
+	execSQL(t, db, "CREATE TABLE users (id INT PRIMARY KEY, email TEXT UNIQUE)")
+	execSQL(t, db, "INSERT INTO users VALUES (1, NULL)")
+	execSQL(t, db, "INSERT INTO users VALUES (2, NULL)")
+	db.Close()
+
+	db = openDurable(t, dir)
+	defer db.Close()
+
+	if rows := execSQL(t, db, "SELECT * FROM users WHERE email IS NULL").([]Row); len(rows) != 2 {
+		t.Errorf("expected NULLs after recovery, got %v", rows)
+	}
+}
@@ -0,0 +1,236 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/raskovnik/rdbms/internal/ast"
+	"github.com/raskovnik/rdbms/internal/datetime"
+	"github.com/raskovnik/rdbms/internal/decimal"
+)
+
+// extra digits kept when dividing decimals -> 1.00 / 3 is 0.333333
+const minDivisionScale = 6
+
+// report whether a column type holds numbers
+func isNumericType(columnType string) bool {
+	return columnType == "INT" || columnType == "FLOAT" || columnType == "DECIMAL"
+}
+
+func isNumeric(value interface{}) bool {
+	switch value.(type) {
+	case int, float64, decimal.Decimal:
+		return true
+	default:
+		return false
+	}
+}
+
+// promote two numbers to a common type: INT with INT stays INT, anything with FLOAT
+// becomes FLOAT, otherwise DECIMAL -> 1 + 0.5 is DECIMAL, 1 + 0.5 in a FLOAT column is FLOAT
+func promote(a, b interface{}) (interface{}, interface{}) {
+	_, aFloat := a.(float64)
+	_, bFloat := b.(float64)
+	_, aDecimal := a.(decimal.Decimal)
+	_, bDecimal := b.(decimal.Decimal)
+
+	switch {
+	case aFloat || bFloat:
+		return toFloat(a), toFloat(b)
+	case aDecimal || bDecimal:
+		return toDecimal(a), toDecimal(b)
+	default:
+		return a, b
+	}
+}
+
+func toFloat(value interface{}) float64 {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case decimal.Decimal:
+		return v.Float64()
+	default:
+		return value.(float64)
+	}
+}
+
+func toDecimal(value interface{}) decimal.Decimal {
+	if v, ok := value.(int); ok {
+		return decimal.FromInt(v)
+	}
+	return value.(decimal.Decimal)
+}
+
+// order two numbers of any numeric type
+func compareNumbers(a, b interface{}) int {
+	switch av := a.(type) {
+	case int:
+		if bv, ok := b.(int); ok {
+			return compareOrdered(av, bv)
+		}
+	}
+
+	a, b = promote(a, b)
+	switch av := a.(type) {
+	case float64:
+		return compareOrdered(av, b.(float64))
+	case decimal.Decimal:
+		return av.Cmp(b.(decimal.Decimal))
+	default:
+		return compareOrdered(a.(int), b.(int))
+	}
+}
+
+// apply + - * / to two values. the result is NULL (nil) when either side is NULL, on
+// division by zero, or when the operator does not apply to the types. dividing
+// integers truncates -> 7 / 2 is 3
+func arithmetic(left interface{}, operator string, right interface{}) interface{} {
+	if !isNumeric(left) || !isNumeric(right) {
+		return datetimeArithmetic(left, operator, right)
+	}
+
+	left, right = promote(left, right)
+	switch l := left.(type) {
+	case int:
+		r := right.(int)
+		switch operator {
+		case "+":
+			return l + r
+		case "-":
+			return l - r
+		case "*":
+			return l * r
+		case "/":
+			if r == 0 {
+				return nil
+			}
+			return l / r
+		}
+	case float64:
+		r := right.(float64)
+		switch operator {
+		case "+":
+			return l + r
+		case "-":
+			return l - r
+		case "*":
+			return l * r
+		case "/":
+			if r == 0 {
+				return nil
+			}
+			return l / r
+		}
+	case decimal.Decimal:
+		r := right.(decimal.Decimal)
+		switch operator {
+		case "+":
+			return l.Add(r)
+		case "-":
+			return l.Sub(r)
+		case "*":
+			return l.Mul(r)
+		case "/":
+			quo, ok := l.Quo(r, max(l.Scale(), r.Scale(), minDivisionScale))
+			if !ok {
+				return nil
+			}
+			return quo
+		}
+	}
+	return nil
+}
+
+// negate a number or an interval, NULL for anything else
+func negate(value interface{}) interface{} {
+	if iv, ok := value.(datetime.Interval); ok {
+		return iv.Neg()
+	}
+	return arithmetic(0, "-", value)
+}
+
+// convert a value to the type of a column, failing if it does not fit -> 1 becomes
+// 1.0 in a FLOAT column, 1.00 in a DECIMAL(5,2) column and '2024-01-15' a date in a
+// DATE column. DECIMAL values are rounded to the column's scale
+func coerceValue(col ast.ColumnDef, value interface{}) (interface{}, error) {
+	if value == nil {
+		if col.NotNull || col.PrimaryKey {
+			return nil, fmt.Errorf("column %s cannot be NULL", col.Name)
+		}
+		return nil, nil
+	}
+
+	switch col.Type {
+	case "FLOAT":
+		if isNumeric(value) {
+			return toFloat(value), nil
+		}
+	case "DECIMAL":
+		var d decimal.Decimal
+		switch v := value.(type) {
+		case int:
+			d = decimal.FromInt(v)
+		case float64:
+			converted, err := decimal.FromFloat(v)
+			if err != nil {
+				return nil, fmt.Errorf("value %v is not valid type for DECIMAL", value)
+			}
+			d = converted
+		case decimal.Decimal:
+			d = v
+		default:
+			return nil, fmt.Errorf("value %v is not valid type for DECIMAL", value)
+		}
+
+		if col.Precision == 0 {
+			return d, nil
+		}
+
+		d = d.Rescale(col.Scale)
+		if d.IntegerDigits() > col.Precision-col.Scale {
+			return nil, fmt.Errorf("value %v is out of range for %s DECIMAL(%d,%d)", value, col.Name, col.Precision, col.Scale)
+		}
+		return d, nil
+	case "DATE", "TIME", "TIMESTAMP":
+		converted, err := coerceDatetime(col.Type, value)
+		if err != nil {
+			return nil, err
+		}
+		value = converted
+	}
+
+	if !isValidType(value, col.Type) {
+		return nil, fmt.Errorf("value %v is not valid type for %s", value, col.Type)
+	}
+	return value, nil
+}
+
+// a number in the form hash keys use, so numbers that compare equal hash the same
+// -> 2, 2.0 and 2.00 are all 2
+func numberKey(value interface{}) interface{} {
+	var d decimal.Decimal
+	switch v := value.(type) {
+	case float64:
+		if v >= math.MinInt64 && v < math.MaxInt64 && v == math.Trunc(v) {
+			return int(v)
+		}
+		converted, err := decimal.FromFloat(v)
+		if err != nil {
+			return v
+		}
+		d = converted
+	case decimal.Decimal:
+		d = v
+	default:
+		return value
+	}
+
+	if n, ok := d.Int(); ok {
+		return n
+	}
+	return decimalKey(d.Normalize().String())
+}
+
+// hash key of a number with a fractional part
+type decimalKey string
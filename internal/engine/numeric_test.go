@@ -0,0 +1,155 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+)
+
+func setupNumericTestDB(t *testing.T) *Database {
+	db := NewDB()
+	execSQL(t, db, "CREATE TABLE items (id INT PRIMARY KEY, price DECIMAL(10,2), weight FLOAT, qty INT)")
+	execSQL(t, db, "INSERT INTO items VALUES (1, 0.10, 1.5, 3)")
+	execSQL(t, db, "INSERT INTO items VALUES (2, 0.20, 2, -1)")
+	execSQL(t, db, "INSERT INTO items VALUES (3, 19.999, 0.25, 10)")
+	return db
+}
+
+func TestNumericColumnsCoerceValues(t *testing.T) {
+	db := setupNumericTestDB(t)
+
+	rows := execSQL(t, db, "SELECT * FROM items ORDER BY id").([]Row)
+
+	// DECIMAL keeps its scale and rounds half away from zero, FLOAT accepts integers
+	for i, expected := range []string{"0.10", "0.20", "20.00"} {
+		if got := fmt.Sprint(rows[i]["price"]); got != expected {
+			t.Errorf("row %d price wrong. expected=%s, got=%s", i, expected, got)
+		}
+	}
+	if rows[1]["weight"] != 2.0 || rows[1]["qty"] != -1 {
+		t.Errorf("wrong values in row 2: %v", rows[1])
+	}
+
+	for _, input := range []string{
+		"INSERT INTO items VALUES (4, 123456789.00, 1, 1)",
+		"INSERT INTO items VALUES (4, 'cheap', 1, 1)",
+		"INSERT INTO items VALUES (4, 1, 'heavy', 1)",
+		"INSERT INTO items VALUES (4, 1, 1, 1.5)",
+		"UPDATE items SET price = 99999999.995 WHERE id = 1",
+	} {
+		if _, err := db.Execute(parseSQL(t, input)); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+
+	execSQL(t, db, "UPDATE items SET price = 5 WHERE id = 1")
+	if row := execSQL(t, db, "SELECT price FROM items WHERE id = 1").([]Row)[0]; fmt.Sprint(row["price"]) != "5.00" {
+		t.Errorf("expected updated price 5.00, got %v", row["price"])
+	}
+}
+
+func TestNumericPromotion(t *testing.T) {
+	db := setupNumericTestDB(t)
+
+	tests := []struct {
+		where    string
+		expected []int
+	}{
+		// 0.1 + 0.2 is exactly 0.3 for DECIMAL
+		{"price + 0.20 = 0.30", []int{1}},
+		{"price = 0.1", []int{1}},
+		{"price = 20", []int{3}},
+		{"weight = 2", []int{2}},
+		{"weight > price", []int{1, 2}},
+		{"price * qty > 0.5", []int{3}},
+		{"qty / 2 = 1", []int{1}},
+		{"qty / 2.0 = 1.5", []int{1}},
+		{"-qty > 0", []int{2}},
+		{"weight * 4 - 1 = qty + 2", []int{1}},
+		{"qty / 0 = 1 OR qty / 0 IS NULL", []int{1, 2, 3}},
+		{"price - 0.05 < 0.1 AND weight + 1 >= 2.5", []int{1}},
+	}
+
+	for _, tt := range tests {
+		rows := execSQL(t, db, "SELECT * FROM items WHERE "+tt.where+" ORDER BY id").([]Row)
+		if len(rows) != len(tt.expected) {
+			t.Errorf("wrong rows for %q. expected=%v, got=%v", tt.where, tt.expected, rows)
+			continue
+		}
+		for i, id := range tt.expected {
+			if rows[i]["id"] != id {
+				t.Errorf("row %d for %q wrong. expected id=%d, got=%v", i, tt.where, id, rows[i]["id"])
+			}
+		}
+	}
+}
+
+func TestNumericAggregates(t *testing.T) {
+	db := setupNumericTestDB(t)
+
+	row := execSQL(t, db, "SELECT SUM(price), AVG(price), SUM(weight), AVG(qty), MIN(price), MAX(weight) FROM items").([]Row)[0]
+
+	expected := map[string]string{
+		"SUM(price)":  "20.30",
+		"AVG(price)":  "6.766667",
+		"SUM(weight)": "3.75",
+		"AVG(qty)":    "4",
+		"MIN(price)":  "0.10",
+		"MAX(weight)": "2",
+	}
+	for key, value := range expected {
+		if got := fmt.Sprint(row[key]); got != value {
+			t.Errorf("%s wrong. expected=%s, got=%s", key, value, got)
+		}
+	}
+}
+
+func TestNumericIndexes(t *testing.T) {
+	db := setupNumericTestDB(t)
+	execSQL(t, db, "CREATE INDEX items_price ON items (price) USING HASH")
+	execSQL(t, db, "CREATE INDEX items_weight ON items (weight)")
+
+	// equal numbers of different types find the same entries
+	for _, where := range []string{"price = 0.2", "price = 0.200", "weight = 2", "weight = 2.0"} {
+		rows := execSQL(t, db, "SELECT * FROM items WHERE "+where).([]Row)
+		if len(rows) != 1 || rows[0]["id"] != 2 {
+			t.Errorf("wrong rows for %q: %v", where, rows)
+		}
+	}
+
+	rows := execSQL(t, db, "SELECT * FROM items WHERE weight >= 1 ORDER BY weight DESC").([]Row)
+	if len(rows) != 2 || rows[0]["id"] != 2 || rows[1]["id"] != 1 {
+		t.Errorf("wrong rows in weight order: %v", rows)
+	}
+
+	execSQL(t, db, "CREATE TABLE prices (amount DECIMAL(6,2) UNIQUE)")
+	execSQL(t, db, "INSERT INTO prices VALUES (1.5)")
+	if _, err := db.Execute(parseSQL(t, "INSERT INTO prices VALUES (1.50)")); err == nil {
+		t.Error("expected unique violation for an equal decimal, got nil")
+	}
+}
+
+func TestNumericValuesSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	db := openDurable(t, dir)
+	execSQL(t, db, "CREATE TABLE items (id INT PRIMARY KEY, price DECIMAL(10,2), weight FLOAT)")
+	execSQL(t, db, "INSERT INTO items VALUES (1, 19.90, 0.5)")
+	execSQL(t, db, "CHECKPOINT")
+	execSQL(t, db, "INSERT INTO items VALUES (2, 0.05, -1.25)")
+	execSQL(t, db, "UPDATE items SET price = 20 WHERE id = 1")
+	db.Close()
+
+	db = openDurable(t, dir)
+	defer db.Close()
+
+	rows := execSQL(t, db, "SELECT * FROM items ORDER BY id").([]Row)
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows after restart, got %v", rows)
+	}
+	if fmt.Sprint(rows[0]["price"]) != "20.00" || rows[0]["weight"] != 0.5 {
+		t.Errorf("wrong row 1 after restart: %v", rows[0])
+	}
+	if fmt.Sprint(rows[1]["price"]) != "0.05" || rows[1]["weight"] != -1.25 {
+		t.Errorf("wrong row 2 after restart: %v", rows[1])
+	}
+}
@@ -0,0 +1,729 @@
+package engine
+
+import (
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+)
+
+// an index page is a node of a B+tree, its entries sorted by key and then row id:
+//
+//	[0]    level plus one, 1 for a leaf, so a page of zeros is no node
+//	[1:3]  number of entries
+//	[3:]   entries, each a key and a row id. an entry of an internal node is the
+//	       lowest one under its child, followed by the child's page
+const indexHeaderSize = 3
+
+// the largest entry a node takes, so a full node holds at least four and each level of
+// the tree is narrower than the one below. keys are limited to what such an entry holds
+const (
+	maxIndexEntrySize = (pageSize - indexHeaderSize) / 4
+	maxIndexKeySize   = maxIndexEntrySize - binary.MaxVarintLen64 - 4
+)
+
+// one key of an index and a row holding it
+type indexEntry struct {
+	key interface{}
+	id  int
+}
+
+func compareEntries(a, b indexEntry) int {
+	if cmp := compareKeys(a.key, b.key); cmp != 0 {
+		return cmp
+	}
+	return compareOrdered(a.id, b.id)
+}
+
+// an entry as a map key, keys that compare equal are the same whatever their type
+type entryKey struct {
+	key interface{}
+	id  int
+}
+
+func (e indexEntry) mapKey() entryKey {
+	return entryKey{key: hashKey(e.key), id: e.id}
+}
+
+// an index of a table in a database file. the entries as of the last checkpoint are a
+// B+tree in index pages, read through the buffer pool as lookups reach them, so opening
+// the database reads none of them. entries added and removed since are held in memory
+// until the next checkpoint writes them to the tree
+type pagedIndex struct {
+	IndexInfo
+	pool    *bufferPool
+	root    pageID // 0 for a tree with no entries
+	added   *BTreeIndex
+	removed map[entryKey]indexEntry
+}
+
+// a paged index of the ordered kind, for range scans, ordering and min/max
+type pagedBTreeIndex struct {
+	*pagedIndex
+}
+
+// open the index of a table in a database file whose tree starts at root
+func newPagedIndex(info IndexInfo, pool *bufferPool, root pageID) Index {
+	idx := &pagedIndex{IndexInfo: info, pool: pool}
+	idx.reset(root)
+	if info.Using == IndexHash {
+		return idx
+	}
+	idx.Using = IndexBTree
+	return &pagedBTreeIndex{idx}
+}
+
+// the paged index behind an index, false for an index held in memory
+func pagedOf(index Index) (*pagedIndex, bool) {
+	switch idx := index.(type) {
+	case *pagedIndex:
+		return idx, true
+	case *pagedBTreeIndex:
+		return idx.pagedIndex, true
+	}
+	return nil, false
+}
+
+// check that a key fits in an index page, an index held in memory takes any key
+func checkIndexKey(index Index, key interface{}) error {
+	if _, paged := pagedOf(index); !paged {
+		return nil
+	}
+	buf, err := appendKey(nil, key)
+	if err != nil {
+		return err
+	}
+	if len(buf) > maxIndexKeySize {
+		return fmt.Errorf("key of %d bytes is too large for index %s, a key takes at most %d", len(buf), index.Info().Name, maxIndexKeySize)
+	}
+	return nil
+}
+
+// switch to the tree at root with no changes held in memory
+func (idx *pagedIndex) reset(root pageID) {
+	idx.root = root
+	idx.added = NewBTreeIndex(idx.IndexInfo)
+	idx.removed = make(map[entryKey]indexEntry)
+}
+
+func (idx *pagedIndex) Add(value interface{}, rowIndex int) {
+	entry := indexEntry{key: value, id: rowIndex}
+	delete(idx.removed, entry.mapKey())
+	if !slices.Contains(idx.added.lookup(value), rowIndex) {
+		idx.added.Add(value, rowIndex)
+	}
+}
+
+func (idx *pagedIndex) Remove(value interface{}, rowIndex int) {
+	entry := indexEntry{key: value, id: rowIndex}
+	idx.added.Remove(value, rowIndex)
+	idx.removed[entry.mapKey()] = entry
+}
+
+// report whether an entry of the tree was removed since the last checkpoint
+func (idx *pagedIndex) isRemoved(entry indexEntry) bool {
+	if len(idx.removed) == 0 {
+		return false
+	}
+	_, removed := idx.removed[entry.mapKey()]
+	return removed
+}
+
+func (idx *pagedIndex) Lookup(value interface{}) ([]int, error) {
+	var positions []int
+	if idx.root != 0 {
+		bound := &Bound{Value: value, Inclusive: true}
+		_, err := walkIndex(idx.pool, idx.root, bound, bound, false, func(entry indexEntry) bool {
+			if !idx.isRemoved(entry) {
+				positions = append(positions, entry.id)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("index %s: %w", idx.Name, err)
+		}
+	}
+	return mergeIDs(positions, idx.added.lookup(value)), nil
+}
+
+func (idx *pagedIndex) Exists(value interface{}) (bool, error) {
+	positions, err := idx.Lookup(value)
+	return len(positions) > 0, err
+}
+
+// remove every entry, the pages of the tree are freed by the next checkpoint
+func (idx *pagedIndex) Clear() {
+	idx.reset(0)
+}
+
+// a copy under info that can change without affecting idx, the tree stays shared
+func (idx *pagedIndex) clone(info IndexInfo) Index {
+	copied := newPagedIndex(info, idx.pool, idx.root)
+	paged, _ := pagedOf(copied)
+	idx.added.Scan(nil, nil, false, func(key interface{}, ids []int) bool {
+		for _, id := range ids {
+			paged.added.Add(key, id)
+		}
+		return true
+	})
+	maps.Copy(paged.removed, idx.removed)
+	return copied
+}
+
+// the row ids of both lists in order, once each
+func mergeIDs(ids, more []int) []int {
+	ids = append(ids, more...)
+	sort.Ints(ids)
+	return slices.Compact(ids)
+}
+
+func (idx *pagedBTreeIndex) Scan(lo, hi *Bound, descending bool, fn func(value interface{}, rowIndices []int) bool) error {
+	// the part of the range not yet read from the entries added in memory, it ends
+	// at each key read from the tree
+	rest := lo
+	if descending {
+		rest = hi
+	}
+	scanAdded := func(until *Bound) bool {
+		from, to := rest, hi
+		if until != nil {
+			to = until
+		}
+		if descending {
+			from, to = lo, rest
+			if until != nil {
+				from = until
+			}
+		}
+
+		more := true
+		idx.added.Scan(from, to, descending, func(key interface{}, ids []int) bool {
+			more = fn(key, mergeIDs(nil, ids))
+			return more
+		})
+		return more
+	}
+
+	// entries of the tree with equal keys are passed on together, with the ones added
+	// under the key
+	var key interface{}
+	var ids []int
+	grouped := false
+	flush := func() bool {
+		if !grouped {
+			return true
+		}
+		grouped = false
+
+		next := &Bound{Value: key}
+		if !scanAdded(next) {
+			return false
+		}
+		rest = next
+
+		if ids = mergeIDs(ids, idx.added.lookup(key)); len(ids) == 0 {
+			return true
+		}
+		return fn(key, ids)
+	}
+
+	if idx.root != 0 {
+		more := true
+		_, err := walkIndex(idx.pool, idx.root, lo, hi, descending, func(entry indexEntry) bool {
+			if grouped && compareKeys(entry.key, key) != 0 {
+				if more = flush(); !more {
+					return false
+				}
+			}
+			if !grouped {
+				key, ids, grouped = entry.key, nil, true
+			}
+			if !idx.isRemoved(entry) {
+				ids = append(ids, entry.id)
+			}
+			return true
+		})
+		if err != nil {
+			return fmt.Errorf("index %s: %w", idx.Name, err)
+		}
+		if !more || !flush() {
+			return nil
+		}
+	}
+
+	scanAdded(nil)
+	return nil
+}
+
+// smallest value in the index
+func (idx *pagedBTreeIndex) Min() (interface{}, bool, error) {
+	return idx.first(false)
+}
+
+// largest value in the index
+func (idx *pagedBTreeIndex) Max() (interface{}, bool, error) {
+	return idx.first(true)
+}
+
+func (idx *pagedBTreeIndex) first(descending bool) (interface{}, bool, error) {
+	var value interface{}
+	found := false
+	err := idx.Scan(nil, nil, descending, func(key interface{}, _ []int) bool {
+		value, found = key, true
+		return false
+	})
+	return value, found, err
+}
+
+// a node of the tree as read from its page
+type indexNode struct {
+	level    int
+	entries  []indexEntry
+	children []pageID // internal nodes, the child under each entry
+}
+
+func readIndexNode(pool *bufferPool, id pageID) (*indexNode, error) {
+	f, err := pool.fetch(id)
+	if err != nil {
+		return nil, err
+	}
+	defer pool.unpin(f)
+
+	n, err := decodeIndexNode(f.data)
+	if err != nil {
+		return nil, fmt.Errorf("index page %d: %w", id, err)
+	}
+	return n, nil
+}
+
+func decodeIndexNode(data []byte) (*indexNode, error) {
+	if data[0] == 0 {
+		return nil, fmt.Errorf("not an index page")
+	}
+	n := &indexNode{level: int(data[0]) - 1}
+	count := int(binary.LittleEndian.Uint16(data[1:3]))
+
+	buf := data[indexHeaderSize:]
+	for range count {
+		key, size, err := decodeKey(buf)
+		if err != nil {
+			return nil, err
+		}
+		buf = buf[size:]
+
+		id, size := binary.Uvarint(buf)
+		if size <= 0 {
+			return nil, fmt.Errorf("bad row id")
+		}
+		buf = buf[size:]
+		n.entries = append(n.entries, indexEntry{key: key, id: int(id)})
+
+		if n.level > 0 {
+			if len(buf) < 4 {
+				return nil, fmt.Errorf("entry runs past the end of the page")
+			}
+			n.children = append(n.children, pageID(binary.LittleEndian.Uint32(buf)))
+			buf = buf[4:]
+		}
+	}
+	return n, nil
+}
+
+// an index key is stored as record values are, a key on several columns as its number
+// of values followed by each
+func appendKey(buf []byte, key interface{}) ([]byte, error) {
+	tuple, ok := key.(Tuple)
+	if !ok {
+		return appendValue(buf, key)
+	}
+
+	buf = binary.AppendUvarint(append(buf, tagTuple), uint64(len(tuple)))
+	for _, value := range tuple {
+		var err error
+		if buf, err = appendValue(buf, value); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// decode one key, returns the bytes it took
+func decodeKey(buf []byte) (interface{}, int, error) {
+	if len(buf) == 0 || buf[0] != tagTuple {
+		return decodeValue(buf)
+	}
+
+	count, n := binary.Uvarint(buf[1:])
+	if n <= 0 || count > uint64(len(buf)) {
+		return nil, 0, fmt.Errorf("bad key length")
+	}
+	size := 1 + n
+	tuple := make(Tuple, count)
+	for i := range tuple {
+		value, n, err := decodeValue(buf[size:])
+		if err != nil {
+			return nil, 0, err
+		}
+		tuple[i] = value
+		size += n
+	}
+	return tuple, size, nil
+}
+
+// visit the entries of the subtree at id from the first with a key not below lo to the
+// last not above hi, in descending order when asked, until fn returns false. a node is
+// released before its children are read. returns false once the scan is over
+func walkIndex(pool *bufferPool, id pageID, lo, hi *Bound, descending bool, fn func(indexEntry) bool) (bool, error) {
+	n, err := readIndexNode(pool, id)
+	if err != nil {
+		return false, err
+	}
+
+	count := len(n.entries)
+	for k := range count {
+		i := k
+		if descending {
+			i = count - 1 - k
+		}
+		entry := n.entries[i]
+
+		if n.level == 0 {
+			below, above := belowBound(entry.key, lo), aboveBound(entry.key, hi)
+			if below && !descending || above && descending {
+				continue
+			}
+			if below || above || !fn(entry) {
+				return false, nil
+			}
+			continue
+		}
+
+		// the keys under a child are from its entry's up to the next entry's
+		if aboveBound(entry.key, hi) {
+			if descending {
+				continue
+			}
+			return false, nil
+		}
+		if i+1 < count && belowBound(n.entries[i+1].key, lo) {
+			if descending {
+				return false, nil
+			}
+			continue
+		}
+		if more, err := walkIndex(pool, n.children[i], lo, hi, descending, fn); err != nil || !more {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// every page of the tree at root. leaves are not read, their parents list them
+func indexPages(pool *bufferPool, root pageID) ([]pageID, error) {
+	pages := []pageID{root}
+	pending := []pageID{root}
+	for len(pending) > 0 {
+		id := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		n, err := readIndexNode(pool, id)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, n.children...)
+		if n.level > 1 {
+			pending = append(pending, n.children...)
+		}
+	}
+	return pages, nil
+}
+
+// an entry added to or removed from the tree by a checkpoint
+type indexOp struct {
+	entry indexEntry
+	add   bool
+}
+
+// the lowest entry of a node and its page
+type indexChild struct {
+	entry indexEntry
+	page  pageID
+}
+
+// write the entries added and removed since the last checkpoint into a new tree. the
+// nodes on the path to a change are copied to new pages and the others shared, the old
+// tree stays whole until the header switches to the new one. returns its root and the
+// pages of the old tree it no longer uses
+func (idx *pagedIndex) writePages() (pageID, []pageID, error) {
+	var ops []indexOp
+	idx.added.Scan(nil, nil, false, func(key interface{}, ids []int) bool {
+		for _, id := range ids {
+			ops = append(ops, indexOp{entry: indexEntry{key: key, id: id}, add: true})
+		}
+		return true
+	})
+	for _, entry := range idx.removed {
+		ops = append(ops, indexOp{entry: entry})
+	}
+	if len(ops) == 0 {
+		return idx.root, nil, nil
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		return compareEntries(ops[i].entry, ops[j].entry) < 0
+	})
+
+	w := &indexWriter{pool: idx.pool}
+	var nodes []indexChild
+	level := 0
+	var err error
+	if idx.root == 0 {
+		nodes, err = w.writeNodes(0, applyOps(nil, ops), nil)
+	} else {
+		nodes, level, err = w.apply(idx.root, ops)
+	}
+
+	// a root that split gets new levels above it
+	for err == nil && len(nodes) > 1 {
+		level++
+		entries := make([]indexEntry, len(nodes))
+		children := make([]pageID, len(nodes))
+		for i, node := range nodes {
+			entries[i], children[i] = node.entry, node.page
+		}
+		nodes, err = w.writeNodes(level, entries, children)
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("index %s: %w", idx.Name, err)
+	}
+
+	if len(nodes) == 0 {
+		return 0, w.released, nil
+	}
+	return nodes[0].page, w.released, nil
+}
+
+// writes the nodes of a tree changed by a checkpoint
+type indexWriter struct {
+	pool     *bufferPool
+	released []pageID // pages of the old tree replaced by new ones
+}
+
+// apply sorted ops to the subtree at id, returns the nodes that replace it and their
+// level. a subtree left with no entries is replaced by none
+func (w *indexWriter) apply(id pageID, ops []indexOp) ([]indexChild, int, error) {
+	n, err := readIndexNode(w.pool, id)
+	if err != nil {
+		return nil, 0, err
+	}
+	w.released = append(w.released, id)
+
+	if n.level == 0 {
+		nodes, err := w.writeNodes(0, applyOps(n.entries, ops), nil)
+		return nodes, 0, err
+	}
+
+	var entries []indexEntry
+	var children []pageID
+	for i := range n.entries {
+		// the ops before the next child's entry are this child's
+		end := len(ops)
+		if i+1 < len(n.entries) {
+			end = sort.Search(len(ops), func(k int) bool {
+				return compareEntries(ops[k].entry, n.entries[i+1]) >= 0
+			})
+		}
+		if end == 0 {
+			entries = append(entries, n.entries[i])
+			children = append(children, n.children[i])
+			continue
+		}
+
+		nodes, _, err := w.apply(n.children[i], ops[:end])
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, node := range nodes {
+			entries = append(entries, node.entry)
+			children = append(children, node.page)
+		}
+		ops = ops[end:]
+	}
+
+	nodes, err := w.writeNodes(n.level, entries, children)
+	return nodes, n.level, err
+}
+
+// the entries of a leaf with sorted ops applied
+func applyOps(entries []indexEntry, ops []indexOp) []indexEntry {
+	merged := make([]indexEntry, 0, len(entries)+len(ops))
+	i := 0
+	for _, op := range ops {
+		for i < len(entries) && compareEntries(entries[i], op.entry) < 0 {
+			merged = append(merged, entries[i])
+			i++
+		}
+		if i < len(entries) && compareEntries(entries[i], op.entry) == 0 {
+			i++
+		}
+		if op.add {
+			merged = append(merged, op.entry)
+		}
+	}
+	return append(merged, entries[i:]...)
+}
+
+// write entries to as many new nodes at level as they fill, children are the pages under
+// the entries of internal nodes. returns the lowest entry and the page of each node
+func (w *indexWriter) writeNodes(level int, entries []indexEntry, children []pageID) ([]indexChild, error) {
+	var nodes []indexChild
+	page := make([]byte, pageSize)
+	used, count := indexHeaderSize, 0
+
+	finish := func() error {
+		if count == 0 {
+			return nil
+		}
+		page[0] = byte(level + 1)
+		binary.LittleEndian.PutUint16(page[1:3], uint16(count))
+		id := w.pool.pager.allocate()
+		if err := w.pool.write(id, page); err != nil {
+			return err
+		}
+		nodes[len(nodes)-1].page = id
+		clear(page)
+		used, count = indexHeaderSize, 0
+		return nil
+	}
+
+	for i, entry := range entries {
+		var child pageID
+		if level > 0 {
+			child = children[i]
+		}
+		buf, err := encodeIndexEntry(level, entry, child)
+		if err != nil {
+			return nil, err
+		}
+
+		if used+len(buf) > pageSize {
+			if err := finish(); err != nil {
+				return nil, err
+			}
+		}
+		if count == 0 {
+			nodes = append(nodes, indexChild{entry: entry})
+		}
+		used += copy(page[used:], buf)
+		count++
+	}
+
+	if err := finish(); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// an entry as a node at level stores it, with the child under it for internal nodes
+func encodeIndexEntry(level int, entry indexEntry, child pageID) ([]byte, error) {
+	buf, err := appendKey(nil, entry.key)
+	if err != nil {
+		return nil, err
+	}
+	buf = binary.AppendUvarint(buf, uint64(entry.id))
+	if level > 0 {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(child))
+	}
+	if len(buf) > maxIndexEntrySize {
+		return nil, fmt.Errorf("key of row %d too large for an index page", entry.id)
+	}
+	return buf, nil
+}
+
+// builds a new tree from entries added in order, writing each node once it is full.
+// only the node being filled at each level is held in memory
+type indexBuilder struct {
+	w      *indexWriter
+	levels []*pendingNode
+}
+
+// the entries of a node not yet written
+type pendingNode struct {
+	entries  []indexEntry
+	children []pageID
+	size     int
+	written  bool // a node of the level was written before, it is not the root
+}
+
+func newIndexBuilder(pool *bufferPool) *indexBuilder {
+	return &indexBuilder{w: &indexWriter{pool: pool}}
+}
+
+// add an entry after every one added so far
+func (b *indexBuilder) add(entry indexEntry) error {
+	return b.addAt(0, entry, 0)
+}
+
+func (b *indexBuilder) addAt(level int, entry indexEntry, child pageID) error {
+	if level == len(b.levels) {
+		b.levels = append(b.levels, &pendingNode{size: indexHeaderSize})
+	}
+	n := b.levels[level]
+
+	buf, err := encodeIndexEntry(level, entry, child)
+	if err != nil {
+		return err
+	}
+	if n.size+len(buf) > pageSize {
+		if err := b.flush(level); err != nil {
+			return err
+		}
+	}
+
+	n.entries = append(n.entries, entry)
+	if level > 0 {
+		n.children = append(n.children, child)
+	}
+	n.size += len(buf)
+	return nil
+}
+
+// write the node being filled at level, it goes under the node filled above it
+func (b *indexBuilder) flush(level int) error {
+	n := b.levels[level]
+	nodes, err := b.w.writeNodes(level, n.entries, n.children)
+	if err != nil {
+		return err
+	}
+	*n = pendingNode{size: indexHeaderSize, written: true}
+	// the entries fit in one node
+	return b.addAt(level+1, nodes[0].entry, nodes[0].page)
+}
+
+// write the nodes still being filled, returns the root of the tree, 0 when it has no
+// entries
+func (b *indexBuilder) finish() (pageID, error) {
+	// a flush can start a level above the last
+	for level := 0; level < len(b.levels); level++ {
+		n := b.levels[level]
+		if n.written {
+			if len(n.entries) > 0 {
+				if err := b.flush(level); err != nil {
+					return 0, err
+				}
+			}
+			continue
+		}
+
+		// the top level, a root over one child is left out
+		if level > 0 && len(n.entries) == 1 {
+			return n.children[0], nil
+		}
+		nodes, err := b.w.writeNodes(level, n.entries, n.children)
+		if err != nil || len(nodes) == 0 {
+			return 0, err
+		}
+		return nodes[0].page, nil
+	}
+	return 0, nil
+}
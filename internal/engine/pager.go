@@ -0,0 +1,206 @@
+package engine
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+)
+
+// a database file is made of fixed-size pages, read and written whole
+const pageSize = 8192
+
+// pages 0 and 1 hold two copies of the file header. a checkpoint writes the one not in
+// use, a crash while writing it leaves the other
+const (
+	headerPages = 2
+	pagerMagic  = "RDBMSPG1"
+)
+
+type pageID uint32
+
+// the header points at the catalog of the last checkpoint, the copy with a valid
+// checksum and the highest generation is the current one
+type fileHeader struct {
+	generation  uint64
+	catalog     pageID // first page of the catalog, 0 for an empty database
+	catalogSize uint32 // length of the encoded catalog in bytes
+}
+
+// a database file of fixed-size pages. pages no checkpoint refers to are reused before
+// the file grows
+type pager struct {
+	file   *os.File
+	header fileHeader
+	count  pageID   // pages in the file
+	free   []pageID // pages not in use
+}
+
+// open a database file, creating it with an empty header if needed
+func openPager(path string) (*pager, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	p := &pager{file: file, count: pageID((info.Size() + pageSize - 1) / pageSize)}
+	if info.Size() == 0 {
+		// both copies, so the file is never without a valid header
+		p.count = headerPages
+		for slot := 0; slot < headerPages; slot++ {
+			if err := p.write(pageID(slot), encodeHeader(fileHeader{})); err != nil {
+				file.Close()
+				return nil, err
+			}
+		}
+		if err := p.sync(); err != nil {
+			file.Close()
+			return nil, err
+		}
+		return p, nil
+	}
+
+	found := false
+	buf := make([]byte, pageSize)
+	for slot := 0; slot < headerPages; slot++ {
+		if err := p.read(pageID(slot), buf); err != nil {
+			file.Close()
+			return nil, err
+		}
+		header, ok := decodeHeader(buf)
+		if ok && (!found || header.generation > p.header.generation) {
+			p.header = header
+			found = true
+		}
+	}
+	if !found {
+		file.Close()
+		return nil, fmt.Errorf("%s is not a database file or its header is damaged", path)
+	}
+
+	return p, nil
+}
+
+// header layout: magic, checksum of the rest, generation, catalog page, catalog size
+func encodeHeader(h fileHeader) []byte {
+	buf := make([]byte, pageSize)
+	copy(buf[0:8], pagerMagic)
+	binary.LittleEndian.PutUint64(buf[12:20], h.generation)
+	binary.LittleEndian.PutUint32(buf[20:24], uint32(h.catalog))
+	binary.LittleEndian.PutUint32(buf[24:28], h.catalogSize)
+	binary.LittleEndian.PutUint32(buf[8:12], crc32.ChecksumIEEE(buf[12:28]))
+	return buf
+}
+
+func decodeHeader(buf []byte) (fileHeader, bool) {
+	if string(buf[0:8]) != pagerMagic || crc32.ChecksumIEEE(buf[12:28]) != binary.LittleEndian.Uint32(buf[8:12]) {
+		return fileHeader{}, false
+	}
+	return fileHeader{
+		generation:  binary.LittleEndian.Uint64(buf[12:20]),
+		catalog:     pageID(binary.LittleEndian.Uint32(buf[20:24])),
+		catalogSize: binary.LittleEndian.Uint32(buf[24:28]),
+	}, true
+}
+
+// read a page into buf, a page past the end of the file reads as zeros
+func (p *pager) read(id pageID, buf []byte) error {
+	n, err := p.file.ReadAt(buf[:pageSize], int64(id)*pageSize)
+	if err == io.EOF {
+		clear(buf[n:pageSize])
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read page %d: %w", id, err)
+	}
+	return nil
+}
+
+func (p *pager) write(id pageID, buf []byte) error {
+	if _, err := p.file.WriteAt(buf[:pageSize], int64(id)*pageSize); err != nil {
+		return fmt.Errorf("write page %d: %w", id, err)
+	}
+	return nil
+}
+
+// take a page that is not in use, growing the file when none is free
+func (p *pager) allocate() pageID {
+	if n := len(p.free); n > 0 {
+		id := p.free[n-1]
+		p.free = p.free[:n-1]
+		return id
+	}
+	id := p.count
+	p.count++
+	return id
+}
+
+// the pages not in use when the file is opened: the ones the last checkpoint listed as
+// free and every page from count on, which a checkpoint that did not finish may have
+// written. the pages of taken are in use whatever the list says
+func (p *pager) setFree(free []pageID, count pageID, taken []pageID) {
+	inUse := make(map[pageID]bool, len(taken))
+	for _, id := range taken {
+		inUse[id] = true
+	}
+
+	p.count = max(p.count, count)
+	p.free = p.free[:0]
+	for _, id := range free {
+		if !inUse[id] {
+			p.free = append(p.free, id)
+		}
+	}
+	for id := max(count, headerPages); id < p.count; id++ {
+		if !inUse[id] {
+			p.free = append(p.free, id)
+		}
+	}
+	p.sortFree()
+}
+
+// give back pages a checkpoint no longer uses, once its header is written
+func (p *pager) release(ids []pageID) {
+	p.free = append(p.free, ids...)
+	p.sortFree()
+}
+
+// the lowest free page is taken first, so the file stays short
+func (p *pager) sortFree() {
+	sort.Slice(p.free, func(i, j int) bool {
+		return p.free[i] > p.free[j]
+	})
+}
+
+// write a new header over the copy not in use and sync it, the checkpoint it points
+// at is current once this returns
+func (p *pager) writeHeader(h fileHeader) error {
+	h.generation = p.header.generation + 1
+	if err := p.write(pageID(h.generation%headerPages), encodeHeader(h)); err != nil {
+		return err
+	}
+	if err := p.sync(); err != nil {
+		return err
+	}
+	p.header = h
+	return nil
+}
+
+func (p *pager) sync() error {
+	if err := p.file.Sync(); err != nil {
+		return fmt.Errorf("sync database file: %w", err)
+	}
+	return nil
+}
+
+func (p *pager) close() error {
+	return p.file.Close()
+}
@@ -0,0 +1,410 @@
+package engine
+
+import (
+	"sort"
+
+	"github.com/raskovnik/rdbms/internal/ast"
+)
+
+// produce the rows of a table the transaction sees that match where, sorted by orderBy
+// when given, until fn returns false. an index is used to find the matching rows or to
+// read them in order. indexes also hold keys of row versions the transaction does not
+// see, so every candidate is checked against the condition again. an error reading a
+// row ends the scan
+func (tx *Tx) scanRows(table *Table, where ast.Expression, orderBy []ast.OrderByItem, fn func(pos int, row Row) bool) error {
+	where = tx.bind(where)
+
+	var conjuncts []ast.Expression
+	if where != nil {
+		conjuncts = splitConjuncts(where)
+	}
+
+	matches := func(row Row) bool {
+		return where == nil || evaluateWhere(row, where)
+	}
+
+	// an equality lookup finds the fewest rows, sorting them is cheap
+	positions, indexed, err := equalityLookup(table, conjuncts)
+	if err != nil {
+		return err
+	}
+	if indexed {
+		return tx.emitSorted(table, positions, matches, orderBy, fn)
+	}
+
+	// read an ordered index in ORDER BY order, restricted to the WHERE range on the
+	// same column if there is one
+	if index, descending, ok := orderIndex(table, orderBy); ok {
+		var lo, hi *Bound
+		if col, rangeLo, rangeHi, ok := rangeBounds(table, conjuncts); ok && col == orderBy[0].Column && len(orderBy) == 1 {
+			lo, hi = rangeLo, rangeHi
+		}
+
+		info := index.Info()
+		scanErr := index.Scan(lo, hi, descending, func(key interface{}, rowIndices []int) bool {
+			// rows with equal keys stay in table order, like a stable sort. a row is
+			// emitted under the key of the version the transaction sees
+			for _, pos := range rowIndices {
+				var row Row
+				var ok bool
+				if row, ok, err = tx.visible(table, pos); err != nil {
+					return false
+				}
+				if !ok || compareKeys(info.key(row), key) != 0 || !matches(row) {
+					continue
+				}
+				if !fn(pos, row) {
+					return false
+				}
+			}
+			return true
+		})
+		if err == nil {
+			err = scanErr
+		}
+		return err
+	}
+
+	positions, indexed, err = rangeLookup(table, conjuncts)
+	if err != nil {
+		return err
+	}
+	if indexed {
+		return tx.emitSorted(table, positions, matches, orderBy, fn)
+	}
+
+	// full table scan
+	return tx.emitSorted(table, nil, matches, orderBy, fn)
+}
+
+// filter rows at the given positions (every row when nil), sort them and pass them on.
+// without ORDER BY rows are passed on as they are found so fn can stop the scan early
+func (tx *Tx) emitSorted(table *Table, positions []int, matches func(Row) bool, orderBy []ast.OrderByItem, fn func(int, Row) bool) error {
+	if positions == nil {
+		positions = make([]int, table.ids)
+		for i := range positions {
+			positions[i] = i
+		}
+	}
+
+	if len(orderBy) == 0 {
+		for _, pos := range positions {
+			row, ok, err := tx.visible(table, pos)
+			if err != nil {
+				return err
+			}
+			if ok && matches(row) && !fn(pos, row) {
+				return nil
+			}
+		}
+		return nil
+	}
+
+	var found []int
+	var rows []Row
+	for _, pos := range positions {
+		row, ok, err := tx.visible(table, pos)
+		if err != nil {
+			return err
+		}
+		if ok && matches(row) {
+			found = append(found, pos)
+			rows = append(rows, row)
+		}
+	}
+
+	order := make([]int, len(rows))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return lessRow(rows[order[i]], rows[order[j]], orderBy)
+	})
+
+	for _, i := range order {
+		if !fn(found[i], rows[i]) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// stable sort by each ORDER BY column in turn
+func sortRows(rows []Row, orderBy []ast.OrderByItem) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		return lessRow(rows[i], rows[j], orderBy)
+	})
+}
+
+// compare two rows by each ORDER BY column in turn
+func lessRow(a, b Row, orderBy []ast.OrderByItem) bool {
+	for _, item := range orderBy {
+		cmp := compareKeys(a[item.Column], b[item.Column])
+		if cmp == 0 {
+			continue
+		}
+		if item.Descending {
+			return cmp > 0
+		}
+		return cmp < 0
+	}
+	return false
+}
+
+// find an ordered index whose columns are the ORDER BY columns, all sorted the same way
+func orderIndex(table *Table, orderBy []ast.OrderByItem) (OrderedIndex, bool, bool) {
+	if len(orderBy) == 0 {
+		return nil, false, false
+	}
+
+	descending := orderBy[0].Descending
+	for _, item := range orderBy {
+		if item.Descending != descending {
+			return nil, false, false
+		}
+	}
+
+	for _, index := range sortedIndexes(table) {
+		ordered, isOrdered := index.(OrderedIndex)
+		cols := index.Info().Columns
+		if !isOrdered || len(cols) != len(orderBy) {
+			continue
+		}
+
+		matched := true
+		for i, item := range orderBy {
+			if cols[i] != item.Column {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return ordered, descending, true
+		}
+	}
+
+	return nil, false, false
+}
+
+// find candidate rows for a WHERE condition through an index, ok is false when no
+// index applies and the caller must scan. candidates are returned in table order and
+// still have to be checked against the full condition -> a = 1 AND b > 2 can use an
+// index on a, or an ordered index on b
+func indexCandidates(table *Table, where ast.Expression) ([]int, bool, error) {
+	conjuncts := splitConjuncts(where)
+
+	if positions, indexed, err := equalityLookup(table, conjuncts); err != nil || indexed {
+		return positions, indexed, err
+	}
+	return rangeLookup(table, conjuncts)
+}
+
+// look up rows through an index with an equality condition on each of its columns,
+// or on its leading columns
+func equalityLookup(table *Table, conjuncts []ast.Expression) ([]int, bool, error) {
+	equal := make(map[string]interface{})
+	for _, cond := range conjuncts {
+		if col, op, value, ok := columnComparison(cond); ok && op == "=" {
+			equal[col] = value
+		}
+		// NULLs are indexed, col IS NULL looks them up like col = NULL would
+		if isNull, ok := cond.(*ast.IsNullExpression); ok && !isNull.Not {
+			if ident, ok := isNull.Operand.(*ast.Identifier); ok {
+				equal[ident.Name] = nil
+			}
+		}
+	}
+
+	if len(equal) == 0 {
+		return nil, false, nil
+	}
+
+	for _, index := range sortedIndexes(table) {
+		if key, ok := equalityKey(index.Info(), equal); ok {
+			positions, err := index.Lookup(key)
+			return positions, true, err
+		}
+	}
+
+	// otherwise the ordered index on several columns with the longest run of leading
+	// columns that have one -> a = 1 uses an index on (a, b)
+	var best OrderedIndex
+	var prefix Tuple
+	for _, index := range sortedIndexes(table) {
+		ordered, isOrdered := index.(OrderedIndex)
+		if !isOrdered {
+			continue
+		}
+
+		var values Tuple
+		for _, col := range index.Info().Columns {
+			value, ok := equal[col]
+			if !ok {
+				break
+			}
+			values = append(values, value)
+		}
+		if len(values) > len(prefix) {
+			best, prefix = ordered, values
+		}
+	}
+	if best == nil {
+		return nil, false, nil
+	}
+	positions, err := prefixLookup(best, prefix)
+	return positions, true, err
+}
+
+// positions of the rows whose key in an index on several columns starts with prefix,
+// in table order. a key sorts after its own prefix, so the scan starts there and stops
+// at the first key with another prefix
+func prefixLookup(index OrderedIndex, prefix Tuple) ([]int, error) {
+	seen := make(map[int]bool)
+	var positions []int
+	err := index.Scan(&Bound{Value: prefix, Inclusive: true}, nil, false, func(key interface{}, rowIndices []int) bool {
+		if compareKeys(key.(Tuple)[:len(prefix)], prefix) != 0 {
+			return false
+		}
+		for _, pos := range rowIndices {
+			if !seen[pos] {
+				seen[pos] = true
+				positions = append(positions, pos)
+			}
+		}
+		return true
+	})
+	sort.Ints(positions)
+
+	return positions, err
+}
+
+// scan the range of an ordered index that the range conditions allow
+func rangeLookup(table *Table, conjuncts []ast.Expression) ([]int, bool, error) {
+	col, lo, hi, ok := rangeBounds(table, conjuncts)
+	if !ok {
+		return nil, false, nil
+	}
+
+	index, _ := table.indexOn(col)
+
+	// a row can be in the range under the keys of several of its versions
+	seen := make(map[int]bool)
+	var positions []int
+	err := index.(OrderedIndex).Scan(lo, hi, false, func(_ interface{}, rowIndices []int) bool {
+		for _, pos := range rowIndices {
+			if !seen[pos] {
+				seen[pos] = true
+				positions = append(positions, pos)
+			}
+		}
+		return true
+	})
+	sort.Ints(positions)
+
+	return positions, true, err
+}
+
+// indexes by name, so plans do not depend on map order
+func sortedIndexes(table *Table) []Index {
+	names := make([]string, 0, len(table.Indexes))
+	for name := range table.Indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	indexes := make([]Index, len(names))
+	for i, name := range names {
+		indexes[i] = table.Indexes[name]
+	}
+	return indexes
+}
+
+// build the key of an index from equality conditions on all of its columns
+func equalityKey(info *IndexInfo, equal map[string]interface{}) (interface{}, bool) {
+	key := make(Row, len(info.Columns))
+	for _, col := range info.Columns {
+		value, ok := equal[col]
+		if !ok {
+			return nil, false
+		}
+		key[col] = value
+	}
+	return info.key(key), true
+}
+
+// flatten a AND b AND c into its conditions
+func splitConjuncts(expr ast.Expression) []ast.Expression {
+	if be, ok := expr.(*ast.BinaryExpression); ok && be.Operator == "AND" {
+		return append(splitConjuncts(be.Left), splitConjuncts(be.Right)...)
+	}
+	return []ast.Expression{expr}
+}
+
+// match col op literal, or literal op col with the operator flipped -> 5 > a is a < 5
+func columnComparison(expr ast.Expression) (string, string, interface{}, bool) {
+	be, ok := expr.(*ast.BinaryExpression)
+	if !ok {
+		return "", "", nil, false
+	}
+
+	if ident, ok := be.Left.(*ast.Identifier); ok {
+		if lit, ok := be.Right.(*ast.Literal); ok {
+			return ident.Name, be.Operator, lit.Value, true
+		}
+	}
+
+	if ident, ok := be.Right.(*ast.Identifier); ok {
+		if lit, ok := be.Left.(*ast.Literal); ok {
+			flipped := map[string]string{"<": ">", "<=": ">=", ">": "<", ">=": "<=", "=": "=", "!=": "!="}
+			return ident.Name, flipped[be.Operator], lit.Value, true
+		}
+	}
+
+	return "", "", nil, false
+}
+
+// combine the range conditions on the first column with an ordered index into a
+// lower and upper bound -> a > 1 AND a <= 5 is (1, 5]
+func rangeBounds(table *Table, conjuncts []ast.Expression) (string, *Bound, *Bound, bool) {
+	var col string
+	var lo, hi *Bound
+
+	for _, cond := range conjuncts {
+		name, op, value, ok := columnComparison(cond)
+		if !ok || (col != "" && name != col) {
+			continue
+		}
+		index, _ := table.indexOn(name)
+		if _, ordered := index.(OrderedIndex); !ordered {
+			continue
+		}
+
+		switch op {
+		case ">", ">=":
+			bound := &Bound{Value: value, Inclusive: op == ">="}
+			if lo == nil || tighterLower(bound, lo) {
+				lo = bound
+			}
+		case "<", "<=":
+			bound := &Bound{Value: value, Inclusive: op == "<="}
+			if hi == nil || tighterUpper(bound, hi) {
+				hi = bound
+			}
+		default:
+			continue
+		}
+		col = name
+	}
+
+	return col, lo, hi, col != ""
+}
+
+func tighterLower(a, b *Bound) bool {
+	cmp := compareKeys(a.Value, b.Value)
+	return cmp > 0 || cmp == 0 && !a.Inclusive
+}
+
+func tighterUpper(a, b *Bound) bool {
+	cmp := compareKeys(a.Value, b.Value)
+	return cmp < 0 || cmp == 0 && !a.Inclusive
+}
@@ -0,0 +1,181 @@
+package engine
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/raskovnik/rdbms/internal/ast"
+)
+
+// a counter handing out INT values to nextval() and SERIAL columns. values are never
+// given back, a rolled back insert leaves a gap
+type Sequence struct {
+	Name      string
+	Increment int
+	Owner     string // table whose SERIAL column it fills, dropped with that table
+
+	// the sequences map only changes under the write latch, but values are also taken
+	// by statements that read, so the counter itself is atomic
+	next atomic.Int64
+}
+
+// how a sequence is written to the log and snapshots
+type sequenceState struct {
+	Name      string
+	Next      int // the value nextval() returns next
+	Increment int
+	Owner     string
+}
+
+func newSequence(state sequenceState) *Sequence {
+	seq := &Sequence{Name: state.Name, Increment: state.Increment, Owner: state.Owner}
+	seq.next.Store(int64(state.Next))
+	return seq
+}
+
+func (s *Sequence) state() sequenceState {
+	return sequenceState{Name: s.Name, Next: int(s.next.Load()), Increment: s.Increment, Owner: s.Owner}
+}
+
+// take the next value
+func (s *Sequence) nextval() int {
+	return int(s.next.Add(int64(s.Increment)) - int64(s.Increment))
+}
+
+// the sequence behind a SERIAL column -> todos_id_seq
+func serialSequenceName(table, column string) string {
+	return table + "_" + column + "_seq"
+}
+
+func (tx *Tx) executeCreateSequence(stmt *ast.CreateSequenceStatement) error {
+	if _, exists := tx.db.sequences[stmt.Name]; exists {
+		if stmt.IfNotExists {
+			return nil
+		}
+		return fmt.Errorf("sequence %s already exists", stmt.Name)
+	}
+	if stmt.Increment == 0 {
+		return fmt.Errorf("INCREMENT of sequence %s cannot be 0", stmt.Name)
+	}
+
+	tx.createSequence(sequenceState{Name: stmt.Name, Next: stmt.Start, Increment: stmt.Increment})
+	return nil
+}
+
+func (tx *Tx) createSequence(state sequenceState) {
+	tx.saveSequence(state.Name)
+	tx.logOps(walOp{Kind: walCreateSequence, Sequence: &state})
+	tx.db.sequences[state.Name] = newSequence(state)
+}
+
+// take the next value of a sequence in the transaction. its new position is logged at
+// commit, a sequence used only by a rolled back transaction may hand the same values
+// out again after a restart since none of them were stored
+func (tx *Tx) nextval(name string) (int, bool) {
+	seq, exists := tx.db.sequences[name]
+	if !exists {
+		return 0, false
+	}
+
+	if tx.advanced == nil {
+		tx.advanced = make(map[*Sequence]bool)
+	}
+	tx.advanced[seq] = true
+	return seq.nextval(), true
+}
+
+// check that every nextval() call in a checked expression names an existing sequence,
+// calls is true if there is any
+func (tx *Tx) checkSequences(expr ast.Expression) (calls bool, err error) {
+	switch e := expr.(type) {
+	case *ast.FunctionCall:
+		if e.Name == "NEXTVAL" {
+			name, ok := sequenceName(e)
+			if !ok {
+				return true, fmt.Errorf("NEXTVAL takes the name of a sequence, got %s", e.Args[0])
+			}
+			if _, exists := tx.db.sequences[name]; !exists {
+				return true, fmt.Errorf("sequence %s does not exist", name)
+			}
+			calls = true
+		}
+		for _, arg := range e.Args {
+			argCalls, err := tx.checkSequences(arg)
+			if err != nil {
+				return true, err
+			}
+			calls = calls || argCalls
+		}
+		return calls, nil
+	case *ast.ExtractExpression:
+		return tx.checkSequences(e.Source)
+	case *ast.UnaryExpression:
+		return tx.checkSequences(e.Operand)
+	case *ast.IsNullExpression:
+		return tx.checkSequences(e.Operand)
+	case *ast.BinaryExpression:
+		leftCalls, err := tx.checkSequences(e.Left)
+		if err != nil {
+			return true, err
+		}
+		rightCalls, err := tx.checkSequences(e.Right)
+		return leftCalls || rightCalls, err
+	}
+	return false, nil
+}
+
+// the sequence a NEXTVAL call names -> nextval('todos_id_seq')
+func sequenceName(call *ast.FunctionCall) (string, bool) {
+	lit, ok := call.Args[0].(*ast.Literal)
+	if !ok {
+		return "", false
+	}
+	name, ok := lit.Value.(string)
+	return name, ok
+}
+
+// remember a sequence before the transaction creates, drops or moves it
+func (tx *Tx) saveSequence(name string) {
+	if _, saved := tx.savedSequences[name]; saved {
+		return
+	}
+
+	seq, exists := tx.db.sequences[name]
+	if !exists {
+		tx.savedSequences[name] = &savedSequence{}
+		return
+	}
+	tx.savedSequences[name] = &savedSequence{sequence: seq, owner: seq.Owner}
+}
+
+// a sequence before a change in a transaction, its position is not restored
+type savedSequence struct {
+	sequence *Sequence // nil if the transaction created it
+	owner    string
+}
+
+// the sequences of a table's SERIAL columns, dropped with the table and moved when it
+// is renamed
+func (db *Database) ownedSequences(table string) []*Sequence {
+	var owned []*Sequence
+	for _, seq := range db.sequences {
+		if seq.Owner == table {
+			owned = append(owned, seq)
+		}
+	}
+	return owned
+}
+
+// fill a SERIAL column from a new sequence named after it, as if it were declared
+// INT NOT NULL DEFAULT nextval('table_col_seq')
+func (tx *Tx) createSerial(table string, col *ast.ColumnDef) error {
+	name := serialSequenceName(table, col.Name)
+	if _, exists := tx.db.sequences[name]; exists {
+		return fmt.Errorf("sequence %s already exists", name)
+	}
+
+	tx.createSequence(sequenceState{Name: name, Next: 1, Increment: 1, Owner: table})
+	col.Default = &ast.FunctionCall{Name: "NEXTVAL", Args: []ast.Expression{&ast.Literal{Value: name}}}
+	col.NotNull = true
+	return nil
+}
@@ -0,0 +1,225 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestSerialColumns(t *testing.T) {
+	db := NewDB()
+	execSQL(t, db, "CREATE TABLE todos (id SERIAL PRIMARY KEY, task TEXT NOT NULL)")
+
+	rows := execSQL(t, db, "INSERT INTO todos (task) VALUES ('write tests'), ('ship') RETURNING id").([]Row)
+	if fmt.Sprint(rows) != "[map[id:1] map[id:2]]" {
+		t.Errorf("wrong ids returned. got=%v", rows)
+	}
+
+	// a rolled back insert leaves a gap, the value is not handed out again
+	tx := db.Begin()
+	execTx(t, tx, "INSERT INTO todos (task) VALUES ('discarded')")
+	tx.Rollback()
+
+	rows = execSQL(t, db, "INSERT INTO todos (task) VALUES ('review') RETURNING *").([]Row)
+	if len(rows) != 1 || rows[0]["id"] != 4 || rows[0]["task"] != "review" {
+		t.Errorf("wrong row after a rolled back insert. got=%v", rows)
+	}
+
+	if col, _ := db.tables["todos"].column("id"); col.Type != "INT" || !col.NotNull || col.Default.String() != "NEXTVAL('todos_id_seq')" {
+		t.Errorf("wrong SERIAL column definition: %+v", col)
+	}
+
+	execSQL(t, db, "CREATE TABLE notes (id INT PRIMARY KEY AUTOINCREMENT, body TEXT)")
+	execSQL(t, db, "INSERT INTO notes (body) VALUES ('a'), ('b')")
+	if rows := execSQL(t, db, "SELECT * FROM notes WHERE id = 2").([]Row); len(rows) != 1 || rows[0]["body"] != "b" {
+		t.Errorf("wrong rows for an AUTOINCREMENT column: %v", rows)
+	}
+
+	for _, input := range []string{
+		"CREATE TABLE other (id SERIAL DEFAULT 1)",
+		"ALTER TABLE notes ADD COLUMN n SERIAL",
+		"INSERT INTO todos (task) VALUES ('x') RETURNING missing",
+	} {
+		if _, err := db.Execute(parseSQL(t, input)); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+}
+
+func TestCreateSequence(t *testing.T) {
+	db := NewDB()
+	execSQL(t, db, "CREATE SEQUENCE order_numbers START WITH 100 INCREMENT BY 10")
+	execSQL(t, db, "CREATE SEQUENCE IF NOT EXISTS order_numbers")
+	execSQL(t, db, "CREATE TABLE orders (id INT PRIMARY KEY DEFAULT nextval('order_numbers'), total INT)")
+
+	execSQL(t, db, "INSERT INTO orders (total) VALUES (5), (7)")
+	execSQL(t, db, "INSERT INTO orders VALUES (1, 9)")
+	rows := execSQL(t, db, "SELECT * FROM orders ORDER BY id").([]Row)
+	if len(rows) != 3 || rows[0]["id"] != 1 || rows[1]["id"] != 100 || rows[2]["id"] != 110 {
+		t.Errorf("wrong ids from the sequence: %v", rows)
+	}
+
+	// an empty table can take a column filled from a sequence
+	execSQL(t, db, "CREATE TABLE tickets (title TEXT)")
+	execSQL(t, db, "ALTER TABLE tickets ADD COLUMN number INT DEFAULT nextval('order_numbers')")
+	rows = execSQL(t, db, "INSERT INTO tickets (title) VALUES ('a') RETURNING number").([]Row)
+	if len(rows) != 1 || rows[0]["number"] != 120 {
+		t.Errorf("wrong value from the sequence: %v", rows)
+	}
+
+	for _, input := range []string{
+		"CREATE SEQUENCE order_numbers",
+		"CREATE SEQUENCE still INCREMENT BY 0",
+		"CREATE TABLE bad (id INT DEFAULT nextval('missing'))",
+		"CREATE TABLE bad (id INT DEFAULT nextval(1))",
+		"ALTER TABLE orders ADD COLUMN number INT DEFAULT nextval('order_numbers')",
+	} {
+		if _, err := db.Execute(parseSQL(t, input)); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+}
+
+func TestNextvalInValuesAndSet(t *testing.T) {
+	db := NewDB()
+	execSQL(t, db, "CREATE SEQUENCE ids START WITH 10")
+	execSQL(t, db, "CREATE TABLE items (id INT PRIMARY KEY, n INT, name TEXT)")
+
+	// every row takes its own value
+	rows := execSQL(t, db, "INSERT INTO items VALUES (nextval('ids'), 1, 'a'), (nextval('ids'), 2, 'b') RETURNING id").([]Row)
+	if fmt.Sprint(rows) != "[map[id:10] map[id:11]]" {
+		t.Errorf("wrong ids from VALUES. got=%v", rows)
+	}
+
+	if n := execSQL(t, db, "UPDATE items SET id = nextval('ids'), n = n * 10"); n != 2 {
+		t.Fatalf("expected 2 rows updated, got %v", n)
+	}
+	rows = execSQL(t, db, "SELECT id, n FROM items ORDER BY id").([]Row)
+	if fmt.Sprint(rows) != "[map[id:12 n:10] map[id:13 n:20]]" {
+		t.Errorf("wrong rows after SET from the sequence. got=%v", rows)
+	}
+
+	for _, input := range []string{
+		"INSERT INTO items VALUES (nextval('missing'), 1, 'c')",
+		"INSERT INTO items VALUES (n + 1, 1, 'c')",
+		"INSERT INTO items VALUES (nextval('ids'), 'x', 'c')",
+		"UPDATE items SET id = nextval(1)",
+		"UPDATE items SET n = missing + 1",
+		"UPDATE items SET n = name",
+	} {
+		if _, err := db.Execute(parseSQL(t, input)); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+}
+
+func TestDropTableDropsSerialSequence(t *testing.T) {
+	db := NewDB()
+	execSQL(t, db, "CREATE TABLE todos (id SERIAL PRIMARY KEY, task TEXT)")
+	execSQL(t, db, "INSERT INTO todos (task) VALUES ('a'), ('b')")
+
+	// renaming the table keeps its sequence, dropping it drops the sequence too
+	tx := db.Begin()
+	execTx(t, tx, "ALTER TABLE todos RENAME TO tasks")
+	execTx(t, tx, "DROP TABLE tasks")
+	if _, exists := db.sequences["todos_id_seq"]; exists {
+		t.Error("sequence left after dropping its table")
+	}
+	tx.Rollback()
+
+	seq, exists := db.sequences["todos_id_seq"]
+	if !exists || seq.Owner != "todos" {
+		t.Fatalf("sequence not restored by rollback: %v", seq)
+	}
+	if rows := execSQL(t, db, "INSERT INTO todos (task) VALUES ('c') RETURNING id").([]Row); rows[0]["id"] != 3 {
+		t.Errorf("restored sequence lost its position. got=%v", rows)
+	}
+
+	execSQL(t, db, "DROP TABLE todos")
+	execSQL(t, db, "CREATE TABLE todos (id SERIAL, task TEXT)")
+	if rows := execSQL(t, db, "INSERT INTO todos (task) VALUES ('a') RETURNING id").([]Row); rows[0]["id"] != 1 {
+		t.Errorf("recreated table did not start a new sequence. got=%v", rows)
+	}
+}
+
+func TestSerialConcurrentInserts(t *testing.T) {
+	db := NewDB()
+	execSQL(t, db, "CREATE TABLE todos (id SERIAL PRIMARY KEY, task TEXT)")
+
+	const writers, inserts = 8, 25
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*inserts)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < inserts; i++ {
+				if _, err := db.Execute(parseSQL(t, "INSERT INTO todos (task) VALUES ('x')")); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("concurrent insert failed: %v", err)
+	}
+	rows := execSQL(t, db, "SELECT COUNT(*), MAX(id) FROM todos").([]Row)
+	if rows[0]["COUNT(*)"] != writers*inserts || rows[0]["MAX(id)"] != writers*inserts {
+		t.Errorf("ids were not handed out once each: %v", rows)
+	}
+}
+
+func TestSequencesSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	db := openDurable(t, dir)
+	execSQL(t, db, "CREATE TABLE todos (id SERIAL PRIMARY KEY, task TEXT)")
+	execSQL(t, db, "INSERT INTO todos (task) VALUES ('a'), ('b')")
+	execSQL(t, db, "CHECKPOINT")
+	execSQL(t, db, "INSERT INTO todos (task) VALUES ('c')")
+	execSQL(t, db, "CREATE SEQUENCE tickets START 50")
+	execSQL(t, db, "CREATE TABLE issues (id INT DEFAULT nextval('tickets'), title TEXT)")
+	execSQL(t, db, "INSERT INTO issues (title) VALUES ('x')")
+	db.Close()
+
+	db = openDurable(t, dir)
+	rows := execSQL(t, db, "INSERT INTO todos (task) VALUES ('d') RETURNING id").([]Row)
+	if rows[0]["id"] != 4 {
+		t.Errorf("sequence restarted from a stale position. got=%v", rows)
+	}
+
+	// the sequence state is part of the next snapshot
+	execSQL(t, db, "CHECKPOINT")
+	db.Close()
+
+	db = openDurable(t, dir)
+	defer db.Close()
+	rows = execSQL(t, db, "INSERT INTO todos (task) VALUES ('e') RETURNING id").([]Row)
+	if rows[0]["id"] != 5 {
+		t.Errorf("sequence lost in the snapshot. got=%v", rows)
+	}
+	if seq, exists := db.sequences["tickets"]; !exists || seq.nextval() != 51 {
+		t.Errorf("standalone sequence lost after restart: %v", seq)
+	}
+}
+
+func TestReadOnlyNextvalSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	db := openDurable(t, dir)
+	execSQL(t, db, "CREATE SEQUENCE tickets")
+	execSQL(t, db, "CREATE TABLE issues (id INT)")
+	// a statement that changes nothing still hands out values
+	execSQL(t, db, "SELECT * FROM issues WHERE id = nextval('tickets')")
+	execSQL(t, db, "SELECT * FROM issues WHERE id = nextval('tickets')")
+	db.Close()
+
+	db = openDurable(t, dir)
+	defer db.Close()
+	if seq := db.sequences["tickets"]; seq.nextval() != 3 {
+		t.Errorf("values taken by a read only statement handed out again after restart")
+	}
+}
@@ -0,0 +1,235 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/raskovnik/rdbms/internal/ast"
+)
+
+const snapshotFileName = "snapshot.db"
+
+// point in time copy of every table, LSN is the last log record it contains
+type snapshot struct {
+	LSN       uint64
+	Tables    []tableSnapshot
+	Sequences []sequenceState
+}
+
+type tableSnapshot struct {
+	Name    string
+	Schema  []ast.ColumnDef
+	Keys    []ast.KeyConstraint
+	Checks  []ast.CheckConstraint
+	Rows    []Row
+	Indexes []IndexInfo // index contents are rebuilt from Rows on load
+}
+
+// write a snapshot of all tables and truncate the log up to it, so restart only
+// replays changes made after the last checkpoint. readers keep running while the
+// snapshot is written, it waits for a running write transaction and writers wait for it.
+// a database opened with Open writes the changed rows to its pages instead
+func (db *Database) Checkpoint() error {
+	db.checkpointMu.Lock()
+	defer db.checkpointMu.Unlock()
+
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+
+	if db.pool != nil {
+		// rows move between memory and pages, statements wait
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		return db.checkpointPages()
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.wal == nil {
+		return fmt.Errorf("checkpoint requires a durable database")
+	}
+
+	snap := snapshot{LSN: db.lsn}
+	for _, table := range db.tables {
+		ts := tableSnapshot{
+			Name:   table.Name,
+			Schema: table.Schema,
+			Keys:   table.Keys,
+			Checks: table.Checks,
+		}
+		// with no write transaction running, the current rows are the committed ones
+		rows, err := table.liveRows()
+		if err != nil {
+			return err
+		}
+		ts.Rows = rows
+		for _, index := range sortedIndexes(table) {
+			ts.Indexes = append(ts.Indexes, *index.Info())
+		}
+		snap.Tables = append(snap.Tables, ts)
+	}
+
+	for _, seq := range db.sequences {
+		snap.Sequences = append(snap.Sequences, seq.state())
+	}
+
+	if err := writeSnapshot(db.dir, snap); err != nil {
+		return err
+	}
+
+	// every logged change is now in the snapshot. if we crash before truncating,
+	// replay skips records up to snap.LSN
+	return db.wal.truncate()
+}
+
+// run Checkpoint on a timer until stop is called, failures are passed to onError.
+// stop waits for a running checkpoint to finish
+func (db *Database) CheckpointEvery(interval time.Duration, onError func(error)) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-ticker.C:
+				if err := db.Checkpoint(); err != nil && onError != nil {
+					onError(err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+		<-stopped
+	}
+}
+
+// write the snapshot to a temporary file and rename it into place, a crash leaves
+// either the old or the new snapshot
+func writeSnapshot(dir string, snap snapshot) error {
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(snap); err != nil {
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+
+	header := make([]byte, walHeaderSize)
+	binary.LittleEndian.PutUint32(header[0:4], uint32(payload.Len()))
+	binary.LittleEndian.PutUint32(header[4:8], crc32.ChecksumIEEE(payload.Bytes()))
+
+	tmpPath := filepath.Join(dir, snapshotFileName+".tmp")
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(append(header, payload.Bytes()...)); err != nil {
+		file.Close()
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("sync snapshot: %w", err)
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, filepath.Join(dir, snapshotFileName)); err != nil {
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+// read the snapshot in dir, ok is false when none has been written yet
+func readSnapshot(dir string) (snap snapshot, ok bool, err error) {
+	file, err := os.Open(filepath.Join(dir, snapshotFileName))
+	if os.IsNotExist(err) {
+		return snap, false, nil
+	}
+	if err != nil {
+		return snap, false, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return snap, false, err
+	}
+
+	header := make([]byte, walHeaderSize)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return snap, false, fmt.Errorf("read snapshot: %w", err)
+	}
+
+	length := binary.LittleEndian.Uint32(header[0:4])
+	if int64(length) > info.Size()-walHeaderSize {
+		return snap, false, fmt.Errorf("read snapshot: length %d past the end of the file", length)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(file, payload); err != nil {
+		return snap, false, fmt.Errorf("read snapshot: %w", err)
+	}
+
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:8]) {
+		return snap, false, fmt.Errorf("snapshot checksum mismatch")
+	}
+
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&snap); err != nil {
+		return snap, false, fmt.Errorf("decode snapshot: %w", err)
+	}
+
+	return snap, true, nil
+}
+
+// restore the tables of a snapshot and rebuild their indexes
+func (db *Database) loadSnapshot(snap snapshot) {
+	for _, ts := range snap.Tables {
+		table := NewTable(ts.Name, ts.Schema)
+		table.addKeys(ts.Keys)
+		table.Checks = ts.Checks
+		// key and unique indexes already exist from the schema and keys
+		for _, info := range ts.Indexes {
+			if _, exists := table.Indexes[info.Name]; !exists {
+				table.Indexes[info.Name] = newIndex(info)
+			}
+		}
+
+		table.loadRows(ts.Rows)
+		db.tables[ts.Name] = table
+	}
+
+	for _, state := range snap.Sequences {
+		db.sequences[state.Name] = newSequence(state)
+	}
+
+	db.lsn = snap.LSN
+}
+
+// fsync a directory so a rename in it is durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
@@ -0,0 +1,153 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckpointTruncatesLog(t *testing.T) {
+	dir := t.TempDir()
+
+	db := openDurable(t, dir)
+	execSQL(t, db, "CREATE TABLE users (id INT PRIMARY KEY, name TEXT)")
+	execSQL(t, db, "INSERT INTO users VALUES (1, 'Alice')")
+	execSQL(t, db, "INSERT INTO users VALUES (2, 'Bob')")
+	execSQL(t, db, "CHECKPOINT")
+
+	info, err := os.Stat(filepath.Join(dir, walFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("log not truncated after checkpoint. size=%d", info.Size())
+	}
+
+	// changes after the checkpoint go to the log
+	execSQL(t, db, "DELETE FROM users WHERE id = 1")
+	execSQL(t, db, "INSERT INTO users VALUES (3, 'Carol')")
+	db.Close()
+
+	db = openDurable(t, dir)
+	defer db.Close()
+
+	rows := execSQL(t, db, "SELECT * FROM users ORDER BY id").([]Row)
+	if len(rows) != 2 || rows[0]["name"] != "Bob" || rows[1]["name"] != "Carol" {
+		t.Fatalf("wrong rows recovered. got=%v", rows)
+	}
+
+	if _, exists := db.tables["users"].Indexes["id"]; !exists {
+		t.Fatal("primary key index not restored")
+	}
+	if len(indexLookup(t, db.tables["users"].Indexes["id"], 3)) != 1 {
+		t.Error("primary key index not rebuilt")
+	}
+}
+
+func TestCheckpointCrashBeforeTruncate(t *testing.T) {
+	dir := t.TempDir()
+
+	db := openDurable(t, dir)
+	execSQL(t, db, "CREATE TABLE users (id INT PRIMARY KEY, name TEXT)")
+	execSQL(t, db, "INSERT INTO users VALUES (1, 'Alice')")
+
+	// keep a copy of the log as it was before the checkpoint truncated it
+	walPath := filepath.Join(dir, walFileName)
+	logged, err := os.ReadFile(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	execSQL(t, db, "CHECKPOINT")
+	db.Close()
+
+	if err := os.WriteFile(walPath, logged, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// records already in the snapshot must not be applied twice
+	db = openDurable(t, dir)
+	defer db.Close()
+
+	if db.tables["users"].ids != 1 {
+		t.Fatalf("wrong number of rows. expected=1, got=%d", db.tables["users"].ids)
+	}
+}
+
+func TestSnapshotLengthPastTheEnd(t *testing.T) {
+	dir := t.TempDir()
+
+	db := openDurable(t, dir)
+	execSQL(t, db, "CREATE TABLE users (id INT PRIMARY KEY)")
+	execSQL(t, db, "CHECKPOINT")
+	db.Close()
+
+	path := filepath.Join(dir, snapshotFileName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a length far past the end must not be trusted for the read
+	data[0], data[1], data[2], data[3] = 0xf0, 0xff, 0xff, 0xff
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if db, err := NewDurableDB(dir); err == nil {
+		db.Close()
+		t.Fatal("expected error for a snapshot length past the end of the file, got nil")
+	}
+}
+
+func TestCheckpointInMemory(t *testing.T) {
+	db := NewDB()
+
+	if err := db.Checkpoint(); err == nil {
+		t.Fatal("expected error for checkpoint of in-memory database, got nil")
+	}
+}
+
+func TestCheckpointWithConcurrentReaders(t *testing.T) {
+	db := openDurable(t, t.TempDir())
+	defer db.Close()
+	execSQL(t, db, "CREATE TABLE users (id INT PRIMARY KEY, name TEXT)")
+	execSQL(t, db, "INSERT INTO users VALUES (1, 'Alice')")
+
+	// a reader holding the lock does not block the checkpoint
+	db.mu.RLock()
+	done := make(chan error)
+	go func() { done <- db.Checkpoint() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Checkpoint failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("checkpoint blocked by a reader")
+	}
+	db.mu.RUnlock()
+}
+
+func TestCheckpointEvery(t *testing.T) {
+	dir := t.TempDir()
+
+	db := openDurable(t, dir)
+	defer db.Close()
+	execSQL(t, db, "CREATE TABLE users (id INT PRIMARY KEY, name TEXT)")
+
+	stop := db.CheckpointEvery(10*time.Millisecond, func(err error) {
+		t.Errorf("checkpoint failed: %v", err)
+	})
+	defer stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(filepath.Join(dir, snapshotFileName)); err == nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("no snapshot written by the checkpoint timer")
+}
@@ -0,0 +1,573 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+
+	"github.com/raskovnik/rdbms/internal/ast"
+)
+
+// the log of a database opened with Open is the database file's path with this suffix
+const walSuffix = "-wal"
+
+// what the header of a database file points at, written to new pages by each checkpoint.
+// LSN is the last log record the pages contain
+type catalog struct {
+	LSN       uint64
+	Tables    []tableCatalog
+	Sequences []sequenceState
+	Free      []pageID // pages not in use, with every page from PageCount on
+	PageCount pageID
+
+	pages []pageID // the pages holding the catalog itself
+}
+
+type tableCatalog struct {
+	Name    string
+	Schema  []ast.ColumnDef
+	Keys    []ast.KeyConstraint
+	Checks  []ast.CheckConstraint
+	Indexes []indexCatalog
+	RowMap  pageID // root of the row map of the table's heap pages, 0 for no rows
+	IDs     int    // row ids handed out
+	FreeIDs []int  // the ones without a record, reused by later rows
+}
+
+// an index and the root page of its tree, 0 for an index with no entries
+type indexCatalog struct {
+	Info IndexInfo
+	Root pageID
+}
+
+// a catalog spans as many pages as it needs, each starting with the id of the next
+const chainHeaderSize = 4
+
+// open a database stored in one file of fixed-size pages at path, creating it if
+// needed. rows are read through a bounded buffer pool as statements use them, so tables
+// can be larger than memory. changes are logged to path-wal first and written to the
+// pages by Checkpoint
+func Open(path string) (*Database, error) {
+	return openPaged(path, defaultPoolPages)
+}
+
+// open a database file with a buffer pool of the given number of pages
+func openPaged(path string, poolPages int) (*Database, error) {
+	p, err := openPager(path)
+	if err != nil {
+		return nil, err
+	}
+
+	log, err := openWAL(path + walSuffix)
+	if err != nil {
+		p.close()
+		return nil, err
+	}
+
+	db := NewDB()
+	db.pool = newBufferPool(p, poolPages)
+
+	err = db.loadCatalog()
+	if err == nil {
+		err = db.replayLog(log)
+	}
+	if err != nil {
+		log.close()
+		p.close()
+		return nil, err
+	}
+
+	db.wal = log
+	return db, nil
+}
+
+// restore the tables of the last checkpoint from its catalog alone. rows and index
+// entries stay in their pages, read as statements reach them
+func (db *Database) loadCatalog() error {
+	pager := db.pool.pager
+	if pager.header.catalog == 0 {
+		pager.setFree(nil, headerPages, nil)
+		return nil
+	}
+
+	data, pages, err := readChain(db.pool, pager.header.catalog, int(pager.header.catalogSize))
+	if err != nil {
+		return fmt.Errorf("read catalog: %w", err)
+	}
+
+	cat := &catalog{pages: pages}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(cat); err != nil {
+		return fmt.Errorf("decode catalog: %w", err)
+	}
+
+	for _, tc := range cat.Tables {
+		table := newTable(tc.Name, tc.Schema, db.pool)
+		table.addKeys(tc.Keys)
+		table.Checks = tc.Checks
+		for _, ic := range tc.Indexes {
+			table.Indexes[ic.Info.Name] = newPagedIndex(ic.Info, db.pool, ic.Root)
+		}
+		table.store = newHeapStore(db.pool, tc.RowMap, tc.Schema)
+		table.ids = tc.IDs
+		table.free = tc.FreeIDs
+		db.tables[tc.Name] = table
+	}
+
+	for _, state := range cat.Sequences {
+		db.sequences[state.Name] = newSequence(state)
+	}
+
+	db.lsn = cat.LSN
+	db.stored = cat
+	pager.setFree(cat.Free, cat.PageCount, pages)
+	return nil
+}
+
+// write the rows and index entries changed since the last checkpoint to the database
+// file and truncate the log. pages in use are never written over: changed pages are
+// copied to free ones, and the new header switches to them at once, so a crash leaves
+// the last checkpoint and the log as they were. pages the last checkpoint used and this
+// one does not are free once the header is written. rows no snapshot needs in memory
+// are dropped from it
+func (db *Database) checkpointPages() (err error) {
+	pager := db.pool.pager
+	horizon := db.horizon()
+
+	// a checkpoint that fails gives back the pages it took
+	free, count := append([]pageID(nil), pager.free...), pager.count
+	defer func() {
+		if err != nil {
+			pager.free, pager.count = free, count
+		}
+	}()
+
+	names := make([]string, 0, len(db.tables))
+	for name := range db.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cat := &catalog{LSN: db.lsn}
+	plans := make([]*pagePlan, 0, len(names))
+	var released []pageID
+	kept := make(map[pageID]bool) // roots of the last checkpoint's trees still in use
+	for _, name := range names {
+		table := db.tables[name]
+		if table.store != nil {
+			kept[table.store.rowMap] = true
+		}
+		plan, err := table.writePages(db.pool, horizon)
+		if err != nil {
+			return fmt.Errorf("checkpoint table %s: %w", name, err)
+		}
+		plans = append(plans, plan)
+		released = append(released, plan.released...)
+
+		tc := tableCatalog{
+			Name:    table.Name,
+			Schema:  table.Schema,
+			Keys:    table.Keys,
+			Checks:  table.Checks,
+			RowMap:  plan.store.rowMap,
+			IDs:     table.ids,
+			FreeIDs: table.storedFree(),
+		}
+
+		for _, index := range sortedIndexes(table) {
+			ic := indexCatalog{Info: *index.Info()}
+			if paged, ok := pagedOf(index); ok {
+				kept[paged.root] = true
+				root, replaced, err := paged.writePages()
+				if err != nil {
+					return fmt.Errorf("checkpoint table %s: %w", name, err)
+				}
+				plan.indexes = append(plan.indexes, indexPlan{index: paged, root: root})
+				released = append(released, replaced...)
+				ic.Root = root
+			}
+			tc.Indexes = append(tc.Indexes, ic)
+		}
+		cat.Tables = append(cat.Tables, tc)
+	}
+
+	// the rows and index trees of the last checkpoint no table uses any more, those of
+	// dropped tables and indexes and of tables whose rows were all written again
+	if db.stored != nil {
+		released = append(released, db.stored.pages...)
+		for _, tc := range db.stored.Tables {
+			if tc.RowMap != 0 && !kept[tc.RowMap] {
+				heap, err := heapPages(db.pool, tc.RowMap)
+				if err != nil {
+					return fmt.Errorf("free table %s: %w", tc.Name, err)
+				}
+				tree, err := indexPages(db.pool, tc.RowMap)
+				if err != nil {
+					return fmt.Errorf("free table %s: %w", tc.Name, err)
+				}
+				released = append(append(released, heap...), tree...)
+			}
+			for _, ic := range tc.Indexes {
+				if ic.Root == 0 || kept[ic.Root] {
+					continue
+				}
+				pages, err := indexPages(db.pool, ic.Root)
+				if err != nil {
+					return fmt.Errorf("free index %s: %w", ic.Info.Name, err)
+				}
+				released = append(released, pages...)
+			}
+		}
+	}
+
+	for _, seq := range db.sequences {
+		cat.Sequences = append(cat.Sequences, seq.state())
+	}
+
+	// the pages the catalog is written to come off this list, open takes them out again
+	cat.Free = append(append([]pageID(nil), pager.free...), released...)
+	cat.PageCount = pager.count
+
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(cat); err != nil {
+		return fmt.Errorf("encode catalog: %w", err)
+	}
+	first, pages, err := writeChain(db.pool, payload.Bytes())
+	if err != nil {
+		return err
+	}
+	cat.pages = pages
+
+	// the new pages are on disk before the header points at them
+	if err := db.pool.flush(); err != nil {
+		return err
+	}
+	if err := pager.writeHeader(fileHeader{catalog: first, catalogSize: uint32(payload.Len())}); err != nil {
+		return err
+	}
+
+	for _, plan := range plans {
+		plan.apply()
+	}
+	pager.release(released)
+	db.stored = cat
+
+	// every logged change is now in the file. if we crash before truncating, replay
+	// skips records up to cat.LSN
+	return db.wal.truncate()
+}
+
+// the pages of a table after a checkpoint, and the rows it no longer needs in memory
+type pagePlan struct {
+	table    *Table
+	store    *heapStore
+	drop     []int
+	indexes  []indexPlan
+	released []pageID // pages of the last checkpoint the rows no longer use
+}
+
+// the tree of an index after a checkpoint
+type indexPlan struct {
+	index *pagedIndex
+	root  pageID
+}
+
+// the table's pages are current once the header points at them
+func (p *pagePlan) apply() {
+	p.table.store = p.store
+	for _, id := range p.drop {
+		delete(p.table.versions, id)
+	}
+	for _, plan := range p.indexes {
+		plan.index.reset(plan.root)
+	}
+}
+
+// the row ids a table has no record for once its rows are written: the free ones and
+// those of rows deleted or rolled back, left in memory for cleanup
+func (t *Table) storedFree() []int {
+	free := slices.Clone(t.free)
+	for id, version := range t.versions {
+		if !version.live() {
+			free = append(free, id)
+		}
+	}
+	return free
+}
+
+// write the rows held in memory to new pages, with the rows that share a page with a
+// changed or removed record, and the row map to match. pages with no such record are
+// kept as they are
+func (t *Table) writePages(pool *bufferPool, horizon uint64) (*pagePlan, error) {
+	old := t.store
+	if old != nil && old.convert != nil {
+		return t.rewritePages(pool, horizon)
+	}
+
+	plan := &pagePlan{table: t}
+	changed := slices.Sorted(maps.Keys(t.versions))
+	if old != nil && len(changed) == 0 && len(old.removed) == 0 {
+		plan.store = old
+		return plan, nil
+	}
+
+	rowMap := &pagedIndex{IndexInfo: rowMapInfo, pool: pool}
+	rowMap.reset(0)
+	w := &heapWriter{pool: pool, placed: func(id int, loc rowLoc) error {
+		rowMap.Add(id, loc.packed())
+		return nil
+	}}
+
+	if old != nil {
+		rowMap.reset(old.rowMap)
+
+		// the pages holding the record of a row changed or removed since are written
+		// again without it
+		rewrite := make(map[pageID]bool)
+		drop := func(id int) error {
+			loc, err := old.stored(id)
+			if err != nil || loc == (rowLoc{}) {
+				return err
+			}
+			rewrite[loc.page] = true
+			rowMap.Remove(id, loc.packed())
+			return nil
+		}
+		for _, id := range changed {
+			if err := drop(id); err != nil {
+				return nil, err
+			}
+		}
+		for id := range old.removed {
+			if err := drop(id); err != nil {
+				return nil, err
+			}
+		}
+
+		plan.released = slices.Sorted(maps.Keys(rewrite))
+		for _, id := range plan.released {
+			if err := w.copyPage(id, t.versions, old, rowMap); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, id := range changed {
+		if err := t.writeVersion(w, plan, id, horizon); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.finish(); err != nil {
+		return nil, err
+	}
+	root, replaced, err := rowMap.writePages()
+	if err != nil {
+		return nil, err
+	}
+	plan.released = append(plan.released, replaced...)
+	plan.store = newHeapStore(pool, root, t.Schema)
+	return plan, nil
+}
+
+// write every row to new pages as a row of the table's schema, once an ALTER TABLE
+// change left records of another. rows on disk are read and written one at a time, and
+// the row map is built in row id order
+func (t *Table) rewritePages(pool *bufferPool, horizon uint64) (*pagePlan, error) {
+	plan := &pagePlan{table: t}
+	old := t.store
+
+	rowMap := newIndexBuilder(pool)
+	w := &heapWriter{pool: pool, placed: func(id int, loc rowLoc) error {
+		return rowMap.add(indexEntry{key: id, id: loc.packed()})
+	}}
+
+	for id := range t.ids {
+		if t.versions[id] != nil {
+			if err := t.writeVersion(w, plan, id, horizon); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		stored, err := old.load(id)
+		if err != nil {
+			return nil, err
+		}
+		if stored == nil {
+			continue
+		}
+		rec, err := encodeRecord(id, stored.row, t.Schema)
+		if err != nil {
+			return nil, err
+		}
+		if err := w.add(id, rec); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.finish(); err != nil {
+		return nil, err
+	}
+	root, err := rowMap.finish()
+	if err != nil {
+		return nil, err
+	}
+
+	// none of the old pages are used any more
+	if old.rowMap != 0 {
+		heap, err := heapPages(pool, old.rowMap)
+		if err != nil {
+			return nil, err
+		}
+		tree, err := indexPages(pool, old.rowMap)
+		if err != nil {
+			return nil, err
+		}
+		plan.released = append(heap, tree...)
+	}
+	plan.store = newHeapStore(pool, root, t.Schema)
+	return plan, nil
+}
+
+// write the newest version of a row held in memory, unless it was deleted. the row is
+// dropped from memory once no snapshot needs an older version
+func (t *Table) writeVersion(w *heapWriter, plan *pagePlan, id int, horizon uint64) error {
+	head := t.versions[id]
+	if !head.live() {
+		// deleted, or inserted and rolled back. the version stays in memory until the
+		// row is cleaned up
+		return nil
+	}
+
+	rec, err := encodeRecord(id, head.row, t.Schema)
+	if err != nil {
+		return err
+	}
+	if err := w.add(id, rec); err != nil {
+		return err
+	}
+
+	if head.prev == nil && head.xmin < horizon {
+		plan.drop = append(plan.drop, id)
+	}
+	return nil
+}
+
+// fills new heap pages with records, and passes on where each went
+type heapWriter struct {
+	pool   *bufferPool
+	placed func(rowID int, loc rowLoc) error
+	page   heapPage
+	id     pageID
+}
+
+// add a record to the page being filled, starting a new one when it is full
+func (w *heapWriter) add(rowID int, rec []byte) error {
+	if len(rec) > maxRecordSize {
+		return fmt.Errorf("row %d takes %d bytes, a page holds at most %d", rowID, len(rec), maxRecordSize)
+	}
+
+	slot, ok := 0, false
+	if w.page != nil {
+		slot, ok = w.page.insert(rec)
+	}
+	if !ok {
+		if err := w.finish(); err != nil {
+			return err
+		}
+		w.page = make(heapPage, pageSize)
+		w.page.init()
+		w.id = w.pool.pager.allocate()
+		slot, _ = w.page.insert(rec)
+	}
+
+	return w.placed(rowID, rowLoc{page: w.id, slot: uint16(slot)})
+}
+
+// copy the records of a page that are still current, the ones of rows that were not
+// removed or changed in memory since, and move their entries in the row map
+func (w *heapWriter) copyPage(id pageID, versions map[int]*rowVersion, old *heapStore, rowMap *pagedIndex) error {
+	f, err := w.pool.fetch(id)
+	if err != nil {
+		return err
+	}
+	defer w.pool.unpin(f)
+
+	page := heapPage(f.data)
+	for slot := 0; slot < page.slots(); slot++ {
+		rec, err := page.record(slot)
+		if err != nil {
+			return fmt.Errorf("page %d: %w", id, err)
+		}
+		rowID, err := recordID(rec)
+		if err != nil {
+			return fmt.Errorf("page %d: %w", id, err)
+		}
+		if versions[rowID] != nil || old.removed[rowID] {
+			continue
+		}
+		rowMap.Remove(rowID, rowLoc{page: id, slot: uint16(slot)}.packed())
+		if err := w.add(rowID, rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write out the page being filled
+func (w *heapWriter) finish() error {
+	if w.page == nil {
+		return nil
+	}
+	err := w.pool.write(w.id, w.page)
+	w.page = nil
+	return err
+}
+
+// write data to a chain of new pages, returns the first and every page used
+func writeChain(pool *bufferPool, data []byte) (pageID, []pageID, error) {
+	capacity := pageSize - chainHeaderSize
+	pages := make([]pageID, max(1, (len(data)+capacity-1)/capacity))
+	for i := range pages {
+		pages[i] = pool.pager.allocate()
+	}
+
+	buf := make([]byte, pageSize)
+	for i, id := range pages {
+		clear(buf)
+		if i+1 < len(pages) {
+			binary.LittleEndian.PutUint32(buf[0:chainHeaderSize], uint32(pages[i+1]))
+		}
+		data = data[copy(buf[chainHeaderSize:], data):]
+		if err := pool.write(id, buf); err != nil {
+			return 0, nil, err
+		}
+	}
+	return pages[0], pages, nil
+}
+
+// read size bytes from the chain of pages starting at first
+func readChain(pool *bufferPool, first pageID, size int) ([]byte, []pageID, error) {
+	data := make([]byte, 0, size)
+	var pages []pageID
+	for id := first; len(data) < size; {
+		if id < headerPages {
+			return nil, nil, fmt.Errorf("broken page chain at page %d", id)
+		}
+		pages = append(pages, id)
+
+		f, err := pool.fetch(id)
+		if err != nil {
+			return nil, nil, err
+		}
+		n := min(size-len(data), pageSize-chainHeaderSize)
+		data = append(data, f.data[chainHeaderSize:chainHeaderSize+n]...)
+		id = pageID(binary.LittleEndian.Uint32(f.data[0:chainHeaderSize]))
+		pool.unpin(f)
+	}
+	return data, pages, nil
+}
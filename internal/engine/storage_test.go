@@ -0,0 +1,853 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openPagedDB(t *testing.T, path string, poolPages int) *Database {
+	t.Helper()
+
+	db, err := openPaged(path, poolPages)
+	if err != nil {
+		t.Fatalf("open %s failed: %v", path, err)
+	}
+	return db
+}
+
+// insert n rows of about 200 bytes into items, a statement per 100 rows
+func fillItems(t *testing.T, db *Database, n int) {
+	t.Helper()
+
+	execSQL(t, db, "CREATE TABLE items (id INT PRIMARY KEY, name TEXT, price DECIMAL(8, 2), added DATE, active BOOL)")
+	for start := 0; start < n; start += 100 {
+		var values []string
+		for id := start; id < min(start+100, n); id++ {
+			values = append(values, fmt.Sprintf("(%d, '%s', %d.50, DATE '2024-01-%02d', %v)", id, strings.Repeat("x", 180)+fmt.Sprint(id), id, id%28+1, id%2 == 0))
+		}
+		execSQL(t, db, "INSERT INTO items VALUES "+strings.Join(values, ", "))
+	}
+}
+
+// the number of rows of a table held in memory
+func residentRows(table *Table) int {
+	n := 0
+	for _, version := range table.versions {
+		if version != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func TestOpenStoresRowsInPages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	// a pool of 8 pages cannot hold the table's 40 or so
+	db := openPagedDB(t, path, 8)
+	fillItems(t, db, 1500)
+	execSQL(t, db, "CHECKPOINT")
+
+	table := db.tables["items"]
+	if n := residentRows(table); n != 0 {
+		t.Errorf("%d rows left in memory after checkpoint", n)
+	}
+	if pages, err := heapPages(db.pool, table.store.rowMap); err != nil || len(pages) < 30 {
+		t.Errorf("expected the rows to take 30 pages or more, got %d, err=%v", len(pages), err)
+	}
+	db.Close()
+
+	db = openPagedDB(t, path, 8)
+	defer db.Close()
+
+	if n := countRows(t, db, "items"); n != 1500 {
+		t.Fatalf("wrong number of rows after reopen. expected=1500, got=%d", n)
+	}
+	if n := residentRows(db.tables["items"]); n != 0 {
+		t.Errorf("reading rows kept %d in memory", n)
+	}
+	if db.pool.evictions == 0 || len(db.pool.pages) > 8 {
+		t.Errorf("buffer pool not bounded: %d pages held, %d evictions", len(db.pool.pages), db.pool.evictions)
+	}
+
+	rows := execSQL(t, db, "SELECT id, price, added, active FROM items WHERE id = 1234").([]Row)
+	if fmt.Sprint(rows) != "[map[active:true added:2024-01-03 id:1234 price:1234.50]]" {
+		t.Errorf("wrong row read back: %v", rows)
+	}
+	rows = execSQL(t, db, "SELECT id FROM items WHERE id >= 1497 ORDER BY id DESC").([]Row)
+	if fmt.Sprint(rows) != "[map[id:1499] map[id:1498] map[id:1497]]" {
+		t.Errorf("wrong rows from an index range: %v", rows)
+	}
+	rows = execSQL(t, db, "SELECT COUNT(*) FROM items WHERE active = TRUE").([]Row)
+	if rows[0]["COUNT(*)"] != 750 {
+		t.Errorf("wrong count from a full scan: %v", rows)
+	}
+}
+
+func TestOpenReadsOnlyTheCatalog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	db := openPagedDB(t, path, 8)
+	fillItems(t, db, 1500)
+	execSQL(t, db, "CREATE INDEX items_name ON items (name)")
+	execSQL(t, db, "DELETE FROM items WHERE id >= 100 AND id < 110")
+	execSQL(t, db, "CHECKPOINT")
+	db.Close()
+
+	db = openPagedDB(t, path, 8)
+	defer db.Close()
+
+	// the rows, the row map and the indexes stay on disk
+	if reads, catalog := db.pool.reads, len(db.stored.pages); reads > catalog {
+		t.Errorf("open read %d pages, the catalog takes %d", reads, catalog)
+	}
+	table := db.tables["items"]
+	if n := len(table.versions); n != 0 || table.ids != 1500 {
+		t.Errorf("expected 1500 row ids and none in memory, got %d and %d", table.ids, n)
+	}
+
+	// the ids of the deleted rows are still free
+	execSQL(t, db, "INSERT INTO items VALUES (2000, 'new', 1, NULL, NULL)")
+	if positions := indexLookup(t, table.Indexes["id"], 2000); len(positions) != 1 || positions[0] < 100 || positions[0] >= 110 {
+		t.Errorf("row id of a deleted row not reused after reopen: %v", positions)
+	}
+	if n := countRows(t, db, "items"); n != 1491 {
+		t.Errorf("wrong number of rows. expected=1491, got=%d", n)
+	}
+
+	// the pages of a dropped table are reused
+	pages, err := heapPages(db.pool, table.store.rowMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	execSQL(t, db, "DROP TABLE items")
+	execSQL(t, db, "CHECKPOINT")
+	if free := len(db.pool.pager.free); free < len(pages) {
+		t.Errorf("expected the %d pages of the dropped table to be free, got %d", len(pages), free)
+	}
+}
+
+func TestOpenWritesChangedRows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	db := openPagedDB(t, path, 8)
+	fillItems(t, db, 500)
+	execSQL(t, db, "CHECKPOINT")
+
+	execSQL(t, db, "UPDATE items SET name = 'changed' WHERE id < 10")
+	execSQL(t, db, "DELETE FROM items WHERE id >= 100 AND id < 200")
+	// deleted rows are cleaned up at once, their records wait for the checkpoint
+	if n, stale := residentRows(db.tables["items"]), len(db.tables["items"].store.removed); n != 10 || stale != 100 {
+		t.Errorf("expected 10 updated rows in memory and 100 deleted on disk, got %d and %d", n, stale)
+	}
+	execSQL(t, db, "CHECKPOINT")
+	if n := residentRows(db.tables["items"]); n != 0 {
+		t.Errorf("%d rows left in memory after checkpoint", n)
+	}
+
+	// removed row ids are reused, the other rows keep theirs
+	execSQL(t, db, "INSERT INTO items VALUES (1000, 'new', 1, NULL, NULL)")
+	if positions := indexLookup(t, db.tables["items"].Indexes["id"], 1000); len(positions) != 1 || positions[0] < 100 || positions[0] >= 200 {
+		t.Errorf("row id of a removed row not reused: %v", positions)
+	}
+	execSQL(t, db, "CHECKPOINT")
+	db.Close()
+
+	db = openPagedDB(t, path, 8)
+	defer db.Close()
+
+	if n := countRows(t, db, "items"); n != 401 {
+		t.Errorf("wrong number of rows after reopen. expected=401, got=%d", n)
+	}
+	rows := execSQL(t, db, "SELECT id FROM items WHERE name = 'changed' OR name = 'new' ORDER BY id").([]Row)
+	if len(rows) != 11 || rows[10]["id"] != 1000 {
+		t.Errorf("wrong changed rows after reopen: %v", rows)
+	}
+	if rows := execSQL(t, db, "SELECT * FROM items WHERE id = 150").([]Row); len(rows) != 0 {
+		t.Errorf("deleted row back after reopen: %v", rows)
+	}
+	if _, err := db.Execute(parseSQL(t, "INSERT INTO items VALUES (5, 'dup', 1, NULL, NULL)")); err == nil {
+		t.Error("primary key index not rebuilt on open")
+	}
+
+	// rewriting every row reuses the pages the last checkpoint freed
+	var sizes []int64
+	for i := range 4 {
+		execSQL(t, db, fmt.Sprintf("UPDATE items SET active = %v", i%2 == 0))
+		execSQL(t, db, "CHECKPOINT")
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, info.Size())
+	}
+	if sizes[3] > sizes[1] {
+		t.Errorf("database file keeps growing: %v", sizes)
+	}
+}
+
+func TestOpenReplaysLogOverPages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	db := openPagedDB(t, path, 8)
+	fillItems(t, db, 300)
+	execSQL(t, db, "CREATE TABLE tags (name TEXT UNIQUE)")
+	execSQL(t, db, "INSERT INTO tags VALUES ('a'), ('b')")
+	execSQL(t, db, "CREATE TABLE old (id INT)")
+	execSQL(t, db, "INSERT INTO old VALUES (1)")
+	execSQL(t, db, "CHECKPOINT")
+
+	// changes the log holds when the database is closed without a checkpoint
+	execSQL(t, db, "UPDATE items SET name = 'changed' WHERE id = 7")
+	execSQL(t, db, "DELETE FROM items WHERE id = 8")
+	execSQL(t, db, "ALTER TABLE items RENAME COLUMN name TO title")
+	execSQL(t, db, "ALTER TABLE items RENAME TO products")
+	execSQL(t, db, "ALTER TABLE tags ADD COLUMN color TEXT DEFAULT 'red'")
+	execSQL(t, db, "TRUNCATE old")
+	execSQL(t, db, "INSERT INTO old VALUES (2)")
+	db.Close()
+
+	for range 2 {
+		db = openPagedDB(t, path, 8)
+
+		if n := countRows(t, db, "products"); n != 299 {
+			t.Errorf("wrong number of rows. expected=299, got=%d", n)
+		}
+		rows := execSQL(t, db, "SELECT title FROM products WHERE id = 7").([]Row)
+		if fmt.Sprint(rows) != "[map[title:changed]]" {
+			t.Errorf("update not replayed over the pages: %v", rows)
+		}
+		rows = execSQL(t, db, "SELECT title FROM products WHERE id = 9").([]Row)
+		if len(rows) != 1 || !strings.HasSuffix(rows[0]["title"].(string), "x9") {
+			t.Errorf("renamed column not read from the pages: %v", rows)
+		}
+		rows = execSQL(t, db, "SELECT * FROM tags ORDER BY name").([]Row)
+		if fmt.Sprint(rows) != "[map[color:red name:a] map[color:red name:b]]" {
+			t.Errorf("added column not replayed: %v", rows)
+		}
+		rows = execSQL(t, db, "SELECT * FROM old").([]Row)
+		if fmt.Sprint(rows) != "[map[id:2]]" {
+			t.Errorf("truncate not replayed: %v", rows)
+		}
+
+		// the second time round everything comes from the pages
+		execSQL(t, db, "CHECKPOINT")
+		db.Close()
+	}
+}
+
+func TestAlterDoesNotReadRowsIntoMemory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	db := openPagedDB(t, path, 8)
+	fillItems(t, db, 1500)
+	execSQL(t, db, "CREATE INDEX items_name ON items (name)")
+	execSQL(t, db, "CHECKPOINT")
+
+	// rolled back, the table is read from its pages as before
+	tx := db.Begin()
+	execTx(t, tx, "ALTER TABLE items DROP COLUMN price")
+	tx.Rollback()
+	if rows := execSQL(t, db, "SELECT price FROM items WHERE id = 3").([]Row); fmt.Sprint(rows) != "[map[price:3.50]]" {
+		t.Errorf("wrong row after a rolled back ALTER: %v", rows)
+	}
+
+	execSQL(t, db, "ALTER TABLE items ADD COLUMN stock INT DEFAULT 3")
+	execSQL(t, db, "ALTER TABLE items DROP COLUMN active")
+	execSQL(t, db, "ALTER TABLE items RENAME COLUMN name TO title")
+	if n := residentRows(db.tables["items"]); n != 0 {
+		t.Errorf("ALTER TABLE kept %d rows in memory", n)
+	}
+	if _, err := db.Execute(parseSQL(t, "ALTER TABLE items ADD COLUMN code INT UNIQUE DEFAULT 1")); err == nil {
+		t.Error("expected duplicate value error for a unique column")
+	}
+	execSQL(t, db, "UPDATE items SET stock = 4 WHERE id = 5")
+
+	check := func() {
+		t.Helper()
+		rows := execSQL(t, db, "SELECT * FROM items WHERE id = 5 OR id = 1234 ORDER BY id").([]Row)
+		if len(rows) != 2 || fmt.Sprint(rows[0]["stock"], rows[1]["stock"], rows[1]["price"]) != "4 3 1234.50" || len(rows[0]) != 5 {
+			t.Errorf("wrong rows after ALTER TABLE: %v", rows)
+		}
+		rows = execSQL(t, db, "SELECT id FROM items WHERE title = '"+strings.Repeat("x", 180)+"77'").([]Row)
+		if fmt.Sprint(rows) != "[map[id:77]]" {
+			t.Errorf("wrong rows from an index of the altered table: %v", rows)
+		}
+		if n := countRows(t, db, "items"); n != 1500 {
+			t.Errorf("wrong number of rows. expected=1500, got=%d", n)
+		}
+	}
+	check()
+
+	// the checkpoint writes every row in the new schema and frees the old pages
+	execSQL(t, db, "CHECKPOINT")
+	if db.tables["items"].store.convert != nil {
+		t.Error("rows left in the old schema after checkpoint")
+	}
+	check()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	execSQL(t, db, "ALTER TABLE items DROP COLUMN stock")
+	execSQL(t, db, "ALTER TABLE items ADD COLUMN stock INT DEFAULT 3")
+	execSQL(t, db, "UPDATE items SET stock = 4 WHERE id = 5")
+	execSQL(t, db, "CHECKPOINT")
+	if after, err := os.Stat(path); err != nil || after.Size() > 2*info.Size() {
+		t.Errorf("rewritten rows did not reuse the freed pages: %d bytes, then %d", info.Size(), after.Size())
+	}
+	db.Close()
+
+	db = openPagedDB(t, path, 8)
+	defer db.Close()
+	check()
+}
+
+func TestCheckpointKeepsVersionsSnapshotsNeed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	db := openPagedDB(t, path, 8)
+	defer db.Close()
+	execSQL(t, db, "CREATE TABLE users (id INT PRIMARY KEY, name TEXT)")
+	execSQL(t, db, "INSERT INTO users VALUES (1, 'Alice'), (2, 'Bob')")
+	execSQL(t, db, "CHECKPOINT")
+
+	reader := db.Begin()
+	execTx(t, reader, "SELECT * FROM users")
+	execSQL(t, db, "UPDATE users SET name = 'Alicia' WHERE id = 1")
+	execSQL(t, db, "CHECKPOINT")
+
+	// the old version stays in memory for the reader, the new one is on disk too
+	rows := execTx(t, reader, "SELECT name FROM users ORDER BY id").([]Row)
+	if fmt.Sprint(rows) != "[map[name:Alice] map[name:Bob]]" {
+		t.Errorf("reader lost its snapshot: %v", rows)
+	}
+	table := db.tables["users"]
+	if loc, err := table.store.loc(0); table.versions[0] == nil || err != nil || loc == (rowLoc{}) {
+		t.Error("updated row not both in memory and on disk")
+	}
+
+	reader.Commit()
+	db.Vacuum()
+	execSQL(t, db, "CHECKPOINT")
+	if n := residentRows(table); n != 0 {
+		t.Errorf("%d rows left in memory once no snapshot needs them", n)
+	}
+	rows = execSQL(t, db, "SELECT name FROM users ORDER BY id").([]Row)
+	if fmt.Sprint(rows) != "[map[name:Alicia] map[name:Bob]]" {
+		t.Errorf("wrong rows read back: %v", rows)
+	}
+}
+
+func TestOpenFallsBackToPreviousHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	db := openPagedDB(t, path, 8)
+	execSQL(t, db, "CREATE TABLE users (id INT PRIMARY KEY, name TEXT)")
+	execSQL(t, db, "INSERT INTO users VALUES (1, 'Alice')")
+	execSQL(t, db, "CHECKPOINT")
+	execSQL(t, db, "INSERT INTO users VALUES (2, 'Bob')")
+	generation := db.pool.pager.header.generation
+	db.Close()
+
+	// a crash tore the next checkpoint's header, its checksum no longer matches
+	torn := encodeHeader(fileHeader{generation: generation + 1, catalog: 5, catalogSize: 100})
+	torn[20] ^= 0xff
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteAt(torn, int64((generation+1)%headerPages)*pageSize); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	db = openPagedDB(t, path, 8)
+	defer db.Close()
+	rows := execSQL(t, db, "SELECT name FROM users ORDER BY id").([]Row)
+	if fmt.Sprint(rows) != "[map[name:Alice] map[name:Bob]]" {
+		t.Errorf("wrong rows after a torn header: %v", rows)
+	}
+
+	// a file that is not a database is refused
+	other := filepath.Join(t.TempDir(), "other")
+	if err := os.WriteFile(other, bytes.Repeat([]byte("not a database"), 1000), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(other); err == nil {
+		t.Error("expected error opening a file that is not a database")
+	}
+}
+
+func TestOpenRejectsRowsLargerThanAPage(t *testing.T) {
+	db := openPagedDB(t, filepath.Join(t.TempDir(), "test.db"), 8)
+	defer db.Close()
+	execSQL(t, db, "CREATE TABLE notes (id INT, body TEXT)")
+
+	large := strings.Repeat("x", pageSize)
+	for _, input := range []string{
+		"INSERT INTO notes VALUES (1, '" + large + "')",
+		"ALTER TABLE notes ADD COLUMN extra TEXT DEFAULT '" + large + "'",
+	} {
+		execSQL(t, db, "INSERT INTO notes VALUES (1, 'short')")
+		if _, err := db.Execute(parseSQL(t, input)); err == nil || !strings.Contains(err.Error(), "too large") {
+			t.Errorf("expected row size error for %.40q, got %v", input, err)
+		}
+	}
+	if _, err := db.Execute(parseSQL(t, "UPDATE notes SET body = '"+large+"'")); err == nil {
+		t.Error("expected row size error for an update, got nil")
+	}
+
+	// the largest row that fits is stored
+	execSQL(t, db, "INSERT INTO notes VALUES (2, '"+strings.Repeat("y", maxRowSize-10)+"')")
+	execSQL(t, db, "CHECKPOINT")
+
+	// in memory there is no limit
+	memory := NewDB()
+	execSQL(t, memory, "CREATE TABLE notes (id INT, body TEXT)")
+	execSQL(t, memory, "INSERT INTO notes VALUES (1, '"+large+"')")
+}
+
+func TestDamagedPageFailsStatements(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	db := openPagedDB(t, path, minPoolPages)
+	defer db.Close()
+	fillItems(t, db, 400)
+	execSQL(t, db, "CHECKPOINT")
+
+	// wipe the page of row 0, then read others until it is out of the pool
+	table := db.tables["items"]
+	loc, err := table.store.loc(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	damaged := loc.page
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = file.WriteAt(make([]byte, pageSize), int64(damaged)*pageSize)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id := 399; id > 200; id-- {
+		if _, err := table.row(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, cached := db.pool.pages[damaged]; cached {
+		t.Fatalf("page %d still in the pool", damaged)
+	}
+
+	for _, input := range []string{
+		"SELECT * FROM items",
+		"SELECT * FROM items WHERE id = 0",
+		"SELECT COUNT(*) FROM items",
+		"UPDATE items SET active = TRUE WHERE id < 5",
+		"DELETE FROM items WHERE id = 0",
+	} {
+		if _, err := db.Execute(parseSQL(t, input)); err == nil || !strings.Contains(err.Error(), "page") {
+			t.Errorf("expected an error reading page %d for %q, got %v", damaged, input, err)
+		}
+	}
+
+	// rows on other pages are still there
+	rows := execSQL(t, db, "SELECT * FROM items WHERE id = 399").([]Row)
+	if len(rows) != 1 {
+		t.Errorf("expected row 399, got %v", rows)
+	}
+}
+
+func TestOpenReadsIndexPages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	db := openPagedDB(t, path, 8)
+	fillItems(t, db, 1500)
+	execSQL(t, db, "CREATE INDEX items_name ON items (name)")
+	execSQL(t, db, "CHECKPOINT")
+	db.Close()
+
+	db = openPagedDB(t, path, 8)
+	defer db.Close()
+
+	// the index is a tree of pages, none of its entries are held in memory
+	index, _ := pagedOf(db.tables["items"].Indexes["items_name"])
+	if _, inMemory, _ := index.added.Min(); inMemory || index.root == 0 {
+		t.Fatalf("index not read from pages, root=%d", index.root)
+	}
+	if root, err := readIndexNode(db.pool, index.root); err != nil || root.level < 1 {
+		t.Fatalf("expected a tree of two levels or more, err=%v", err)
+	}
+
+	rows := execSQL(t, db, "SELECT id FROM items WHERE name = '"+strings.Repeat("x", 180)+"1234'").([]Row)
+	if fmt.Sprint(rows) != "[map[id:1234]]" {
+		t.Errorf("wrong rows from an index lookup: %v", rows)
+	}
+
+	// changes since the checkpoint are merged with the pages
+	execSQL(t, db, "DELETE FROM items WHERE id >= 1490 AND id < 1495")
+	execSQL(t, db, "INSERT INTO items VALUES (1492, 'new', 1, NULL, NULL), (5000, 'new', 1, NULL, NULL)")
+	execSQL(t, db, "UPDATE items SET id = -1 WHERE id = 0")
+	check := func() {
+		t.Helper()
+		rows := execSQL(t, db, "SELECT id FROM items WHERE id >= 1488 ORDER BY id DESC").([]Row)
+		if fmt.Sprint(rows) != "[map[id:5000] map[id:1499] map[id:1498] map[id:1497] map[id:1496] map[id:1495] map[id:1492] map[id:1489] map[id:1488]]" {
+			t.Errorf("wrong rows from an index range: %v", rows)
+		}
+		rows = execSQL(t, db, "SELECT id FROM items ORDER BY id LIMIT 2").([]Row)
+		if fmt.Sprint(rows) != "[map[id:-1] map[id:1]]" {
+			t.Errorf("wrong first rows in index order: %v", rows)
+		}
+		rows = execSQL(t, db, "SELECT id FROM items WHERE name = 'new' ORDER BY id").([]Row)
+		if fmt.Sprint(rows) != "[map[id:1492] map[id:5000]]" {
+			t.Errorf("wrong rows for a key added since the checkpoint: %v", rows)
+		}
+		if _, err := db.Execute(parseSQL(t, "INSERT INTO items VALUES (1499, 'dup', 1, NULL, NULL)")); err == nil {
+			t.Error("expected duplicate key error for a key in the index pages")
+		}
+	}
+	check()
+
+	execSQL(t, db, "CHECKPOINT")
+	if _, inMemory, _ := index.added.Min(); inMemory || len(index.removed) != 0 {
+		t.Error("index changes left in memory after checkpoint")
+	}
+	check()
+	db.Close()
+
+	db = openPagedDB(t, path, 8)
+	check()
+}
+
+func TestPagedIndexMatchesReference(t *testing.T) {
+	p, err := openPager(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.close()
+	p.setFree(nil, headerPages, nil)
+	pool := newBufferPool(p, 16)
+
+	// long keys make a tree of several levels from a few hundred entries
+	const padding = 500
+	key := func(n int) string {
+		return strings.Repeat("k", padding) + fmt.Sprintf("%04d", n)
+	}
+	idx := newPagedIndex(IndexInfo{Name: "n", Columns: []string{"n"}}, pool, 0).(*pagedBTreeIndex)
+	reference := make(map[int]map[int]bool)
+	rng := rand.New(rand.NewSource(1))
+
+	for round := range 12 {
+		for i := 0; i < 300; i++ {
+			n, id := rng.Intn(400), rng.Intn(4)
+			if rng.Intn(3) == 0 {
+				idx.Remove(key(n), id)
+				delete(reference[n], id)
+				continue
+			}
+			idx.Add(key(n), id)
+			if reference[n] == nil {
+				reference[n] = make(map[int]bool)
+			}
+			reference[n][id] = true
+		}
+
+		// half the rounds are checked before their changes are written to pages
+		if round%2 == 0 {
+			root, released, err := idx.writePages()
+			if err != nil {
+				t.Fatal(err)
+			}
+			idx.reset(root)
+			p.release(released)
+		}
+
+		var expected []string
+		for n := range 400 {
+			var ids []int
+			for id := range 4 {
+				if reference[n][id] {
+					ids = append(ids, id)
+				}
+			}
+			if got := indexLookup(t, idx, key(n)); fmt.Sprint(got) != fmt.Sprint(ids) {
+				t.Fatalf("round %d: Lookup(%d) wrong. expected=%v, got=%v", round, n, ids, got)
+			}
+			if len(ids) > 0 {
+				expected = append(expected, fmt.Sprint(n, ids))
+			}
+		}
+
+		lo, hi := rng.Intn(400), rng.Intn(400)
+		if lo > hi {
+			lo, hi = hi, lo
+		}
+		for _, descending := range []bool{false, true} {
+			var got []string
+			err := idx.Scan(&Bound{Value: key(lo), Inclusive: true}, &Bound{Value: key(hi)}, descending, func(value interface{}, ids []int) bool {
+				n, _ := strconv.Atoi(value.(string)[padding:])
+				got = append(got, fmt.Sprint(n, ids))
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var want []string
+			for _, entry := range expected {
+				var n int
+				fmt.Sscan(entry, &n)
+				if n >= lo && n < hi {
+					want = append(want, entry)
+				}
+			}
+			if descending {
+				slices.Reverse(want)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Fatalf("round %d: scan of [%d, %d) descending=%v wrong.\nexpected=%v\ngot=%v", round, lo, hi, descending, want, got)
+			}
+		}
+	}
+
+	if root, err := readIndexNode(pool, idx.root); err != nil || root.level < 2 {
+		t.Errorf("expected a tree of three levels or more, err=%v", err)
+	}
+	// replaced nodes are given back, the file holds about two copies of the tree
+	pages, err := indexPages(pool, idx.root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int(p.count) > 3*len(pages)+headerPages {
+		t.Errorf("file of %d pages for a tree of %d", p.count, len(pages))
+	}
+}
+
+func TestIndexBuilderWritesEntriesInOrder(t *testing.T) {
+	p, err := openPager(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.close()
+	p.setFree(nil, headerPages, nil)
+	pool := newBufferPool(p, 16)
+
+	key := func(n int) string {
+		return strings.Repeat("k", 500) + fmt.Sprintf("%04d", n)
+	}
+	for _, count := range []int{0, 1, 400} {
+		b := newIndexBuilder(pool)
+		for n := range count {
+			if err := b.add(indexEntry{key: key(n), id: n}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		root, err := b.finish()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		idx := newPagedIndex(IndexInfo{Name: "n"}, pool, root).(*pagedBTreeIndex)
+		var got []int
+		err = idx.Scan(nil, nil, false, func(_ interface{}, ids []int) bool {
+			got = append(got, ids...)
+			return true
+		})
+		if err != nil || len(got) != count || !slices.IsSorted(got) {
+			t.Fatalf("wrong entries in a tree of %d: %v, err=%v", count, got, err)
+		}
+		for n := range count {
+			if ids := indexLookup(t, idx, key(n)); fmt.Sprint(ids) != fmt.Sprint([]int{n}) {
+				t.Fatalf("Lookup(%d) wrong in a tree of %d: %v", n, count, ids)
+			}
+		}
+		if count == 400 {
+			if node, err := readIndexNode(pool, root); err != nil || node.level < 2 {
+				t.Errorf("expected a tree of three levels or more, err=%v", err)
+			}
+		}
+	}
+}
+
+func TestOpenRejectsKeysLargerThanAnIndexEntry(t *testing.T) {
+	db := openPagedDB(t, filepath.Join(t.TempDir(), "test.db"), 8)
+	defer db.Close()
+	execSQL(t, db, "CREATE TABLE notes (id INT, body TEXT)")
+	large := strings.Repeat("x", maxIndexKeySize)
+	execSQL(t, db, "INSERT INTO notes VALUES (1, '"+large+"')")
+
+	if _, err := db.Execute(parseSQL(t, "CREATE INDEX notes_body ON notes (body)")); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("expected key size error creating an index, got %v", err)
+	}
+
+	execSQL(t, db, "DELETE FROM notes")
+	execSQL(t, db, "CREATE INDEX notes_body ON notes (body)")
+	if _, err := db.Execute(parseSQL(t, "INSERT INTO notes VALUES (1, '"+large+"')")); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("expected key size error for an insert, got %v", err)
+	}
+
+	// the largest key that fits is stored
+	execSQL(t, db, "INSERT INTO notes VALUES (2, '"+strings.Repeat("y", maxIndexKeySize-10)+"')")
+	execSQL(t, db, "CHECKPOINT")
+	if n := countRows(t, db, "notes"); n != 1 {
+		t.Errorf("expected one row, got %d", n)
+	}
+}
+
+func TestBufferPoolEvictsWithClock(t *testing.T) {
+	p, err := openPager(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.close()
+
+	pool := newBufferPool(p, 1)
+	if len(pool.frames) != minPoolPages {
+		t.Fatalf("expected a pool of at least %d pages, got %d", minPoolPages, len(pool.frames))
+	}
+
+	page := func(id pageID) []byte {
+		return bytes.Repeat([]byte{byte(id)}, pageSize)
+	}
+	for id := pageID(2); id < 8; id++ {
+		if p.allocate() != id {
+			t.Fatalf("page %d not allocated in order", id)
+		}
+		if err := pool.write(id, page(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// dirty pages are written back when evicted, and by flush
+	if err := pool.flush(); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, pageSize)
+	for id := pageID(2); id < 8; id++ {
+		if err := p.read(id, buf); err != nil || !bytes.Equal(buf, page(id)) {
+			t.Fatalf("page %d not written back, err=%v", id, err)
+		}
+	}
+
+	fetch := func(id pageID) {
+		t.Helper()
+		f, err := pool.fetch(id)
+		if err != nil {
+			t.Fatalf("fetch page %d: %v", id, err)
+		}
+		if !bytes.Equal(f.data, page(id)) {
+			t.Errorf("wrong data for page %d", id)
+		}
+		pool.unpin(f)
+	}
+	cached := func() string {
+		var ids []pageID
+		for _, f := range pool.frames {
+			ids = append(ids, f.id)
+		}
+		return fmt.Sprint(ids)
+	}
+
+	pool = newBufferPool(p, 4)
+	for id := pageID(2); id < 6; id++ {
+		fetch(id)
+	}
+	// every page was used since the hand passed, it clears them all and takes the first
+	fetch(6)
+	if cached() != "[6 3 4 5]" {
+		t.Errorf("wrong page evicted: %s", cached())
+	}
+	// a page used again gets a second chance
+	fetch(3)
+	fetch(7)
+	if cached() != "[6 3 7 5]" {
+		t.Errorf("wrong page evicted after a second chance: %s", cached())
+	}
+	if pool.reads != 6 || pool.evictions != 2 {
+		t.Errorf("expected 6 reads and 2 evictions, got %d and %d", pool.reads, pool.evictions)
+	}
+
+	// pinned pages stay
+	var pinned []*frame
+	for _, id := range []pageID{2, 3, 4, 5} {
+		f, err := pool.fetch(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pinned = append(pinned, f)
+	}
+	// with every page pinned a fetch waits for one to be unpinned
+	fetched := make(chan error)
+	go func() {
+		f, err := pool.fetch(6)
+		if err == nil {
+			pool.unpin(f)
+		}
+		fetched <- err
+	}()
+	select {
+	case err := <-fetched:
+		t.Fatalf("fetch with every page pinned did not wait, err=%v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	pool.unpin(pinned[0])
+	if err := <-fetched; err != nil {
+		t.Fatalf("fetch after an unpin: %v", err)
+	}
+	if _, exists := pool.pages[2]; exists {
+		t.Errorf("expected the unpinned page to be evicted: %s", cached())
+	}
+}
+
+func TestHeapPageRecords(t *testing.T) {
+	db := NewDB()
+	execSQL(t, db, "CREATE TABLE t (a INT, b TEXT, c FLOAT, d DECIMAL(6, 2), e DATE, f TIME, g TIMESTAMP, h BOOL, i INT)")
+	execSQL(t, db, "INSERT INTO t VALUES (-42, 'héllo', 2.5, -1234.56, DATE '2024-02-29', TIME '09:30', TIMESTAMP '2024-01-15 09:30:00', FALSE, NULL)")
+	table := db.tables["t"]
+	row := tableRow(t, table, 0)
+
+	page := make(heapPage, pageSize)
+	page.init()
+	count := 0
+	for id := 0; ; id++ {
+		rec, err := encodeRecord(id, row, table.Schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		slot, ok := page.insert(rec)
+		if !ok {
+			break
+		}
+		if slot != id {
+			t.Fatalf("wrong slot for record %d: %d", id, slot)
+		}
+		count++
+	}
+	if count != page.slots() || count < 50 {
+		t.Fatalf("page full after %d records, %d slots", count, page.slots())
+	}
+
+	for slot := range count {
+		rec, err := page.record(slot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, decoded, err := decodeRecord(rec, table.Schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != slot || !rowsEqual(decoded, row) {
+			t.Fatalf("record %d read back as row %d %v, expected %v", slot, id, decoded, row)
+		}
+	}
+}
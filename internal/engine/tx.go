@@ -0,0 +1,481 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/raskovnik/rdbms/internal/ast"
+	"github.com/raskovnik/rdbms/internal/datetime"
+)
+
+// a transaction groups statements into one all-or-nothing change and reads from a
+// snapshot taken at its first statement, so it never sees changes committed after
+// that or made by transactions still running. readers never wait for writers, write
+// transactions run one at a time
+type Tx struct {
+	db     *Database
+	xid    uint64
+	snap   *txSnapshot        // nil until the first statement
+	now    datetime.Timestamp // NOW(), the time of the first statement
+	writer bool               // holds the database write lock
+	done   bool
+
+	undo    []undoEntry
+	garbage map[*Table][]int       // ids of rows holding versions made dead, cleaned up at the end
+	saved   map[string]*savedTable // tables before the transaction changed their schema
+	ops     []walOp                // changes to log at commit
+
+	savedSequences map[string]*savedSequence // sequences before the transaction changed them
+	advanced       map[*Sequence]bool        // sequences nextval() was called on
+}
+
+type undoKind uint8
+
+const (
+	undoInsert undoKind = iota + 1
+	undoUpdate
+	undoDelete
+)
+
+// how to reverse one row change on rollback
+type undoEntry struct {
+	kind  undoKind
+	table *Table
+	pos   int
+}
+
+// a table before a schema change in a transaction
+type savedTable struct {
+	table    *Table // nil if the transaction created the table
+	schema   []ast.ColumnDef
+	pkColumn string
+	indexes  map[string]Index
+}
+
+// start a transaction, it must end with Commit or Rollback. while a goroutine has a
+// transaction that wrote open it must not write through Database.Execute, which would
+// wait for that transaction to end
+func (db *Database) Begin() *Tx {
+	return &Tx{
+		db:      db,
+		garbage: make(map[*Table][]int),
+		saved:   make(map[string]*savedTable),
+
+		savedSequences: make(map[string]*savedSequence),
+	}
+}
+
+// take the snapshot on the first statement. a transaction that writes first waits for
+// the write lock before its snapshot, so it never has to conflict with the writer
+// before it
+func (tx *Tx) start(write bool) {
+	if write && !tx.writer {
+		tx.db.writeMu.Lock()
+		tx.writer = true
+	}
+
+	if tx.snap != nil {
+		return
+	}
+
+	db := tx.db
+	db.txMu.Lock()
+	defer db.txMu.Unlock()
+
+	tx.xid = db.nextXID
+	db.nextXID++
+
+	tx.now = datetime.Now()
+	tx.snap = &txSnapshot{xmin: tx.xid, xmax: db.nextXID, active: make(map[uint64]bool, len(db.active))}
+	for xid, other := range db.active {
+		tx.snap.active[xid] = true
+		tx.snap.xmin = min(tx.snap.xmin, other.snap.xmin, xid)
+	}
+	db.active[tx.xid] = tx
+}
+
+// report whether the transaction sees the changes of transaction xid
+func (tx *Tx) sees(xid uint64) bool {
+	return xid != invalidXID && (xid == tx.xid || tx.snap.committed(xid))
+}
+
+// the version of the row at pos the transaction sees, nil if the row did not exist or
+// was deleted as of its snapshot
+func (tx *Tx) version(table *Table, pos int) (*rowVersion, error) {
+	head, err := table.head(pos)
+	if err != nil {
+		return nil, err
+	}
+	for v := head; v != nil; v = v.prev {
+		if tx.sees(v.xmin) {
+			if v.xmax != invalidXID && tx.sees(v.xmax) {
+				return nil, nil
+			}
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+
+// the row at pos as the transaction sees it
+func (tx *Tx) visible(table *Table, pos int) (Row, bool, error) {
+	v, err := tx.version(table, pos)
+	if v == nil {
+		return nil, false, err
+	}
+	return v.row, true, nil
+}
+
+// check that the transaction is changing the newest version of a row, a row changed by
+// a transaction that committed after the snapshot cannot be changed again
+func (tx *Tx) checkCurrent(table *Table, pos int) error {
+	head := table.versions[pos]
+	if head == nil {
+		// only on disk, the row has not changed since the last checkpoint
+		return nil
+	}
+	// the head is in memory, so finding the version reads nothing
+	if v, _ := tx.version(table, pos); v != head || head.xmax != invalidXID {
+		return fmt.Errorf("could not serialize access to table %s: row was changed by a concurrent transaction", table.Name)
+	}
+	return nil
+}
+
+// add a row in the transaction
+func (tx *Tx) insertRow(table *Table, row Row) {
+	pos := table.addRow(row, tx.xid)
+	tx.undo = append(tx.undo, undoEntry{kind: undoInsert, table: table, pos: pos})
+}
+
+// replace the row at pos with a new version in the transaction
+func (tx *Tx) updateRow(table *Table, pos int, row Row) error {
+	if err := table.pushVersion(pos, row, tx.xid); err != nil {
+		return err
+	}
+	tx.undo = append(tx.undo, undoEntry{kind: undoUpdate, table: table, pos: pos})
+	tx.garbage[table] = append(tx.garbage[table], pos)
+	return nil
+}
+
+// delete the row at pos in the transaction
+func (tx *Tx) deleteRow(table *Table, pos int) error {
+	head, err := table.hold(pos)
+	if err != nil {
+		return err
+	}
+	head.xmax = tx.xid
+	tx.undo = append(tx.undo, undoEntry{kind: undoDelete, table: table, pos: pos})
+	tx.garbage[table] = append(tx.garbage[table], pos)
+	return nil
+}
+
+// collect changes to write to the log at commit
+func (tx *Tx) logOps(ops ...walOp) {
+	if tx.db.wal != nil {
+		tx.ops = append(tx.ops, ops...)
+	}
+}
+
+// run a statement in the transaction
+func (tx *Tx) Execute(stmt ast.Statement) (interface{}, error) {
+	if tx.done {
+		return nil, fmt.Errorf("transaction has already been committed or rolled back")
+	}
+
+	switch stmt.(type) {
+	case *ast.BeginStatement:
+		return nil, fmt.Errorf("a transaction is already in progress")
+	case *ast.CommitStatement:
+		return nil, tx.Commit()
+	case *ast.RollbackStatement:
+		return nil, tx.Rollback()
+	case *ast.CheckpointStatement:
+		return nil, fmt.Errorf("CHECKPOINT cannot run inside a transaction")
+	}
+
+	// statements hold the table latch only while they run, reads share it
+	write := writes(stmt)
+	tx.start(write)
+	if write {
+		tx.db.mu.Lock()
+		defer tx.db.mu.Unlock()
+	} else {
+		tx.db.mu.RLock()
+		defer tx.db.mu.RUnlock()
+	}
+
+	// a failed statement leaves no partial changes behind, the transaction goes on
+	undoMark, opsMark := len(tx.undo), len(tx.ops)
+	res, err := tx.execute(stmt)
+	if err != nil {
+		tx.undoTo(undoMark)
+		tx.ops = tx.ops[:opsMark]
+	}
+	return res, err
+}
+
+func (tx *Tx) execute(stmt ast.Statement) (interface{}, error) {
+	switch s := stmt.(type) {
+	case *ast.CreateStatement:
+		return nil, tx.executeCreate(s)
+	case *ast.InsertStatement:
+		return tx.executeInsert(s)
+	case *ast.SelectStatement:
+		return tx.executeSelect(s)
+	case *ast.DeleteStatement:
+		return tx.executeDelete(s)
+	case *ast.UpdateStatement:
+		return tx.executeUpdate(s)
+	case *ast.JoinStatement:
+		return tx.executeJoin(s)
+	case *ast.CreateIndexStatement:
+		return nil, tx.executeCreateIndex(s)
+	case *ast.DropIndexStatement:
+		return nil, tx.executeDropIndex(s)
+	case *ast.AlterTableStatement:
+		return nil, tx.executeAlter(s)
+	case *ast.DropTableStatement:
+		return nil, tx.executeDropTable(s)
+	case *ast.TruncateStatement:
+		return nil, tx.executeTruncate(s)
+	case *ast.CreateSequenceStatement:
+		return nil, tx.executeCreateSequence(s)
+	default:
+		return nil, fmt.Errorf("unknown statement type: %T", stmt)
+	}
+}
+
+// report whether a statement changes the database
+func writes(stmt ast.Statement) bool {
+	switch stmt.(type) {
+	case *ast.SelectStatement, *ast.JoinStatement:
+		return false
+	default:
+		return true
+	}
+}
+
+// remember a table before the transaction changes its schema
+func (tx *Tx) saveSchema(name string) {
+	if _, saved := tx.saved[name]; saved {
+		return
+	}
+
+	table, exists := tx.db.tables[name]
+	if !exists {
+		tx.saved[name] = &savedTable{}
+		return
+	}
+
+	indexes := make(map[string]Index, len(table.Indexes))
+	for indexName, index := range table.Indexes {
+		indexes[indexName] = index
+	}
+
+	tx.saved[name] = &savedTable{
+		table:    table,
+		schema:   table.Schema,
+		pkColumn: table.pkColumn,
+		indexes:  indexes,
+	}
+}
+
+// make the changes permanent and visible to transactions that start afterwards. they
+// are logged as a single record so recovery replays all of them or none
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return fmt.Errorf("transaction has already been committed or rolled back")
+	}
+
+	if !tx.writer {
+		// a read only transaction has no changes, but values it took from sequences
+		// may have been shown or stored elsewhere
+		var err error
+		if ops := tx.sequenceOps(); len(ops) > 0 {
+			tx.db.mu.Lock()
+			err = tx.db.writeLog(ops)
+			tx.db.mu.Unlock()
+		}
+		tx.end()
+		if err != nil {
+			return fmt.Errorf("commit failed: %w", err)
+		}
+		return nil
+	}
+
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+
+	tx.ops = append(tx.ops, tx.sequenceOps()...)
+	if len(tx.ops) > 0 {
+		if err := tx.db.writeLog(tx.ops); err != nil {
+			tx.rollback()
+			return fmt.Errorf("commit failed, transaction rolled back: %w", err)
+		}
+	}
+
+	tx.end()
+	return nil
+}
+
+// the positions of the sequences nextval() was called on. values taken from them must
+// not be handed out again after a restart
+func (tx *Tx) sequenceOps() []walOp {
+	if tx.db.wal == nil {
+		return nil
+	}
+
+	var ops []walOp
+	for seq := range tx.advanced {
+		state := seq.state()
+		ops = append(ops, walOp{Kind: walSetSequence, Sequence: &state})
+	}
+	return ops
+}
+
+// undo every change made in the transaction
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return fmt.Errorf("transaction has already been committed or rolled back")
+	}
+
+	if !tx.writer {
+		tx.end()
+		return nil
+	}
+
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+
+	tx.rollback()
+	return nil
+}
+
+// reverse the row changes newest first, then the schema changes. the caller holds the
+// table latch
+func (tx *Tx) rollback() {
+	tx.undoTo(0)
+
+	for name, saved := range tx.saved {
+		if saved.table == nil {
+			delete(tx.db.tables, name)
+			continue
+		}
+
+		table := saved.table
+		table.Schema = saved.schema
+		table.pkColumn = saved.pkColumn
+		table.Indexes = saved.indexes
+		// every row change was undone above, so an index dropped in the transaction
+		// missed only changes that no longer exist
+		tx.db.tables[name] = table
+	}
+
+	// sequences come back where they are, values taken are not given back
+	for name, saved := range tx.savedSequences {
+		if saved.sequence == nil {
+			delete(tx.db.sequences, name)
+			continue
+		}
+		saved.sequence.Owner = saved.owner
+		tx.db.sequences[name] = saved.sequence
+	}
+
+	tx.end()
+}
+
+// reverse the row changes after the first n entries of the undo log, newest first
+func (tx *Tx) undoTo(n int) {
+	for i := len(tx.undo) - 1; i >= n; i-- {
+		entry := tx.undo[i]
+		switch entry.kind {
+		case undoInsert:
+			// never visible to anyone, removed by cleanup
+			entry.table.versions[entry.pos].xmin = invalidXID
+			tx.garbage[entry.table] = append(tx.garbage[entry.table], entry.pos)
+		case undoUpdate:
+			entry.table.popVersion(entry.pos)
+		case undoDelete:
+			entry.table.versions[entry.pos].xmax = invalidXID
+		}
+	}
+	tx.undo = tx.undo[:n]
+}
+
+// leave the set of running transactions and release the write lock, a writer cleans
+// up first so the next one can reuse the row ids it freed. a writer's caller holds the
+// table latch
+func (tx *Tx) end() {
+	tx.done = true
+
+	if tx.snap != nil {
+		tx.db.txMu.Lock()
+		delete(tx.db.active, tx.xid)
+		tx.db.txMu.Unlock()
+	}
+
+	if tx.writer {
+		tx.cleanup()
+		tx.db.writeMu.Unlock()
+	}
+}
+
+// reclaim the versions the transaction made dead right away when no other snapshot
+// needs them, the background cleaner gets the rest
+func (tx *Tx) cleanup() {
+	horizon := tx.db.horizon()
+	for table, positions := range tx.garbage {
+		if tx.db.tables[table.Name] == table {
+			table.prune(horizon, positions)
+		}
+	}
+}
+
+// a connection-like context for running SQL, BEGIN starts a transaction that the
+// following statements run in until COMMIT or ROLLBACK
+type Session struct {
+	db *Database
+	tx *Tx // nil outside a transaction
+}
+
+func (db *Database) NewSession() *Session {
+	return &Session{db: db}
+}
+
+func (s *Session) Execute(stmt ast.Statement) (interface{}, error) {
+	switch stmt.(type) {
+	case *ast.BeginStatement:
+		if s.tx != nil {
+			return nil, fmt.Errorf("a transaction is already in progress")
+		}
+		s.tx = s.db.Begin()
+		return nil, nil
+	case *ast.CommitStatement, *ast.RollbackStatement:
+		if s.tx == nil {
+			return nil, fmt.Errorf("no transaction in progress")
+		}
+		tx := s.tx
+		s.tx = nil
+		return tx.Execute(stmt)
+	}
+
+	if s.tx != nil {
+		return s.tx.Execute(stmt)
+	}
+	return s.db.Execute(stmt)
+}
+
+// report whether the session has an open transaction
+func (s *Session) InTransaction() bool {
+	return s.tx != nil
+}
+
+// roll back a transaction left open
+func (s *Session) Close() error {
+	if s.tx == nil {
+		return nil
+	}
+
+	tx := s.tx
+	s.tx = nil
+	return tx.Rollback()
+}
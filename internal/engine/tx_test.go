@@ -0,0 +1,326 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+// execute a statement in a transaction and fail the test on error
+func execTx(t *testing.T, tx *Tx, input string) interface{} {
+	t.Helper()
+
+	res, err := tx.Execute(parseSQL(t, input))
+	if err != nil {
+		t.Fatalf("could not execute %q: %v", input, err)
+	}
+
+	return res
+}
+
+func TestTxRollbackRestoresTables(t *testing.T) {
+	db := setupTestDB(t)
+	table := db.tables["users"]
+	rowsBefore := liveRows(t, table)
+
+	tx := db.Begin()
+	execTx(t, tx, "INSERT INTO users VALUES (10, 'Zed')")
+	execTx(t, tx, "UPDATE users SET name = 'Changed' WHERE id = 1")
+	execTx(t, tx, "DELETE FROM users WHERE id = 2")
+	execTx(t, tx, "CREATE INDEX users_name ON users (name)")
+	execTx(t, tx, "CREATE TABLE scratch (id INT PRIMARY KEY)")
+	execTx(t, tx, "INSERT INTO scratch VALUES (1)")
+
+	// the transaction sees its own changes
+	if rows := execTx(t, tx, "SELECT * FROM users WHERE id = 10").([]Row); len(rows) != 1 {
+		t.Fatalf("expected transaction to see its insert, got %v", rows)
+	}
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+
+	if _, exists := db.tables["scratch"]; exists {
+		t.Error("table created in the transaction survived rollback")
+	}
+
+	if _, exists := table.Indexes["users_name"]; exists {
+		t.Error("index created in the transaction survived rollback")
+	}
+
+	if rows := liveRows(t, table); len(rows) != len(rowsBefore) {
+		t.Fatalf("wrong number of rows after rollback. expected=%d, got=%d", len(rowsBefore), len(rows))
+	}
+	for i, row := range rowsBefore {
+		if !rowsEqual(tableRow(t, table, i), row) {
+			t.Errorf("row %d not restored. expected=%v, got=%v", i, row, tableRow(t, table, i))
+		}
+	}
+
+	// indexes point at the restored rows
+	for _, row := range rowsBefore {
+		positions := indexLookup(t, table.Indexes["id"], row["id"])
+		if len(positions) != 1 || tableRow(t, table, positions[0])["id"] != row["id"] {
+			t.Errorf("primary key index not restored for id %v", row["id"])
+		}
+	}
+	if indexHas(t, table.Indexes["id"], 10) {
+		t.Error("primary key index still holds the rolled back insert")
+	}
+
+	// the database is usable again
+	execSQL(t, db, "INSERT INTO users VALUES (10, 'Zed')")
+}
+
+func TestTxRollbackRestoresDroppedIndex(t *testing.T) {
+	db := setupTestDB(t)
+	execSQL(t, db, "CREATE INDEX users_name ON users (name)")
+
+	tx := db.Begin()
+	execTx(t, tx, "DROP INDEX users_name")
+	execTx(t, tx, "INSERT INTO users VALUES (10, 'Zed')")
+	execTx(t, tx, "UPDATE users SET name = 'Alicia' WHERE name = 'Alice'")
+	tx.Rollback()
+
+	index, exists := db.tables["users"].Indexes["users_name"]
+	if !exists {
+		t.Fatal("dropped index was not restored")
+	}
+	if indexHas(t, index, "Zed") || indexHas(t, index, "Alicia") {
+		t.Error("restored index holds rolled back changes")
+	}
+	if len(indexLookup(t, index, "Alice")) != 1 {
+		t.Error("restored index lost its entries")
+	}
+}
+
+func TestTxRollbackRestoresDroppedTable(t *testing.T) {
+	db := setupTestDB(t)
+	users := db.tables["users"]
+	execSQL(t, db, "CREATE TABLE orders (id INT)")
+	execSQL(t, db, "INSERT INTO orders VALUES (1)")
+	orders := db.tables["orders"]
+
+	tx := db.Begin()
+	execTx(t, tx, "INSERT INTO users VALUES (3, 'Carol')")
+	execTx(t, tx, "DROP TABLE users")
+	execTx(t, tx, "CREATE TABLE users (id INT)")
+	execTx(t, tx, "TRUNCATE TABLE orders")
+	execTx(t, tx, "INSERT INTO orders VALUES (2)")
+	tx.Rollback()
+
+	if db.tables["users"] != users || db.tables["orders"] != orders {
+		t.Fatal("tables were not restored")
+	}
+	if rows := execSQL(t, db, "SELECT * FROM users").([]Row); len(rows) != 2 {
+		t.Errorf("wrong users after rollback: %v", rows)
+	}
+	if rows := execSQL(t, db, "SELECT * FROM orders").([]Row); len(rows) != 1 || rows[0]["id"] != 1 {
+		t.Errorf("wrong orders after rollback: %v", rows)
+	}
+	if len(indexLookup(t, users.Indexes["id"], 1)) != 1 {
+		t.Error("restored table lost its index entries")
+	}
+}
+
+func TestTxCommit(t *testing.T) {
+	db := setupTestDB(t)
+
+	tx := db.Begin()
+	execTx(t, tx, "INSERT INTO users VALUES (10, 'Zed')")
+	execTx(t, tx, "DELETE FROM users WHERE id = 1")
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	if rows := execSQL(t, db, "SELECT * FROM users WHERE id = 10").([]Row); len(rows) != 1 {
+		t.Error("committed insert is missing")
+	}
+	if rows := execSQL(t, db, "SELECT * FROM users WHERE id = 1").([]Row); len(rows) != 0 {
+		t.Error("committed delete was undone")
+	}
+
+	if err := tx.Rollback(); err == nil {
+		t.Error("expected error rolling back a committed transaction, got nil")
+	}
+	if _, err := tx.Execute(parseSQL(t, "SELECT * FROM users")); err == nil {
+		t.Error("expected error using a committed transaction, got nil")
+	}
+}
+
+func TestTxFailedStatementKeepsEarlierChanges(t *testing.T) {
+	db := setupTestDB(t)
+
+	tx := db.Begin()
+	execTx(t, tx, "INSERT INTO users VALUES (10, 'Zed')")
+	execTx(t, tx, "UPDATE users SET name = 'Changed' WHERE id = 1")
+
+	// rejected as a whole, neither row changes
+	if _, err := tx.Execute(parseSQL(t, "UPDATE users SET id = 10 WHERE id <= 2")); err == nil {
+		t.Fatal("expected error for duplicate primary key, got nil")
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	rows := execSQL(t, db, "SELECT * FROM users ORDER BY id").([]Row)
+	if len(rows) != 3 || rows[0]["name"] != "Changed" || rows[1]["id"] != 2 || rows[2]["id"] != 10 {
+		t.Errorf("expected the statements before the failure to commit, got %v", rows)
+	}
+}
+
+func TestTxDoesNotBlockReaders(t *testing.T) {
+	db := setupTestDB(t)
+
+	tx := db.Begin()
+	execTx(t, tx, "INSERT INTO users VALUES (10, 'Zed')")
+
+	// a reader runs while the transaction is open and does not see its insert
+	stmt := parseSQL(t, "SELECT * FROM users WHERE id = 10")
+	done := make(chan []Row)
+	go func() {
+		res, _ := db.Execute(stmt)
+		done <- res.([]Row)
+	}()
+
+	select {
+	case rows := <-done:
+		if len(rows) != 0 {
+			t.Errorf("reader saw an uncommitted insert: %v", rows)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reader blocked by an open transaction")
+	}
+
+	// a writer waits for the transaction to end
+	insert := parseSQL(t, "INSERT INTO users VALUES (11, 'Yan')")
+	written := make(chan error)
+	go func() {
+		_, err := db.Execute(insert)
+		written <- err
+	}()
+
+	select {
+	case <-written:
+		t.Fatal("writer ran while a write transaction was open")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	tx.Commit()
+
+	if err := <-written; err != nil {
+		t.Fatalf("writer failed after commit: %v", err)
+	}
+	if rows := execSQL(t, db, "SELECT * FROM users WHERE id >= 10").([]Row); len(rows) != 2 {
+		t.Errorf("expected both inserts after commit, got %v", rows)
+	}
+}
+
+func TestSessionTransactions(t *testing.T) {
+	db := setupTestDB(t)
+	session := db.NewSession()
+
+	exec := func(input string) error {
+		_, err := session.Execute(parseSQL(t, input))
+		return err
+	}
+
+	if err := exec("COMMIT"); err == nil {
+		t.Error("expected error for COMMIT without BEGIN, got nil")
+	}
+
+	exec("BEGIN")
+	if err := exec("BEGIN"); err == nil {
+		t.Error("expected error for nested BEGIN, got nil")
+	}
+	exec("INSERT INTO users VALUES (10, 'Zed')")
+	exec("ROLLBACK")
+
+	exec("BEGIN")
+	exec("INSERT INTO users VALUES (11, 'Yan')")
+	if !session.InTransaction() {
+		t.Error("expected session to be in a transaction")
+	}
+	exec("COMMIT")
+
+	if session.InTransaction() {
+		t.Error("expected transaction to end at COMMIT")
+	}
+
+	rows := execSQL(t, db, "SELECT * FROM users WHERE id >= 10").([]Row)
+	if len(rows) != 1 || rows[0]["id"] != 11 {
+		t.Errorf("expected only the committed insert, got %v", rows)
+	}
+
+	// an open transaction is rolled back when the session closes
+	exec("BEGIN")
+	exec("DELETE FROM users")
+	session.Close()
+
+	if rows := execSQL(t, db, "SELECT * FROM users").([]Row); len(rows) == 0 {
+		t.Error("closing the session committed its transaction")
+	}
+
+	if _, err := db.Execute(parseSQL(t, "BEGIN")); err == nil {
+		t.Error("expected error for BEGIN outside a session, got nil")
+	}
+}
+
+func TestTxDurability(t *testing.T) {
+	dir := t.TempDir()
+
+	db := openDurable(t, dir)
+	execSQL(t, db, "CREATE TABLE users (id INT PRIMARY KEY, name TEXT)")
+
+	tx := db.Begin()
+	execTx(t, tx, "INSERT INTO users VALUES (1, 'Alice')")
+	execTx(t, tx, "INSERT INTO users VALUES (2, 'Bob')")
+	tx.Commit()
+
+	tx = db.Begin()
+	execTx(t, tx, "INSERT INTO users VALUES (3, 'Carol')")
+	tx.Rollback()
+
+	// left open when the process stops, nothing of it is logged
+	tx = db.Begin()
+	execTx(t, tx, "DELETE FROM users WHERE id = 1")
+	db.Close()
+
+	db = openDurable(t, dir)
+	defer db.Close()
+
+	rows := execSQL(t, db, "SELECT * FROM users ORDER BY id").([]Row)
+	if len(rows) != 2 || rows[0]["id"] != 1 || rows[1]["id"] != 2 {
+		t.Errorf("expected only the committed transaction after recovery, got %v", rows)
+	}
+}
+
+func TestTxDeleteWithoutWhereKeepsLaterRowsAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	db := openDurable(t, dir)
+	execSQL(t, db, "CREATE TABLE t (id INT PRIMARY KEY)")
+	execSQL(t, db, "INSERT INTO t VALUES (1), (2)")
+
+	// the delete only removes the rows its snapshot sees, not the one inserted after
+	tx := db.Begin()
+	execTx(t, tx, "SELECT * FROM t")
+	execSQL(t, db, "INSERT INTO t VALUES (5)")
+	execTx(t, tx, "DELETE FROM t")
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	rows := execSQL(t, db, "SELECT * FROM t").([]Row)
+	if len(rows) != 1 || rows[0]["id"] != 5 {
+		t.Fatalf("expected the row inserted after the snapshot, got %v", rows)
+	}
+	db.Close()
+
+	db = openDurable(t, dir)
+	defer db.Close()
+	rows = execSQL(t, db, "SELECT * FROM t").([]Row)
+	if len(rows) != 1 || rows[0]["id"] != 5 {
+		t.Errorf("expected the row inserted after the snapshot after recovery, got %v", rows)
+	}
+}
@@ -0,0 +1,400 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"github.com/raskovnik/rdbms/internal/ast"
+	"github.com/raskovnik/rdbms/internal/datetime"
+	"github.com/raskovnik/rdbms/internal/decimal"
+)
+
+const walFileName = "wal.log"
+
+// every record is framed as [length uint32][crc32 uint32][payload]
+const walHeaderSize = 8
+
+type walOpKind uint8
+
+const (
+	walCreate         walOpKind = iota + 1 // create table with Schema
+	walInsert                              // append Rows
+	walDelete                              // remove Rows
+	walUpdate                              // replace Rows with New, pairwise
+	walClear                               // remove every row, for TRUNCATE
+	walCreateIndex                         // build Index over the table
+	walDropIndex                           // drop Index by name
+	walAddColumn                           // add the column in Schema, set to Value in every row
+	walDropColumn                          // drop Column and the indexes that use it
+	walRenameColumn                        // rename Column to NewName
+	walRenameTable                         // rename the table to NewName
+	walDropTable                           // drop the table and its sequences
+	walCreateSequence                      // create Sequence
+	walSetSequence                         // move Sequence to the value it returns next
+)
+
+// a logical change to one table. rows are identified by value rather than position,
+// deleting either of two identical rows leaves the same table
+type walOp struct {
+	Kind   walOpKind
+	Table  string
+	Schema []ast.ColumnDef
+	Keys   []ast.KeyConstraint   // keys on several columns of a created table
+	Checks []ast.CheckConstraint // table CHECK constraints of a created table
+	Index  *IndexInfo
+	Rows   []Row
+	New    []Row
+
+	Column  string      // column dropped or renamed by ALTER TABLE
+	NewName string      // new name of the column or table
+	Value   interface{} // value of an added column in existing rows
+
+	Sequence *sequenceState
+}
+
+// all changes made by one statement, applied on replay all or nothing.
+// LSN increases by one per record and survives log truncation
+type walRecord struct {
+	LSN uint64
+	Ops []walOp
+}
+
+// row values and column defaults are interfaces, gob needs to know every type besides
+// the basic ones
+func init() {
+	gob.Register(decimal.Decimal{})
+	gob.Register(datetime.Date{})
+	gob.Register(datetime.Time{})
+	gob.Register(datetime.Timestamp{})
+	gob.Register(datetime.Interval{})
+
+	gob.Register(&ast.Literal{})
+	gob.Register(&ast.Identifier{})
+	gob.Register(&ast.UnaryExpression{})
+	gob.Register(&ast.BinaryExpression{})
+	gob.Register(&ast.IsNullExpression{})
+	gob.Register(&ast.FunctionCall{})
+	gob.Register(&ast.ExtractExpression{})
+}
+
+type wal struct {
+	file *os.File
+}
+
+// open the log file at path, creating it if needed
+func openWAL(path string) (*wal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &wal{file: file}, nil
+}
+
+// append a record and fsync it, the change is durable once this returns
+func (w *wal) append(rec walRecord) error {
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(rec); err != nil {
+		return fmt.Errorf("encode log record: %w", err)
+	}
+
+	buf := make([]byte, walHeaderSize+payload.Len())
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(payload.Len()))
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload.Bytes()))
+	copy(buf[walHeaderSize:], payload.Bytes())
+
+	if _, err := w.file.Write(buf); err != nil {
+		return fmt.Errorf("write log: %w", err)
+	}
+
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("sync log: %w", err)
+	}
+
+	return nil
+}
+
+// read every record from the start of the log. a torn or corrupt record can only be
+// the tail of a crashed write, so the log is truncated there and replay stops
+func (w *wal) replay(apply func(walRecord) error) error {
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	info, err := w.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	header := make([]byte, walHeaderSize)
+
+	for {
+		rec, size, err := readRecord(w.file, header, info.Size()-offset)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if truncErr := w.file.Truncate(offset); truncErr != nil {
+				return truncErr
+			}
+			break
+		}
+
+		if err := apply(rec); err != nil {
+			return fmt.Errorf("replay log record at offset %d: %w", offset, err)
+		}
+
+		offset += size
+	}
+
+	// new records go after the last good one
+	_, err = w.file.Seek(offset, io.SeekStart)
+	return err
+}
+
+var errCorruptRecord = errors.New("corrupt log record")
+
+// read one framed record from the remaining bytes of the log, io.EOF means a clean end
+// of log
+func readRecord(r io.Reader, header []byte, remaining int64) (walRecord, int64, error) {
+	var rec walRecord
+
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF {
+			return rec, 0, io.EOF
+		}
+		return rec, 0, errCorruptRecord // partial header
+	}
+
+	length := binary.LittleEndian.Uint32(header[0:4])
+	checksum := binary.LittleEndian.Uint32(header[4:8])
+	if int64(length) > remaining-walHeaderSize {
+		return rec, 0, errCorruptRecord // length past the end of the log
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return rec, 0, errCorruptRecord // partial payload
+	}
+
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return rec, 0, errCorruptRecord
+	}
+
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&rec); err != nil {
+		return rec, 0, errCorruptRecord
+	}
+
+	return rec, walHeaderSize + int64(length), nil
+}
+
+// drop every record, called once they are all covered by a snapshot
+func (w *wal) truncate() error {
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	return w.file.Sync()
+}
+
+func (w *wal) close() error {
+	return w.file.Close()
+}
+
+// apply the records of the log that are newer than what was loaded from disk
+func (db *Database) replayLog(log *wal) error {
+	return log.replay(func(rec walRecord) error {
+		// already on disk, the log was not truncated before a crash
+		if rec.LSN <= db.lsn {
+			return nil
+		}
+
+		db.lsn = rec.LSN
+		for _, op := range rec.Ops {
+			if err := db.replayOp(op); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// append the changes of one transaction as one log record, replayed all or nothing
+func (db *Database) writeLog(ops []walOp) error {
+	if db.wal == nil {
+		return nil
+	}
+
+	if err := db.wal.append(walRecord{LSN: db.lsn + 1, Ops: ops}); err != nil {
+		return err
+	}
+
+	db.lsn++
+	return nil
+}
+
+// re-apply a logged change to the in-memory tables. the changes were committed, so
+// rows replace their old versions instead of adding new ones
+func (db *Database) replayOp(op walOp) error {
+	switch op.Kind {
+	case walCreate:
+		table := newTable(op.Table, op.Schema, db.pool)
+		table.addKeys(op.Keys)
+		table.Checks = op.Checks
+		db.tables[op.Table] = table
+		return nil
+	case walCreateSequence:
+		db.sequences[op.Sequence.Name] = newSequence(*op.Sequence)
+		return nil
+	case walSetSequence:
+		seq, exists := db.sequences[op.Sequence.Name]
+		if !exists {
+			return fmt.Errorf("sequence %s does not exist", op.Sequence.Name)
+		}
+		seq.next.Store(int64(op.Sequence.Next))
+		return nil
+	}
+
+	table, exists := db.tables[op.Table]
+	if !exists {
+		return fmt.Errorf("table %s does not exist", op.Table)
+	}
+
+	switch op.Kind {
+	case walDropTable:
+		for _, seq := range db.ownedSequences(table.Name) {
+			delete(db.sequences, seq.Name)
+		}
+		delete(db.tables, table.Name)
+		return nil
+	case walInsert:
+		for _, row := range op.Rows {
+			table.addRow(row, frozenXID)
+		}
+		return nil
+	case walCreateIndex:
+		index, err := buildIndex(table, *op.Index)
+		if err != nil {
+			return err
+		}
+		table.Indexes[op.Index.Name] = index
+		return nil
+	case walDropIndex:
+		delete(table.Indexes, op.Index.Name)
+		return nil
+	case walAddColumn, walDropColumn, walRenameColumn, walRenameTable:
+		altered, err := alterTable(table, op)
+		if err != nil {
+			return err
+		}
+		for _, seq := range db.ownedSequences(table.Name) {
+			seq.Owner = altered.Name
+		}
+		delete(db.tables, table.Name)
+		db.tables[altered.Name] = altered
+		db.renameReferences(op, func(string) {})
+		return nil
+	case walClear:
+		table.loadRows(nil)
+		return nil
+	case walDelete:
+		positions, err := findRows(table, op.Rows)
+		if err != nil {
+			return err
+		}
+
+		for _, pos := range positions {
+			head, err := table.head(pos)
+			if err != nil {
+				return err
+			}
+			table.removeRow(pos, head)
+		}
+	case walUpdate:
+		positions, err := findRows(table, op.Rows)
+		if err != nil {
+			return err
+		}
+
+		for i, pos := range positions {
+			if err := table.replaceRow(pos, op.New[i]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unknown log operation %d", op.Kind)
+	}
+
+	return nil
+}
+
+// find the position of a distinct table row equal to each of rows
+func findRows(table *Table, rows []Row) ([]int, error) {
+	used := make(map[int]bool, len(rows))
+	positions := make([]int, 0, len(rows))
+
+	for _, row := range rows {
+		// narrow the search through the primary key when there is one
+		var candidates []int
+		if pkIndex, hasPK := table.primaryIndex(); hasPK {
+			var err error
+			if candidates, err = pkIndex.Lookup(pkIndex.Info().key(row)); err != nil {
+				return nil, err
+			}
+		} else {
+			candidates = make([]int, table.ids)
+			for pos := range candidates {
+				candidates[pos] = pos
+			}
+		}
+
+		found := -1
+		for _, pos := range candidates {
+			if used[pos] {
+				continue
+			}
+			candidate, err := table.row(pos)
+			if err != nil {
+				return nil, err
+			}
+			if candidate != nil && rowsEqual(candidate, row) {
+				found = pos
+				break
+			}
+		}
+
+		if found < 0 {
+			return nil, fmt.Errorf("row %v not found in table %s", row, table.Name)
+		}
+
+		used[found] = true
+		positions = append(positions, found)
+	}
+
+	return positions, nil
+}
+
+func rowsEqual(a, b Row) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for col, val := range a {
+		if other, exists := b[col]; !exists || compareKeys(other, val) != 0 {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,173 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/raskovnik/rdbms/internal/ast"
+)
+
+func openDurable(t *testing.T, dir string) *Database {
+	t.Helper()
+
+	db, err := NewDurableDB(dir)
+	if err != nil {
+		t.Fatalf("NewDurableDB failed: %v", err)
+	}
+
+	return db
+}
+
+func TestDurableDBReplaysLog(t *testing.T) {
+	dir := t.TempDir()
+
+	db := openDurable(t, dir)
+	execSQL(t, db, "CREATE TABLE users (id INT PRIMARY KEY, name TEXT)")
+	execSQL(t, db, "INSERT INTO users VALUES (1, 'Alice')")
+	execSQL(t, db, "INSERT INTO users VALUES (2, 'Bob')")
+	execSQL(t, db, "INSERT INTO users VALUES (3, 'Carol')")
+	execSQL(t, db, "UPDATE users SET name = 'Bobby' WHERE id = 2")
+	execSQL(t, db, "DELETE FROM users WHERE id = 1")
+	db.Close()
+
+	db = openDurable(t, dir)
+	defer db.Close()
+
+	table := db.tables["users"]
+	if table == nil {
+		t.Fatal("table was not recovered")
+	}
+
+	rows := liveRows(t, table)
+	if len(rows) != 2 {
+		t.Fatalf("wrong number of rows. expected=2, got=%d", len(rows))
+	}
+
+	if rows[0]["name"] != "Bobby" || rows[1]["name"] != "Carol" {
+		t.Errorf("wrong rows recovered. got=%v", rows)
+	}
+
+	// indexes are rebuilt and enforced after recovery
+	if _, err := db.Execute(&ast.InsertStatement{Table: "users", Values: [][]interface{}{{3, "Dup"}}}); err == nil {
+		t.Error("expected error for duplicate primary key after recovery, got nil")
+	}
+
+	// new changes are appended after the replayed records
+	execSQL(t, db, "INSERT INTO users VALUES (4, 'Dave')")
+	db.Close()
+
+	db = openDurable(t, dir)
+	defer db.Close()
+	if db.tables["users"].ids != 3 {
+		t.Errorf("wrong number of rows after second restart. expected=3, got=%d", db.tables["users"].ids)
+	}
+}
+
+func TestDurableDBReplaysDropAndTruncate(t *testing.T) {
+	dir := t.TempDir()
+
+	db := openDurable(t, dir)
+	execSQL(t, db, "CREATE TABLE users (id INT PRIMARY KEY, name TEXT)")
+	execSQL(t, db, "CREATE TABLE orders (id INT PRIMARY KEY)")
+	execSQL(t, db, "INSERT INTO users VALUES (1, 'Alice')")
+	execSQL(t, db, "INSERT INTO orders VALUES (1)")
+	execSQL(t, db, "TRUNCATE TABLE users")
+	execSQL(t, db, "INSERT INTO users VALUES (2, 'Bob')")
+	execSQL(t, db, "DROP TABLE orders")
+	execSQL(t, db, "CREATE TABLE IF NOT EXISTS users (id INT)")
+	db.Close()
+
+	db = openDurable(t, dir)
+	defer db.Close()
+
+	if _, exists := db.tables["orders"]; exists {
+		t.Error("dropped table came back after restart")
+	}
+	rows := execSQL(t, db, "SELECT * FROM users").([]Row)
+	if len(rows) != 1 || rows[0]["name"] != "Bob" {
+		t.Errorf("wrong rows after restart: %v", rows)
+	}
+}
+
+func TestDurableDBDuplicateRowsWithoutKey(t *testing.T) {
+	dir := t.TempDir()
+
+	db := openDurable(t, dir)
+	execSQL(t, db, "CREATE TABLE tags (name TEXT)")
+	execSQL(t, db, "INSERT INTO tags VALUES ('a')")
+	execSQL(t, db, "INSERT INTO tags VALUES ('a')")
+	execSQL(t, db, "INSERT INTO tags VALUES ('b')")
+	execSQL(t, db, "DELETE FROM tags WHERE name = 'a'")
+	execSQL(t, db, "INSERT INTO tags VALUES ('c')")
+	execSQL(t, db, "DELETE FROM tags")
+	execSQL(t, db, "INSERT INTO tags VALUES ('d')")
+	db.Close()
+
+	db = openDurable(t, dir)
+	defer db.Close()
+
+	rows := liveRows(t, db.tables["tags"])
+	if len(rows) != 1 || rows[0]["name"] != "d" {
+		t.Errorf("wrong rows recovered. got=%v", rows)
+	}
+}
+
+func TestDurableDBTruncatesTornTail(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(data []byte) []byte
+	}{
+		{"partial header", func(data []byte) []byte { return append(data, 0x01, 0x02) }},
+		{"length past the end", func(data []byte) []byte {
+			return append(data, 0xf0, 0xff, 0xff, 0xff, 0, 0, 0, 0, 0x01)
+		}},
+		{"partial payload", func(data []byte) []byte { return data[:len(data)-3] }},
+		{"bad checksum", func(data []byte) []byte {
+			data[len(data)-1] ^= 0xff
+			return data
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			db := openDurable(t, dir)
+			execSQL(t, db, "CREATE TABLE users (id INT PRIMARY KEY, name TEXT)")
+			execSQL(t, db, "INSERT INTO users VALUES (1, 'Alice')")
+			execSQL(t, db, "INSERT INTO users VALUES (2, 'Bob')")
+			db.Close()
+
+			path := filepath.Join(dir, walFileName)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, tt.corrupt(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			db = openDurable(t, dir)
+			rows := liveRows(t, db.tables["users"])
+			if tt.name == "partial header" || tt.name == "length past the end" {
+				// every complete record survives
+				if len(rows) != 2 {
+					t.Fatalf("wrong number of rows. expected=2, got=%d", len(rows))
+				}
+			} else if len(rows) != 1 || rows[0]["name"] != "Alice" {
+				t.Fatalf("expected only the first insert to survive. got=%v", rows)
+			}
+
+			// the log was cut back to the last good record and stays usable
+			execSQL(t, db, "INSERT INTO users VALUES (3, 'Carol')")
+			db.Close()
+
+			db = openDurable(t, dir)
+			defer db.Close()
+			if db.tables["users"].ids != len(rows)+1 {
+				t.Errorf("wrong number of rows after reopen. expected=%d, got=%d", len(rows)+1, db.tables["users"].ids)
+			}
+		})
+	}
+}
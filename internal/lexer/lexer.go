@@ -6,9 +6,10 @@ import (
 
 type Lexer struct {
 	input        string
-	position     int  // current position in input
-	readPosition int  // current reading position in input after current char
-	ch           byte // current char under examination
+	position     int             // current position in input
+	readPosition int             // current reading position in input after current char
+	ch           byte            // current char under examination
+	last         token.TokenType // type of the previous token, decides what a - means
 }
 
 func New(input string) *Lexer {
@@ -31,6 +32,12 @@ func (l *Lexer) readChar() {
 
 // read a character at a time and return tokens, advances to the next character
 func (l *Lexer) NextToken() token.Token {
+	tok := l.readToken()
+	l.last = tok.Type
+	return tok
+}
+
+func (l *Lexer) readToken() token.Token {
 	var tok token.Token
 
 	// consume white spaces
@@ -49,10 +56,45 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.RPAREN, l.ch)
 	case '.':
 		tok = newToken(token.DOT, l.ch)
+	case '+':
+		tok = newToken(token.PLUS, l.ch)
+	case '/':
+		tok = newToken(token.SLASH, l.ch)
+	case '-':
+		// a minus sign where a value is expected belongs to the number -> (1, -5), a > -5
+		// while after a value it subtracts -> a -5, 3-5
+		if isDigit(l.peekChar()) && !endsValue(l.last) {
+			l.readChar()
+			tok.Type, tok.Literal = l.readNumber()
+			tok.Literal = "-" + tok.Literal
+			return tok
+		}
+		tok = newToken(token.MINUS, l.ch)
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.GTE, Literal: ">="}
+		} else {
+			tok = newToken(token.GT, l.ch)
+		}
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.LTE, Literal: "<="}
+		} else if l.peekChar() == '>' {
+			// <> is the standard sql spelling of !=
+			l.readChar()
+			tok = token.Token{Type: token.NOT_EQ, Literal: "<>"}
+		} else {
+			tok = newToken(token.LT, l.ch)
+		}
+	case '!':
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.NOT_EQ, Literal: "!="}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case '\'':
 		tok.Type = token.STRING
 		tok.Literal = l.readString()
@@ -68,8 +110,7 @@ func (l *Lexer) NextToken() token.Token {
 			return tok
 		} else if isDigit(l.ch) {
 			// read number
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			tok.Type, tok.Literal = l.readNumber()
 
 			return tok
 		} else {
@@ -108,13 +149,33 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readNumber() string {
+// read an integer, or a number with a fractional part -> 42, 3.14
+func (l *Lexer) readNumber() (token.TokenType, string) {
 	position := l.position
 	for isDigit(l.ch) {
 		l.readChar()
 	}
 
-	return l.input[position:l.position]
+	if l.ch != '.' || !isDigit(l.peekChar()) {
+		return token.INT, l.input[position:l.position]
+	}
+
+	l.readChar() // consume .
+	for isDigit(l.ch) {
+		l.readChar()
+	}
+
+	return token.FLOAT, l.input[position:l.position]
+}
+
+// report whether a token can end a value, so a - after it is a subtraction
+func endsValue(t token.TokenType) bool {
+	switch t {
+	case token.IDENT, token.INT, token.FLOAT, token.STRING, token.RPAREN, token.NULL, token.TRUE, token.FALSE:
+		return true
+	default:
+		return false
+	}
 }
 
 func (l *Lexer) readString() string {
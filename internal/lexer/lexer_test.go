@@ -141,3 +141,243 @@ func TestAllCommands(t *testing.T) {
 		}
 	}
 }
+
+func TestLogicalOperators(t *testing.T) {
+	input := `WHERE NOT (a >= 1 AND b <= 2) OR c != 3 OR d <> 4`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.WHERE, "WHERE"},
+		{token.NOT, "NOT"},
+		{token.LPAREN, "("},
+		{token.IDENT, "a"},
+		{token.GTE, ">="},
+		{token.INT, "1"},
+		{token.AND, "AND"},
+		{token.IDENT, "b"},
+		{token.LTE, "<="},
+		{token.INT, "2"},
+		{token.RPAREN, ")"},
+		{token.OR, "OR"},
+		{token.IDENT, "c"},
+		{token.NOT_EQ, "!="},
+		{token.INT, "3"},
+		{token.OR, "OR"},
+		{token.IDENT, "d"},
+		{token.NOT_EQ, "<>"},
+		{token.INT, "4"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNullKeywords(t *testing.T) {
+	input := `email TEXT NOT NULL WHERE bio is not null`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "email"},
+		{token.TYPE_TEXT, "TEXT"},
+		{token.NOT, "NOT"},
+		{token.NULL, "NULL"},
+		{token.WHERE, "WHERE"},
+		{token.IDENT, "bio"},
+		{token.IS, "is"},
+		{token.NOT, "not"},
+		{token.NULL, "null"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	input := `VALUES (-5, 2.50, -0.75) WHERE a-1 > b - 2 * 0.5 / 3 + 1`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.VALUES, "VALUES"},
+		{token.LPAREN, "("},
+		{token.INT, "-5"},
+		{token.COMMA, ","},
+		{token.FLOAT, "2.50"},
+		{token.COMMA, ","},
+		{token.FLOAT, "-0.75"},
+		{token.RPAREN, ")"},
+		{token.WHERE, "WHERE"},
+		// after a value a minus is subtraction, not a sign
+		{token.IDENT, "a"},
+		{token.MINUS, "-"},
+		{token.INT, "1"},
+		{token.GT, ">"},
+		{token.IDENT, "b"},
+		{token.MINUS, "-"},
+		{token.INT, "2"},
+		{token.ASTERISK, "*"},
+		{token.FLOAT, "0.5"},
+		{token.SLASH, "/"},
+		{token.INT, "3"},
+		{token.PLUS, "+"},
+		{token.INT, "1"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestDatetimeKeywords(t *testing.T) {
+	input := `day DATE, at time, created_at TIMESTAMP > NOW() - interval '1 day'`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "day"},
+		{token.TYPE_DATE, "DATE"},
+		{token.COMMA, ","},
+		{token.IDENT, "at"},
+		{token.TYPE_TIME, "time"},
+		{token.COMMA, ","},
+		{token.IDENT, "created_at"},
+		{token.TYPE_TIMESTAMP, "TIMESTAMP"},
+		{token.GT, ">"},
+		{token.IDENT, "NOW"},
+		{token.LPAREN, "("},
+		{token.RPAREN, ")"},
+		{token.MINUS, "-"},
+		{token.INTERVAL, "interval"},
+		{token.STRING, "1 day"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestAlterKeywords(t *testing.T) {
+	input := `ALTER TABLE users add column age INT default 0 RENAME to`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.ALTER, "ALTER"},
+		{token.TABLE, "TABLE"},
+		{token.IDENT, "users"},
+		{token.ADD, "add"},
+		{token.COLUMN, "column"},
+		{token.IDENT, "age"},
+		{token.TYPE_INT, "INT"},
+		{token.DEFAULT, "default"},
+		{token.INT, "0"},
+		{token.RENAME, "RENAME"},
+		{token.TO, "to"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestForeignKeyKeywords(t *testing.T) {
+	input := `FOREIGN KEY (user_id) references users ON DELETE cascade restrict`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.FOREIGN, "FOREIGN"},
+		{token.KEY, "KEY"},
+		{token.LPAREN, "("},
+		{token.IDENT, "user_id"},
+		{token.RPAREN, ")"},
+		{token.REFERENCES, "references"},
+		{token.IDENT, "users"},
+		{token.ON, "ON"},
+		{token.DELETE, "DELETE"},
+		{token.CASCADE, "cascade"},
+		{token.RESTRICT, "restrict"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
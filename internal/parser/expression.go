@@ -0,0 +1,304 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/raskovnik/rdbms/internal/ast"
+	"github.com/raskovnik/rdbms/internal/token"
+)
+
+// operator precedences, lowest binds last
+const (
+	_ int = iota
+	LOWEST
+	OR         // OR
+	AND        // AND
+	NOT        // NOT x
+	COMPARISON // = != < <= > >= IS
+	SUM        // + -
+	PRODUCT    // * /
+	PREFIX     // -x
+)
+
+var precedences = map[token.TokenType]int{
+	token.OR:       OR,
+	token.AND:      AND,
+	token.ASSIGN:   COMPARISON,
+	token.NOT_EQ:   COMPARISON,
+	token.LT:       COMPARISON,
+	token.LTE:      COMPARISON,
+	token.GT:       COMPARISON,
+	token.GTE:      COMPARISON,
+	token.IS:       COMPARISON,
+	token.PLUS:     SUM,
+	token.MINUS:    SUM,
+	token.ASTERISK: PRODUCT,
+	token.SLASH:    PRODUCT,
+}
+
+// tokens that start an aggregate function call
+var aggregateFunctions = map[token.TokenType]bool{
+	token.COUNT: true,
+	token.SUM:   true,
+	token.AVG:   true,
+	token.MIN:   true,
+	token.MAX:   true,
+}
+
+type (
+	prefixParseFn func() (ast.Expression, error)
+	infixParseFn  func(ast.Expression) (ast.Expression, error)
+)
+
+func (p *Parser) registerExpressionFns() {
+	p.prefixParseFns = map[token.TokenType]prefixParseFn{
+		token.IDENT:  p.parseIdentifier,
+		token.INT:    p.parseLiteral,
+		token.FLOAT:  p.parseLiteral,
+		token.MINUS:  p.parseNegation,
+		token.STRING: p.parseLiteral,
+		token.NULL:   p.parseLiteral,
+		token.TRUE:   p.parseLiteral,
+		token.FALSE:  p.parseLiteral,
+		token.LPAREN: p.parseGroupedExpression,
+		token.NOT:    p.parseNotExpression,
+
+		token.TYPE_DATE:      p.parseLiteral,
+		token.TYPE_TIME:      p.parseLiteral,
+		token.TYPE_TIMESTAMP: p.parseLiteral,
+		token.INTERVAL:       p.parseLiteral,
+	}
+	for tokenType := range aggregateFunctions {
+		p.prefixParseFns[tokenType] = p.parseAggregateExpression
+	}
+
+	p.infixParseFns = make(map[token.TokenType]infixParseFn)
+	for tokenType := range precedences {
+		p.infixParseFns[tokenType] = p.parseBinaryExpression
+	}
+	p.infixParseFns[token.IS] = p.parseIsNullExpression
+}
+
+func (p *Parser) peekPrecedence() int {
+	if p, ok := precedences[p.peekToken.Type]; ok {
+		return p
+	}
+	return LOWEST
+}
+
+func (p *Parser) curPrecedence() int {
+	if p, ok := precedences[p.curToken.Type]; ok {
+		return p
+	}
+	return LOWEST
+}
+
+// parse an expression starting at the current token (pratt parsing), leaves the
+// current token on the last token of the expression
+func (p *Parser) parseExpression(precedence int) (ast.Expression, error) {
+	prefix, ok := p.prefixParseFns[p.curToken.Type]
+	if !ok {
+		return nil, fmt.Errorf("unexpected %s in expression", p.curToken.Type)
+	}
+
+	left, err := prefix()
+	if err != nil {
+		return nil, err
+	}
+
+	for precedence < p.peekPrecedence() {
+		infix := p.infixParseFns[p.peekToken.Type]
+		p.nextToken() // move to the operator
+
+		left, err = infix(left)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return left, nil
+}
+
+// parse a column name, or a function call when a ( follows the name. CURRENT_DATE
+// is a call written without one
+func (p *Parser) parseIdentifier() (ast.Expression, error) {
+	if p.peekTokenIs(token.LPAREN) {
+		return p.parseFunctionCall()
+	}
+	if name := strings.ToUpper(p.curToken.Literal); name == "CURRENT_DATE" {
+		return &ast.FunctionCall{Name: name}, nil
+	}
+	return &ast.Identifier{Name: p.curToken.Literal}, nil
+}
+
+// parse NAME(arg, ...) or EXTRACT(field FROM source), leaves the current token on )
+func (p *Parser) parseFunctionCall() (ast.Expression, error) {
+	name := strings.ToUpper(p.curToken.Literal)
+	p.nextToken() // consume the name, ( is current
+
+	if name == "EXTRACT" {
+		return p.parseExtract()
+	}
+
+	call := &ast.FunctionCall{Name: name}
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return call, nil
+	}
+
+	for {
+		p.nextToken() // move to the argument
+		arg, err := p.parseExpression(LOWEST)
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken() // consume ,
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil, fmt.Errorf("expected ) to close %s, got %s", name, p.peekToken.Type)
+	}
+
+	return call, nil
+}
+
+func (p *Parser) parseExtract() (ast.Expression, error) {
+	if !p.expectPeek(token.IDENT) {
+		return nil, fmt.Errorf("expected field name in EXTRACT, got %s", p.peekToken.Type)
+	}
+	expr := &ast.ExtractExpression{Field: strings.ToUpper(p.curToken.Literal)}
+
+	if !p.expectPeek(token.FROM) {
+		return nil, fmt.Errorf("expected FROM after EXTRACT field, got %s", p.peekToken.Type)
+	}
+
+	p.nextToken() // move to the source
+	source, err := p.parseExpression(LOWEST)
+	if err != nil {
+		return nil, err
+	}
+	expr.Source = source
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil, fmt.Errorf("expected ) to close EXTRACT, got %s", p.peekToken.Type)
+	}
+
+	return expr, nil
+}
+
+func (p *Parser) parseLiteral() (ast.Expression, error) {
+	val, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.Literal{Value: val}, nil
+}
+
+func (p *Parser) parseGroupedExpression() (ast.Expression, error) {
+	p.nextToken() // consume (
+
+	expr, err := p.parseExpression(LOWEST)
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil, fmt.Errorf("expected ) to close expression, got %s", p.peekToken.Type)
+	}
+
+	return expr, nil
+}
+
+func (p *Parser) parseNotExpression() (ast.Expression, error) {
+	p.nextToken() // consume NOT
+
+	// NOT binds looser than comparisons -> NOT a = 1 is NOT (a = 1)
+	operand, err := p.parseExpression(NOT)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.UnaryExpression{Operator: "NOT", Operand: operand}, nil
+}
+
+func (p *Parser) parseNegation() (ast.Expression, error) {
+	p.nextToken() // consume -
+
+	operand, err := p.parseExpression(PREFIX)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.UnaryExpression{Operator: "-", Operand: operand}, nil
+}
+
+func (p *Parser) parseBinaryExpression(left ast.Expression) (ast.Expression, error) {
+	expr := &ast.BinaryExpression{
+		Left:     left,
+		Operator: string(p.curToken.Type),
+	}
+
+	precedence := p.curPrecedence()
+	p.nextToken() // move to the right operand
+
+	right, err := p.parseExpression(precedence)
+	if err != nil {
+		return nil, err
+	}
+
+	expr.Right = right
+
+	return expr, nil
+}
+
+// parse IS NULL or IS NOT NULL after an operand, leaves the current token on NULL
+func (p *Parser) parseIsNullExpression(left ast.Expression) (ast.Expression, error) {
+	expr := &ast.IsNullExpression{Operand: left}
+
+	if p.peekTokenIs(token.NOT) {
+		p.nextToken() // consume NOT
+		expr.Not = true
+	}
+
+	if !p.expectPeek(token.NULL) {
+		return nil, fmt.Errorf("expected NULL after IS, got %s", p.peekToken.Type)
+	}
+
+	return expr, nil
+}
+
+func (p *Parser) parseAggregateExpression() (ast.Expression, error) {
+	return p.parseAggregate()
+}
+
+// parse FUNC(col) or COUNT(*), leaves the current token on )
+func (p *Parser) parseAggregate() (*ast.AggregateExpression, error) {
+	agg := &ast.AggregateExpression{Function: string(p.curToken.Type)}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil, fmt.Errorf("expected ( after %s, got %s", agg.Function, p.peekToken.Type)
+	}
+
+	p.nextToken() // move to the argument
+	switch {
+	case p.curTokenIs(token.IDENT):
+		agg.Column = p.curToken.Literal
+	case p.curTokenIs(token.ASTERISK) && agg.Function == token.COUNT:
+		agg.Column = "*"
+	default:
+		return nil, fmt.Errorf("expected column name in %s, got %s", agg.Function, p.curToken.Type)
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil, fmt.Errorf("expected ) to close %s, got %s", agg.Function, p.peekToken.Type)
+	}
+
+	return agg, nil
+}
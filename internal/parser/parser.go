@@ -3,8 +3,11 @@ package parser
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/raskovnik/rdbms/internal/ast"
+	"github.com/raskovnik/rdbms/internal/datetime"
+	"github.com/raskovnik/rdbms/internal/decimal"
 	"github.com/raskovnik/rdbms/internal/lexer"
 	"github.com/raskovnik/rdbms/internal/token"
 )
@@ -14,6 +17,9 @@ type Parser struct {
 	curToken  token.Token
 	peekToken token.Token
 	errors    []string
+
+	prefixParseFns map[token.TokenType]prefixParseFn
+	infixParseFns  map[token.TokenType]infixParseFn
 }
 
 func New(l *lexer.Lexer) *Parser {
@@ -22,6 +28,8 @@ func New(l *lexer.Lexer) *Parser {
 		errors: []string{},
 	}
 
+	p.registerExpressionFns()
+
 	// initialize curToken and peekToken
 	p.nextToken()
 	p.nextToken()
@@ -67,13 +75,33 @@ func (p *Parser) ParseStatement() (ast.Statement, error) {
 	case token.INSERT:
 		return p.parseInsert()
 	case token.CREATE:
+		if p.peekTokenIs(token.INDEX) || p.peekTokenIs(token.UNIQUE) {
+			return p.parseCreateIndexStatement()
+		}
+		if p.peekTokenIs(token.SEQUENCE) {
+			return p.parseCreateSequence()
+		}
 		return p.parseCreateStatement()
+	case token.DROP:
+		return p.parseDropStatement()
+	case token.ALTER:
+		return p.parseAlterStatement()
+	case token.TRUNCATE:
+		return p.parseTruncateStatement()
 	case token.SELECT:
 		return p.parseSelectStatement()
 	case token.UPDATE:
 		return p.parseUpdateStatement()
 	case token.DELETE:
 		return p.parseDeleteStatement()
+	case token.CHECKPOINT:
+		return &ast.CheckpointStatement{}, nil
+	case token.BEGIN:
+		return &ast.BeginStatement{}, nil
+	case token.COMMIT:
+		return &ast.CommitStatement{}, nil
+	case token.ROLLBACK:
+		return &ast.RollbackStatement{}, nil
 	default:
 		return nil, fmt.Errorf("unexpected token: %s", p.curToken.Type)
 	}
@@ -93,27 +121,99 @@ func (p *Parser) parseInsert() (*ast.InsertStatement, error) {
 	}
 	stmt.Table = p.curToken.Literal
 
+	// optional column list -> INSERT INTO users (id, name) VALUES ...
+	if p.peekTokenIs(token.LPAREN) {
+		p.nextToken() // move to (
+		columns, err := p.parseColumnList()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Columns = columns
+	}
+
 	// expect values keyword
 	if !p.expectPeek(token.VALUES) {
 		return nil, fmt.Errorf("expected VALUES")
 	}
 
-	// expect opening parenthesis
-	if !p.expectPeek(token.LPAREN) {
-		return nil, fmt.Errorf("expected ( after VALUES")
+	// one or more rows -> VALUES (1, 'a'), (2, 'b')
+	for {
+		if !p.expectPeek(token.LPAREN) {
+			return nil, fmt.Errorf("expected ( after VALUES")
+		}
+
+		values, err := p.parseValueList()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Values = append(stmt.Values, values)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken() // consume comma
+	}
+
+	// RETURNING * or RETURNING col, col
+	if p.peekTokenIs(token.RETURNING) {
+		p.nextToken() // consume returning
+		if p.peekTokenIs(token.ASTERISK) {
+			p.nextToken()
+			stmt.Returning = []string{"*"}
+			return stmt, nil
+		}
+
+		for {
+			if !p.expectPeek(token.IDENT) {
+				return nil, fmt.Errorf("expected column name after RETURNING, got %s", p.peekToken.Type)
+			}
+			stmt.Returning = append(stmt.Returning, p.curToken.Literal)
+
+			if !p.peekTokenIs(token.COMMA) {
+				break
+			}
+			p.nextToken() // consume comma
+		}
 	}
 
-	// parse values
-	stmt.Values = []interface{}{}
+	return stmt, nil
+
+}
+
+// parse (col, col) starting at (, leaves the current token on )
+func (p *Parser) parseColumnList() ([]string, error) {
+	var columns []string
+	for {
+		if !p.expectPeek(token.IDENT) {
+			return nil, fmt.Errorf("expected column name, got %s", p.peekToken.Type)
+		}
+		columns = append(columns, p.curToken.Literal)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken() // consume comma
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil, fmt.Errorf("expected ',' or ')' after column name")
+	}
+
+	return columns, nil
+}
+
+// parse (value, value) starting at (, leaves the current token on )
+func (p *Parser) parseValueList() ([]interface{}, error) {
+	values := []interface{}{}
 	p.nextToken() // move to the first value
 
 	for !p.curTokenIs(token.RPAREN) && !p.curTokenIs(token.EOF) {
-		val, err := p.parseValue()
+		val, err := p.parseSlot()
 		if err != nil {
 			return nil, err
 		}
 
-		stmt.Values = append(stmt.Values, val)
+		values = append(values, val)
 
 		// check for comma or closing parenthesis
 		if p.peekTokenIs(token.COMMA) {
@@ -130,8 +230,20 @@ func (p *Parser) parseInsert() (*ast.InsertStatement, error) {
 		return nil, fmt.Errorf("expected ')' to close values")
 	}
 
-	return stmt, nil
+	return values, nil
+}
 
+// parse a VALUES or SET value, a literal is kept as its value and anything else as
+// the expression the engine computes for each row -> 1, nextval('ids'), NOW()
+func (p *Parser) parseSlot() (interface{}, error) {
+	expr, err := p.parseExpression(LOWEST)
+	if err != nil {
+		return nil, err
+	}
+	if lit, ok := expr.(*ast.Literal); ok {
+		return lit.Value, nil
+	}
+	return expr, nil
 }
 
 func (p *Parser) parseValue() (interface{}, error) {
@@ -142,13 +254,56 @@ func (p *Parser) parseValue() (interface{}, error) {
 			return nil, fmt.Errorf("could not parse %s as integer", p.curToken.Literal)
 		}
 		return val, nil
+	case token.FLOAT:
+		// fractional literals are exact, the column type decides how they are stored
+		val, err := decimal.Parse(p.curToken.Literal)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %s as a number", p.curToken.Literal)
+		}
+		return val, nil
 	case token.STRING:
 		return p.curToken.Literal, nil
+	case token.TRUE:
+		return true, nil
+	case token.FALSE:
+		return false, nil
+	case token.NULL:
+		return nil, nil
+	case token.TYPE_DATE, token.TYPE_TIME, token.TYPE_TIMESTAMP, token.INTERVAL:
+		return p.parseTypedLiteral()
 	default:
 		return nil, fmt.Errorf("unexpected value type: %s", p.curToken.Type)
 	}
 }
 
+// parse a type name followed by a string -> DATE '2024-01-15', TIME '14:30:00',
+// TIMESTAMP '2024-01-15 14:30:00', INTERVAL '1 day'
+func (p *Parser) parseTypedLiteral() (interface{}, error) {
+	typeName := strings.ToUpper(p.curToken.Literal)
+	if !p.expectPeek(token.STRING) {
+		return nil, fmt.Errorf("expected string after %s, got %s", typeName, p.peekToken.Type)
+	}
+
+	var (
+		val interface{}
+		err error
+	)
+	switch typeName {
+	case "DATE":
+		val, err = datetime.ParseDate(p.curToken.Literal)
+	case "TIME":
+		val, err = datetime.ParseTime(p.curToken.Literal)
+	case "TIMESTAMP":
+		val, err = datetime.ParseTimestamp(p.curToken.Literal)
+	default:
+		val, err = datetime.ParseInterval(p.curToken.Literal)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
 func (p *Parser) parseCreateStatement() (*ast.CreateStatement, error) {
 	stmt := &ast.CreateStatement{}
 
@@ -157,6 +312,14 @@ func (p *Parser) parseCreateStatement() (*ast.CreateStatement, error) {
 		return nil, fmt.Errorf("expected TABLE after CREATE")
 	}
 
+	if p.peekTokenIs(token.IF) {
+		p.nextToken() // consume if
+		if !p.expectPeek(token.NOT) || !p.expectPeek(token.EXISTS) {
+			return nil, fmt.Errorf("expected NOT EXISTS after IF")
+		}
+		stmt.IfNotExists = true
+	}
+
 	// get table name
 	if !p.expectPeek(token.IDENT) {
 		return nil, fmt.Errorf("expected table name")
@@ -175,12 +338,41 @@ func (p *Parser) parseCreateStatement() (*ast.CreateStatement, error) {
 	// move to first column
 	p.nextToken()
 
+	// table constraints name their column, which may be defined after them
+	foreignKeys := map[string]*ast.ForeignKey{}
+	var constrained []string
+	var keys []ast.KeyConstraint
+
 	for !p.curTokenIs(token.RPAREN) && !p.curTokenIs(token.EOF) {
-		col, err := p.parseColumnDef()
-		if err != nil {
-			return nil, err
+		if p.curTokenIs(token.CONSTRAINT) || p.curTokenIs(token.CHECK) {
+			check, err := p.parseCheck()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Checks = append(stmt.Checks, check)
+		} else if (p.curTokenIs(token.PRIMARY) && p.peekTokenIs(token.KEY)) || (p.curTokenIs(token.UNIQUE) && p.peekTokenIs(token.LPAREN)) {
+			key, err := p.parseKey()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		} else if p.curTokenIs(token.FOREIGN) {
+			column, fk, err := p.parseForeignKey()
+			if err != nil {
+				return nil, err
+			}
+			if _, exists := foreignKeys[column]; exists {
+				return nil, fmt.Errorf("column %s has more than one FOREIGN KEY", column)
+			}
+			foreignKeys[column] = fk
+			constrained = append(constrained, column)
+		} else {
+			col, err := p.parseColumnDef()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Columns = append(stmt.Columns, col)
 		}
-		stmt.Columns = append(stmt.Columns, col)
 
 		// check for comma -> more columnr or closing rparen -> done
 		if p.peekTokenIs(token.COMMA) {
@@ -197,9 +389,193 @@ func (p *Parser) parseCreateStatement() (*ast.CreateStatement, error) {
 		return nil, fmt.Errorf("expected ) to close column definitions")
 	}
 
+	// a key on one column is the same as the column constraint
+	for _, key := range keys {
+		for _, column := range key.Columns {
+			if !hasColumn(stmt.Columns, column) {
+				return nil, fmt.Errorf("key column %s is not defined", column)
+			}
+		}
+		if len(key.Columns) > 1 {
+			stmt.Keys = append(stmt.Keys, key)
+			continue
+		}
+
+		for i := range stmt.Columns {
+			col := &stmt.Columns[i]
+			if col.Name != key.Columns[0] {
+				continue
+			}
+			if key.Primary {
+				col.PrimaryKey = true
+			} else {
+				col.Unique = true
+			}
+		}
+	}
+
+	for _, column := range constrained {
+		found := false
+		for i := range stmt.Columns {
+			if stmt.Columns[i].Name != column {
+				continue
+			}
+			if stmt.Columns[i].References != nil {
+				return nil, fmt.Errorf("column %s has more than one FOREIGN KEY", column)
+			}
+			stmt.Columns[i].References = foreignKeys[column]
+			found = true
+		}
+		if !found {
+			return nil, fmt.Errorf("FOREIGN KEY column %s is not defined", column)
+		}
+	}
+
 	return stmt, nil
 }
 
+// parse PRIMARY KEY (col, col) or UNIQUE (col, col) starting at PRIMARY or UNIQUE,
+// leaves the current token on )
+func (p *Parser) parseKey() (ast.KeyConstraint, error) {
+	key := ast.KeyConstraint{Primary: p.curTokenIs(token.PRIMARY)}
+	if key.Primary {
+		p.nextToken() // consume primary
+	}
+
+	if !p.expectPeek(token.LPAREN) {
+		return key, fmt.Errorf("expected ( after %s", p.curToken.Literal)
+	}
+	columns, err := p.parseColumnList()
+	if err != nil {
+		return key, err
+	}
+
+	seen := make(map[string]bool, len(columns))
+	for _, col := range columns {
+		if seen[col] {
+			return key, fmt.Errorf("column %s appears more than once in key", col)
+		}
+		seen[col] = true
+	}
+	key.Columns = columns
+	return key, nil
+}
+
+// report whether a column is defined in a list of column definitions
+func hasColumn(columns []ast.ColumnDef, name string) bool {
+	for _, col := range columns {
+		if col.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parse [CONSTRAINT name] CHECK (expr) starting at CONSTRAINT or CHECK, leaves the
+// current token on )
+func (p *Parser) parseCheck() (ast.CheckConstraint, error) {
+	check := ast.CheckConstraint{}
+
+	if p.curTokenIs(token.CONSTRAINT) {
+		if !p.expectPeek(token.IDENT) {
+			return check, fmt.Errorf("expected constraint name after CONSTRAINT")
+		}
+		check.Name = p.curToken.Literal
+
+		if !p.expectPeek(token.CHECK) {
+			return check, fmt.Errorf("expected CHECK after CONSTRAINT %s", check.Name)
+		}
+	}
+
+	if !p.expectPeek(token.LPAREN) {
+		return check, fmt.Errorf("expected ( after CHECK")
+	}
+	p.nextToken() // move to the expression
+
+	expr, err := p.parseExpression(LOWEST)
+	if err != nil {
+		return check, fmt.Errorf("invalid CHECK: %w", err)
+	}
+	check.Expr = expr
+
+	if !p.expectPeek(token.RPAREN) {
+		return check, fmt.Errorf("expected ) to close CHECK, got %s", p.peekToken.Type)
+	}
+	return check, nil
+}
+
+// parse FOREIGN KEY (col) REFERENCES table[(col)] [ON DELETE action] starting at
+// FOREIGN, a constraint on a single column
+func (p *Parser) parseForeignKey() (string, *ast.ForeignKey, error) {
+	if !p.expectPeek(token.KEY) {
+		return "", nil, fmt.Errorf("expected KEY after FOREIGN")
+	}
+	if !p.expectPeek(token.LPAREN) {
+		return "", nil, fmt.Errorf("expected ( after FOREIGN KEY")
+	}
+	columns, err := p.parseColumnList()
+	if err != nil {
+		return "", nil, err
+	}
+	if len(columns) != 1 {
+		return "", nil, fmt.Errorf("FOREIGN KEY takes a single column, got %d", len(columns))
+	}
+
+	if !p.expectPeek(token.REFERENCES) {
+		return "", nil, fmt.Errorf("expected REFERENCES after FOREIGN KEY (%s)", columns[0])
+	}
+	fk, err := p.parseReferences()
+	if err != nil {
+		return "", nil, err
+	}
+	return columns[0], fk, nil
+}
+
+// parse REFERENCES table[(col)] [ON DELETE RESTRICT | CASCADE | SET NULL] starting at
+// REFERENCES
+func (p *Parser) parseReferences() (*ast.ForeignKey, error) {
+	if !p.expectPeek(token.IDENT) {
+		return nil, fmt.Errorf("expected table name after REFERENCES")
+	}
+	fk := &ast.ForeignKey{Table: p.curToken.Literal, OnDelete: "RESTRICT"}
+
+	if p.peekTokenIs(token.LPAREN) {
+		p.nextToken() // consume (
+		columns, err := p.parseColumnList()
+		if err != nil {
+			return nil, err
+		}
+		if len(columns) != 1 {
+			return nil, fmt.Errorf("REFERENCES takes a single column, got %d", len(columns))
+		}
+		fk.Column = columns[0]
+	}
+
+	if p.peekTokenIs(token.ON) {
+		p.nextToken() // consume on
+		if !p.expectPeek(token.DELETE) {
+			return nil, fmt.Errorf("expected DELETE after ON")
+		}
+
+		p.nextToken() // move to the action
+		switch p.curToken.Type {
+		case token.RESTRICT:
+			fk.OnDelete = "RESTRICT"
+		case token.CASCADE:
+			fk.OnDelete = "CASCADE"
+		case token.SET:
+			if !p.expectPeek(token.NULL) {
+				return nil, fmt.Errorf("expected NULL after ON DELETE SET")
+			}
+			fk.OnDelete = "SET NULL"
+		default:
+			return nil, fmt.Errorf("expected RESTRICT, CASCADE or SET NULL after ON DELETE, got %s", p.curToken.Type)
+		}
+	}
+
+	return fk, nil
+}
+
 func (p *Parser) parseColumnDef() (ast.ColumnDef, error) {
 	col := ast.ColumnDef{}
 
@@ -219,24 +595,366 @@ func (p *Parser) parseColumnDef() (ast.ColumnDef, error) {
 		col.Type = "TEXT"
 	case token.TYPE_BOOL:
 		col.Type = "BOOL"
+	case token.TYPE_FLOAT:
+		col.Type = "FLOAT"
+	case token.TYPE_DECIMAL:
+		col.Type = "DECIMAL"
+		if err := p.parseDecimalSize(&col); err != nil {
+			return col, err
+		}
+	case token.TYPE_DATE:
+		col.Type = "DATE"
+	case token.TYPE_TIME:
+		col.Type = "TIME"
+	case token.TYPE_TIMESTAMP:
+		col.Type = "TIMESTAMP"
+	case token.TYPE_SERIAL:
+		col.Type = "INT"
+		col.Serial = true
 	default:
-		return col, fmt.Errorf("expected type (INT, STRING, BOOL), got %s", p.curToken.Type)
+		return col, fmt.Errorf("expected type (INT, TEXT, BOOL, FLOAT, DECIMAL, DATE, TIME, TIMESTAMP, SERIAL), got %s", p.curToken.Type)
 	}
 
-	// check for primary key or unique
-	if p.peekTokenIs(token.PRIMARY) {
-		p.nextToken() // consume primary
-		if !p.expectPeek(token.KEY) {
-			return col, fmt.Errorf("expected KEY after PRIMARY")
+	// column constraints in any order -> PRIMARY KEY, UNIQUE, NOT NULL, DEFAULT expr,
+	// AUTOINCREMENT, REFERENCES table(col), [CONSTRAINT name] CHECK (expr)
+	for {
+		switch {
+		case p.peekTokenIs(token.CONSTRAINT) || p.peekTokenIs(token.CHECK):
+			p.nextToken() // move to constraint or check
+			if col.Check != nil {
+				return col, fmt.Errorf("column %s has more than one CHECK, combine them with AND", col.Name)
+			}
+
+			check, err := p.parseCheck()
+			if err != nil {
+				return col, err
+			}
+			col.Check = &check
+		case p.peekTokenIs(token.REFERENCES):
+			p.nextToken() // consume references
+			if col.References != nil {
+				return col, fmt.Errorf("column %s has more than one REFERENCES", col.Name)
+			}
+
+			fk, err := p.parseReferences()
+			if err != nil {
+				return col, err
+			}
+			col.References = fk
+		case p.peekTokenIs(token.AUTOINCREMENT):
+			p.nextToken() // consume autoincrement
+			if col.Type != "INT" {
+				return col, fmt.Errorf("AUTOINCREMENT column %s must be INT", col.Name)
+			}
+			col.Serial = true
+		case p.peekTokenIs(token.PRIMARY):
+			p.nextToken() // consume primary
+			if !p.expectPeek(token.KEY) {
+				return col, fmt.Errorf("expected KEY after PRIMARY")
+			}
+
+			col.PrimaryKey = true
+		case p.peekTokenIs(token.UNIQUE):
+			p.nextToken() // consume unique
+			col.Unique = true
+		case p.peekTokenIs(token.NOT):
+			p.nextToken() // consume not
+			if !p.expectPeek(token.NULL) {
+				return col, fmt.Errorf("expected NULL after NOT")
+			}
+
+			col.NotNull = true
+		case p.peekTokenIs(token.DEFAULT):
+			p.nextToken() // consume default
+			p.nextToken() // move to the value
+
+			expr, err := p.parseExpression(LOWEST)
+			if err != nil {
+				return col, fmt.Errorf("invalid DEFAULT for column %s: %w", col.Name, err)
+			}
+			col.Default = expr
+		default:
+			return col, nil
+		}
+	}
+}
+
+// parse the optional (precision, scale) after DECIMAL, leaves the current token on )
+func (p *Parser) parseDecimalSize(col *ast.ColumnDef) error {
+	if !p.peekTokenIs(token.LPAREN) {
+		return nil
+	}
+	p.nextToken() // consume (
+
+	if !p.expectPeek(token.INT) {
+		return fmt.Errorf("expected precision after DECIMAL(, got %s", p.peekToken.Type)
+	}
+	precision, err := strconv.Atoi(p.curToken.Literal)
+	if err != nil || precision < 1 {
+		return fmt.Errorf("DECIMAL precision must be a positive integer, got %s", p.curToken.Literal)
+	}
+	col.Precision = precision
+
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken() // consume ,
+		if !p.expectPeek(token.INT) {
+			return fmt.Errorf("expected scale after DECIMAL(%d,, got %s", precision, p.peekToken.Type)
+		}
+		scale, err := strconv.Atoi(p.curToken.Literal)
+		if err != nil || scale < 0 || scale > precision {
+			return fmt.Errorf("DECIMAL scale must be between 0 and the precision %d, got %s", precision, p.curToken.Literal)
 		}
+		col.Scale = scale
+	}
 
-		col.PrimaryKey = true
-	} else if p.peekTokenIs(token.UNIQUE) {
+	if !p.expectPeek(token.RPAREN) {
+		return fmt.Errorf("expected ) to close DECIMAL(, got %s", p.peekToken.Type)
+	}
+	return nil
+}
+
+func (p *Parser) parseCreateIndexStatement() (*ast.CreateIndexStatement, error) {
+	stmt := &ast.CreateIndexStatement{}
+
+	// current token is CREATE
+	if p.peekTokenIs(token.UNIQUE) {
 		p.nextToken() // consume unique
-		col.Unique = true
+		stmt.Unique = true
+	}
+
+	if !p.expectPeek(token.INDEX) {
+		return nil, fmt.Errorf("expected INDEX after CREATE")
+	}
+
+	// get index name
+	if !p.expectPeek(token.IDENT) {
+		return nil, fmt.Errorf("expected index name")
 	}
 
-	return col, nil
+	stmt.Name = p.curToken.Literal
+
+	if !p.expectPeek(token.ON) {
+		return nil, fmt.Errorf("expected ON after index name")
+	}
+
+	// get table name
+	if !p.expectPeek(token.IDENT) {
+		return nil, fmt.Errorf("expected table name after ON")
+	}
+
+	stmt.Table = p.curToken.Literal
+
+	// USING is optional
+	if p.peekTokenIs(token.USING) {
+		p.nextToken() // consume using
+		if !p.expectPeek(token.IDENT) {
+			return nil, fmt.Errorf("expected index method after USING")
+		}
+
+		switch method := strings.ToUpper(p.curToken.Literal); method {
+		case "BTREE", "HASH":
+			stmt.Using = method
+		default:
+			return nil, fmt.Errorf("unknown index method %s, expected BTREE or HASH", p.curToken.Literal)
+		}
+	}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil, fmt.Errorf("expected ( before indexed columns")
+	}
+
+	// parse indexed columns
+	for {
+		if !p.expectPeek(token.IDENT) {
+			return nil, fmt.Errorf("expected column name in index")
+		}
+
+		stmt.Columns = append(stmt.Columns, p.curToken.Literal)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken() // consume comma
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil, fmt.Errorf("expected ) after indexed columns")
+	}
+
+	return stmt, nil
+}
+
+func (p *Parser) parseDropStatement() (ast.Statement, error) {
+	// current token is DROP
+	if p.peekTokenIs(token.TABLE) {
+		return p.parseDropTable()
+	}
+
+	if !p.expectPeek(token.INDEX) {
+		return nil, fmt.Errorf("expected TABLE or INDEX after DROP")
+	}
+
+	// get index name
+	if !p.expectPeek(token.IDENT) {
+		return nil, fmt.Errorf("expected index name")
+	}
+
+	return &ast.DropIndexStatement{Name: p.curToken.Literal}, nil
+}
+
+func (p *Parser) parseCreateSequence() (*ast.CreateSequenceStatement, error) {
+	stmt := &ast.CreateSequenceStatement{Start: 1, Increment: 1}
+	p.nextToken() // consume create, SEQUENCE is current
+
+	if p.peekTokenIs(token.IF) {
+		p.nextToken() // consume sequence
+		if !p.expectPeek(token.NOT) || !p.expectPeek(token.EXISTS) {
+			return nil, fmt.Errorf("expected NOT EXISTS after IF")
+		}
+		stmt.IfNotExists = true
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil, fmt.Errorf("expected sequence name")
+	}
+	stmt.Name = p.curToken.Literal
+
+	// options in any order -> START WITH 100 INCREMENT BY 10
+	for {
+		var target *int
+		switch {
+		case p.peekTokenIs(token.START):
+			p.nextToken() // consume start
+			p.skipPeek(token.WITH)
+			target = &stmt.Start
+		case p.peekTokenIs(token.INCREMENT):
+			p.nextToken() // consume increment
+			p.skipPeek(token.BY)
+			target = &stmt.Increment
+		default:
+			return stmt, nil
+		}
+
+		n, err := p.parseSignedInt()
+		if err != nil {
+			return nil, err
+		}
+		*target = n
+	}
+}
+
+// parse an INT after the current token, with an optional minus sign
+func (p *Parser) parseSignedInt() (int, error) {
+	sign := 1
+	if p.peekTokenIs(token.MINUS) {
+		p.nextToken()
+		sign = -1
+	}
+
+	if !p.expectPeek(token.INT) {
+		return 0, fmt.Errorf("expected number, got %s", p.peekToken.Type)
+	}
+
+	n, err := strconv.Atoi(p.curToken.Literal)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse %s as integer", p.curToken.Literal)
+	}
+	return sign * n, nil
+}
+
+func (p *Parser) parseDropTable() (*ast.DropTableStatement, error) {
+	stmt := &ast.DropTableStatement{}
+	p.nextToken() // consume drop, TABLE is current
+
+	if p.peekTokenIs(token.IF) {
+		p.nextToken() // consume table
+		if !p.expectPeek(token.EXISTS) {
+			return nil, fmt.Errorf("expected EXISTS after IF")
+		}
+		stmt.IfExists = true
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil, fmt.Errorf("expected table name")
+	}
+	stmt.Table = p.curToken.Literal
+
+	return stmt, nil
+}
+
+func (p *Parser) parseTruncateStatement() (*ast.TruncateStatement, error) {
+	// current token is TRUNCATE, TABLE is optional
+	p.skipPeek(token.TABLE)
+
+	if !p.expectPeek(token.IDENT) {
+		return nil, fmt.Errorf("expected table name")
+	}
+
+	return &ast.TruncateStatement{Table: p.curToken.Literal}, nil
+}
+
+func (p *Parser) parseAlterStatement() (*ast.AlterTableStatement, error) {
+	stmt := &ast.AlterTableStatement{}
+
+	// current token is ALTER
+	if !p.expectPeek(token.TABLE) {
+		return nil, fmt.Errorf("expected TABLE after ALTER")
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil, fmt.Errorf("expected table name")
+	}
+	stmt.Table = p.curToken.Literal
+
+	p.nextToken() // move to the action
+	switch p.curToken.Type {
+	case token.ADD:
+		stmt.Action = "ADD COLUMN"
+		p.skipPeek(token.COLUMN)
+		p.nextToken() // move to the column name
+
+		col, err := p.parseColumnDef()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Column = col
+	case token.DROP:
+		stmt.Action = "DROP COLUMN"
+		p.skipPeek(token.COLUMN)
+		if !p.expectPeek(token.IDENT) {
+			return nil, fmt.Errorf("expected column name after DROP")
+		}
+		stmt.Name = p.curToken.Literal
+	case token.RENAME:
+		stmt.Action = "RENAME TO"
+		if !p.peekTokenIs(token.TO) {
+			stmt.Action = "RENAME COLUMN"
+			p.skipPeek(token.COLUMN)
+			if !p.expectPeek(token.IDENT) {
+				return nil, fmt.Errorf("expected column name after RENAME")
+			}
+			stmt.Name = p.curToken.Literal
+		}
+
+		if !p.expectPeek(token.TO) {
+			return nil, fmt.Errorf("expected TO after RENAME %s", stmt.Name)
+		}
+		if !p.expectPeek(token.IDENT) {
+			return nil, fmt.Errorf("expected new name after TO")
+		}
+		stmt.NewName = p.curToken.Literal
+	default:
+		return nil, fmt.Errorf("expected ADD, DROP or RENAME after ALTER TABLE %s, got %s", stmt.Table, p.curToken.Type)
+	}
+
+	return stmt, nil
+}
+
+// consume the next token if it is of type t, for optional keywords
+func (p *Parser) skipPeek(t token.TokenType) {
+	if p.peekTokenIs(t) {
+		p.nextToken()
+	}
 }
 
 func (p *Parser) parseSelectStatement() (ast.Statement, error) {
@@ -255,15 +973,21 @@ func (p *Parser) parseSelectStatement() (ast.Statement, error) {
 		stmt.Columns = []string{"*"}
 		p.nextToken() // move past *
 	} else {
-		// parse column list
+		// parse column list, aggregates can be mixed with columns
 		stmt.Columns = []string{}
 		for {
-			if !p.curTokenIs(token.IDENT) {
+			if aggregateFunctions[p.curToken.Type] {
+				agg, err := p.parseAggregate()
+				if err != nil {
+					return nil, err
+				}
+				stmt.Aggregates = append(stmt.Aggregates, agg)
+			} else if p.curTokenIs(token.IDENT) {
+				stmt.Columns = append(stmt.Columns, p.curToken.Literal)
+			} else {
 				return nil, fmt.Errorf("expected column name but got %s instead", p.curToken.Type)
 			}
 
-			stmt.Columns = append(stmt.Columns, p.curToken.Literal)
-
 			if p.peekTokenIs(token.COMMA) {
 				p.nextToken() // consume comma
 				p.nextToken() // move to next column
@@ -297,42 +1021,159 @@ func (p *Parser) parseSelectStatement() (ast.Statement, error) {
 
 		stmt.Where = wc
 	}
+
+	// check for GROUP BY clause
+	if p.peekTokenIs(token.GROUP) {
+		p.nextToken() // consume GROUP
+		groupBy, err := p.parseGroupBy()
+		if err != nil {
+			return nil, err
+		}
+
+		stmt.GroupBy = groupBy
+	}
+
+	// check for HAVING clause
+	if p.peekTokenIs(token.HAVING) {
+		p.nextToken() // consume HAVING
+		p.nextToken() // move to start of condition
+
+		if p.curTokenIs(token.EOF) {
+			return nil, fmt.Errorf("expected condition after HAVING")
+		}
+
+		having, err := p.parseExpression(LOWEST)
+		if err != nil {
+			return nil, err
+		}
+
+		stmt.Having = having
+	}
+
+	// check for ORDER BY clause
+	if p.peekTokenIs(token.ORDER) {
+		p.nextToken() // consume ORDER
+		orderBy, err := p.parseOrderBy()
+		if err != nil {
+			return nil, err
+		}
+
+		stmt.OrderBy = orderBy
+	}
+
+	// check for LIMIT [OFFSET] clause
+	if p.peekTokenIs(token.LIMIT) {
+		p.nextToken() // consume LIMIT
+		limit, err := p.parseCount("LIMIT")
+		if err != nil {
+			return nil, err
+		}
+		stmt.Limit = &limit
+
+		if p.peekTokenIs(token.OFFSET) {
+			p.nextToken() // consume OFFSET
+			offset, err := p.parseCount("OFFSET")
+			if err != nil {
+				return nil, err
+			}
+			stmt.Offset = offset
+		}
+	}
 	return stmt, nil
 }
 
-func (p *Parser) parseWhereClause() (*ast.WhereClause, error) {
-	where := &ast.WhereClause{}
+// read the row count after LIMIT or OFFSET
+func (p *Parser) parseCount(clause string) (int, error) {
+	if !p.expectPeek(token.INT) {
+		return 0, fmt.Errorf("expected row count after %s, got %s", clause, p.peekToken.Type)
+	}
 
-	// get column name
-	if !p.expectPeek(token.IDENT) {
-		return nil, fmt.Errorf("expected column name in WHERE clause, got %s", p.curToken.Type)
+	count, err := strconv.Atoi(p.curToken.Literal)
+	if err != nil {
+		return 0, fmt.Errorf("invalid row count %s after %s", p.curToken.Literal, clause)
 	}
+	if count < 0 {
+		return 0, fmt.Errorf("row count after %s must not be negative", clause)
+	}
+	return count, nil
+}
 
-	where.Column = p.curToken.Literal
+func (p *Parser) parseOrderBy() ([]ast.OrderByItem, error) {
+	// current token is ORDER
+	if !p.expectPeek(token.BY) {
+		return nil, fmt.Errorf("expected BY after ORDER")
+	}
 
-	// get the operator
-	p.nextToken() // move to the operator
-	switch p.curToken.Type {
-	case token.ASSIGN:
-		where.Operator = "="
-	case token.GT:
-		where.Operator = ">"
-	case token.LT:
-		where.Operator = "<"
-	default:
-		return nil, fmt.Errorf("expected operator (=, >, <), got %s instead", p.curToken.Type)
+	var items []ast.OrderByItem
+	for {
+		p.nextToken() // move to the column or aggregate
+
+		var item ast.OrderByItem
+		switch {
+		case p.curTokenIs(token.IDENT):
+			item.Column = p.curToken.Literal
+		case aggregateFunctions[p.curToken.Type]:
+			agg, err := p.parseAggregate()
+			if err != nil {
+				return nil, err
+			}
+			item.Column = agg.String()
+			item.Aggregate = agg
+		default:
+			return nil, fmt.Errorf("expected column name in ORDER BY, got %s", p.curToken.Type)
+		}
+
+		// direction is optional, ascending by default
+		if p.peekTokenIs(token.ASC) {
+			p.nextToken()
+		} else if p.peekTokenIs(token.DESC) {
+			p.nextToken()
+			item.Descending = true
+		}
+
+		items = append(items, item)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken() // consume comma
 	}
 
-	// get the value
-	p.nextToken()
-	val, err := p.parseValue()
-	if err != nil {
-		return nil, err
+	return items, nil
+}
+
+func (p *Parser) parseGroupBy() ([]string, error) {
+	// current token is GROUP
+	if !p.expectPeek(token.BY) {
+		return nil, fmt.Errorf("expected BY after GROUP")
 	}
 
-	where.Value = val
+	var columns []string
+	for {
+		if !p.expectPeek(token.IDENT) {
+			return nil, fmt.Errorf("expected column name in GROUP BY, got %s", p.peekToken.Type)
+		}
+
+		columns = append(columns, p.curToken.Literal)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken() // consume comma
+	}
+
+	return columns, nil
+}
+
+func (p *Parser) parseWhereClause() (ast.Expression, error) {
+	// current token is WHERE
+	p.nextToken() // move to start of condition
+
+	if p.curTokenIs(token.EOF) {
+		return nil, fmt.Errorf("expected condition after WHERE")
+	}
 
-	return where, nil
+	return p.parseExpression(LOWEST)
 }
 
 func (p *Parser) parseUpdateStatement() (*ast.UpdateStatement, error) {
@@ -364,7 +1205,7 @@ func (p *Parser) parseUpdateStatement() (*ast.UpdateStatement, error) {
 		}
 
 		p.nextToken() // consume =
-		val, err := p.parseValue()
+		val, err := p.parseSlot()
 		if err != nil {
 			return nil, err
 		}
@@ -427,7 +1268,13 @@ func (p *Parser) parseJoinStatement() (*ast.JoinStatement, error) {
 
 	// note to self -> parse from SELECT and not from JOIN, JOIN is not independent
 
-	// parse column selections table.column
+	// parse column selections table.column, tables are only known after FROM and JOIN
+	type qualifiedColumn struct {
+		table  string
+		column string
+	}
+	var selected []qualifiedColumn
+
 	for {
 		if !p.curTokenIs(token.IDENT) {
 			return nil, fmt.Errorf("expected table name in column")
@@ -442,21 +1289,7 @@ func (p *Parser) parseJoinStatement() (*ast.JoinStatement, error) {
 			return nil, fmt.Errorf("expected column name after .")
 		}
 
-		columnName := p.curToken.Literal
-
-		// determine which table this column belongs to
-		switch stmt.LeftTable {
-		case "":
-			stmt.LeftTable = tableName
-			stmt.LeftCols = []string{columnName}
-		case tableName:
-			stmt.LeftCols = append(stmt.LeftCols, columnName)
-		default:
-			if stmt.RightTable == "" {
-				stmt.RightTable = tableName
-			}
-			stmt.RightCols = append(stmt.RightCols, columnName)
-		}
+		selected = append(selected, qualifiedColumn{table: tableName, column: p.curToken.Literal})
 
 		if p.peekTokenIs(token.COMMA) {
 			p.nextToken() // consume comma
@@ -477,7 +1310,7 @@ func (p *Parser) parseJoinStatement() (*ast.JoinStatement, error) {
 		return nil, fmt.Errorf("expected table name")
 	}
 
-	leftTable := p.curToken.Literal
+	stmt.LeftTable = p.curToken.Literal
 
 	// expect JOIN
 	if !p.expectPeek(token.JOIN) {
@@ -489,14 +1322,18 @@ func (p *Parser) parseJoinStatement() (*ast.JoinStatement, error) {
 		return nil, fmt.Errorf("expected table name after JOIN")
 	}
 
-	rightTable := p.curToken.Literal
+	stmt.RightTable = p.curToken.Literal
 
-	// verify tables match what we parsed in SELECT
-	if stmt.LeftTable != leftTable {
-		stmt.LeftTable = leftTable
-	}
-	if stmt.RightTable != rightTable {
-		stmt.RightTable = rightTable
+	// determine which table each selected column belongs to
+	for _, sel := range selected {
+		switch sel.table {
+		case stmt.LeftTable:
+			stmt.LeftCols = append(stmt.LeftCols, sel.column)
+		case stmt.RightTable:
+			stmt.RightCols = append(stmt.RightCols, sel.column)
+		default:
+			return nil, fmt.Errorf("table %s in column list is not part of the join", sel.table)
+		}
 	}
 
 	// expect ON
@@ -509,7 +1346,7 @@ func (p *Parser) parseJoinStatement() (*ast.JoinStatement, error) {
 		return nil, fmt.Errorf("expected table name in ON clause")
 	}
 
-	leftTable = p.curToken.Literal
+	onFirstTable := p.curToken.Literal
 
 	if !p.expectPeek(token.DOT) {
 		return nil, fmt.Errorf("expected . in ON clause")
@@ -519,7 +1356,7 @@ func (p *Parser) parseJoinStatement() (*ast.JoinStatement, error) {
 		return nil, fmt.Errorf("expected column name in ON clause")
 	}
 
-	stmt.OnLeft = p.curToken.Literal
+	onFirstCol := p.curToken.Literal
 
 	if !p.expectPeek(token.ASSIGN) {
 		return nil, fmt.Errorf("expected = in ON clause")
@@ -529,7 +1366,7 @@ func (p *Parser) parseJoinStatement() (*ast.JoinStatement, error) {
 		return nil, fmt.Errorf("expected table name in ON clause")
 	}
 
-	rightTable = p.curToken.Literal
+	onSecondTable := p.curToken.Literal
 
 	if !p.expectPeek(token.DOT) {
 		return nil, fmt.Errorf("expected . in ON clause")
@@ -539,7 +1376,17 @@ func (p *Parser) parseJoinStatement() (*ast.JoinStatement, error) {
 		return nil, fmt.Errorf("expected column name in ON clause")
 	}
 
-	stmt.OnRight = p.curToken.Literal
+	onSecondCol := p.curToken.Literal
+
+	// the condition may be written either way round -> right.col = left.col
+	switch {
+	case onFirstTable == stmt.LeftTable && onSecondTable == stmt.RightTable:
+		stmt.OnLeft, stmt.OnRight = onFirstCol, onSecondCol
+	case onFirstTable == stmt.RightTable && onSecondTable == stmt.LeftTable:
+		stmt.OnLeft, stmt.OnRight = onSecondCol, onFirstCol
+	default:
+		return nil, fmt.Errorf("ON clause must compare columns of %s and %s", stmt.LeftTable, stmt.RightTable)
+	}
 
 	return stmt, nil
 
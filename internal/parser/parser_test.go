@@ -1,6 +1,8 @@
 package parser
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/raskovnik/rdbms/internal/ast"
@@ -27,16 +29,47 @@ func TestParseInsert(t *testing.T) {
 		t.Errorf("table name wrong. expected=users, got=%s", insertStmt.Table)
 	}
 
-	if len(insertStmt.Values) != 3 {
-		t.Fatalf("wrong number of values. expected=3, got=%d", len(insertStmt.Values))
+	if len(insertStmt.Values) != 1 || insertStmt.Columns != nil {
+		t.Fatalf("expected one row for every column. got=%v, columns=%v", insertStmt.Values, insertStmt.Columns)
 	}
 
-	if insertStmt.Values[0] != 1 {
-		t.Errorf("value[0] wrong. expected=1, got=%v", insertStmt.Values[0])
+	if len(insertStmt.Values[0]) != 3 {
+		t.Fatalf("wrong number of values. expected=3, got=%d", len(insertStmt.Values[0]))
 	}
 
-	if insertStmt.Values[1] != "Alice" {
-		t.Errorf("value[1] wrong. expected=Alice, got=%v", insertStmt.Values[1])
+	if insertStmt.Values[0][0] != 1 {
+		t.Errorf("value[0] wrong. expected=1, got=%v", insertStmt.Values[0][0])
+	}
+
+	if insertStmt.Values[0][1] != "Alice" {
+		t.Errorf("value[1] wrong. expected=Alice, got=%v", insertStmt.Values[0][1])
+	}
+}
+
+func TestParseInsertColumnsAndRows(t *testing.T) {
+	stmt, err := New(lexer.New("INSERT INTO users (id, name) VALUES (1, 'Alice'), (2, 'Bob'), (3, NULL)")).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement() returned error: %v", err)
+	}
+
+	insertStmt := stmt.(*ast.InsertStatement)
+	if fmt.Sprint(insertStmt.Columns) != "[id name]" {
+		t.Errorf("columns wrong. expected=[id name], got=%v", insertStmt.Columns)
+	}
+	if fmt.Sprint(insertStmt.Values) != "[[1 Alice] [2 Bob] [3 <nil>]]" {
+		t.Errorf("rows wrong. got=%v", insertStmt.Values)
+	}
+
+	for _, input := range []string{
+		"INSERT INTO users () VALUES (1)",
+		"INSERT INTO users (id, ) VALUES (1)",
+		"INSERT INTO users (id VALUES (1)",
+		"INSERT INTO users VALUES (1), ",
+		"INSERT INTO users VALUES (1), 2",
+	} {
+		if _, err := New(lexer.New(input)).ParseStatement(); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
 	}
 }
 
@@ -177,13 +210,7 @@ func TestParseUpdateSingleColumn(t *testing.T) {
 		t.Fatal("expected WHERE clause")
 	}
 
-	if updateStmt.Where.Column != "id" {
-		t.Errorf("WHERE column wrong. expected=id, got=%s", updateStmt.Where.Column)
-	}
-
-	if updateStmt.Where.Value != 1 {
-		t.Errorf("WHERE value wrong. expected=1, got=%v", updateStmt.Where.Value)
-	}
+	testComparison(t, updateStmt.Where, "id", "=", 1)
 }
 
 func TestParseUpdateMultipleColumns(t *testing.T) {
@@ -317,13 +344,7 @@ func TestParseDeleteWithWhere(t *testing.T) {
 		t.Fatal("expected WHERE clause")
 	}
 
-	if deleteStmt.Where.Column != "id" {
-		t.Errorf("WHERE column wrong. expected=id, got=%s", deleteStmt.Where.Column)
-	}
-
-	if deleteStmt.Where.Value != 1 {
-		t.Errorf("WHERE value wrong. expected=1, got=%v", deleteStmt.Where.Value)
-	}
+	testComparison(t, deleteStmt.Where, "id", "=", 1)
 }
 
 func TestParseDeleteWithoutWhere(t *testing.T) {
@@ -371,13 +392,7 @@ func TestParseDeleteWithStringCondition(t *testing.T) {
 		t.Fatal("expected WHERE clause")
 	}
 
-	if deleteStmt.Where.Column != "email" {
-		t.Errorf("WHERE column wrong. expected=email, got=%s", deleteStmt.Where.Column)
-	}
-
-	if deleteStmt.Where.Value != "test@example.com" {
-		t.Errorf("WHERE value wrong. expected=test@example.com, got=%v", deleteStmt.Where.Value)
-	}
+	testComparison(t, deleteStmt.Where, "email", "=", "test@example.com")
 }
 
 func TestParseJoin(t *testing.T) {
@@ -412,3 +427,905 @@ func TestParseJoin(t *testing.T) {
 		t.Errorf("OnRight wrong. expected=user_id, got=%s", joinStmt.OnRight)
 	}
 }
+
+func TestParseJoinReversedOnClause(t *testing.T) {
+	input := "SELECT orders.total, users.name FROM users JOIN orders ON orders.user_id = users.id"
+
+	l := lexer.New(input)
+	p := New(l)
+
+	stmt, err := p.ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement() returned error: %v", err)
+	}
+
+	joinStmt, ok := stmt.(*ast.JoinStatement)
+	if !ok {
+		t.Fatalf("stmt is not *JoinStmt. got=%T", stmt)
+	}
+
+	if len(joinStmt.LeftCols) != 1 || joinStmt.LeftCols[0] != "name" {
+		t.Errorf("left columns wrong. expected=[name], got=%v", joinStmt.LeftCols)
+	}
+
+	if len(joinStmt.RightCols) != 1 || joinStmt.RightCols[0] != "total" {
+		t.Errorf("right columns wrong. expected=[total], got=%v", joinStmt.RightCols)
+	}
+
+	if joinStmt.OnLeft != "id" {
+		t.Errorf("OnLeft wrong. expected=id, got=%s", joinStmt.OnLeft)
+	}
+
+	if joinStmt.OnRight != "user_id" {
+		t.Errorf("OnRight wrong. expected=user_id, got=%s", joinStmt.OnRight)
+	}
+}
+
+func TestParseWhereExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"SELECT * FROM users WHERE id = 1",
+			"(id = 1)",
+		},
+		{
+			"SELECT * FROM users WHERE id > 1 AND name = 'Bob'",
+			"((id > 1) AND (name = 'Bob'))",
+		},
+		{
+			"SELECT * FROM users WHERE a = 1 OR b = 2 AND c = 3",
+			"((a = 1) OR ((b = 2) AND (c = 3)))",
+		},
+		{
+			"SELECT * FROM users WHERE (a = 1 OR b = 2) AND c = 3",
+			"(((a = 1) OR (b = 2)) AND (c = 3))",
+		},
+		{
+			"SELECT * FROM users WHERE NOT a = 1 AND b = 2",
+			"((NOT (a = 1)) AND (b = 2))",
+		},
+		{
+			"SELECT * FROM users WHERE a >= 1 AND a <= 5 AND b != 'x' OR c <> 3",
+			"((((a >= 1) AND (a <= 5)) AND (b != 'x')) OR (c != 3))",
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+
+		stmt, err := p.ParseStatement()
+		if err != nil {
+			t.Fatalf("ParseStatement() for %q returned error: %v", tt.input, err)
+		}
+
+		selectStmt, ok := stmt.(*ast.SelectStatement)
+		if !ok {
+			t.Fatalf("stmt is not *SelectStatement for %q. got=%T", tt.input, stmt)
+		}
+
+		if selectStmt.Where.String() != tt.expected {
+			t.Errorf("WHERE wrong for %q. expected=%s, got=%s", tt.input, tt.expected, selectStmt.Where.String())
+		}
+	}
+}
+
+func TestParseWhereErrors(t *testing.T) {
+	inputs := []string{
+		"SELECT * FROM users WHERE",
+		"SELECT * FROM users WHERE (a = 1",
+		"SELECT * FROM users WHERE a = AND",
+	}
+
+	for _, input := range inputs {
+		l := lexer.New(input)
+		p := New(l)
+
+		if _, err := p.ParseStatement(); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+}
+
+// Helper function
+func testComparison(t *testing.T, expr ast.Expression, column, operator string, value interface{}) {
+	t.Helper()
+
+	be, ok := expr.(*ast.BinaryExpression)
+	if !ok {
+		t.Fatalf("expr is not *BinaryExpression. got=%T", expr)
+	}
+
+	ident, ok := be.Left.(*ast.Identifier)
+	if !ok || ident.Name != column {
+		t.Errorf("WHERE column wrong. expected=%s, got=%s", column, be.Left)
+	}
+
+	if be.Operator != operator {
+		t.Errorf("WHERE operator wrong. expected=%s, got=%s", operator, be.Operator)
+	}
+
+	lit, ok := be.Right.(*ast.Literal)
+	if !ok || lit.Value != value {
+		t.Errorf("WHERE value wrong. expected=%v, got=%s", value, be.Right)
+	}
+}
+
+func TestParseCheckpoint(t *testing.T) {
+	stmt, err := New(lexer.New("CHECKPOINT")).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement() returned error: %v", err)
+	}
+
+	if _, ok := stmt.(*ast.CheckpointStatement); !ok {
+		t.Fatalf("stmt is not *CheckpointStatement. got=%T", stmt)
+	}
+}
+
+func TestParseCreateIndex(t *testing.T) {
+	tests := []struct {
+		input   string
+		name    string
+		table   string
+		columns []string
+		unique  bool
+		using   string
+	}{
+		{"CREATE INDEX orders_user ON orders (user_id)", "orders_user", "orders", []string{"user_id"}, false, ""},
+		{"CREATE UNIQUE INDEX members_pk ON members (group_id, user_id)", "members_pk", "members", []string{"group_id", "user_id"}, true, ""},
+		{"CREATE INDEX users_name ON users USING hash (name)", "users_name", "users", []string{"name"}, false, "HASH"},
+	}
+
+	for _, tt := range tests {
+		stmt, err := New(lexer.New(tt.input)).ParseStatement()
+		if err != nil {
+			t.Fatalf("ParseStatement() for %q returned error: %v", tt.input, err)
+		}
+
+		indexStmt, ok := stmt.(*ast.CreateIndexStatement)
+		if !ok {
+			t.Fatalf("stmt is not *CreateIndexStatement for %q. got=%T", tt.input, stmt)
+		}
+
+		if indexStmt.Name != tt.name || indexStmt.Table != tt.table {
+			t.Errorf("name or table wrong for %q. got=%s, %s", tt.input, indexStmt.Name, indexStmt.Table)
+		}
+
+		if len(indexStmt.Columns) != len(tt.columns) {
+			t.Fatalf("wrong number of columns for %q. expected=%d, got=%d", tt.input, len(tt.columns), len(indexStmt.Columns))
+		}
+		for i, col := range tt.columns {
+			if indexStmt.Columns[i] != col {
+				t.Errorf("column[%d] wrong for %q. expected=%s, got=%s", i, tt.input, col, indexStmt.Columns[i])
+			}
+		}
+
+		if indexStmt.Unique != tt.unique {
+			t.Errorf("unique wrong for %q. expected=%t", tt.input, tt.unique)
+		}
+
+		if indexStmt.Using != tt.using {
+			t.Errorf("using wrong for %q. expected=%s, got=%s", tt.input, tt.using, indexStmt.Using)
+		}
+	}
+}
+
+func TestParseDropIndex(t *testing.T) {
+	stmt, err := New(lexer.New("DROP INDEX orders_user")).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement() returned error: %v", err)
+	}
+
+	dropStmt, ok := stmt.(*ast.DropIndexStatement)
+	if !ok {
+		t.Fatalf("stmt is not *DropIndexStatement. got=%T", stmt)
+	}
+
+	if dropStmt.Name != "orders_user" {
+		t.Errorf("name wrong. expected=orders_user, got=%s", dropStmt.Name)
+	}
+}
+
+func TestParseDropAndTruncateTable(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected ast.Statement
+	}{
+		{"DROP TABLE users", &ast.DropTableStatement{Table: "users"}},
+		{"DROP TABLE IF EXISTS users", &ast.DropTableStatement{Table: "users", IfExists: true}},
+		{"TRUNCATE TABLE users", &ast.TruncateStatement{Table: "users"}},
+		{"TRUNCATE users", &ast.TruncateStatement{Table: "users"}},
+	}
+	for _, tt := range tests {
+		stmt, err := New(lexer.New(tt.input)).ParseStatement()
+		if err != nil {
+			t.Fatalf("ParseStatement(%q) returned error: %v", tt.input, err)
+		}
+		if fmt.Sprintf("%#v", stmt) != fmt.Sprintf("%#v", tt.expected) {
+			t.Errorf("wrong statement for %q. expected=%#v, got=%#v", tt.input, tt.expected, stmt)
+		}
+	}
+
+	stmt, err := New(lexer.New("CREATE TABLE IF NOT EXISTS users (id INT)")).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement() returned error: %v", err)
+	}
+	if create := stmt.(*ast.CreateStatement); !create.IfNotExists || create.Table != "users" {
+		t.Errorf("wrong CREATE TABLE IF NOT EXISTS. got=%+v", create)
+	}
+
+	for _, input := range []string{
+		"DROP TABLE",
+		"DROP TABLE IF users",
+		"DROP users",
+		"TRUNCATE",
+		"CREATE TABLE IF EXISTS users (id INT)",
+	} {
+		if _, err := New(lexer.New(input)).ParseStatement(); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+}
+
+func TestParseCreateIndexErrors(t *testing.T) {
+	inputs := []string{
+		"CREATE INDEX ON users (name)",
+		"CREATE INDEX users_name users (name)",
+		"CREATE INDEX users_name ON users ()",
+		"CREATE INDEX users_name ON users USING gist (name)",
+		"CREATE UNIQUE users_name ON users (name)",
+	}
+
+	for _, input := range inputs {
+		if _, err := New(lexer.New(input)).ParseStatement(); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+}
+
+func TestParseOrderBy(t *testing.T) {
+	input := "SELECT * FROM todos WHERE done = 0 ORDER BY priority DESC, created ASC, id"
+
+	stmt, err := New(lexer.New(input)).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement() returned error: %v", err)
+	}
+
+	selectStmt, ok := stmt.(*ast.SelectStatement)
+	if !ok {
+		t.Fatalf("stmt is not *SelectStatement. got=%T", stmt)
+	}
+
+	expected := []ast.OrderByItem{
+		{Column: "priority", Descending: true},
+		{Column: "created"},
+		{Column: "id"},
+	}
+
+	if len(selectStmt.OrderBy) != len(expected) {
+		t.Fatalf("wrong number of ORDER BY items. expected=%d, got=%d", len(expected), len(selectStmt.OrderBy))
+	}
+
+	for i, item := range expected {
+		if selectStmt.OrderBy[i] != item {
+			t.Errorf("ORDER BY[%d] wrong. expected=%v, got=%v", i, item, selectStmt.OrderBy[i])
+		}
+	}
+
+	for _, input := range []string{"SELECT * FROM todos ORDER id", "SELECT * FROM todos ORDER BY"} {
+		if _, err := New(lexer.New(input)).ParseStatement(); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+}
+
+func TestParseLimitOffset(t *testing.T) {
+	tests := []struct {
+		input  string
+		limit  int
+		offset int
+	}{
+		{"SELECT * FROM todos LIMIT 10", 10, 0},
+		{"SELECT * FROM todos ORDER BY id DESC LIMIT 10 OFFSET 20", 10, 20},
+		{"SELECT * FROM todos WHERE done = 0 LIMIT 0", 0, 0},
+	}
+
+	for _, tt := range tests {
+		stmt, err := New(lexer.New(tt.input)).ParseStatement()
+		if err != nil {
+			t.Fatalf("ParseStatement(%q) returned error: %v", tt.input, err)
+		}
+
+		selectStmt := stmt.(*ast.SelectStatement)
+		if selectStmt.Limit == nil || *selectStmt.Limit != tt.limit {
+			t.Errorf("wrong LIMIT for %q. expected=%d, got=%v", tt.input, tt.limit, selectStmt.Limit)
+		}
+		if selectStmt.Offset != tt.offset {
+			t.Errorf("wrong OFFSET for %q. expected=%d, got=%d", tt.input, tt.offset, selectStmt.Offset)
+		}
+	}
+
+	stmt, _ := New(lexer.New("SELECT * FROM todos")).ParseStatement()
+	if stmt.(*ast.SelectStatement).Limit != nil {
+		t.Error("expected no LIMIT when the clause is missing")
+	}
+
+	for _, input := range []string{"SELECT * FROM todos LIMIT", "SELECT * FROM todos LIMIT 'a'", "SELECT * FROM todos LIMIT 1 OFFSET"} {
+		if _, err := New(lexer.New(input)).ParseStatement(); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+
+	// the lexer reads -1 as one number, it is refused as a count
+	for _, input := range []string{"SELECT * FROM todos LIMIT -1", "SELECT * FROM todos LIMIT 1 OFFSET -3", "SELECT COUNT(*) FROM todos LIMIT -1"} {
+		_, err := New(lexer.New(input)).ParseStatement()
+		if err == nil || !strings.Contains(err.Error(), "must not be negative") {
+			t.Errorf("expected negative row count error for %q, got %v", input, err)
+		}
+	}
+}
+
+func TestParseAggregates(t *testing.T) {
+	input := "SELECT user_id, COUNT(*), MAX(total) FROM orders WHERE total > 0 GROUP BY user_id HAVING COUNT(*) > 1 ORDER BY SUM(total) DESC LIMIT 5"
+
+	stmt, err := New(lexer.New(input)).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement() returned error: %v", err)
+	}
+
+	selectStmt := stmt.(*ast.SelectStatement)
+
+	if len(selectStmt.Columns) != 1 || selectStmt.Columns[0] != "user_id" {
+		t.Errorf("wrong columns. got=%v", selectStmt.Columns)
+	}
+
+	aggregates := []string{"COUNT(*)", "MAX(total)"}
+	if len(selectStmt.Aggregates) != len(aggregates) {
+		t.Fatalf("wrong number of aggregates. expected=%d, got=%d", len(aggregates), len(selectStmt.Aggregates))
+	}
+	for i, agg := range aggregates {
+		if selectStmt.Aggregates[i].String() != agg {
+			t.Errorf("aggregate %d wrong. expected=%s, got=%s", i, agg, selectStmt.Aggregates[i])
+		}
+	}
+
+	if len(selectStmt.GroupBy) != 1 || selectStmt.GroupBy[0] != "user_id" {
+		t.Errorf("wrong GROUP BY. got=%v", selectStmt.GroupBy)
+	}
+
+	if selectStmt.Having == nil || selectStmt.Having.String() != "(COUNT(*) > 1)" {
+		t.Errorf("wrong HAVING. got=%v", selectStmt.Having)
+	}
+
+	if len(selectStmt.OrderBy) != 1 || selectStmt.OrderBy[0].Column != "SUM(total)" || selectStmt.OrderBy[0].Aggregate == nil || !selectStmt.OrderBy[0].Descending {
+		t.Errorf("wrong ORDER BY. got=%v", selectStmt.OrderBy)
+	}
+
+	for _, input := range []string{
+		"SELECT SUM(*) FROM orders",
+		"SELECT COUNT( FROM orders",
+		"SELECT COUNT(id FROM orders",
+		"SELECT user_id FROM orders GROUP user_id",
+		"SELECT user_id FROM orders GROUP BY user_id HAVING",
+	} {
+		if _, err := New(lexer.New(input)).ParseStatement(); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+}
+
+func TestParseTransactionStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected ast.Statement
+	}{
+		{"BEGIN", &ast.BeginStatement{}},
+		{"COMMIT", &ast.CommitStatement{}},
+		{"ROLLBACK", &ast.RollbackStatement{}},
+	}
+
+	for _, tt := range tests {
+		stmt, err := New(lexer.New(tt.input)).ParseStatement()
+		if err != nil {
+			t.Fatalf("ParseStatement(%q) returned error: %v", tt.input, err)
+		}
+
+		if stmt.String() != tt.expected.String() {
+			t.Errorf("wrong statement for %q. expected=%T, got=%T", tt.input, tt.expected, stmt)
+		}
+	}
+}
+
+func TestParseNull(t *testing.T) {
+	stmt, err := New(lexer.New("CREATE TABLE users (id INT PRIMARY KEY, email TEXT UNIQUE NOT NULL, nick TEXT NOT NULL UNIQUE, bio TEXT)")).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement() returned error: %v", err)
+	}
+
+	cols := stmt.(*ast.CreateStatement).Columns
+	if !cols[1].Unique || !cols[1].NotNull || !cols[2].Unique || !cols[2].NotNull || cols[3].NotNull {
+		t.Errorf("wrong column constraints. got=%+v", cols)
+	}
+
+	stmt, err = New(lexer.New("INSERT INTO users VALUES (1, NULL)")).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement() returned error: %v", err)
+	}
+	if values := stmt.(*ast.InsertStatement).Values[0]; len(values) != 2 || values[1] != nil {
+		t.Errorf("expected NULL value. got=%v", values)
+	}
+
+	stmt, err = New(lexer.New("UPDATE users SET bio = NULL")).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement() returned error: %v", err)
+	}
+	if updates := stmt.(*ast.UpdateStatement).Updates; updates[0].Value != nil {
+		t.Errorf("expected NULL update. got=%v", updates[0].Value)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"SELECT * FROM users WHERE bio IS NULL", "(bio IS NULL)"},
+		{"SELECT * FROM users WHERE bio IS NOT NULL AND id = 1", "((bio IS NOT NULL) AND (id = 1))"},
+		{"SELECT * FROM users WHERE NOT bio IS NULL", "(NOT (bio IS NULL))"},
+		{"SELECT * FROM users WHERE bio = NULL", "(bio = NULL)"},
+	}
+
+	for _, tt := range tests {
+		stmt, err := New(lexer.New(tt.input)).ParseStatement()
+		if err != nil {
+			t.Fatalf("ParseStatement(%q) returned error: %v", tt.input, err)
+		}
+		if where := stmt.(*ast.SelectStatement).Where.String(); where != tt.expected {
+			t.Errorf("wrong WHERE for %q. expected=%s, got=%s", tt.input, tt.expected, where)
+		}
+	}
+
+	for _, input := range []string{
+		"SELECT * FROM users WHERE bio IS",
+		"SELECT * FROM users WHERE bio IS 1",
+		"CREATE TABLE users (id INT NOT)",
+	} {
+		if _, err := New(lexer.New(input)).ParseStatement(); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+}
+
+func TestParseBooleans(t *testing.T) {
+	stmt, err := New(lexer.New("INSERT INTO todos VALUES (1, 'write tests', TRUE)")).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement() returned error: %v", err)
+	}
+	if values := stmt.(*ast.InsertStatement).Values[0]; len(values) != 3 || values[2] != true {
+		t.Errorf("expected TRUE value. got=%v", values)
+	}
+
+	stmt, err = New(lexer.New("UPDATE todos SET done = false WHERE done = TRUE OR NOT done != FALSE")).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement() returned error: %v", err)
+	}
+
+	update := stmt.(*ast.UpdateStatement)
+	if update.Updates[0].Value != false {
+		t.Errorf("expected FALSE update. got=%v", update.Updates[0].Value)
+	}
+	if where := update.Where.String(); where != "((done = TRUE) OR (NOT (done != FALSE)))" {
+		t.Errorf("wrong WHERE. got=%s", where)
+	}
+}
+
+func TestParseNumericTypes(t *testing.T) {
+	stmt, err := New(lexer.New("CREATE TABLE items (price DECIMAL(10,2), rate FLOAT, ratio REAL, amount NUMERIC)")).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement() returned error: %v", err)
+	}
+
+	expected := []ast.ColumnDef{
+		{Name: "price", Type: "DECIMAL", Precision: 10, Scale: 2},
+		{Name: "rate", Type: "FLOAT"},
+		{Name: "ratio", Type: "FLOAT"},
+		{Name: "amount", Type: "DECIMAL"},
+	}
+	columns := stmt.(*ast.CreateStatement).Columns
+	if len(columns) != len(expected) {
+		t.Fatalf("expected %d columns. got=%v", len(expected), columns)
+	}
+	for i, col := range expected {
+		if columns[i] != col {
+			t.Errorf("column %d wrong. expected=%+v, got=%+v", i, col, columns[i])
+		}
+	}
+
+	for _, input := range []string{
+		"CREATE TABLE items (price DECIMAL(2,3))",
+		"CREATE TABLE items (price DECIMAL(0))",
+		"CREATE TABLE items (price DECIMAL(10,)",
+	} {
+		if _, err := New(lexer.New(input)).ParseStatement(); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+}
+
+func TestParseArithmetic(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"SELECT * FROM items WHERE price * 2 > 10", "((price * 2) > 10)"},
+		{"SELECT * FROM items WHERE a + b * c = 7", "((a + (b * c)) = 7)"},
+		{"SELECT * FROM items WHERE (a + b) * c = 7", "(((a + b) * c) = 7)"},
+		{"SELECT * FROM items WHERE a - 1 - 2 < a / 2", "(((a - 1) - 2) < (a / 2))"},
+		{"SELECT * FROM items WHERE -price > -1.5", "((- price) > -1.5)"},
+		{"SELECT * FROM items WHERE a-1 = 0 AND b + 0.25 != 1", "(((a - 1) = 0) AND ((b + 0.25) != 1))"},
+	}
+
+	for _, tt := range tests {
+		stmt, err := New(lexer.New(tt.input)).ParseStatement()
+		if err != nil {
+			t.Fatalf("ParseStatement(%q) returned error: %v", tt.input, err)
+		}
+		if where := stmt.(*ast.SelectStatement).Where.String(); where != tt.expected {
+			t.Errorf("wrong WHERE for %q. expected=%s, got=%s", tt.input, tt.expected, where)
+		}
+	}
+
+	stmt, err := New(lexer.New("INSERT INTO items VALUES (-3, 19.90, -0.5)")).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement() returned error: %v", err)
+	}
+	values := stmt.(*ast.InsertStatement).Values[0]
+	if values[0] != -3 || fmt.Sprint(values[1]) != "19.90" || fmt.Sprint(values[2]) != "-0.5" {
+		t.Errorf("wrong values. got=%v", values)
+	}
+}
+
+func TestParseDatetime(t *testing.T) {
+	stmt, err := New(lexer.New("CREATE TABLE events (day DATE, starts TIME, created_at TIMESTAMP NOT NULL)")).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement() returned error: %v", err)
+	}
+	columns := stmt.(*ast.CreateStatement).Columns
+	for i, expected := range []string{"DATE", "TIME", "TIMESTAMP"} {
+		if columns[i].Type != expected {
+			t.Errorf("column %d type wrong. expected=%s, got=%s", i, expected, columns[i].Type)
+		}
+	}
+
+	stmt, err = New(lexer.New("INSERT INTO events VALUES (DATE '2024-01-15', TIME '09:30', '2024-01-15 09:30:00')")).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement() returned error: %v", err)
+	}
+	values := stmt.(*ast.InsertStatement).Values[0]
+	if fmt.Sprint(values[0]) != "2024-01-15" || fmt.Sprint(values[1]) != "09:30:00" || values[2] != "2024-01-15 09:30:00" {
+		t.Errorf("wrong values. got=%v", values)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"created_at > NOW() - INTERVAL '1 day'", "(created_at > (NOW() - INTERVAL '1 day'))"},
+		{"date_trunc('month', created_at) = TIMESTAMP '2024-01-01'", "(DATE_TRUNC('month', created_at) = TIMESTAMP '2024-01-01 00:00:00')"},
+		{"extract(year from created_at) = 2024", "(EXTRACT(YEAR FROM created_at) = 2024)"},
+		{"EXTRACT(DAY FROM created_at - day) > 1", "(EXTRACT(DAY FROM (created_at - day)) > 1)"},
+		{"day + 1 = DATE '2024-01-16'", "((day + 1) = DATE '2024-01-16')"},
+		{"day >= current_date - 7", "(day >= (CURRENT_DATE - 7))"},
+	}
+	for _, tt := range tests {
+		if where := parseTestWhere(t, tt.input).String(); where != tt.expected {
+			t.Errorf("wrong WHERE for %q. expected=%s, got=%s", tt.input, tt.expected, where)
+		}
+	}
+
+	// datetime expressions are values and assignments too
+	stmt, err = New(lexer.New("INSERT INTO events VALUES (NOW(), CURRENT_DATE, TIMESTAMP '2024-01-15 09:30:00' + INTERVAL '1 day')")).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement() returned error: %v", err)
+	}
+	values = stmt.(*ast.InsertStatement).Values[0]
+	for i, expected := range []string{"NOW()", "CURRENT_DATE", "(TIMESTAMP '2024-01-15 09:30:00' + INTERVAL '1 day')"} {
+		if expr, ok := values[i].(ast.Expression); !ok || expr.String() != expected {
+			t.Errorf("wrong value %d. expected=%s, got=%#v", i, expected, values[i])
+		}
+	}
+
+	stmt, err = New(lexer.New("UPDATE events SET created_at = NOW(), day = day + INTERVAL '1 month'")).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement() returned error: %v", err)
+	}
+	updates := stmt.(*ast.UpdateStatement).Updates
+	for i, expected := range []string{"NOW()", "(day + INTERVAL '1 month')"} {
+		if expr, ok := updates[i].Value.(ast.Expression); !ok || expr.String() != expected {
+			t.Errorf("wrong assignment %d. expected=%s, got=%#v", i, expected, updates[i].Value)
+		}
+	}
+
+	for _, input := range []string{
+		"SELECT * FROM events WHERE day = DATE '2024-13-01'",
+		"SELECT * FROM events WHERE day = DATE 20240101",
+		"SELECT * FROM events WHERE created_at > NOW() - INTERVAL '1 fortnight'",
+		"SELECT * FROM events WHERE EXTRACT(YEAR created_at) = 2024",
+		"SELECT * FROM events WHERE DATE_TRUNC('day', created_at = day",
+	} {
+		if _, err := New(lexer.New(input)).ParseStatement(); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+}
+
+func TestParseAlterTable(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected ast.AlterTableStatement
+	}{
+		{"ALTER TABLE users DROP COLUMN age", ast.AlterTableStatement{Table: "users", Action: "DROP COLUMN", Name: "age"}},
+		{"ALTER TABLE users DROP age", ast.AlterTableStatement{Table: "users", Action: "DROP COLUMN", Name: "age"}},
+		{"ALTER TABLE users RENAME COLUMN name TO full_name", ast.AlterTableStatement{Table: "users", Action: "RENAME COLUMN", Name: "name", NewName: "full_name"}},
+		{"ALTER TABLE users RENAME name TO full_name", ast.AlterTableStatement{Table: "users", Action: "RENAME COLUMN", Name: "name", NewName: "full_name"}},
+		{"ALTER TABLE users RENAME TO people", ast.AlterTableStatement{Table: "users", Action: "RENAME TO", NewName: "people"}},
+	}
+	for _, tt := range tests {
+		stmt, err := New(lexer.New(tt.input)).ParseStatement()
+		if err != nil {
+			t.Fatalf("ParseStatement(%q) returned error: %v", tt.input, err)
+		}
+		if alter := stmt.(*ast.AlterTableStatement); *alter != tt.expected {
+			t.Errorf("wrong statement for %q. expected=%+v, got=%+v", tt.input, tt.expected, *alter)
+		}
+	}
+
+	stmt, err := New(lexer.New("ALTER TABLE users ADD COLUMN score DECIMAL(5, 2) NOT NULL DEFAULT 1.5 * 2")).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement() returned error: %v", err)
+	}
+	alter := stmt.(*ast.AlterTableStatement)
+	col := alter.Column
+	if alter.Action != "ADD COLUMN" || col.Name != "score" || col.Type != "DECIMAL" || col.Precision != 5 || !col.NotNull {
+		t.Errorf("wrong ADD COLUMN. got=%+v", alter)
+	}
+	if col.Default == nil || col.Default.String() != "(1.5 * 2)" {
+		t.Errorf("wrong DEFAULT. got=%v", col.Default)
+	}
+
+	stmt, err = New(lexer.New("CREATE TABLE todos (id INT PRIMARY KEY, done BOOL DEFAULT FALSE NOT NULL, created_at TIMESTAMP DEFAULT NOW())")).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement() returned error: %v", err)
+	}
+	columns := stmt.(*ast.CreateStatement).Columns
+	if columns[0].Default != nil || columns[1].Default.String() != "FALSE" || !columns[1].NotNull || columns[2].Default.String() != "NOW()" {
+		t.Errorf("wrong defaults. got=%+v", columns)
+	}
+
+	for _, input := range []string{
+		"ALTER users ADD COLUMN age INT",
+		"ALTER TABLE users ADD COLUMN age",
+		"ALTER TABLE users MODIFY age INT",
+		"ALTER TABLE users RENAME COLUMN name full_name",
+		"ALTER TABLE users RENAME TO",
+		"ALTER TABLE users ADD age INT DEFAULT",
+	} {
+		if _, err := New(lexer.New(input)).ParseStatement(); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+}
+
+func TestParseSerialAndSequences(t *testing.T) {
+	stmt, err := New(lexer.New("CREATE TABLE todos (id SERIAL PRIMARY KEY, n INT AUTOINCREMENT, task TEXT)")).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement() returned error: %v", err)
+	}
+	columns := stmt.(*ast.CreateStatement).Columns
+	if columns[0].Type != "INT" || !columns[0].Serial || !columns[0].PrimaryKey {
+		t.Errorf("wrong SERIAL column. got=%+v", columns[0])
+	}
+	if columns[1].Type != "INT" || !columns[1].Serial || columns[2].Serial {
+		t.Errorf("wrong AUTOINCREMENT column. got=%+v", columns[1:])
+	}
+
+	tests := []struct {
+		input    string
+		expected ast.CreateSequenceStatement
+	}{
+		{"CREATE SEQUENCE ids", ast.CreateSequenceStatement{Name: "ids", Start: 1, Increment: 1}},
+		{"CREATE SEQUENCE ids START WITH 100 INCREMENT BY 10", ast.CreateSequenceStatement{Name: "ids", Start: 100, Increment: 10}},
+		{"CREATE SEQUENCE IF NOT EXISTS ids INCREMENT -1 START 0", ast.CreateSequenceStatement{Name: "ids", Start: 0, Increment: -1, IfNotExists: true}},
+	}
+	for _, tt := range tests {
+		stmt, err := New(lexer.New(tt.input)).ParseStatement()
+		if err != nil {
+			t.Fatalf("ParseStatement(%q) returned error: %v", tt.input, err)
+		}
+		if seq := stmt.(*ast.CreateSequenceStatement); *seq != tt.expected {
+			t.Errorf("wrong statement for %q. expected=%+v, got=%+v", tt.input, tt.expected, *seq)
+		}
+	}
+
+	stmt, err = New(lexer.New("INSERT INTO todos (task) VALUES ('a') RETURNING id, task")).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement() returned error: %v", err)
+	}
+	if returning := stmt.(*ast.InsertStatement).Returning; len(returning) != 2 || returning[0] != "id" || returning[1] != "task" {
+		t.Errorf("wrong RETURNING columns. got=%v", returning)
+	}
+
+	// values and assignments may be expressions, literals stay plain values
+	stmt, err = New(lexer.New("INSERT INTO todos VALUES (nextval('ids'), 'a'), (-1, 'b')")).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement() returned error: %v", err)
+	}
+	values := stmt.(*ast.InsertStatement).Values
+	if call, ok := values[0][0].(*ast.FunctionCall); !ok || call.String() != "NEXTVAL('ids')" {
+		t.Errorf("wrong expression in VALUES. got=%#v", values[0][0])
+	}
+	if values[0][1] != "a" || values[1][0] != -1 {
+		t.Errorf("wrong literals in VALUES. got=%v", values)
+	}
+
+	stmt, err = New(lexer.New("UPDATE todos SET id = nextval('ids'), n = n + 1, task = 'c' WHERE id = 1")).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement() returned error: %v", err)
+	}
+	updates := stmt.(*ast.UpdateStatement).Updates
+	if call, ok := updates[0].Value.(*ast.FunctionCall); !ok || call.String() != "NEXTVAL('ids')" {
+		t.Errorf("wrong expression in SET. got=%#v", updates[0].Value)
+	}
+	if expr, ok := updates[1].Value.(ast.Expression); !ok || expr.String() != "(n + 1)" {
+		t.Errorf("wrong expression in SET. got=%#v", updates[1].Value)
+	}
+	if updates[2].Value != "c" {
+		t.Errorf("wrong literal in SET. got=%v", updates[2].Value)
+	}
+
+	for _, input := range []string{
+		"CREATE TABLE t (name TEXT AUTOINCREMENT)",
+		"CREATE SEQUENCE",
+		"INSERT INTO todos VALUES (nextval('ids') 1)",
+		"UPDATE todos SET id = nextval('ids'",
+		"CREATE SEQUENCE ids START WITH x",
+		"INSERT INTO todos VALUES (1) RETURNING",
+	} {
+		if _, err := New(lexer.New(input)).ParseStatement(); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+}
+
+func TestParseForeignKeys(t *testing.T) {
+	stmt, err := New(lexer.New("CREATE TABLE orders (id INT PRIMARY KEY, user_id INT REFERENCES users(id) ON DELETE CASCADE, note TEXT REFERENCES notes, " +
+		"FOREIGN KEY (shop) REFERENCES shops(code) ON DELETE SET NULL, shop TEXT)")).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement() returned error: %v", err)
+	}
+
+	expected := map[string]ast.ForeignKey{
+		"user_id": {Table: "users", Column: "id", OnDelete: "CASCADE"},
+		"note":    {Table: "notes", OnDelete: "RESTRICT"},
+		"shop":    {Table: "shops", Column: "code", OnDelete: "SET NULL"},
+	}
+	for _, col := range stmt.(*ast.CreateStatement).Columns {
+		fk, wanted := expected[col.Name]
+		if !wanted {
+			if col.References != nil {
+				t.Errorf("column %s should have no REFERENCES. got=%+v", col.Name, col.References)
+			}
+			continue
+		}
+		if col.References == nil || *col.References != fk {
+			t.Errorf("wrong REFERENCES for column %s. expected=%+v, got=%+v", col.Name, fk, col.References)
+		}
+	}
+
+	for _, input := range []string{
+		"CREATE TABLE t (a INT REFERENCES)",
+		"CREATE TABLE t (a INT REFERENCES p(x, y))",
+		"CREATE TABLE t (a INT REFERENCES p ON DELETE NOTHING)",
+		"CREATE TABLE t (a INT REFERENCES p ON UPDATE CASCADE)",
+		"CREATE TABLE t (a INT, FOREIGN KEY (b) REFERENCES p)",
+		"CREATE TABLE t (a INT REFERENCES p, FOREIGN KEY (a) REFERENCES q)",
+		"CREATE TABLE t (a INT, FOREIGN KEY a REFERENCES p)",
+	} {
+		if _, err := New(lexer.New(input)).ParseStatement(); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+}
+
+func TestParseCheckConstraints(t *testing.T) {
+	stmt, err := New(lexer.New("CREATE TABLE items (qty INT NOT NULL CHECK (qty > 0), price INT CONSTRAINT positive CHECK (price >= 0) DEFAULT 1, " +
+		"CHECK (qty < price), CONSTRAINT small CHECK (qty < 10 OR price IS NULL))")).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement() returned error: %v", err)
+	}
+	create := stmt.(*ast.CreateStatement)
+
+	qty, price := create.Columns[0], create.Columns[1]
+	if qty.Check == nil || qty.Check.Name != "" || qty.Check.Expr.String() != "(qty > 0)" || !qty.NotNull {
+		t.Errorf("wrong column CHECK. got=%+v", qty)
+	}
+	if price.Check == nil || price.Check.Name != "positive" || price.Check.Expr.String() != "(price >= 0)" || price.Default == nil {
+		t.Errorf("wrong named column CHECK. got=%+v", price)
+	}
+
+	if len(create.Checks) != 2 {
+		t.Fatalf("wrong number of table CHECKs. got=%d", len(create.Checks))
+	}
+	if create.Checks[0].Name != "" || create.Checks[0].Expr.String() != "(qty < price)" {
+		t.Errorf("wrong table CHECK. got=%+v", create.Checks[0])
+	}
+	if create.Checks[1].Name != "small" || create.Checks[1].Expr.String() != "((qty < 10) OR (price IS NULL))" {
+		t.Errorf("wrong named table CHECK. got=%+v", create.Checks[1])
+	}
+
+	for _, input := range []string{
+		"CREATE TABLE t (a INT CHECK a > 0)",
+		"CREATE TABLE t (a INT CHECK (a > 0)",
+		"CREATE TABLE t (a INT CHECK ())",
+		"CREATE TABLE t (a INT CONSTRAINT CHECK (a > 0))",
+		"CREATE TABLE t (a INT CONSTRAINT c UNIQUE)",
+		"CREATE TABLE t (a INT CHECK (a > 0) CHECK (a < 9))",
+	} {
+		if _, err := New(lexer.New(input)).ParseStatement(); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+}
+
+func TestParseTableKeys(t *testing.T) {
+	stmt, err := New(lexer.New("CREATE TABLE members (team_id INT, user_id INT, email TEXT, role TEXT, " +
+		"PRIMARY KEY (team_id, user_id), UNIQUE (team_id, email), UNIQUE (role))")).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement() returned error: %v", err)
+	}
+	create := stmt.(*ast.CreateStatement)
+
+	if len(create.Keys) != 2 {
+		t.Fatalf("wrong number of keys. got=%d", len(create.Keys))
+	}
+	if !create.Keys[0].Primary || fmt.Sprint(create.Keys[0].Columns) != "[team_id user_id]" {
+		t.Errorf("wrong primary key. got=%+v", create.Keys[0])
+	}
+	if create.Keys[1].Primary || fmt.Sprint(create.Keys[1].Columns) != "[team_id email]" {
+		t.Errorf("wrong unique key. got=%+v", create.Keys[1])
+	}
+	// a key on one column is a column constraint
+	if role := create.Columns[3]; !role.Unique {
+		t.Errorf("UNIQUE (role) not set on the column. got=%+v", role)
+	}
+
+	stmt, err = New(lexer.New("CREATE TABLE t (a INT, b INT, PRIMARY KEY (a))")).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement() returned error: %v", err)
+	}
+	if create := stmt.(*ast.CreateStatement); !create.Columns[0].PrimaryKey || create.Keys != nil {
+		t.Errorf("PRIMARY KEY (a) not set on the column. got=%+v", create)
+	}
+
+	for _, input := range []string{
+		"CREATE TABLE t (a INT, PRIMARY KEY (a, c))",
+		"CREATE TABLE t (a INT, b INT, UNIQUE (a, a))",
+		"CREATE TABLE t (a INT, b INT, PRIMARY KEY a, b)",
+		"CREATE TABLE t (a INT, b INT, PRIMARY KEY ())",
+		"CREATE TABLE t (a INT, b INT, UNIQUE (a, b)",
+	} {
+		if _, err := New(lexer.New(input)).ParseStatement(); err == nil {
+			t.Errorf("expected error for %q, got nil", input)
+		}
+	}
+}
+
+func parseTestWhere(t *testing.T, input string) ast.Expression {
+	t.Helper()
+
+	stmt, err := New(lexer.New("SELECT * FROM events WHERE " + input)).ParseStatement()
+	if err != nil {
+		t.Fatalf("ParseStatement(%q) returned error: %v", input, err)
+	}
+	return stmt.(*ast.SelectStatement).Where
+}
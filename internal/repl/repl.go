@@ -10,12 +10,20 @@ import (
 	"github.com/raskovnik/rdbms/internal/parser"
 )
 
-func Start(in io.Reader, out io.Writer) {
+func Start(in io.Reader, out io.Writer, db *engine.Database) {
 	scanner := bufio.NewScanner(in)
-	db := engine.NewDB() // create DB
+
+	// statements run in a session so BEGIN/COMMIT/ROLLBACK span lines,
+	// a transaction still open at EOF is rolled back
+	session := db.NewSession()
+	defer session.Close()
 
 	for {
-		fmt.Fprint(out, "db> ")
+		if session.InTransaction() {
+			fmt.Fprint(out, "db*> ")
+		} else {
+			fmt.Fprint(out, "db> ")
+		}
 		if !scanner.Scan() {
 			break // EOF
 		}
@@ -32,7 +40,7 @@ func Start(in io.Reader, out io.Writer) {
 		}
 
 		// execute the query
-		res, err := db.Execute(stmt)
+		res, err := session.Execute(stmt)
 		if err != nil {
 			fmt.Fprintln(out, "Error:", err)
 			continue
@@ -53,6 +61,9 @@ func Start(in io.Reader, out io.Writer) {
 func printRows(rows []engine.Row, out io.Writer) {
 	for _, row := range rows {
 		for col, val := range row {
+			if val == nil {
+				val = "NULL"
+			}
 			fmt.Fprintf(out, "%s=%v ", col, val)
 		}
 		fmt.Fprintln(out)
@@ -12,26 +12,77 @@ type Token struct {
 const (
 
 	// keywords
-	CREATE  = "CREATE"
-	TABLE   = "TABLE"
-	INSERT  = "INSERT"
-	INTO    = "INTO"
-	VALUES  = "VALUES"
-	SELECT  = "SELECT"
-	FROM    = "FROM"
-	WHERE   = "WHERE"
-	UPDATE  = "UPDATE"
-	SET     = "SET"
-	DELETE  = "DELETE"
-	JOIN    = "JOIN"
-	ON      = "ON"
-	PRIMARY = "PRIMARY"
-	KEY     = "KEY"
-	UNIQUE  = "UNIQUE"
+	CREATE     = "CREATE"
+	TABLE      = "TABLE"
+	INSERT     = "INSERT"
+	INTO       = "INTO"
+	VALUES     = "VALUES"
+	SELECT     = "SELECT"
+	FROM       = "FROM"
+	WHERE      = "WHERE"
+	UPDATE     = "UPDATE"
+	SET        = "SET"
+	DELETE     = "DELETE"
+	JOIN       = "JOIN"
+	ON         = "ON"
+	PRIMARY    = "PRIMARY"
+	KEY        = "KEY"
+	UNIQUE     = "UNIQUE"
+	AND        = "AND"
+	OR         = "OR"
+	NOT        = "NOT"
+	CHECKPOINT = "CHECKPOINT"
+	INDEX      = "INDEX"
+	DROP       = "DROP"
+	USING      = "USING"
+	ORDER      = "ORDER"
+	BY         = "BY"
+	ASC        = "ASC"
+	DESC       = "DESC"
+	LIMIT      = "LIMIT"
+	OFFSET     = "OFFSET"
+	GROUP      = "GROUP"
+	HAVING     = "HAVING"
+	COUNT      = "COUNT"
+	SUM        = "SUM"
+	AVG        = "AVG"
+	MIN        = "MIN"
+	MAX        = "MAX"
+	BEGIN      = "BEGIN"
+	COMMIT     = "COMMIT"
+	ROLLBACK   = "ROLLBACK"
+	NULL       = "NULL"
+	IS         = "IS"
+	TRUE       = "TRUE"
+	FALSE      = "FALSE"
+	INTERVAL   = "INTERVAL"
+	ALTER      = "ALTER"
+	ADD        = "ADD"
+	COLUMN     = "COLUMN"
+	RENAME     = "RENAME"
+	TO         = "TO"
+	DEFAULT    = "DEFAULT"
+	IF         = "IF"
+	EXISTS     = "EXISTS"
+	TRUNCATE   = "TRUNCATE"
+	SEQUENCE   = "SEQUENCE"
+	START      = "START"
+	WITH       = "WITH"
+	INCREMENT  = "INCREMENT"
+	RETURNING  = "RETURNING"
+	REFERENCES = "REFERENCES"
+	FOREIGN    = "FOREIGN"
+	CASCADE    = "CASCADE"
+	RESTRICT   = "RESTRICT"
+	CHECK      = "CHECK"
+	CONSTRAINT = "CONSTRAINT"
+
+	AUTOINCREMENT = "AUTOINCREMENT"
 
 	// identifiers & literals
 	IDENT  = "IDENT"
 	INT    = "INT"
+	FLOAT  = "FLOAT" // number with a fractional part -> 1.5
 	STRING = "STRING"
 
 	// operators & delimiters
@@ -44,11 +95,23 @@ const (
 	SEMICOLON = ";"
 	GT        = ">"
 	LT        = "<"
+	GTE       = ">="
+	LTE       = "<="
+	NOT_EQ    = "!="
+	PLUS      = "+"
+	MINUS     = "-"
+	SLASH     = "/"
 
 	// data type keywords
-	TYPE_INT  = "TYPE_INT"
-	TYPE_TEXT = "TYPE_TEXT"
-	TYPE_BOOL = "TYPE_BOOL"
+	TYPE_INT       = "TYPE_INT"
+	TYPE_TEXT      = "TYPE_TEXT"
+	TYPE_BOOL      = "TYPE_BOOL"
+	TYPE_FLOAT     = "TYPE_FLOAT"
+	TYPE_DECIMAL   = "TYPE_DECIMAL"
+	TYPE_DATE      = "TYPE_DATE"
+	TYPE_TIME      = "TYPE_TIME"
+	TYPE_TIMESTAMP = "TYPE_TIMESTAMP"
+	TYPE_SERIAL    = "TYPE_SERIAL"
 
 	// special
 	ILLEGAL = "ILLEGAL"
@@ -56,25 +119,83 @@ const (
 )
 
 var keywords = map[string]TokenType{
-	"create":  CREATE,
-	"table":   TABLE,
-	"insert":  INSERT,
-	"into":    INTO,
-	"values":  VALUES,
-	"select":  SELECT,
-	"from":    FROM,
-	"where":   WHERE,
-	"update":  UPDATE,
-	"set":     SET,
-	"delete":  DELETE,
-	"join":    JOIN,
-	"on":      ON,
-	"primary": PRIMARY,
-	"key":     KEY,
-	"unique":  UNIQUE,
-	"int":     TYPE_INT,
-	"text":    TYPE_TEXT,
-	"bool":    TYPE_BOOL,
+	"create":     CREATE,
+	"table":      TABLE,
+	"insert":     INSERT,
+	"into":       INTO,
+	"values":     VALUES,
+	"select":     SELECT,
+	"from":       FROM,
+	"where":      WHERE,
+	"update":     UPDATE,
+	"set":        SET,
+	"delete":     DELETE,
+	"join":       JOIN,
+	"on":         ON,
+	"primary":    PRIMARY,
+	"key":        KEY,
+	"unique":     UNIQUE,
+	"and":        AND,
+	"or":         OR,
+	"not":        NOT,
+	"checkpoint": CHECKPOINT,
+	"index":      INDEX,
+	"drop":       DROP,
+	"using":      USING,
+	"order":      ORDER,
+	"by":         BY,
+	"asc":        ASC,
+	"desc":       DESC,
+	"limit":      LIMIT,
+	"offset":     OFFSET,
+	"group":      GROUP,
+	"having":     HAVING,
+	"count":      COUNT,
+	"sum":        SUM,
+	"avg":        AVG,
+	"min":        MIN,
+	"max":        MAX,
+	"begin":      BEGIN,
+	"commit":     COMMIT,
+	"rollback":   ROLLBACK,
+	"null":       NULL,
+	"is":         IS,
+	"true":       TRUE,
+	"false":      FALSE,
+	"interval":   INTERVAL,
+	"alter":      ALTER,
+	"add":        ADD,
+	"column":     COLUMN,
+	"rename":     RENAME,
+	"to":         TO,
+	"default":    DEFAULT,
+	"if":         IF,
+	"exists":     EXISTS,
+	"truncate":   TRUNCATE,
+	"sequence":   SEQUENCE,
+	"start":      START,
+	"with":       WITH,
+	"increment":  INCREMENT,
+	"returning":  RETURNING,
+	"references": REFERENCES,
+	"foreign":    FOREIGN,
+	"cascade":    CASCADE,
+	"restrict":   RESTRICT,
+	"check":      CHECK,
+	"constraint": CONSTRAINT,
+	"int":        TYPE_INT,
+	"text":       TYPE_TEXT,
+	"bool":       TYPE_BOOL,
+	"float":      TYPE_FLOAT,
+	"real":       TYPE_FLOAT,
+	"decimal":    TYPE_DECIMAL,
+	"numeric":    TYPE_DECIMAL,
+	"date":       TYPE_DATE,
+	"time":       TYPE_TIME,
+	"timestamp":  TYPE_TIMESTAMP,
+	"serial":     TYPE_SERIAL,
+
+	"autoincrement": AUTOINCREMENT,
 }
 
 // check if an identifier is a keyword